@@ -3,15 +3,16 @@ package audioserver
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"unicode"
 
 	"github.com/google/uuid"
+	"github.com/messenger/internal/blobstore"
 	"github.com/messenger/internal/logger"
 )
 
@@ -38,16 +39,16 @@ type UploadResponse struct {
 
 // Service обрабатывает загрузку и раздачу голосовых сообщений.
 type Service struct {
-	UploadDir     string
+	Store         blobstore.Storage
 	MaxUploadSize int64
 }
 
-// New создаёт сервис с заданным каталогом и лимитом размера (в байтах).
-func New(uploadDir string, maxSize int64) *Service {
+// New создаёт сервис с заданным хранилищем и лимитом размера (в байтах).
+func New(store blobstore.Storage, maxSize int64) *Service {
 	if maxSize <= 0 || maxSize > maxUploadSize {
 		maxSize = maxUploadSize
 	}
-	return &Service{UploadDir: uploadDir, MaxUploadSize: maxSize}
+	return &Service{Store: store, MaxUploadSize: maxSize}
 }
 
 func (s *Service) writeJSON(w http.ResponseWriter, status int, data any) {
@@ -115,31 +116,23 @@ func (s *Service) Upload(w http.ResponseWriter, r *http.Request) {
 	// Если Content-Type пустой — полагаемся на расширение (часть браузеров не выставляет тип у части)
 
 	newName := uuid.New().String() + ext
-	if err := os.MkdirAll(s.UploadDir, 0o755); err != nil {
-		logger.Errorf("audioserver upload: mkdir %s: %v", s.UploadDir, err)
-		s.writeError(w, http.StatusInternalServerError, "failed to create upload dir")
-		return
-	}
-
-	dstPath := filepath.Join(s.UploadDir, newName)
-	dst, err := os.Create(dstPath)
-	if err != nil {
-		logger.Errorf("audioserver upload: create %s: %v", dstPath, err)
-		s.writeError(w, http.StatusInternalServerError, "failed to save file")
-		return
-	}
-	defer dst.Close()
-
-	n, err := copyWithContext(ctx, dst, file)
-	if err != nil {
-		os.Remove(dstPath)
+	pr, pw := io.Pipe()
+	written := make(chan int64, 1)
+	go func() {
+		n, err := copyWithContext(ctx, pw, file)
+		written <- n
+		pw.CloseWithError(err)
+	}()
+	if err := s.Store.Put(ctx, newName, pr); err != nil {
+		pr.CloseWithError(err)
 		if ctx.Err() != nil {
 			return
 		}
-		logger.Errorf("audioserver upload: copy: %v", err)
+		logger.Errorf("audioserver upload: save %s: %v", newName, err)
 		s.writeError(w, http.StatusInternalServerError, "failed to save file")
 		return
 	}
+	n := <-written
 
 	displayName := strings.TrimSpace(filepath.Base(rawFilename))
 	if displayName == "" || safeFilename(displayName) == "" {
@@ -189,22 +182,17 @@ func (s *Service) Serve(w http.ResponseWriter, r *http.Request, filename string)
 		http.Error(w, "not found", http.StatusNotFound)
 		return
 	}
-	path := filepath.Join(s.UploadDir, filename)
-	f, err := os.Open(path)
+	f, info, err := s.Store.Get(r.Context(), filename)
 	if err != nil {
-		if os.IsNotExist(err) {
+		if errors.Is(err, blobstore.ErrNotFound) {
 			http.Error(w, "not found", http.StatusNotFound)
 			return
 		}
+		logger.Errorf("audioserver serve %s: %v", filename, err)
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 	defer f.Close()
-	info, err := f.Stat()
-	if err != nil || info.IsDir() {
-		http.Error(w, "not found", http.StatusNotFound)
-		return
-	}
 	ext := strings.ToLower(filepath.Ext(filename))
 	ct := "audio/ogg"
 	switch ext {
@@ -216,6 +204,19 @@ func (s *Service) Serve(w http.ResponseWriter, r *http.Request, filename string)
 		ct = "audio/ogg"
 	}
 	w.Header().Set("Content-Type", ct)
-	w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
-	http.ServeContent(w, r, filename, info.ModTime(), f)
+	etag := blobstore.ETag(filename, info)
+	blobstore.SetCacheHeaders(w.Header(), etag, info.ModTime)
+	// Локальный файл поддерживает Seek — ServeContent отдаст Range-запросы (перемотка в плеере).
+	if rs, ok := f.(io.ReadSeeker); ok {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+		http.ServeContent(w, r, filename, info.ModTime, rs)
+		return
+	}
+	if blobstore.NotModified(r, etag, info.ModTime) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, f)
 }
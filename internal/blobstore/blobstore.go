@@ -0,0 +1,114 @@
+// Package blobstore — хранилище загруженных файлов и голосовых сообщений: локальный диск или
+// S3-совместимое объектное хранилище (AWS S3, MinIO). Выбирается конфигурацией (STORAGE_BACKEND).
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrNotFound — объекта с таким ключом нет.
+var ErrNotFound = errors.New("blobstore: object not found")
+
+// ObjectInfo — метаданные сохранённого объекта.
+type ObjectInfo struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// Storage — хранилище объектов по плоскому ключу (имя файла).
+type Storage interface {
+	// Put сохраняет объект целиком; при ошибке чтения r частично записанный объект не остаётся.
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Get открывает объект на чтение. Для локального диска ReadCloser — *os.File (поддерживает Seek).
+	Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error)
+	// Delete удаляет объект; ErrNotFound — объекта не было.
+	Delete(ctx context.Context, key string) error
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+}
+
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+// Config — выбор и настройки хранилища.
+type Config struct {
+	// Backend — local (по умолчанию) или s3.
+	Backend string
+	// Dir — каталог для local.
+	Dir string
+	// Gzip — хранить загружаемые файлы сжатыми (.gz). Голосовые сообщения не сжимаются никогда.
+	Gzip bool
+	S3   S3Config
+}
+
+// S3Config — параметры S3-совместимого хранилища.
+type S3Config struct {
+	// Endpoint — например https://s3.eu-central-1.amazonaws.com или http://minio:9000.
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// Prefix добавляется к ключам (например "files/"), чтобы сервисы делили один бакет.
+	Prefix string
+	// PathStyle — адресация endpoint/bucket/key (MinIO) вместо bucket.endpoint/key.
+	PathStyle bool
+}
+
+// ConfigFromEnv читает настройки хранилища из окружения; dir — каталог для local (UPLOAD_DIR сервиса).
+// STORAGE_BACKEND=local|s3, STORAGE_GZIP (по умолчанию true), S3_ENDPOINT, S3_REGION, S3_BUCKET,
+// S3_ACCESS_KEY, S3_SECRET_KEY, S3_PREFIX, S3_PATH_STYLE.
+func ConfigFromEnv(dir string) Config {
+	return Config{
+		Backend: strings.ToLower(envStr("STORAGE_BACKEND", BackendLocal)),
+		Dir:     dir,
+		Gzip:    envBool("STORAGE_GZIP", true),
+		S3: S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    envStr("S3_REGION", "us-east-1"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			Prefix:    os.Getenv("S3_PREFIX"),
+			PathStyle: envBool("S3_PATH_STYLE", false),
+		},
+	}
+}
+
+// New создаёт хранилище по конфигурации.
+func New(cfg Config) (Storage, error) {
+	switch cfg.Backend {
+	case "", BackendLocal:
+		if cfg.Dir == "" {
+			return nil, errors.New("blobstore: local backend requires a directory")
+		}
+		return NewLocal(cfg.Dir), nil
+	case BackendS3:
+		return NewS3(cfg.S3)
+	}
+	return nil, fmt.Errorf("blobstore: unknown backend %q", cfg.Backend)
+}
+
+func envStr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func envBool(key string, fallback bool) bool {
+	switch strings.ToLower(os.Getenv(key)) {
+	case "1", "true", "yes":
+		return true
+	case "0", "false", "no":
+		return false
+	}
+	return fallback
+}
@@ -0,0 +1,48 @@
+package blobstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ImmutableCacheControl — файлы называются уникальными UUID и не меняются, поэтому кешируются надолго.
+// private: раздача идёт по сессии или подписанной ссылке — общим кешам (прокси, CDN) хранить нельзя.
+const ImmutableCacheControl = "private, max-age=31536000, immutable"
+
+// ETag — сильный ETag по ключу и метаданным хранимого объекта (для .gz — метаданные сжатого файла).
+func ETag(key string, info ObjectInfo) string {
+	sum := sha256.Sum256([]byte(key + "\n" + strconv.FormatInt(info.Size, 10) + "\n" + strconv.FormatInt(info.ModTime.UnixNano(), 10)))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// NotModified проверяет If-None-Match (приоритетнее) и If-Modified-Since; true — можно ответить 304.
+func NotModified(r *http.Request, etag string, modTime time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, t := range strings.Split(inm, ",") {
+			t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+			if t == "*" || t == etag {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !modTime.IsZero() {
+		if t, err := http.ParseTime(ims); err == nil {
+			return !modTime.Truncate(time.Second).After(t)
+		}
+	}
+	return false
+}
+
+// SetCacheHeaders выставляет ETag, Last-Modified и Cache-Control для неизменяемого файла.
+func SetCacheHeaders(h http.Header, etag string, modTime time.Time) {
+	h.Set("ETag", etag)
+	h.Set("Cache-Control", ImmutableCacheControl)
+	if !modTime.IsZero() {
+		h.Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+}
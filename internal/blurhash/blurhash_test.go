@@ -0,0 +1,44 @@
+package blurhash
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// Эталонные строки посчитаны референсной реализацией (woltapp/blurhash, encode.ts) для тех же точек;
+// картинки меньше sampleSize, поэтому уменьшение не влияет на результат.
+func TestEncodeMatchesReference(t *testing.T) {
+	cases := []struct {
+		name string
+		w, h int
+		px   func(x, y int) color.NRGBA
+		want string
+	}{
+		{"landscape", 6, 4, func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(x * 40), uint8(y * 60), uint8(255 - x*40), 255}
+		}, "L~EL]~G1WwxdvrR=b0nneXe;fQe;"},
+		{"portrait", 4, 6, func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(x * 60), uint8(y * 40), uint8(255 - y*40), 255}
+		}, "T~DJraKkN]r8V~Wpe_fAfQtTX9Wp"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			img := image.NewNRGBA(image.Rect(0, 0, tc.w, tc.h))
+			for y := 0; y < tc.h; y++ {
+				for x := 0; x < tc.w; x++ {
+					img.SetNRGBA(x, y, tc.px(x, y))
+				}
+			}
+			if got := Encode(img); got != tc.want {
+				t.Errorf("Encode = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEncodeEmpty(t *testing.T) {
+	if got := Encode(image.NewNRGBA(image.Rect(0, 0, 0, 0))); got != "" {
+		t.Errorf("Encode(empty) = %q, want \"\"", got)
+	}
+}
@@ -0,0 +1,69 @@
+// Package buildinfo — версия сборки сервиса. Значения задаются при сборке через ldflags:
+//
+//	go build -ldflags="-X github.com/messenger/internal/buildinfo.Version=1.4.0 \
+//	  -X github.com/messenger/internal/buildinfo.Commit=$(git rev-parse --short HEAD) \
+//	  -X github.com/messenger/internal/buildinfo.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Без ldflags коммит и время берутся из данных VCS, которые go build встраивает сам (если собирали в git-репозитории).
+package buildinfo
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/messenger/internal/logger"
+)
+
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+// Info — то, что отдаёт /version.
+type Info struct {
+	Service   string `json:"service"`
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get собирает информацию о сборке сервиса service.
+func Get(service string) Info {
+	info := Info{Service: service, Version: Version, Commit: Commit, BuildTime: BuildTime, GoVersion: runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch {
+			case s.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = s.Value
+			case s.Key == "vcs.time" && info.BuildTime == "":
+				info.BuildTime = s.Value
+			}
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.BuildTime == "" {
+		info.BuildTime = "unknown"
+	}
+	return info
+}
+
+// LogStartup пишет одну строку key=value с версией сервиса — по ней видно, какая сборка запущена.
+func LogStartup(service string) {
+	i := Get(service)
+	logger.Infof("starting service=%s version=%s commit=%s build_time=%s go=%s", i.Service, i.Version, i.Commit, i.BuildTime, i.GoVersion)
+}
+
+// Handler отдаёт Get(service) в JSON (GET /version).
+func Handler(service string) http.HandlerFunc {
+	body, _ := json.Marshal(Get(service))
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}
+}
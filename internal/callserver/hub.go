@@ -1,10 +1,12 @@
 package callserver
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"net/http"
 	"net/url"
+	"os"
 	"strings"
 	"sync"
 	"time"
@@ -28,6 +30,9 @@ type CallState struct {
 	ToUser    string
 	Status    string // ringing, active, ended
 	CreatedAt time.Time
+	// AcceptedAt/EndedAt — время принятия и завершения; нулевые, пока события не было.
+	AcceptedAt time.Time
+	EndedAt    time.Time
 }
 
 // Hub — хаб сигнализации звонков (WebRTC offer/answer/ICE).
@@ -36,6 +41,8 @@ type Hub struct {
 	clients  map[string]*callConn // user_id -> одна активная коннекция
 	calls    map[string]*CallState
 	validate func(ctx context.Context, sessionID, timestamp, signature, path string) (userID string, err error)
+	// record — сохранение состояния звонка в API (RecordViaHTTP); nil — не сохранять.
+	record func(ctx context.Context, call CallState)
 }
 
 type callConn struct {
@@ -88,6 +95,58 @@ func ValidateViaHTTP(apiURL string, client *http.Client) func(ctx context.Contex
 	}
 }
 
+// SetRecorder задаёт, куда сообщать о начале, принятии и завершении звонков.
+func (h *Hub) SetRecorder(record func(ctx context.Context, call CallState)) {
+	h.record = record
+}
+
+// RecordViaHTTP сохраняет состояние звонка через POST {apiURL}/internal/calls: по этим данным API проверяет
+// участников и считает длительность в отчётах о качестве. Каждый вызов передаёт полное состояние, поэтому
+// порядок доставки не важен. Заголовок X-Internal-Secret — из INTERNAL_VALIDATE_SECRET.
+func RecordViaHTTP(apiURL string, client *http.Client) func(ctx context.Context, call CallState) {
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Second}
+	}
+	secret := strings.TrimSpace(os.Getenv("INTERNAL_VALIDATE_SECRET"))
+	return func(ctx context.Context, call CallState) {
+		body := map[string]any{"id": call.ID, "caller_id": call.FromUser, "callee_id": call.ToUser, "created_at": call.CreatedAt}
+		if !call.AcceptedAt.IsZero() {
+			body["accepted_at"] = call.AcceptedAt
+		}
+		if !call.EndedAt.IsZero() {
+			body["ended_at"] = call.EndedAt
+		}
+		data, _ := json.Marshal(body)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(apiURL, "/")+"/internal/calls", bytes.NewReader(data))
+		if err != nil {
+			logger.Errorf("call record call_id=%s: %v", call.ID, err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if secret != "" {
+			req.Header.Set("X-Internal-Secret", secret)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			logger.Errorf("call record call_id=%s: %v", call.ID, err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			logger.Errorf("call record call_id=%s: status %d", call.ID, resp.StatusCode)
+		}
+	}
+}
+
+// recordCall отправляет снимок состояния звонка в фоне; вызывается под h.mu.
+func (h *Hub) recordCall(call *CallState) {
+	if h.record == nil {
+		return
+	}
+	snap := *call
+	go h.record(context.Background(), snap)
+}
+
 var errUnauthorized = &authErr{msg: "unauthorized"}
 
 type authErr struct{ msg string }
@@ -157,6 +216,8 @@ func (h *Hub) unregister(c *callConn) {
 	for id, call := range h.calls {
 		if call.Status != "ended" && (call.FromUser == c.userID || call.ToUser == c.userID) {
 			call.Status = "ended"
+			call.EndedAt = time.Now()
+			h.recordCall(call)
 			other := call.ToUser
 			if other == c.userID {
 				other = call.FromUser
@@ -269,7 +330,9 @@ func (h *Hub) handleMessage(c *callConn, typ string, payload json.RawMessage) {
 			return
 		}
 		callID := uuid.New().String()
-		h.calls[callID] = &CallState{ID: callID, FromUser: c.userID, ToUser: body.PeerID, Status: "ringing", CreatedAt: time.Now()}
+		call := &CallState{ID: callID, FromUser: c.userID, ToUser: body.PeerID, Status: "ringing", CreatedAt: time.Now()}
+		h.calls[callID] = call
+		h.recordCall(call)
 		h.mu.Unlock()
 		peer.sendMsg("incoming_call", map[string]any{
 			"call_id":       callID,
@@ -294,6 +357,8 @@ func (h *Hub) handleMessage(c *callConn, typ string, payload json.RawMessage) {
 			return
 		}
 		call.Status = "active"
+		call.AcceptedAt = time.Now()
+		h.recordCall(call)
 		caller := h.clients[call.FromUser]
 		h.mu.Unlock()
 		if caller != nil {
@@ -311,6 +376,8 @@ func (h *Hub) handleMessage(c *callConn, typ string, payload json.RawMessage) {
 		call, ok := h.calls[body.CallID]
 		if ok && call.Status == "ringing" {
 			call.Status = "ended"
+			call.EndedAt = time.Now()
+			h.recordCall(call)
 			caller := h.clients[call.FromUser]
 			h.mu.Unlock()
 			if caller != nil {
@@ -330,6 +397,8 @@ func (h *Hub) handleMessage(c *callConn, typ string, payload json.RawMessage) {
 		call, ok := h.calls[body.CallID]
 		if ok && call.Status != "ended" {
 			call.Status = "ended"
+			call.EndedAt = time.Now()
+			h.recordCall(call)
 			other := call.ToUser
 			if other == c.userID {
 				other = call.FromUser
@@ -0,0 +1,101 @@
+// Package clamav — проверка загружаемых файлов антивирусом через clamd (команда INSTREAM).
+package clamav
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// chunkSize — размер блока INSTREAM; clamd ограничивает весь поток StreamMaxLength (по умолчанию 25 МБ).
+const chunkSize = 64 << 10
+
+// InfectedError — clamd нашёл сигнатуру.
+type InfectedError struct {
+	Signature string
+}
+
+func (e *InfectedError) Error() string { return "infected: " + e.Signature }
+
+// Scanner отправляет файлы в clamd. FailOpen — пропускать файл, если сканер недоступен
+// (по умолчанию такие загрузки отклоняются).
+type Scanner struct {
+	network  string
+	address  string
+	Timeout  time.Duration
+	FailOpen bool
+}
+
+// New создаёт сканер. addr — "host:port", "tcp://host:port" или "unix:///path/clamd.sock".
+func New(addr string, failOpen bool) *Scanner {
+	s := &Scanner{network: "tcp", address: addr, Timeout: 60 * time.Second, FailOpen: failOpen}
+	if rest, ok := strings.CutPrefix(addr, "unix://"); ok {
+		s.network, s.address = "unix", rest
+	} else if rest, ok := strings.CutPrefix(addr, "tcp://"); ok {
+		s.address = rest
+	}
+	return s
+}
+
+// Scan передаёт содержимое r в clamd. nil — файл чистый; *InfectedError — найден вирус;
+// иная ошибка — сканер недоступен или ответил непонятно.
+func (s *Scanner) Scan(ctx context.Context, r io.Reader) error {
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return fmt.Errorf("clamav dial: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return fmt.Errorf("clamav write: %w", err)
+	}
+	buf := make([]byte, 4+chunkSize)
+	for {
+		n, readErr := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, err := conn.Write(buf[:4+n]); err != nil {
+				return fmt.Errorf("clamav write: %w", err)
+			}
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return fmt.Errorf("clamav read file: %w", readErr)
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return fmt.Errorf("clamav write: %w", err)
+	}
+
+	reply, err := io.ReadAll(io.LimitReader(conn, 4096))
+	if err != nil {
+		return fmt.Errorf("clamav read reply: %w", err)
+	}
+	return parseReply(string(bytes.TrimRight(reply, "\x00\n")))
+}
+
+// parseReply разбирает ответ вида "stream: OK", "stream: <сигнатура> FOUND" или "... ERROR".
+func parseReply(reply string) error {
+	_, result, _ := strings.Cut(reply, ": ")
+	switch {
+	case result == "OK":
+		return nil
+	case strings.HasSuffix(result, " FOUND"):
+		return &InfectedError{Signature: strings.TrimSuffix(result, " FOUND")}
+	}
+	return errors.New("clamav: unexpected reply: " + reply)
+}
@@ -3,11 +3,16 @@ package config
 import (
 	"bufio"
 	"encoding/json"
+	"fmt"
+	"net/url"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/messenger/internal/blobstore"
+	"github.com/messenger/internal/fileserver"
 	"github.com/messenger/internal/logger"
 	"github.com/messenger/internal/push"
 	"gopkg.in/yaml.v3"
@@ -83,6 +88,8 @@ type IceServer struct {
 // RedisConfig — Redis (OTP, rate limit, секреты сессий).
 type RedisConfig struct {
 	URL string `yaml:"url"`
+	// RateLimit — считать общий лимит запросов API в Redis (RATE_LIMIT_BACKEND=redis), а не в памяти процесса.
+	RateLimit bool `yaml:"-"`
 }
 
 // SMTPConfig — SMTP для отправки OTP (Яндекс.Почта и др.).
@@ -100,6 +107,13 @@ type SMTPConfig struct {
 type DatabaseConfig struct {
 	URL            string `yaml:"database_url"`
 	MaxConnections int    `yaml:"db_max_connections"`
+	// QueryExecMode — режим выполнения запросов pgx (DB_QUERY_EXEC_MODE): cache_statement (по умолчанию),
+	// cache_describe, describe_exec, exec, simple_protocol. За PgBouncer в режиме transaction pooling
+	// подготовленные выражения живут не в том соединении — нужен exec или simple_protocol (ценой лишнего
+	// round-trip на описание или текстовой передачи параметров).
+	QueryExecMode string `yaml:"-"`
+	// StatementCacheCapacity — размер кеша подготовленных выражений на соединение (DB_STATEMENT_CACHE_CAPACITY); 0 — по умолчанию pgx.
+	StatementCacheCapacity int `yaml:"-"`
 }
 
 // Config содержит настройки приложения, БД и кеша.
@@ -113,20 +127,86 @@ type Config struct {
 
 	// База данных (загружается из config/database.yaml)
 	Database DatabaseConfig `yaml:"-"`
+	// SlowQueryThreshold — запросы к БД дольше этого пишутся в лог с SQL (без значений аргументов); 0 — выключено.
+	SlowQueryThreshold time.Duration `yaml:"-"`
 
 	// Файлы
 	UploadDir     string `yaml:"upload_dir"`
 	MaxUploadSize int64  `yaml:"-"`
+	// MaxBodySize — предельный размер тела остальных (JSON) запросов; 0 — без ограничения.
+	MaxBodySize int64 `yaml:"-"`
+	// CompressLevel — уровень gzip ответов API (1–9, 0 — без сжатия); CompressMinSize — ответы меньше
+	// этого размера (байт) не сжимаются.
+	CompressLevel   int `yaml:"-"`
+	CompressMinSize int `yaml:"-"`
+	// LogBodiesSamplePercent — доля запросов (%), тела которых пишутся в лог для отладки (только при
+	// LOG_LEVEL=debug и LOG_BODIES=true, иначе 0); LogBodiesMaxBytes — сколько байт тела писать.
+	LogBodiesSamplePercent int `yaml:"-"`
+	LogBodiesMaxBytes      int `yaml:"-"`
+	// UploadQuota — сколько байт суммарно может загрузить один пользователь; 0 — без ограничения.
+	UploadQuota int64 `yaml:"-"`
+	// MaxConcurrentUploads — сколько загрузок одного пользователя может идти одновременно; 0 — без ограничения.
+	MaxConcurrentUploads int `yaml:"-"`
+	// FileURLSigningKey — секрет HMAC для подписанных ссылок на файлы (/api/files/signed/...). Пусто — выключено.
+	FileURLSigningKey string `yaml:"-"`
+	// FileURLHosts — внешние хосты, на которые может ссылаться file_url сообщения (CDN/S3); пусто — только свои пути.
+	FileURLHosts []string `yaml:"-"`
+	// ClamAVAddr — адрес clamd для проверки загрузок ("host:port" или "unix:///path"). Пусто — проверка выключена.
+	ClamAVAddr string `yaml:"-"`
+	// ClamAVFailOpen — принимать файлы, если clamd недоступен (по умолчанию — отклонять).
+	ClamAVFailOpen bool `yaml:"-"`
+	// ClamAVAsync — проверять загрузки в фоне: файл принимается сразу со статусом pending и не отдаётся
+	// до проверки. Только когда файлы обрабатывает API (без FILE_SERVICE_URL).
+	ClamAVAsync bool `yaml:"-"`
+	// FileContentTypes — дополнительные MIME-типы для раздачи файлов (FILE_CONTENT_TYPES, ".ext=type,...").
+	FileContentTypes map[string]string `yaml:"-"`
+	// Storage — хранилище файлов (локальный UploadDir или S3); только из env, см. blobstore.ConfigFromEnv.
+	Storage blobstore.Config `yaml:"-"`
 
 	// WebSocket
 	MaxWSConnections int `yaml:"max_ws_connections"`
 	WSSendBufferSize int `yaml:"ws_send_buffer_size"`
 	WSWriteTimeout   int `yaml:"ws_write_timeout"`
+	// WSPongTimeout — через сколько секунд без pong соединение рвётся (ping — раз в 0.9 этого срока);
+	// WSMaxMessageSize — предел входящего сообщения в байтах. Оба отдаются клиенту в /api/config/ws.
 	WSPongTimeout    int `yaml:"ws_pong_timeout"`
 	WSMaxMessageSize int `yaml:"ws_max_message_size"`
+	// WSIdleTimeout — через сколько секунд без сообщений от клиента (pong не считается) соединение закрывается; 0 — никогда.
+	WSIdleTimeout int `yaml:"ws_idle_timeout"`
 
 	// Звонки (WebRTC)
 	CallICEServers []IceServer `yaml:"call_ice_servers"`
+	// CallICEHealthInterval — период проверки доступности ICE-серверов; 0 — проверка отключена.
+	CallICEHealthInterval time.Duration `yaml:"-"`
+
+	// Реакции: разрешённые эмодзи (пустой список — любые).
+	AllowedReactions []string `yaml:"allowed_reactions"`
+	// MaxReactionsPerUser — сколько разных реакций один пользователь может поставить на одно сообщение; 0 — без ограничения.
+	MaxReactionsPerUser int `yaml:"-"`
+
+	// PresenceAwayAfter — через сколько бездействия (по отчёту клиента) статус online меняется на away; 0 — никогда.
+	PresenceAwayAfter time.Duration `yaml:"-"`
+
+	// UnreadIncludeSystem — учитывать служебные сообщения в счётчике непрочитанных (по умолчанию нет).
+	UnreadIncludeSystem bool `yaml:"-"`
+	// MaxMessageOffset — наибольший offset в GET /api/chats/{chatId}/messages; глубже — только по курсору
+	// ?before=. 0 — без ограничения.
+	MaxMessageOffset int `yaml:"-"`
+	// MaxPinnedPage — наибольший limit в GET /api/chats/{chatId}/pinned (по умолчанию отдаётся 20 закреплённых).
+	MaxPinnedPage int `yaml:"-"`
+	// SystemMessageLang — язык текста служебных сообщений в content (ru, en); клиенты могут собрать
+	// текст сами по system_event или запросить историю с ?lang= / Accept-Language.
+	SystemMessageLang string `yaml:"-"`
+
+	// PhoneAllowedPrefixes — разрешённые префиксы телефонов (например "+993", "+7"); пустой список — любой номер E.164.
+	PhoneAllowedPrefixes []string `yaml:"phone_allowed_prefixes"`
+
+	// Сообщения: окна редактирования и удаления своих сообщений; 0 — без ограничения.
+	MessageEditWindow   time.Duration `yaml:"-"`
+	MessageDeleteWindow time.Duration `yaml:"-"`
+	// MessageEncryptionKeys — ключи шифрования содержимого чувствительных чатов ("1:<base64>,2:<base64>",
+	// текущий — с наибольшей версией). Пусто — шифрование выключено. Только из env MESSAGE_ENCRYPTION_KEYS.
+	MessageEncryptionKeys string `yaml:"-"`
 
 	// CORS
 	CORSAllowedOrigins string `yaml:"cors_allowed_origins"`
@@ -140,14 +220,47 @@ type Config struct {
 	// Redis и SMTP (для микросервиса auth и опционально для API)
 	Redis RedisConfig `yaml:"-"`
 	SMTP  SMTPConfig  `yaml:"-"`
+	// OTPDelivery — канал доставки кодов входа: email (SMTP, по умолчанию), webhook (POST на OTPWebhookURL)
+	// или console (код пишется в лог; только для локальной разработки).
+	OTPDelivery      string `yaml:"-"`
+	OTPWebhookURL    string `yaml:"-"`
+	OTPWebhookSecret string `yaml:"-"`
+	// DevOTPEndpoint — подключить GET /api/auth/dev/last-code (DEV_OTP_ENDPOINT=true); в production игнорируется.
+	DevOTPEndpoint bool `yaml:"-"`
 
 	// AuthServiceURL — URL микросервиса авторизации (для API: проверка сессий).
 	AuthServiceURL string `yaml:"-"`
+	// APIServiceURL — URL API для внутренних вызовов из auth (закрытие WebSocket при logout). Пустой — отключено.
+	APIServiceURL string `yaml:"-"`
+	// WelcomeMessage — шаблон приветствия новому пользователю в «Заметках» (text/template: {{.Username}}, {{.Email}}).
+	// Берётся из WELCOME_MESSAGE_FILE или WELCOME_MESSAGE; пустой — приветствие не отправляется.
+	WelcomeMessage string `yaml:"-"`
+	// AllowedEmailDomains — домены email, которым разрешён вход (например "company.com"); пусто — любые.
+	AllowedEmailDomains []string `yaml:"-"`
+	// AutoProvision — создавать пользователя при первом входе по OTP (по умолчанию да). Для закрытых
+	// развёртываний выключается: входят только пользователи, заранее созданные администратором.
+	AutoProvision bool `yaml:"-"`
+	// AutoProvisionDomains — домены email, для которых разрешено автосоздание; пусто — любые.
+	AutoProvisionDomains []string `yaml:"-"`
+	// MaxSessionsPerUser — сколько активных сессий (устройств) может быть у пользователя; 0 — без ограничения.
+	// При превышении отзывается самая давно активная сессия, а при SESSION_LIMIT_MODE=reject вход отклоняется.
+	MaxSessionsPerUser int  `yaml:"-"`
+	SessionLimitReject bool `yaml:"-"`
+	// AuthActivityRetention — сколько хранится журнал попыток входа по коду (auth_activity); 0 — журнал выключен.
+	AuthActivityRetention time.Duration `yaml:"-"`
+	// AuthActivityHashKey — секрет HMAC, которым в журнале auth_activity хешируется email (одинаковый у auth
+	// и api). Пусто — журнал не ведётся.
+	AuthActivityHashKey string `yaml:"-"`
 
 	// PushServiceURL — URL микросервиса пуш-уведомлений. Пустой — пуши отключены.
 	PushServiceURL string `yaml:"-"`
 	// PushVAPIDPublicKey — публичный VAPID-ключ для подписки в браузере (отдаётся фронту).
 	PushVAPIDPublicKey string `yaml:"-"`
+	// PushConcurrency — сколько запросов к push-сервису API отправляет одновременно.
+	PushConcurrency int `yaml:"-"`
+
+	// MaintenanceMode — режим обслуживания включён конфигурацией; администратор не может выключить его через API.
+	MaintenanceMode bool `yaml:"-"`
 
 	// FileServiceURL — URL микросервиса файлов (upload/serve). Пустой — файлы обрабатываются в API.
 	FileServiceURL string `yaml:"-"`
@@ -166,22 +279,72 @@ func (c *Config) DBMaxConnections() int {
 	return c.Database.MaxConnections
 }
 
+// CORSOrigins разбирает CORSAllowedOrigins (через запятую) в список для cors.Options.AllowedOrigins.
+// Допустимы "*", "scheme://host[:port]" и поддомены вида "https://*.example.com". Пустое значение — "*".
+func (c *Config) CORSOrigins() ([]string, error) {
+	origins := splitList(c.CORSAllowedOrigins)
+	if len(origins) == 0 {
+		return []string{"*"}, nil
+	}
+	for _, o := range origins {
+		if err := validateOrigin(o); err != nil {
+			return nil, err
+		}
+	}
+	return origins, nil
+}
+
+func validateOrigin(o string) error {
+	if o == "*" {
+		return nil
+	}
+	if strings.Count(o, "*") > 1 {
+		return fmt.Errorf("cors origin %q: only one wildcard is allowed", o)
+	}
+	check := o
+	if strings.Contains(o, "*") {
+		scheme, host, ok := strings.Cut(o, "://")
+		if !ok || !strings.HasPrefix(host, "*.") {
+			return fmt.Errorf("cors origin %q: wildcard must be a subdomain, e.g. https://*.example.com", o)
+		}
+		check = scheme + "://" + strings.TrimPrefix(host, "*.")
+	}
+	u, err := url.Parse(check)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("cors origin %q: expected scheme://host[:port]", o)
+	}
+	if u.Path != "" || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return fmt.Errorf("cors origin %q: must not contain path, query or credentials", o)
+	}
+	return nil
+}
+
 // yamlConfig — промежуточная структура для парсинга app YAML (без БД).
 type yamlConfig struct {
-	ServerAddr         string      `yaml:"server_addr"`
-	ReadTimeout        int         `yaml:"read_timeout"`
-	WriteTimeout       int         `yaml:"write_timeout"`
-	IdleTimeout        int         `yaml:"idle_timeout"`
-	UploadDir          string      `yaml:"upload_dir"`
-	MaxUploadSizeMB    int         `yaml:"max_upload_size_mb"`
-	MaxWSConnections   int         `yaml:"max_ws_connections"`
-	WSSendBufferSize   int         `yaml:"ws_send_buffer_size"`
-	WSWriteTimeout     int         `yaml:"ws_write_timeout"`
-	WSPongTimeout      int         `yaml:"ws_pong_timeout"`
-	WSMaxMessageSize   int         `yaml:"ws_max_message_size"`
-	CORSAllowedOrigins string      `yaml:"cors_allowed_origins"`
-	LogLevel           string      `yaml:"log_level"`
-	CallICEServers     []IceServer `yaml:"call_ice_servers"`
+	ServerAddr          string      `yaml:"server_addr"`
+	ReadTimeout         int         `yaml:"read_timeout"`
+	WriteTimeout        int         `yaml:"write_timeout"`
+	IdleTimeout         int         `yaml:"idle_timeout"`
+	UploadDir           string      `yaml:"upload_dir"`
+	MaxUploadSizeMB     int         `yaml:"max_upload_size_mb"`
+	UploadQuotaMB       int         `yaml:"upload_quota_mb"`
+	UploadConcurrency   int         `yaml:"max_concurrent_uploads"`
+	MaxWSConnections    int         `yaml:"max_ws_connections"`
+	WSSendBufferSize    int         `yaml:"ws_send_buffer_size"`
+	WSWriteTimeout      int         `yaml:"ws_write_timeout"`
+	WSPongTimeout       int         `yaml:"ws_pong_timeout"`
+	WSMaxMessageSize    int         `yaml:"ws_max_message_size"`
+	WSIdleTimeout       int         `yaml:"ws_idle_timeout"`
+	CORSAllowedOrigins  string      `yaml:"cors_allowed_origins"`
+	LogLevel            string      `yaml:"log_level"`
+	CallICEServers      []IceServer `yaml:"call_ice_servers"`
+	CallICEHealthSec    int         `yaml:"call_ice_health_interval"`
+	AllowedReactions    []string    `yaml:"allowed_reactions"`
+	MaxReactionsPerUser int         `yaml:"max_reactions_per_user"`
+	PresenceAwaySec     int         `yaml:"presence_away_after"`
+	MessageEditHours    int         `yaml:"message_edit_window_hours"`
+	MessageDeleteHours  int         `yaml:"message_delete_window_hours"`
+	PhonePrefixes       []string    `yaml:"phone_allowed_prefixes"`
 }
 
 // Load загружает конфигурацию.
@@ -190,19 +353,26 @@ func Load() *Config {
 	loadEnv()
 	// Значения по умолчанию
 	yc := yamlConfig{
-		ServerAddr:         ":8080",
-		ReadTimeout:        15,
-		WriteTimeout:       15,
-		IdleTimeout:        60,
-		UploadDir:          "./uploads",
-		MaxUploadSizeMB:    20,
-		MaxWSConnections:   10000,
-		WSSendBufferSize:   256,
-		WSWriteTimeout:     10,
-		WSPongTimeout:      60,
-		WSMaxMessageSize:   4096,
-		CORSAllowedOrigins: "*",
-		LogLevel:           "info",
+		ServerAddr:          ":8080",
+		ReadTimeout:         15,
+		WriteTimeout:        15,
+		IdleTimeout:         60,
+		UploadDir:           "./uploads",
+		MaxUploadSizeMB:     20,
+		UploadQuotaMB:       1024,
+		UploadConcurrency:   3,
+		MaxWSConnections:    10000,
+		WSSendBufferSize:    256,
+		WSWriteTimeout:      10,
+		WSPongTimeout:       60,
+		WSMaxMessageSize:    4096,
+		CORSAllowedOrigins:  "*",
+		LogLevel:            "info",
+		CallICEHealthSec:    60,
+		MaxReactionsPerUser: 3,
+		PresenceAwaySec:     300,
+		MessageEditHours:    48,
+		MessageDeleteHours:  7 * 24,
 	}
 
 	// Загрузка конфигурации приложения: CONFIG_PATH → config/api.yaml / config/auth.yaml
@@ -257,6 +427,8 @@ func Load() *Config {
 	if dbMaxConn <= 0 {
 		dbMaxConn = 20
 	}
+	dbExecMode := os.Getenv("DB_QUERY_EXEC_MODE")
+	dbStmtCache := envInt("DB_STATEMENT_CACHE_CAPACITY", 0)
 
 	// Загрузка конфигурации кеша: CACHE_CONFIG_PATH > config/cache.yaml
 	cacheDefault := 10
@@ -317,38 +489,103 @@ func Load() *Config {
 			callIceServers = parsed
 		}
 	}
+	// ALLOWED_REACTIONS — через запятую, например "👍,❤️,😂".
+	allowedReactions := yc.AllowedReactions
+	if raw := os.Getenv("ALLOWED_REACTIONS"); raw != "" {
+		allowedReactions = splitList(raw)
+	}
+	// PHONE_ALLOWED_PREFIXES — через запятую, например "+993,+7".
+	phonePrefixes := yc.PhonePrefixes
+	if raw := os.Getenv("PHONE_ALLOWED_PREFIXES"); raw != "" {
+		phonePrefixes = splitList(raw)
+	}
+
 	if len(callIceServers) == 0 {
 		callIceServers = []IceServer{{URLs: []string{"stun:stun.l.google.com:19302"}}}
 	}
 
 	cfg := &Config{
-		ServerAddr:         envStr("SERVER_ADDR", yc.ServerAddr),
-		ReadTimeout:        time.Duration(envInt("READ_TIMEOUT", yc.ReadTimeout)) * time.Second,
-		WriteTimeout:       time.Duration(envInt("WRITE_TIMEOUT", yc.WriteTimeout)) * time.Second,
-		IdleTimeout:        time.Duration(envInt("IDLE_TIMEOUT", yc.IdleTimeout)) * time.Second,
-		Database:           DatabaseConfig{URL: dbURL, MaxConnections: dbMaxConn},
-		UploadDir:          envStr("UPLOAD_DIR", yc.UploadDir),
-		MaxUploadSize:      int64(envInt("MAX_UPLOAD_SIZE_MB", yc.MaxUploadSizeMB)) << 20,
-		MaxWSConnections:   envInt("MAX_WS_CONNECTIONS", yc.MaxWSConnections),
-		WSSendBufferSize:   envInt("WS_SEND_BUFFER_SIZE", yc.WSSendBufferSize),
-		WSWriteTimeout:     envInt("WS_WRITE_TIMEOUT", yc.WSWriteTimeout),
-		WSPongTimeout:      envInt("WS_PONG_TIMEOUT", yc.WSPongTimeout),
-		WSMaxMessageSize:   envInt("WS_MAX_MESSAGE_SIZE", yc.WSMaxMessageSize),
-		CallICEServers:     callIceServers,
-		CORSAllowedOrigins: envStr("CORS_ALLOWED_ORIGINS", yc.CORSAllowedOrigins),
-		LogLevel:           envStr("LOG_LEVEL", yc.LogLevel),
-		Cache:              CacheConfig{TTLMinutes: cacheTTL},
-		Redis:              RedisConfig{URL: redisURL},
-		SMTP:               smtpCfg,
-		AuthServiceURL:     authServiceURL,
-		PushServiceURL:     pushServiceURL,
-		PushVAPIDPublicKey: pushVAPIDPublic,
-		FileServiceURL:     envStr("FILE_SERVICE_URL", ""),
-		AudioServiceURL:    envStr("AUDIO_SERVICE_URL", ""),
+		ServerAddr:            envStr("SERVER_ADDR", yc.ServerAddr),
+		ReadTimeout:           time.Duration(envInt("READ_TIMEOUT", yc.ReadTimeout)) * time.Second,
+		WriteTimeout:          time.Duration(envInt("WRITE_TIMEOUT", yc.WriteTimeout)) * time.Second,
+		IdleTimeout:           time.Duration(envInt("IDLE_TIMEOUT", yc.IdleTimeout)) * time.Second,
+		Database:              DatabaseConfig{URL: dbURL, MaxConnections: dbMaxConn, QueryExecMode: dbExecMode, StatementCacheCapacity: dbStmtCache},
+		SlowQueryThreshold:    time.Duration(envInt("SLOW_QUERY_MS", 200)) * time.Millisecond,
+		UploadDir:             envStr("UPLOAD_DIR", yc.UploadDir),
+		Storage:               blobstore.ConfigFromEnv(envStr("UPLOAD_DIR", yc.UploadDir)),
+		FileURLSigningKey:     os.Getenv("FILE_URL_SIGNING_KEY"),
+		FileURLHosts:          splitList(os.Getenv("FILE_URL_ALLOWED_HOSTS")),
+		ClamAVAddr:            os.Getenv("CLAMAV_ADDR"),
+		ClamAVFailOpen:        os.Getenv("CLAMAV_FAIL_OPEN") == "true",
+		ClamAVAsync:           os.Getenv("CLAMAV_ASYNC") == "true",
+		FileContentTypes:      fileserver.ParseContentTypes(os.Getenv("FILE_CONTENT_TYPES")),
+		MaxUploadSize:         int64(envInt("MAX_UPLOAD_SIZE_MB", yc.MaxUploadSizeMB)) << 20,
+		MaxBodySize:           int64(envInt("MAX_BODY_SIZE_KB", 1024)) << 10,
+		CompressLevel:         envInt("COMPRESS_LEVEL", 5),
+		CompressMinSize:       envInt("COMPRESS_MIN_SIZE", 1024),
+		LogBodiesMaxBytes:     envInt("LOG_BODIES_MAX_BYTES", 2048),
+		UploadQuota:           int64(envInt("UPLOAD_QUOTA_MB", yc.UploadQuotaMB)) << 20,
+		MaxConcurrentUploads:  envInt("MAX_CONCURRENT_UPLOADS", yc.UploadConcurrency),
+		MaxWSConnections:      envInt("MAX_WS_CONNECTIONS", yc.MaxWSConnections),
+		WSSendBufferSize:      envInt("WS_SEND_BUFFER_SIZE", yc.WSSendBufferSize),
+		WSWriteTimeout:        envInt("WS_WRITE_TIMEOUT", yc.WSWriteTimeout),
+		WSPongTimeout:         envInt("WS_PONG_TIMEOUT", yc.WSPongTimeout),
+		WSMaxMessageSize:      envInt("WS_MAX_MESSAGE_SIZE", yc.WSMaxMessageSize),
+		WSIdleTimeout:         envInt("WS_IDLE_TIMEOUT", yc.WSIdleTimeout),
+		CallICEServers:        callIceServers,
+		CallICEHealthInterval: time.Duration(envInt("CALL_ICE_HEALTH_INTERVAL", yc.CallICEHealthSec)) * time.Second,
+		AllowedReactions:      allowedReactions,
+		MaxReactionsPerUser:   envInt("MAX_REACTIONS_PER_USER", yc.MaxReactionsPerUser),
+		PresenceAwayAfter:     time.Duration(envInt("PRESENCE_AWAY_AFTER", yc.PresenceAwaySec)) * time.Second,
+		PhoneAllowedPrefixes:  phonePrefixes,
+		UnreadIncludeSystem:   os.Getenv("UNREAD_COUNT_SYSTEM_MESSAGES") == "true",
+		MaxMessageOffset:      envInt("MESSAGES_MAX_OFFSET", 2000),
+		MaxPinnedPage:         envInt("PINNED_MESSAGES_MAX_LIMIT", 100),
+		SystemMessageLang:     envStr("SYSTEM_MESSAGE_LANG", "ru"),
+		MessageEditWindow:     time.Duration(envInt("MESSAGE_EDIT_WINDOW_HOURS", yc.MessageEditHours)) * time.Hour,
+		MessageDeleteWindow:   time.Duration(envInt("MESSAGE_DELETE_WINDOW_HOURS", yc.MessageDeleteHours)) * time.Hour,
+		MessageEncryptionKeys: os.Getenv("MESSAGE_ENCRYPTION_KEYS"),
+		CORSAllowedOrigins:    envStr("CORS_ALLOWED_ORIGINS", yc.CORSAllowedOrigins),
+		LogLevel:              envStr("LOG_LEVEL", yc.LogLevel),
+		Cache:                 CacheConfig{TTLMinutes: cacheTTL},
+		Redis:                 RedisConfig{URL: redisURL, RateLimit: os.Getenv("RATE_LIMIT_BACKEND") == "redis"},
+		SMTP:                  smtpCfg,
+		OTPDelivery:           envStr("OTP_DELIVERY", "email"),
+		OTPWebhookURL:         os.Getenv("OTP_WEBHOOK_URL"),
+		OTPWebhookSecret:      os.Getenv("OTP_WEBHOOK_SECRET"),
+		DevOTPEndpoint:        os.Getenv("DEV_OTP_ENDPOINT") == "true" && os.Getenv("APP_ENV") != "production",
+		AuthServiceURL:        authServiceURL,
+		APIServiceURL:         envStr("API_SERVICE_URL", ""),
+		WelcomeMessage:        welcomeMessage(),
+		AllowedEmailDomains:   splitList(os.Getenv("ALLOWED_EMAIL_DOMAINS")),
+		AutoProvision:         os.Getenv("AUTO_PROVISION_USERS") != "false",
+		AutoProvisionDomains:  splitList(os.Getenv("AUTO_PROVISION_DOMAINS")),
+		MaxSessionsPerUser:    envInt("MAX_SESSIONS_PER_USER", 0),
+		SessionLimitReject:    os.Getenv("SESSION_LIMIT_MODE") == "reject",
+		AuthActivityRetention: time.Duration(envInt("AUTH_ACTIVITY_RETENTION_DAYS", 30)) * 24 * time.Hour,
+		AuthActivityHashKey:   os.Getenv("AUTH_ACTIVITY_HASH_KEY"),
+		PushServiceURL:        pushServiceURL,
+		PushVAPIDPublicKey:    pushVAPIDPublic,
+		PushConcurrency:       envInt("PUSH_CONCURRENCY", 16),
+		MaintenanceMode:       os.Getenv("MAINTENANCE_MODE") == "true",
+		FileServiceURL:        envStr("FILE_SERVICE_URL", ""),
+		AudioServiceURL:       envStr("AUDIO_SERVICE_URL", ""),
+	}
+
+	if os.Getenv("LOG_BODIES") == "true" {
+		cfg.LogBodiesSamplePercent = min(max(envInt("LOG_BODIES_SAMPLE_PERCENT", 100), 0), 100)
+	}
+
+	// Параметры WebSocket отдаются клиенту (/api/config/ws), поэтому умолчания — здесь, те же, что у ws.Hub.
+	if cfg.WSPongTimeout <= 0 {
+		cfg.WSPongTimeout = 60
+	}
+	if cfg.WSMaxMessageSize <= 0 {
+		cfg.WSMaxMessageSize = 4096
 	}
 
 	if os.Getenv("APP_ENV") == "production" {
-		if cfg.CORSAllowedOrigins == "" || cfg.CORSAllowedOrigins == "*" {
+		if origins, _ := cfg.CORSOrigins(); len(origins) == 0 || slices.Contains(origins, "*") {
 			logger.Errorf("config: в production задайте CORS_ALLOWED_ORIGINS (явный список origins, не *)")
 			// Не роняем процесс — сайт должен открываться; CORS можно задать позже
 		}
@@ -369,6 +606,17 @@ func envStr(key, fallback string) string {
 	return fallback
 }
 
+// splitList разбивает строку через запятую, обрезая пробелы и пропуская пустые элементы.
+func splitList(raw string) []string {
+	var out []string
+	for _, v := range strings.Split(raw, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
 // envInt возвращает числовое значение переменной окружения или fallback.
 func envInt(key string, fallback int) int {
 	v := os.Getenv(key)
@@ -381,3 +629,17 @@ func envInt(key string, fallback int) int {
 	}
 	return n
 }
+
+// welcomeMessage читает шаблон приветствия: файл WELCOME_MESSAGE_FILE (удобно для многострочного и
+// локализованного текста) или WELCOME_MESSAGE, где "\n" означает перевод строки.
+func welcomeMessage() string {
+	if path := os.Getenv("WELCOME_MESSAGE_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			logger.Errorf("config: WELCOME_MESSAGE_FILE: %v", err)
+			return ""
+		}
+		return strings.TrimSpace(string(data))
+	}
+	return strings.ReplaceAll(os.Getenv("WELCOME_MESSAGE"), `\n`, "\n")
+}
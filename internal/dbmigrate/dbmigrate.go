@@ -0,0 +1,68 @@
+// Package dbmigrate — список SQL-миграций из каталога migrations и их применение.
+// Миграции идемпотентны (IF NOT EXISTS и т.п.) и применяются все по порядку при каждом старте API.
+package dbmigrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Files — файлы миграций в порядке применения; новая миграция добавляется в конец.
+var Files = []string{
+	"001_init.sql", "002_features.sql", "003_phone.sql",
+	"004_system_messages.sql", "005_user_favorites.sql", "006_notes_chat.sql",
+	"007_sessions_otp_auth.sql", "008_sessions_revoked_at.sql",
+	"010_user_permissions.sql", "011_user_permissions_administrator.sql", "012_user_permissions_member.sql",
+	"013_normalize_file_names.sql", "014_allow_voice_content_type.sql",
+	"015_user_disabled_at.sql", "016_message_search_filters.sql",
+	"017_call_stats.sql", "018_chat_pin_policy.sql",
+	"019_hidden_messages.sql",
+	"020_sensitive_chats.sql",
+	"021_message_attachments.sql",
+	"022_message_locations.sql",
+	"023_message_contacts.sql",
+	"024_user_presence.sql",
+	"025_user_custom_status.sql",
+	"026_user_last_ping.sql",
+	"027_user_uploads.sql",
+	"028_user_presence_pings.sql",
+	"029_message_mentions.sql",
+	"030_user_hide_last_seen.sql",
+	"031_maintenance_mode.sql",
+	"032_user_phone_unique.sql",
+	"033_message_receipts.sql",
+	"034_chat_member_cleared_before.sql",
+	"035_admin_audit_log.sql",
+	"036_chat_send_policy.sql",
+	"037_channels.sql",
+	"038_auth_activity.sql",
+	"039_message_system_events.sql",
+	"040_bot_api_keys.sql",
+	"041_admin_audit_log_indexes.sql",
+	"042_upload_scan_status.sql",
+	"043_image_metadata.sql",
+	"044_user_chat_order.sql",
+	"045_chat_member_marked_unread.sql",
+	"046_message_reply_index.sql",
+	"047_calls.sql",
+	"048_message_image_metadata.sql",
+	"049_auth_activity_hmac.sql",
+}
+
+// Apply выполняет все миграции из каталога dir.
+func Apply(ctx context.Context, pool *pgxpool.Pool, dir string) error {
+	for _, f := range Files {
+		data, err := os.ReadFile(filepath.Join(dir, f))
+		if err != nil {
+			return fmt.Errorf("read migration %s: %w", f, err)
+		}
+		if _, err := pool.Exec(ctx, string(data)); err != nil {
+			return fmt.Errorf("run migration %s: %w", f, err)
+		}
+	}
+	return nil
+}
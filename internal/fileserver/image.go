@@ -0,0 +1,75 @@
+package fileserver
+
+import (
+	"bytes"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/messenger/internal/blurhash"
+)
+
+// decodableImageExt — картинки, которые декодирует стандартная библиотека: для них при загрузке
+// определяются размеры и BlurHash.
+var decodableImageExt = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true}
+
+// maxDecodePixels — картинки больше этого не декодируются целиком (декодированный RGBA занимает
+// 4 байта на точку, ~16 МБ на 4 Мп): для них известны только размеры, BlurHash не считается.
+const maxDecodePixels = 4_000_000
+
+// blurhashMaxBytes — сколько байт загрузки держится в памяти для определения размеров и BlurHash.
+// Для файлов больше BlurHash не считается, размеры берутся из заголовка в начале файла.
+const blurhashMaxBytes = 4 << 20
+
+// imageBuffer копит не больше limit байт и отмечает, что данные не поместились.
+type imageBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func newImageBuffer(head []byte, limit int) *imageBuffer {
+	b := &imageBuffer{limit: limit}
+	b.Write(head)
+	return b
+}
+
+// Write никогда не возвращает ошибку: избыток молча отбрасывается, чтобы не прерывать загрузку.
+func (b *imageBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); len(p) > room {
+		b.truncated = true
+		b.buf.Write(p[:max(room, 0)])
+	} else {
+		b.buf.Write(p)
+	}
+	return len(p), nil
+}
+
+// meta возвращает размеры и BlurHash накопленной картинки; BlurHash — только если файл поместился целиком.
+func (b *imageBuffer) meta() (width, height int, hash string) {
+	if b.truncated {
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(b.buf.Bytes()))
+		if err != nil {
+			return 0, 0, ""
+		}
+		return cfg.Width, cfg.Height, ""
+	}
+	return imageMeta(b.buf.Bytes())
+}
+
+// imageMeta возвращает размеры картинки и её BlurHash; нули и "" — не удалось разобрать.
+func imageMeta(data []byte) (width, height int, hash string) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, ""
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > maxDecodePixels/cfg.Height {
+		return cfg.Width, cfg.Height, ""
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return cfg.Width, cfg.Height, ""
+	}
+	return cfg.Width, cfg.Height, blurhash.Encode(img)
+}
@@ -0,0 +1,47 @@
+package fileserver
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestImageMeta(t *testing.T) {
+	w, h, hash := imageMeta(encodePNG(t, 40, 30))
+	if w != 40 || h != 30 || hash == "" {
+		t.Errorf("small image: %dx%d %q", w, h, hash)
+	}
+	// Больше maxDecodePixels: размеры из заголовка, без полного декодирования.
+	w, h, hash = imageMeta(encodePNG(t, 2500, 2000))
+	if w != 2500 || h != 2000 || hash != "" {
+		t.Errorf("large image: %dx%d %q", w, h, hash)
+	}
+	if w, h, hash = imageMeta([]byte("not an image")); w != 0 || h != 0 || hash != "" {
+		t.Errorf("garbage: %dx%d %q", w, h, hash)
+	}
+}
+
+func TestImageBufferLimit(t *testing.T) {
+	data := encodePNG(t, 40, 30)
+	b := newImageBuffer(data[:8], len(data)/2)
+	if n, err := b.Write(data[8:]); n != len(data)-8 || err != nil {
+		t.Fatalf("Write = %d, %v", n, err)
+	}
+	if !b.truncated || b.buf.Len() != len(data)/2 {
+		t.Fatalf("truncated=%v len=%d", b.truncated, b.buf.Len())
+	}
+	// Заголовок PNG поместился — размеры известны, BlurHash по обрезанным данным не считается.
+	if w, h, hash := b.meta(); w != 40 || h != 30 || hash != "" {
+		t.Errorf("meta = %dx%d %q", w, h, hash)
+	}
+}
@@ -0,0 +1,93 @@
+package fileserver
+
+import (
+	"mime"
+	"strings"
+
+	"github.com/messenger/internal/logger"
+)
+
+// defaultContentTypes — MIME-типы по расширению для раздачи файлов. HTML и XML сюда не входят: без
+// Content-Type и с nosniff браузер их не отрисует и не выполнит скрипты в контексте нашего домена.
+var defaultContentTypes = map[string]string{
+	// Изображения
+	".jpg": "image/jpeg", ".jpeg": "image/jpeg", ".png": "image/png", ".gif": "image/gif",
+	".webp": "image/webp", ".heic": "image/heic", ".heif": "image/heif", ".avif": "image/avif",
+	".bmp": "image/bmp", ".tif": "image/tiff", ".tiff": "image/tiff", ".ico": "image/x-icon",
+	".svg": "image/svg+xml",
+	// Документы
+	".pdf": "application/pdf", ".txt": "text/plain", ".csv": "text/csv", ".md": "text/markdown",
+	".rtf": "application/rtf", ".json": "application/json",
+	".doc":  "application/msword",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".xls":  "application/vnd.ms-excel",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".ppt":  "application/vnd.ms-powerpoint",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".odt":  "application/vnd.oasis.opendocument.text",
+	".ods":  "application/vnd.oasis.opendocument.spreadsheet",
+	".odp":  "application/vnd.oasis.opendocument.presentation",
+	// Аудио и видео
+	".mp3": "audio/mpeg", ".m4a": "audio/mp4", ".aac": "audio/aac", ".ogg": "audio/ogg", ".oga": "audio/ogg",
+	".opus": "audio/opus", ".wav": "audio/wav", ".flac": "audio/flac",
+	".mp4": "video/mp4", ".m4v": "video/mp4", ".mov": "video/quicktime", ".webm": "video/webm",
+	".mkv": "video/x-matroska", ".avi": "video/x-msvideo",
+	// Архивы
+	".zip": "application/zip", ".rar": "application/vnd.rar", ".7z": "application/x-7z-compressed",
+	".tar": "application/x-tar", ".gz": "application/gzip", ".tgz": "application/gzip",
+	".bz2": "application/x-bzip2", ".xz": "application/x-xz",
+}
+
+// ParseContentTypes разбирает дополнительные соответствия расширение→MIME из строки вида
+// ".dwg=image/vnd.dwg, step=model/step" (FILE_CONTENT_TYPES). Они дополняют и переопределяют встроенные.
+// Записи без "=" или с пустой частью пропускаются, как и активные типы (activeContentType): иначе,
+// например, ".jpg=text/html" отдавал бы загруженную страницу inline с нашего домена.
+func ParseContentTypes(raw string) map[string]string {
+	out := make(map[string]string)
+	for _, part := range strings.Split(raw, ",") {
+		ext, ct, ok := strings.Cut(strings.TrimSpace(part), "=")
+		ext, ct = strings.ToLower(strings.TrimSpace(ext)), strings.TrimSpace(ct)
+		if !ok || ext == "" || ext == "." || ct == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		if activeContentType(ct) {
+			logger.Errorf("FILE_CONTENT_TYPES: %s=%s ignored: active content type", ext, ct)
+			continue
+		}
+		out[ext] = ct
+	}
+	return out
+}
+
+// activeContentType — тип, который браузер может исполнить или отрисовать со скриптами: HTML, XML
+// (включая SVG и XHTML) и JavaScript. Неразбираемый тип тоже считается активным.
+func activeContentType(ct string) bool {
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return true
+	}
+	switch {
+	case mediaType == "text/html", strings.HasSuffix(mediaType, "/xml"), strings.HasSuffix(mediaType, "+xml"),
+		strings.HasSuffix(mediaType, "javascript"), strings.HasSuffix(mediaType, "ecmascript"):
+		return true
+	}
+	return false
+}
+
+// contentTypeByExt — MIME-тип по расширению: сначала ContentTypes, затем встроенные; "" — неизвестен.
+func (s *Service) contentTypeByExt(ext string) string {
+	ext = strings.ToLower(ext)
+	if ct, ok := s.ContentTypes[ext]; ok {
+		return ct
+	}
+	return defaultContentTypes[ext]
+}
+
+// isImage — файл показывается в чате как картинка (сообщение "image"). SVG — нет: inline он не отдаётся.
+func (s *Service) isImage(ext string) bool {
+	ct := s.contentTypeByExt(ext)
+	return strings.HasPrefix(ct, "image/") && ct != "image/svg+xml"
+}
@@ -0,0 +1,16 @@
+package fileserver
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestParseContentTypes(t *testing.T) {
+	got := ParseContentTypes(" .dwg=image/vnd.dwg, step=model/step, .JPG=image/jpeg, bad, .x=, " +
+		".jpg=text/html, .htm=text/html; charset=utf-8, .xml=application/xml, .rss=application/rss+xml, " +
+		".svgz=image/svg+xml, .xht=application/xhtml+xml, .js=text/javascript, .mjs=application/javascript, .q=a/b/c")
+	want := map[string]string{".dwg": "image/vnd.dwg", ".step": "model/step", ".jpg": "image/jpeg"}
+	if !maps.Equal(got, want) {
+		t.Errorf("ParseContentTypes = %v, want %v", got, want)
+	}
+}
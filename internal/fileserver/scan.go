@@ -0,0 +1,60 @@
+package fileserver
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/messenger/internal/blobstore"
+	"github.com/messenger/internal/clamav"
+	"github.com/messenger/internal/model"
+)
+
+// ScanStored проверяет антивирусом файл, сохранённый при ScanAsync. Читает сам сохранённый объект
+// (распаковывая .gz), поэтому проверку можно повторить после сбоя clamd или перезапуска.
+// Возвращает model.ScanClean или model.ScanInfected; при недоступном clamd — ошибку (с FailOpen — ScanClean);
+// blobstore.ErrNotFound — файла уже нет.
+func (s *Service) ScanStored(ctx context.Context, filename string) (string, error) {
+	filename = filepath.Base(filename)
+	var (
+		f   io.ReadCloser
+		err error
+	)
+	for _, key := range []string{filename + ".gz", filename} {
+		f, _, err = s.Store.Get(ctx, key)
+		if errors.Is(err, blobstore.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("fileserver scan %s: %w", filename, err)
+		}
+		if key != filename {
+			gz, gzErr := gzip.NewReader(f)
+			if gzErr != nil {
+				f.Close()
+				return "", fmt.Errorf("fileserver scan %s: %w", filename, gzErr)
+			}
+			f = struct {
+				io.Reader
+				io.Closer
+			}{gz, f}
+		}
+		break
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	err = s.Scanner.Scan(ctx, f)
+	var infected *clamav.InfectedError
+	switch {
+	case errors.As(err, &infected):
+		return model.ScanInfected, nil
+	case err != nil && !s.Scanner.FailOpen:
+		return "", fmt.Errorf("fileserver scan %s: %w", filename, err)
+	}
+	return model.ScanClean, nil
+}
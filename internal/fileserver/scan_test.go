@@ -0,0 +1,100 @@
+package fileserver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/messenger/internal/blobstore"
+	"github.com/messenger/internal/clamav"
+	"github.com/messenger/internal/model"
+)
+
+// fakeClamd отвечает на INSTREAM: FOUND, если в потоке есть "EICAR", иначе OK.
+func fakeClamd(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				cmd := make([]byte, len("zINSTREAM\x00"))
+				if _, err := io.ReadFull(conn, cmd); err != nil {
+					return
+				}
+				var data bytes.Buffer
+				for {
+					var size uint32
+					if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+						return
+					}
+					if size == 0 {
+						break
+					}
+					if _, err := io.CopyN(&data, conn, int64(size)); err != nil {
+						return
+					}
+				}
+				if bytes.Contains(data.Bytes(), []byte("EICAR")) {
+					conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+					return
+				}
+				conn.Write([]byte("stream: OK\x00"))
+			}(conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestScanStored(t *testing.T) {
+	ctx := context.Background()
+	store := blobstore.NewLocal(t.TempDir())
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte("X5O!P%@AP EICAR test"))
+	zw.Close()
+	if err := store.Put(ctx, "bad.txt.gz", &gz); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(ctx, "good.txt", strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	s := New(store, true, 0)
+	s.ScanAsync = true
+	s.Scanner = clamav.New(fakeClamd(t), false)
+
+	if status, err := s.ScanStored(ctx, "good.txt"); err != nil || status != model.ScanClean {
+		t.Errorf("good.txt: %q, %v", status, err)
+	}
+	// Сжатый объект проверяется распакованным.
+	if status, err := s.ScanStored(ctx, "bad.txt"); err != nil || status != model.ScanInfected {
+		t.Errorf("bad.txt: %q, %v", status, err)
+	}
+	if _, err := s.ScanStored(ctx, "missing.txt"); !errors.Is(err, blobstore.ErrNotFound) {
+		t.Errorf("missing.txt: err = %v, want ErrNotFound", err)
+	}
+
+	// clamd недоступен: ошибка (файл остаётся pending для повтора), с FailOpen — clean.
+	s.Scanner = clamav.New("127.0.0.1:1", false)
+	if _, err := s.ScanStored(ctx, "good.txt"); err == nil {
+		t.Error("unavailable clamd: no error")
+	}
+	s.Scanner = clamav.New("127.0.0.1:1", true)
+	if status, err := s.ScanStored(ctx, "good.txt"); err != nil || status != model.ScanClean {
+		t.Errorf("fail-open: %q, %v", status, err)
+	}
+}
@@ -5,14 +5,20 @@ import (
 	"compress/gzip"
 	"context"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
 
+	"github.com/messenger/internal/blobstore"
+	"github.com/messenger/internal/clamav"
 	"github.com/messenger/internal/logger"
+	"github.com/messenger/internal/model"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"unicode"
 
@@ -31,17 +37,32 @@ type UploadResponse struct {
 	FileName    string `json:"file_name"`
 	FileSize    int64  `json:"file_size"`
 	ContentType string `json:"content_type"`
+	// ScanStatus — "pending", если файл ждёт фоновой проверки антивирусом (ScanAsync); иначе пусто.
+	ScanStatus string `json:"scan_status,omitempty"`
+	// Width, Height и BlurHash — для картинок JPEG, PNG и GIF: клиент резервирует место и рисует заглушку.
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
+	BlurHash string `json:"blurhash,omitempty"`
 }
 
 // Service обрабатывает загрузку и раздачу файлов.
 type Service struct {
-	UploadDir     string
+	Store blobstore.Storage
+	// Gzip — сохранять новые файлы сжатыми (имя + ".gz"); раздаются оба варианта.
+	Gzip          bool
 	MaxUploadSize int64
+	// Scanner — проверка загрузок антивирусом (ClamAV); nil — выключена.
+	Scanner *clamav.Scanner
+	// ContentTypes — дополнительные MIME-типы по расширению (см. ParseContentTypes) поверх встроенных.
+	ContentTypes map[string]string
+	// ScanAsync — не ждать антивирус при загрузке: файл сохраняется сразу со статусом pending,
+	// проверку сохранённого объекта запускает вызывающий через ScanStored.
+	ScanAsync bool
 }
 
-// New создаёт сервис с заданным каталогом и лимитом размера (в байтах).
-func New(uploadDir string, maxUploadSize int64) *Service {
-	return &Service{UploadDir: uploadDir, MaxUploadSize: maxUploadSize}
+// New создаёт сервис с заданным хранилищем и лимитом размера (в байтах).
+func New(store blobstore.Storage, gzip bool, maxUploadSize int64) *Service {
+	return &Service{Store: store, Gzip: gzip, MaxUploadSize: maxUploadSize}
 }
 
 func (s *Service) writeJSON(w http.ResponseWriter, status int, data any) {
@@ -88,54 +109,88 @@ func (s *Service) Upload(w http.ResponseWriter, r *http.Request) {
 		s.writeError(w, http.StatusBadRequest, "file content does not match type")
 		return
 	}
-
-	newName := uuid.New().String() + ext
-	if err := os.MkdirAll(s.UploadDir, 0o755); err != nil {
-		s.writeError(w, http.StatusInternalServerError, "failed to create upload dir")
-		return
+	// Остаток файла; для SVG — уже прочитанный и проверенный целиком (размер ограничен MaxBytesReader).
+	var rest io.Reader = file
+	if ext == ".svg" {
+		data, err := io.ReadAll(io.MultiReader(bytes.NewReader(head), file))
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, "file too large")
+			return
+		}
+		if err := checkSVG(data); err != nil {
+			s.writeError(w, http.StatusBadRequest, "svg not allowed: "+err.Error())
+			return
+		}
+		head, rest = data, bytes.NewReader(nil)
+	}
+	// При ScanAsync файл сохраняется без проверки; её делает ScanStored по сохранённому объекту.
+	if s.Scanner != nil && !s.ScanAsync {
+		tmp, err := s.scan(ctx, w, head, rest)
+		if tmp == nil {
+			if err != nil {
+				logger.Errorf("fileserver upload: %v", err)
+			}
+			return
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+		head, rest = nil, tmp
 	}
 
-	// Сохраняем в сжатом виде (.gz) для экономии места
-	dstPath := filepath.Join(s.UploadDir, newName+".gz")
-	dst, err := os.Create(dstPath)
-	if err != nil {
-		s.writeError(w, http.StatusInternalServerError, "failed to save file")
-		return
+	// Копия начала картинки (не больше blurhashMaxBytes) — чтобы после сохранения определить размеры и BlurHash.
+	var imgBuf *imageBuffer
+	if decodableImageExt[ext] {
+		imgBuf = newImageBuffer(head, blurhashMaxBytes)
+		rest = io.TeeReader(rest, imgBuf)
 	}
-	gz := gzip.NewWriter(dst)
-	if _, err := gz.Write(head); err != nil {
-		gz.Close()
-		dst.Close()
-		os.Remove(dstPath)
-		s.writeError(w, http.StatusInternalServerError, "failed to save file")
-		return
+
+	newName := uuid.New().String() + ext
+	key := newName
+	compress := s.Gzip && compressibleExt(ext)
+	if compress {
+		// Сохраняем в сжатом виде (.gz) для экономии места
+		key += ".gz"
 	}
-	if err := copyWithContext(ctx, gz, file); err != nil {
-		gz.Close()
-		dst.Close()
-		os.Remove(dstPath)
+	pr, pw := io.Pipe()
+	go func() {
+		var dst io.Writer = pw
+		var gz *gzip.Writer
+		if compress {
+			gz = gzip.NewWriter(pw)
+			dst = gz
+		}
+		_, err := dst.Write(head)
+		if err == nil {
+			err = copyWithContext(ctx, dst, rest)
+		}
+		if err == nil && gz != nil {
+			err = gz.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	if err := s.Store.Put(ctx, key, pr); err != nil {
+		pr.CloseWithError(err)
 		if ctx.Err() != nil {
 			return
 		}
+		logger.Errorf("fileserver upload %s: %v", key, err)
 		s.writeError(w, http.StatusInternalServerError, "failed to save file")
 		return
 	}
-	if err := gz.Close(); err != nil {
-		dst.Close()
-		os.Remove(dstPath)
-		s.writeError(w, http.StatusInternalServerError, "failed to save file")
-		return
-	}
-	if err := dst.Close(); err != nil {
-		os.Remove(dstPath)
-		s.writeError(w, http.StatusInternalServerError, "failed to save file")
-		return
+	scanStatus := ""
+	if s.Scanner != nil && s.ScanAsync {
+		scanStatus = model.ScanPending
 	}
 
 	contentType := "file"
-	if ext == ".jpg" || ext == ".jpeg" || ext == ".png" || ext == ".gif" || ext == ".webp" || ext == ".heic" {
+	if s.isImage(ext) {
 		contentType = "image"
 	}
+	var width, height int
+	var blur string
+	if imgBuf != nil {
+		width, height, blur = imgBuf.meta()
+	}
 
 	// Имя для отображения: только базовая часть без пути, безопасные символы; иначе — сгенерированное
 	displayName := strings.TrimSpace(filepath.Base(rawFilename))
@@ -150,9 +205,82 @@ func (s *Service) Upload(w http.ResponseWriter, r *http.Request) {
 		FileName:    displayName,
 		FileSize:    header.Size,
 		ContentType: contentType,
+		ScanStatus:  scanStatus,
+		Width:       width,
+		Height:      height,
+		BlurHash:    blur,
 	})
 }
 
+// scan сохраняет файл во временный каталог и проверяет его антивирусом до записи в хранилище.
+// Возвращает временный файл (позиция — начало) или nil, если ответ клиенту уже отправлен.
+func (s *Service) scan(ctx context.Context, w http.ResponseWriter, head []byte, rest io.Reader) (*os.File, error) {
+	tmp, err := s.spool(ctx, w, head, rest)
+	if tmp == nil {
+		return nil, err
+	}
+	ok := false
+	defer func() {
+		if !ok {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	err = s.Scanner.Scan(ctx, tmp)
+	var infected *clamav.InfectedError
+	switch {
+	case errors.As(err, &infected):
+		logger.Infof("fileserver upload rejected: %s", infected.Signature)
+		s.writeError(w, http.StatusUnprocessableEntity, "file rejected by virus scan")
+		return nil, nil
+	case err != nil && !s.Scanner.FailOpen:
+		s.writeError(w, http.StatusServiceUnavailable, "virus scan unavailable")
+		return nil, err
+	case err != nil:
+		logger.Errorf("fileserver upload: virus scan failed, accepting file (fail-open): %v", err)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to save file")
+		return nil, err
+	}
+	ok = true
+	return tmp, nil
+}
+
+// spool сохраняет файл во временный каталог. Возвращает его (позиция — начало) или nil, если ответ
+// клиенту уже отправлен.
+func (s *Service) spool(ctx context.Context, w http.ResponseWriter, head []byte, rest io.Reader) (*os.File, error) {
+	tmp, err := os.CreateTemp("", "upload-scan-*")
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to save file")
+		return nil, err
+	}
+	ok := false
+	defer func() {
+		if !ok {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err := tmp.Write(head); err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to save file")
+		return nil, err
+	}
+	if err := copyWithContext(ctx, tmp, rest); err != nil {
+		if ctx.Err() != nil {
+			return nil, nil
+		}
+		s.writeError(w, http.StatusInternalServerError, "failed to save file")
+		return nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to save file")
+		return nil, err
+	}
+	ok = true
+	return tmp, nil
+}
+
 func matchMagic(ext string, head []byte) bool {
 	switch ext {
 	case ".jpg", ".jpeg":
@@ -171,81 +299,178 @@ func matchMagic(ext string, head []byte) bool {
 		return len(head) >= 8 && head[0] == 0xD0 && head[1] == 0xCF && head[2] == 0x11 && head[3] == 0xE0
 	case ".docx":
 		return len(head) >= 4 && head[0] == 0x50 && head[1] == 0x4B && (head[2] == 0x03 || head[2] == 0x05) && head[3] == 0x04
+	case ".svg":
+		return looksLikeSVG(head)
 	case ".txt":
 		return true
 	}
 	return true
 }
 
-// Serve отдаёт файл по имени (разархивирует при отдаче); query name= — оригинальное имя для Content-Disposition.
+// InlineSafeExt — типы, которые можно показывать в браузере (disposition=inline): изображения и PDF.
+// SVG и HTML сюда не входят никогда — они могут исполнять скрипты в контексте нашего домена.
+var InlineSafeExt = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".heic": true, ".pdf": true,
+}
+
+// Serve отдаёт файл по имени (разархивирует при отдаче); query name= — оригинальное имя для Content-Disposition,
+// disposition=inline — показать в браузере (только для InlineSafeExt, иначе всё равно attachment).
+// Типы не из InlineSafeExt (SVG, HTML и т.п.) всегда отдаются с Content-Disposition: attachment — и без name=.
 func (s *Service) Serve(w http.ResponseWriter, r *http.Request, filename string) {
 	filename = filepath.Base(filename)
 	ext := filepath.Ext(filename)
-	gzPath := filepath.Join(s.UploadDir, filename+".gz")
-	plainPath := filepath.Join(s.UploadDir, filename)
 
-	if ct := contentTypeByExt(ext); ct != "" {
+	ct := s.contentTypeByExt(ext)
+	if ct != "" {
 		w.Header().Set("Content-Type", ct)
 	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if strings.EqualFold(ext, ".svg") {
+		// Даже проверенный при загрузке SVG (и старые, загруженные до проверки) отдаём без права
+		// исполнять скрипты и только как attachment (нет в InlineSafeExt).
+		w.Header().Set("Content-Security-Policy", svgCSP)
+	}
+	dispType := "attachment"
+	if r.URL.Query().Get("disposition") == "inline" && InlineSafeExt[strings.ToLower(ext)] && !activeContentType(ct) {
+		dispType = "inline"
+	}
+	disp := ""
 	if origName := r.URL.Query().Get("name"); origName != "" {
 		// В URL пробел может приходить как "+"; нормализуем для сохранения имени при скачивании (UTF-8).
 		origName = strings.TrimSpace(strings.ReplaceAll(origName, "+", " "))
 		safe := safeFilename(origName)
 		if safe != "" {
-			disp := "attachment; filename*=UTF-8''" + url.QueryEscape(safe)
+			disp = "filename*=UTF-8''" + url.QueryEscape(safe)
 			// Legacy filename= с ASCII искажает кириллицу (подчёркивания) — не добавляем его,
 			// чтобы панель загрузки браузера показывала имя из filename*=UTF-8''.
 			if ascii := asciiFallbackFilename(safe); ascii != "" && ascii == safe {
-				disp = "attachment; filename=\"" + ascii + "\"; " + disp
+				disp = "filename=\"" + ascii + "\"; " + disp
 			}
-			w.Header().Set("Content-Disposition", disp)
+			disp = dispType + "; " + disp
 		}
 	}
+	if disp == "" && (dispType == "inline" || !InlineSafeExt[strings.ToLower(ext)]) {
+		disp = dispType
+	}
+	if disp != "" {
+		w.Header().Set("Content-Disposition", disp)
+	}
 
-	// Сначала сжатый .gz, иначе — обычный файл (обратная совместимость)
-	if f, err := os.Open(gzPath); err == nil {
-		defer f.Close()
+	// Сначала сжатый .gz, иначе — обычный файл (обратная совместимость и хранилища без сжатия)
+	key := filename + ".gz"
+	info, err := s.Store.Stat(r.Context(), key)
+	if errors.Is(err, blobstore.ErrNotFound) {
+		key = filename
+		info, err = s.Store.Stat(r.Context(), key)
+	}
+	compressed := key != filename
+	// Клиенту, принимающему gzip, сжатый файл отдаётся как есть — без распаковки на сервере.
+	passthrough := compressed && compressibleExt(ext) && acceptsGzip(r)
+	if errors.Is(err, blobstore.ErrNotFound) {
+		s.writeError(w, http.StatusNotFound, "file not found")
+		return
+	}
+	if err != nil {
+		logger.Errorf("fileserver serve %s: %v", filename, err)
+		s.writeError(w, http.StatusInternalServerError, "failed to read file")
+		return
+	}
+	etag := blobstore.ETag(key, info)
+	if compressed {
+		w.Header().Set("Vary", "Accept-Encoding")
+	}
+	if passthrough {
+		// Сильный ETag различает представления: сжатое и распакованное.
+		etag = strings.TrimSuffix(etag, `"`) + `-gzip"`
+	}
+	blobstore.SetCacheHeaders(w.Header(), etag, info.ModTime)
+	if blobstore.NotModified(r, etag, info.ModTime) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	f, _, err := s.Store.Get(r.Context(), key)
+	if err != nil {
+		logger.Errorf("fileserver serve %s: %v", filename, err)
+		s.writeError(w, http.StatusInternalServerError, "failed to read file")
+		return
+	}
+	defer f.Close()
+	var body io.Reader = f
+	if passthrough {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	} else if compressed {
 		gz, err := gzip.NewReader(f)
 		if err != nil {
 			s.writeError(w, http.StatusInternalServerError, "failed to read file")
 			return
 		}
 		defer gz.Close()
-		w.WriteHeader(http.StatusOK)
-		io.Copy(w, gz)
+		body = gz
+	}
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, body)
+}
+
+// Delete удаляет файл (сжатый и/или обычный). Права на удаление проверяет вызывающий (API).
+func (s *Service) Delete(w http.ResponseWriter, r *http.Request, filename string) {
+	removed, err := s.Remove(r.Context(), filename)
+	if err != nil {
+		logger.Errorf("fileserver delete %s: %v", filename, err)
+		s.writeError(w, http.StatusInternalServerError, "failed to delete file")
 		return
 	}
-	if f, err := os.Open(plainPath); err == nil {
-		defer f.Close()
-		w.WriteHeader(http.StatusOK)
-		io.Copy(w, f)
+	if !removed {
+		s.writeError(w, http.StatusNotFound, "file not found")
 		return
 	}
-	s.writeError(w, http.StatusNotFound, "file not found")
+	w.WriteHeader(http.StatusNoContent)
 }
 
-func contentTypeByExt(ext string) string {
-	switch strings.ToLower(ext) {
-	case ".jpg", ".jpeg":
-		return "image/jpeg"
-	case ".png":
-		return "image/png"
-	case ".gif":
-		return "image/gif"
-	case ".webp":
-		return "image/webp"
-	case ".heic":
-		return "image/heic"
-	case ".pdf":
-		return "application/pdf"
-	case ".doc":
-		return "application/msword"
-	case ".docx":
-		return "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
-	case ".txt":
-		return "text/plain"
+// Remove удаляет файл из хранилища (сжатый и/или обычный); false — файла не было.
+func (s *Service) Remove(ctx context.Context, filename string) (bool, error) {
+	filename = filepath.Base(filename)
+	removed := false
+	for _, key := range []string{filename + ".gz", filename} {
+		err := s.Store.Delete(ctx, key)
+		if err == nil {
+			removed = true
+			continue
+		}
+		if !errors.Is(err, blobstore.ErrNotFound) {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// precompressedExt — форматы, уже сжатые внутри (изображения, архивы, медиа, OOXML): gzip их не уменьшает,
+// поэтому такие файлы хранятся и отдаются без сжатия.
+var precompressedExt = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".heic": true,
+	".zip": true, ".gz": true, ".7z": true, ".rar": true, ".docx": true, ".xlsx": true, ".pptx": true,
+	".mp3": true, ".mp4": true, ".m4a": true, ".ogg": true, ".webm": true, ".mov": true,
+}
+
+func compressibleExt(ext string) bool {
+	return !precompressedExt[strings.ToLower(ext)]
+}
+
+// acceptsGzip сообщает, принимает ли клиент Content-Encoding: gzip (с q > 0).
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				return false
+			}
+		}
+		return true
 	}
-	return ""
+	return false
 }
 
 // safeFilename оставляет имя файла безопасным для Content-Disposition (без управляющих символов и кавычек).
@@ -307,3 +532,93 @@ func copyWithContext(ctx context.Context, dst io.Writer, src io.Reader) error {
 		}
 	}
 }
+
+// svgCSP запрещает в отдаваемом SVG скрипты, внешние ресурсы и навигацию.
+const svgCSP = "default-src 'none'; img-src data:; style-src 'unsafe-inline'; sandbox"
+
+// looksLikeSVG проверяет начало файла: XML-пролог, комментарий, DOCTYPE или сразу <svg.
+func looksLikeSVG(head []byte) bool {
+	t := bytes.TrimLeft(bytes.TrimPrefix(head, []byte("\xEF\xBB\xBF")), " \t\r\n")
+	if !bytes.HasPrefix(t, []byte("<")) {
+		return false
+	}
+	lower := bytes.ToLower(t)
+	return bytes.HasPrefix(lower, []byte("<?xml")) || bytes.HasPrefix(lower, []byte("<!--")) ||
+		bytes.HasPrefix(lower, []byte("<!doctype svg")) || bytes.HasPrefix(lower, []byte("<svg"))
+}
+
+// svgAnimationElems — элементы SMIL-анимации: через attributeName они подменяют атрибуты других элементов
+// (<set attributeName="href" to="javascript:…">), поэтому их значения проверяются как ссылки.
+var svgAnimationElems = map[string]bool{"animate": true, "set": true, "animatemotion": true, "animatetransform": true, "animatecolor": true}
+
+// svgURLAttrs — атрибуты, значение которых браузер может открыть как ссылку; to/from/values/by — у анимаций.
+var svgURLAttrs = map[string]bool{"href": true, "src": true, "action": true, "formaction": true, "to": true, "from": true, "values": true, "by": true}
+
+// isScriptURL — ссылка исполняет код: javascript:, vbscript:, data:text/html (пробелы внутри игнорируются,
+// как это делает браузер). values анимации — список через ";", проверяется каждый элемент.
+func isScriptURL(value string) bool {
+	for _, part := range strings.Split(value, ";") {
+		v := strings.ToLower(strings.Join(strings.FieldsFunc(part, unicode.IsSpace), ""))
+		if strings.HasPrefix(v, "javascript:") || strings.HasPrefix(v, "vbscript:") || strings.HasPrefix(v, "data:text/html") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSVG разбирает SVG и отклоняет активное содержимое: <script>, <foreignObject> (встраивает HTML),
+// обработчики on*, ссылки javascript:/data:text/html (в том числе выставляемые анимацией <set>/<animate>),
+// анимацию обработчиков и ссылок, а также DOCTYPE с сущностями.
+func checkSVG(data []byte) error {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	sawSVG := false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("invalid xml")
+		}
+		switch t := tok.(type) {
+		case xml.Directive:
+			if bytes.Contains(bytes.ToUpper(t), []byte("ENTITY")) {
+				return fmt.Errorf("entities are not allowed")
+			}
+		case xml.StartElement:
+			name := strings.ToLower(t.Name.Local)
+			if !sawSVG {
+				if name != "svg" {
+					return fmt.Errorf("root element is not svg")
+				}
+				sawSVG = true
+			}
+			if name == "script" || name == "foreignobject" || name == "iframe" || name == "embed" || name == "object" {
+				return fmt.Errorf("element <%s> is not allowed", t.Name.Local)
+			}
+			for _, a := range t.Attr {
+				attr := strings.ToLower(a.Name.Local)
+				if strings.HasPrefix(attr, "on") {
+					return fmt.Errorf("event handler %s is not allowed", a.Name.Local)
+				}
+				if svgURLAttrs[attr] && isScriptURL(a.Value) {
+					return fmt.Errorf("script link is not allowed")
+				}
+				if svgAnimationElems[name] && attr == "attributename" {
+					target := strings.ToLower(strings.TrimSpace(a.Value))
+					if i := strings.LastIndex(target, ":"); i >= 0 {
+						target = target[i+1:]
+					}
+					if strings.HasPrefix(target, "on") || target == "href" {
+						return fmt.Errorf("animating %s is not allowed", a.Value)
+					}
+				}
+			}
+		}
+	}
+	if !sawSVG {
+		return fmt.Errorf("no svg element")
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package fileserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/messenger/internal/blobstore"
+)
+
+func TestCheckSVG(t *testing.T) {
+	cases := []struct {
+		name string
+		svg  string
+		ok   bool
+	}{
+		{"plain", `<svg xmlns="http://www.w3.org/2000/svg"><circle r="5"/></svg>`, true},
+		{"link", `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink"><a xlink:href="https://example.com"><text>x</text></a></svg>`, true},
+		{"color animation", `<svg><rect><animate attributeName="fill" values="red;blue" dur="1s"/></rect></svg>`, true},
+		{"script", `<svg><script>alert(1)</script></svg>`, false},
+		{"onload", `<svg onload="alert(1)"/>`, false},
+		{"foreignObject", `<svg><foreignObject><body/></foreignObject></svg>`, false},
+		{"javascript href", `<svg><a href="javascript:alert(1)"><text>x</text></a></svg>`, false},
+		{"javascript href with whitespace", `<svg><a href=" java&#x09;script:alert(1)"><text>x</text></a></svg>`, false},
+		{"set href", `<svg><a><set attributeName="href" to="javascript:alert(1)"/><text>x</text></a></svg>`, false},
+		{"set xlink:href", `<svg><a><set attributeName="xlink:href" to="https://example.com"/><text>x</text></a></svg>`, false},
+		{"animate href values", `<svg><a><animate attributeName="href" values="https://example.com;javascript:alert(1)"/><text>x</text></a></svg>`, false},
+		{"animate to javascript", `<svg><a><animate attributeName="x" to="javascript:alert(1)"/></a></svg>`, false},
+		{"animate event handler", `<svg><rect><set attributeName="onclick" to="alert(1)"/></rect></svg>`, false},
+		{"entity", `<!DOCTYPE svg [<!ENTITY x "y">]><svg>&x;</svg>`, false},
+		{"not svg", `<html><body/></html>`, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkSVG([]byte(tc.svg))
+			if tc.ok && err != nil {
+				t.Errorf("rejected: %v", err)
+			}
+			if !tc.ok && err == nil {
+				t.Error("accepted")
+			}
+		})
+	}
+}
+
+func TestServeForcesAttachment(t *testing.T) {
+	store := blobstore.NewLocal(t.TempDir())
+	ctx := context.Background()
+	for _, name := range []string{"a.svg", "a.png"} {
+		if err := store.Put(ctx, name, strings.NewReader(`<svg xmlns="http://www.w3.org/2000/svg"/>`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := New(store, false, 0)
+	cases := []struct {
+		file, query, wantDisp string
+		wantCSP               bool
+	}{
+		{"a.svg", "", "attachment", true},
+		{"a.svg", "?disposition=inline", "attachment", true},
+		{"a.svg", "?name=pic.svg&disposition=inline", `attachment; filename="pic.svg"; filename*=UTF-8''pic.svg`, true},
+		{"a.png", "", "", false},
+		{"a.png", "?disposition=inline", "inline", false},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		s.Serve(rec, httptest.NewRequest(http.MethodGet, "/files/"+tc.file+tc.query, nil), tc.file)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s%s: status %d", tc.file, tc.query, rec.Code)
+		}
+		if got := rec.Header().Get("Content-Disposition"); got != tc.wantDisp {
+			t.Errorf("%s%s: Content-Disposition = %q, want %q", tc.file, tc.query, got, tc.wantDisp)
+		}
+		if got := rec.Header().Get("Content-Security-Policy") != ""; got != tc.wantCSP {
+			t.Errorf("%s%s: CSP set = %v, want %v", tc.file, tc.query, got, tc.wantCSP)
+		}
+	}
+}
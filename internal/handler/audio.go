@@ -89,6 +89,7 @@ func (h *AudioHandler) Serve(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, "internal error")
 		return
 	}
+	copyFileRequestHeaders(proxyReq.Header, r.Header)
 	resp, err := h.audioClient.Do(proxyReq)
 	if err != nil {
 		logger.Errorf("audio serve proxy: request failed: %v", err)
@@ -98,7 +99,7 @@ func (h *AudioHandler) Serve(w http.ResponseWriter, r *http.Request) {
 	defer resp.Body.Close()
 	for k, v := range resp.Header {
 		if strings.EqualFold(k, "Content-Length") || strings.EqualFold(k, "Content-Type") ||
-			strings.EqualFold(k, "Content-Disposition") {
+			strings.EqualFold(k, "Content-Disposition") || isFileResponseHeader(k) {
 			w.Header()[k] = v
 		}
 	}
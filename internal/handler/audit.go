@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/messenger/internal/logger"
+	"github.com/messenger/internal/middleware"
+	"github.com/messenger/internal/model"
+	"github.com/messenger/internal/repository"
+)
+
+type AuditHandler struct {
+	repo     *repository.AuditRepository
+	permRepo *repository.PermissionRepository
+}
+
+func NewAuditHandler(repo *repository.AuditRepository, permRepo *repository.PermissionRepository) *AuditHandler {
+	return &AuditHandler{repo: repo, permRepo: permRepo}
+}
+
+// List отдаёт журнал действий администраторов, новые записи первыми, всегда в конверте Page с total.
+// Фильтры: ?actor_id=, ?action=, ?target_id=, ?from= и ?to= (RFC 3339); следующая страница —
+// ?cursor=<next_cursor>. Только для администраторов.
+func (h *AuditHandler) List(w http.ResponseWriter, r *http.Request) {
+	perm, err := h.permRepo.GetByUserID(r.Context(), middleware.GetUserID(r.Context()))
+	if err != nil || !perm.Administrator {
+		writeError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+	q := r.URL.Query()
+	f := repository.AuditFilter{ActorID: q.Get("actor_id"), Action: q.Get("action"), TargetID: q.Get("target_id")}
+	for _, id := range []string{f.ActorID, f.TargetID} {
+		if id != "" && uuid.Validate(id) != nil {
+			writeError(w, http.StatusBadRequest, "invalid user id")
+			return
+		}
+	}
+	for key, dst := range map[string]*time.Time{"from": &f.From, "to": &f.To} {
+		if v := q.Get(key); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "invalid "+key)
+				return
+			}
+			*dst = t
+		}
+	}
+	if v := q.Get("cursor"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid cursor")
+			return
+		}
+		f.BeforeID = id
+	}
+	limit, _ := pageParams(r, 50, 200)
+
+	list, err := h.repo.List(r.Context(), f, limit+1)
+	if err != nil {
+		logger.Errorf("audit log list: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to load audit log")
+		return
+	}
+	total, err := h.repo.Count(r.Context(), f)
+	if err != nil {
+		logger.Errorf("audit log count: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to load audit log")
+		return
+	}
+	page := Page[model.AuditEntry]{Items: list, Total: &total}
+	if len(list) > limit {
+		page.Items = list[:limit]
+		page.HasMore = true
+		page.NextCursor = strconv.FormatInt(page.Items[limit-1].ID, 10)
+	}
+	if page.Items == nil {
+		page.Items = []model.AuditEntry{}
+	}
+	writeJSON(w, http.StatusOK, page)
+}
@@ -1,17 +1,22 @@
 package handler
 
 import (
-	"encoding/json"
 	"errors"
+	"net"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/messenger/internal/logger"
 	"github.com/messenger/internal/middleware"
 	"github.com/messenger/internal/service"
+	"github.com/messenger/internal/storage"
 )
 
+// errDomainNotAllowedMsg не говорит, существует ли адрес: отказ зависит только от домена.
+const errDomainNotAllowedMsg = "Вход с адресов этого домена не разрешён"
+
 type AuthHandler struct {
 	otpSvc *service.OTPAuthService
 }
@@ -26,14 +31,15 @@ func (h *AuthHandler) RequestCode(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	var req service.RequestCodeRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid request body")
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err, "invalid request body")
 		return
 	}
 	if req.Email == "" {
 		writeError(w, http.StatusBadRequest, "email обязателен")
 		return
 	}
+	req.IP = remoteIP(r)
 	err := h.otpSvc.RequestCode(r.Context(), req)
 	if err != nil {
 		if errors.Is(err, service.ErrRateLimitExceeded) {
@@ -44,6 +50,13 @@ func (h *AuthHandler) RequestCode(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusBadRequest, "Неверный формат email")
 			return
 		}
+		if errors.Is(err, service.ErrDomainNotAllowed) {
+			writeError(w, http.StatusForbidden, errDomainNotAllowedMsg)
+			return
+		}
+		if writeUnavailable(w, err) {
+			return
+		}
 		logger.Errorf("request-code send failed for %s: %v", req.Email, err)
 		writeError(w, http.StatusInternalServerError, "Не удалось отправить код")
 		return
@@ -57,12 +70,17 @@ func (h *AuthHandler) VerifyCode(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	var req service.VerifyCodeRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid request body")
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err, "invalid request body")
 		return
 	}
+	req.IP = remoteIP(r)
 	resp, err := h.otpSvc.VerifyCode(r.Context(), req)
 	if err != nil {
+		if errors.Is(err, service.ErrRateLimitExceeded) {
+			writeError(w, http.StatusTooManyRequests, "Слишком много попыток. Попробуйте позже.")
+			return
+		}
 		if errors.Is(err, service.ErrInvalidOTP) {
 			writeError(w, http.StatusUnauthorized, "Неверный или истёкший код")
 			return
@@ -71,6 +89,21 @@ func (h *AuthHandler) VerifyCode(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusForbidden, "Пользователь отключён и не может войти")
 			return
 		}
+		if errors.Is(err, service.ErrDomainNotAllowed) {
+			writeError(w, http.StatusForbidden, errDomainNotAllowedMsg)
+			return
+		}
+		if errors.Is(err, service.ErrSessionLimit) {
+			writeError(w, http.StatusConflict, "Достигнут лимит устройств. Завершите сеанс на одном из них.")
+			return
+		}
+		if errors.Is(err, service.ErrNotProvisioned) {
+			writeError(w, http.StatusForbidden, "Учётная запись не создана. Обратитесь к администратору.")
+			return
+		}
+		if writeUnavailable(w, err) {
+			return
+		}
 		logger.Errorf("verify-code error email=%s device_id=%s: %v", req.Email, req.DeviceID, err)
 		msg := "Ошибка верификации"
 		if os.Getenv("APP_ENV") != "production" && os.Getenv("DEBUG") != "" {
@@ -82,6 +115,37 @@ func (h *AuthHandler) VerifyCode(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, resp)
 }
 
+// DevLastCode — GET /api/auth/dev/last-code?email=: текущий код из хранилища, чтобы пройти вход без SMTP.
+// Подключается только при DEV_OTP_ENDPOINT=true вне production; в production отвечает 404, даже если подключён.
+func (h *AuthHandler) DevLastCode(w http.ResponseWriter, r *http.Request) {
+	if os.Getenv("APP_ENV") == "production" || h.otpSvc == nil {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	email := strings.TrimSpace(r.URL.Query().Get("email"))
+	if email == "" {
+		writeError(w, http.StatusBadRequest, "email обязателен")
+		return
+	}
+	code, err := h.otpSvc.DevLastCode(r.Context(), email)
+	if writeUnavailable(w, err) {
+		return
+	}
+	if err != nil || code == "" {
+		writeError(w, http.StatusNotFound, "code not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"code": code})
+}
+
+// remoteIP — адрес клиента без порта (RemoteAddr уже подменён middleware.RealIP по X-Real-Ip от прокси).
+func remoteIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
 func (h *AuthHandler) GetSessions(w http.ResponseWriter, r *http.Request) {
 	if h.otpSvc == nil {
 		writeError(w, http.StatusNotImplemented, "auth service unavailable")
@@ -113,6 +177,9 @@ func (h *AuthHandler) LogoutSession(w http.ResponseWriter, r *http.Request) {
 	}
 	ok, err := h.otpSvc.LogoutSession(r.Context(), userID, sessionID)
 	if err != nil {
+		if writeUnavailable(w, err) {
+			return
+		}
 		writeError(w, http.StatusInternalServerError, "Ошибка выхода")
 		return
 	}
@@ -135,12 +202,79 @@ func (h *AuthHandler) LogoutAllSessions(w http.ResponseWriter, r *http.Request)
 	}
 	_, err := h.otpSvc.LogoutAllSessions(r.Context(), userID)
 	if err != nil {
+		if writeUnavailable(w, err) {
+			return
+		}
 		writeError(w, http.StatusInternalServerError, "Ошибка выхода")
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 }
 
+// LogoutOtherSessions завершает все сессии пользователя, кроме той, с которой пришёл запрос.
+func (h *AuthHandler) LogoutOtherSessions(w http.ResponseWriter, r *http.Request) {
+	if h.otpSvc == nil {
+		writeError(w, http.StatusNotImplemented, "auth service unavailable")
+		return
+	}
+	userID := middleware.GetUserID(r.Context())
+	sessionID := middleware.GetSessionID(r.Context())
+	if userID == "" || sessionID == "" {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	n, err := h.otpSvc.LogoutOtherSessions(r.Context(), userID, sessionID)
+	if err != nil {
+		if writeUnavailable(w, err) {
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Ошибка выхода")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"status": "ok", "revoked": n})
+}
+
+// RotateSession выдаёт текущей сессии новый session_secret. Старый действует ещё пару минут.
+func (h *AuthHandler) RotateSession(w http.ResponseWriter, r *http.Request) {
+	if h.otpSvc == nil {
+		writeError(w, http.StatusNotImplemented, "auth service unavailable")
+		return
+	}
+	userID := middleware.GetUserID(r.Context())
+	sessionID := middleware.GetSessionID(r.Context())
+	if userID == "" || sessionID == "" {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	resp, err := h.otpSvc.RotateSessionSecret(r.Context(), userID, sessionID)
+	if err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) {
+			writeError(w, http.StatusNotFound, "Сессия не найдена")
+			return
+		}
+		if writeUnavailable(w, err) {
+			return
+		}
+		logger.Errorf("rotate session session_id=%s: %v", middleware.MaskSessionID(sessionID), err)
+		writeError(w, http.StatusInternalServerError, "Ошибка обновления сессии")
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// ServerTimeResponse — время сервера для расчёта сдвига часов клиента (X-Timestamp проверяется в окне ±30 с).
+type ServerTimeResponse struct {
+	Unix   int64 `json:"unix"`
+	UnixMs int64 `json:"unix_ms"`
+}
+
+// ServerTime отдаёт текущее время сервера; без авторизации.
+func ServerTime(w http.ResponseWriter, _ *http.Request) {
+	now := time.Now()
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, ServerTimeResponse{Unix: now.Unix(), UnixMs: now.UnixMilli()})
+}
+
 type ValidateRequest struct {
 	SessionID string `json:"session_id"`
 	Timestamp string `json:"timestamp"`
@@ -157,11 +291,18 @@ type ValidateResponse struct {
 func ValidateSession(otpSvc *service.OTPAuthService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req ValidateRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			writeError(w, http.StatusBadRequest, "invalid request body")
+		if err := decodeJSON(r, &req); err != nil {
+			writeDecodeError(w, err, "invalid request body")
 			return
 		}
 		userID, err := otpSvc.ValidateRequest(r.Context(), req.SessionID, req.Timestamp, req.Signature, req.Method, req.Path, req.Body)
+		if writeUnavailable(w, err) {
+			return
+		}
+		if errors.Is(err, service.ErrTimestampSkew) {
+			middleware.WriteClockSkew(w)
+			return
+		}
 		if err != nil {
 			writeError(w, http.StatusUnauthorized, "unauthorized")
 			return
@@ -169,3 +310,14 @@ func ValidateSession(otpSvc *service.OTPAuthService) http.HandlerFunc {
 		writeJSON(w, http.StatusOK, ValidateResponse{UserID: userID})
 	}
 }
+
+// writeUnavailable отвечает 503, если err — недоступность хранилища OTP/сессий (Redis),
+// вместо 500 с внутренней ошибкой. Возвращает true, если ответ записан.
+func writeUnavailable(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, storage.ErrUnavailable) {
+		return false
+	}
+	w.Header().Set("Retry-After", "5")
+	writeError(w, http.StatusServiceUnavailable, "Сервис временно недоступен, попробуйте позже")
+	return true
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/messenger/internal/logger"
+	"github.com/messenger/internal/middleware"
+	"github.com/messenger/internal/repository"
+	"github.com/messenger/internal/service"
+)
+
+type AuthActivityHandler struct {
+	repo     *repository.AuthActivityRepository
+	permRepo *repository.PermissionRepository
+	// hashKey — секрет хеша email (AUTH_ACTIVITY_HASH_KEY), тот же, что у сервиса auth.
+	hashKey []byte
+}
+
+func NewAuthActivityHandler(repo *repository.AuthActivityRepository, permRepo *repository.PermissionRepository, hashKey []byte) *AuthActivityHandler {
+	return &AuthActivityHandler{repo: repo, permRepo: permRepo, hashKey: hashKey}
+}
+
+// List отдаёт последние попытки входа по коду для ?email= (поиск по хешу адреса). Только для администраторов.
+func (h *AuthActivityHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	perm, err := h.permRepo.GetByUserID(r.Context(), userID)
+	if err != nil || !perm.Administrator {
+		writeError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+	email := strings.TrimSpace(r.URL.Query().Get("email"))
+	if email == "" {
+		writeError(w, http.StatusBadRequest, "email required")
+		return
+	}
+	if len(h.hashKey) == 0 {
+		writeError(w, http.StatusServiceUnavailable, "auth activity log is not configured")
+		return
+	}
+	limit, _ := pageParams(r, 50, 200)
+	list, err := h.repo.ListByEmailHash(r.Context(), service.EmailHash(h.hashKey, email), limit)
+	if err != nil {
+		logger.Errorf("auth activity list: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to load auth activity")
+		return
+	}
+	writeList(w, r, list)
+}
@@ -0,0 +1,230 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/messenger/internal/logger"
+	"github.com/messenger/internal/middleware"
+	"github.com/messenger/internal/model"
+	"github.com/messenger/internal/repository"
+)
+
+// botKeyPrefix — начало всех API-ключей ботов (удобно искать утёкшие ключи в логах и репозиториях).
+const botKeyPrefix = "mbot_"
+
+// BotHandler — служебные учётные записи и их API-ключи. Все методы требуют право manage_bots.
+type BotHandler struct {
+	userRepo *repository.UserRepository
+	botRepo  *repository.BotRepository
+	permRepo *repository.PermissionRepository
+	audit    *repository.AuditRepository
+}
+
+func NewBotHandler(userRepo *repository.UserRepository, botRepo *repository.BotRepository, permRepo *repository.PermissionRepository, audit *repository.AuditRepository) *BotHandler {
+	return &BotHandler{userRepo: userRepo, botRepo: botRepo, permRepo: permRepo, audit: audit}
+}
+
+type CreateBotRequest struct {
+	Username  string `json:"username"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+type CreateBotKeyRequest struct {
+	Name string `json:"name"`
+}
+
+// CreateBotKeyResponse — ключ целиком отдаётся только здесь; в БД хранится его хеш.
+type CreateBotKeyResponse struct {
+	Key    string          `json:"key"`
+	APIKey model.BotAPIKey `json:"api_key"`
+}
+
+// canManage проверяет право manage_bots; иначе отвечает 403.
+func (h *BotHandler) canManage(w http.ResponseWriter, r *http.Request) bool {
+	perm, err := h.permRepo.GetByUserID(r.Context(), middleware.GetUserID(r.Context()))
+	if err != nil || !perm.ManageBots {
+		writeError(w, http.StatusForbidden, "forbidden")
+		return false
+	}
+	return true
+}
+
+// Create заводит бота: пользователя без входа по коду (адрес в зарезервированном домене .invalid).
+func (h *BotHandler) Create(w http.ResponseWriter, r *http.Request) {
+	if !h.canManage(w, r) {
+		return
+	}
+	var req CreateBotRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err, "invalid body")
+		return
+	}
+	username := strings.TrimSpace(req.Username)
+	if username == "" {
+		writeValidationErrors(w, []FieldError{{Field: "username", Code: codeRequired, Message: "username required"}})
+		return
+	}
+	now := time.Now().UTC()
+	id := uuid.New().String()
+	u := &model.User{
+		ID:         id,
+		Username:   username,
+		Email:      id + "@bots.invalid",
+		AvatarURL:  strings.TrimSpace(req.AvatarURL),
+		LastSeenAt: now,
+		CreatedAt:  now,
+	}
+	err := h.botRepo.WithTx(r.Context(), func(ctx context.Context) error {
+		if err := h.userRepo.Create(ctx, u); err != nil {
+			return err
+		}
+		return h.botRepo.MarkBot(ctx, u.ID, middleware.GetUserID(ctx))
+	})
+	if err != nil {
+		if writeProfileConflict(w, err) {
+			return
+		}
+		logger.Errorf("create bot: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to create bot")
+		return
+	}
+	createdBy := middleware.GetUserID(r.Context())
+	writeJSON(w, http.StatusCreated, model.Bot{User: u.ToPublic(), CreatedBy: &createdBy, CreatedAt: now})
+}
+
+func (h *BotHandler) List(w http.ResponseWriter, r *http.Request) {
+	if !h.canManage(w, r) {
+		return
+	}
+	bots, err := h.botRepo.List(r.Context())
+	if err != nil {
+		logger.Errorf("list bots: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to list bots")
+		return
+	}
+	writeList(w, r, bots)
+}
+
+// requireBot проверяет, что {id} — бот; иначе отвечает 404. Ключи выдаются только ботам, чтобы право
+// manage_bots не давало входа от имени обычных пользователей.
+func (h *BotHandler) requireBot(w http.ResponseWriter, r *http.Request) (string, bool) {
+	botID := chi.URLParam(r, "id")
+	if uuid.Validate(botID) != nil {
+		writeError(w, http.StatusNotFound, "bot not found")
+		return "", false
+	}
+	ok, err := h.botRepo.IsBot(r.Context(), botID)
+	if err != nil {
+		logger.Errorf("check bot %s: %v", botID, err)
+		writeError(w, http.StatusInternalServerError, "failed to check bot")
+		return "", false
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "bot not found")
+		return "", false
+	}
+	return botID, true
+}
+
+// CreateKey выпускает API-ключ бота. Ключ возвращается один раз; выпуск записывается в журнал
+// администраторов той же транзакцией.
+func (h *BotHandler) CreateKey(w http.ResponseWriter, r *http.Request) {
+	if !h.canManage(w, r) {
+		return
+	}
+	botID, ok := h.requireBot(w, r)
+	if !ok {
+		return
+	}
+	var req CreateBotKeyRequest
+	if r.ContentLength != 0 {
+		if err := decodeJSON(r, &req); err != nil {
+			writeDecodeError(w, err, "invalid body")
+			return
+		}
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to generate key")
+		return
+	}
+	key := botKeyPrefix + base64.RawURLEncoding.EncodeToString(raw)
+	createdBy := middleware.GetUserID(r.Context())
+	k := model.BotAPIKey{
+		ID:        uuid.New().String(),
+		UserID:    botID,
+		Name:      strings.TrimSpace(req.Name),
+		Prefix:    key[:len(botKeyPrefix)+6],
+		CreatedBy: &createdBy,
+		CreatedAt: time.Now().UTC(),
+	}
+	err := h.botRepo.WithTx(r.Context(), func(ctx context.Context) error {
+		if err := h.botRepo.CreateKey(ctx, &k, repository.HashBotKey(key)); err != nil {
+			return err
+		}
+		return h.audit.Record(ctx, createdBy, repository.AuditBotKeyCreate, botID, map[string]any{
+			"key_id": k.ID, "key_prefix": k.Prefix, "name": k.Name,
+		})
+	})
+	if err != nil {
+		logger.Errorf("create bot key bot=%s: %v", botID, err)
+		writeError(w, http.StatusInternalServerError, "failed to create key")
+		return
+	}
+	writeJSON(w, http.StatusCreated, CreateBotKeyResponse{Key: key, APIKey: k})
+}
+
+func (h *BotHandler) ListKeys(w http.ResponseWriter, r *http.Request) {
+	if !h.canManage(w, r) {
+		return
+	}
+	botID, ok := h.requireBot(w, r)
+	if !ok {
+		return
+	}
+	keys, err := h.botRepo.ListKeys(r.Context(), botID)
+	if err != nil {
+		logger.Errorf("list bot keys bot=%s: %v", botID, err)
+		writeError(w, http.StatusInternalServerError, "failed to list keys")
+		return
+	}
+	writeList(w, r, keys)
+}
+
+// RevokeKey отзывает ключ: следующие запросы с ним получают 401. Отзыв записывается в журнал администраторов.
+func (h *BotHandler) RevokeKey(w http.ResponseWriter, r *http.Request) {
+	if !h.canManage(w, r) {
+		return
+	}
+	botID, keyID := chi.URLParam(r, "id"), chi.URLParam(r, "keyId")
+	if uuid.Validate(botID) != nil || uuid.Validate(keyID) != nil {
+		writeError(w, http.StatusNotFound, "key not found")
+		return
+	}
+	err := h.botRepo.WithTx(r.Context(), func(ctx context.Context) error {
+		if err := h.botRepo.RevokeKey(ctx, botID, keyID); err != nil {
+			return err
+		}
+		return h.audit.Record(ctx, middleware.GetUserID(ctx), repository.AuditBotKeyRevoke, botID, map[string]any{
+			"key_id": keyID,
+		})
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "key not found")
+		return
+	}
+	if err != nil {
+		logger.Errorf("revoke bot key bot=%s: %v", botID, err)
+		writeError(w, http.StatusInternalServerError, "failed to revoke key")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/messenger/internal/middleware"
+	"github.com/messenger/internal/model"
+	"github.com/messenger/internal/repository"
+)
+
+// CallStatsHandler принимает отчёты о качестве звонков и отдаёт агрегат администратору.
+type CallStatsHandler struct {
+	statsRepo *repository.CallStatsRepository
+	permRepo  *repository.PermissionRepository
+}
+
+func NewCallStatsHandler(statsRepo *repository.CallStatsRepository, permRepo *repository.PermissionRepository) *CallStatsHandler {
+	return &CallStatsHandler{statsRepo: statsRepo, permRepo: permRepo}
+}
+
+type callStatsRequest struct {
+	// PeerID и DurationSec принимаются для совместимости со старыми клиентами, но не используются:
+	// собеседник и длительность берутся из данных сигнализации.
+	PeerID         string  `json:"peer_id"`
+	DurationSec    int     `json:"duration_sec"`
+	AvgBitrateKbps int     `json:"avg_bitrate_kbps"`
+	PacketLossPct  float64 `json:"packet_loss_pct"`
+	JitterMs       float64 `json:"jitter_ms"`
+	EndReason      string  `json:"end_reason"`
+}
+
+// ReportStats сохраняет сводку WebRTC-статистики звонка от текущего пользователя.
+// Звонок должен быть известен по сигнализации call-сервиса (RecordCall), а отправитель — его участником;
+// собеседник и длительность разговора берутся оттуда, от клиента — только метрики качества.
+func (h *CallStatsHandler) ReportStats(w http.ResponseWriter, r *http.Request) {
+	callID := chi.URLParam(r, "callId")
+	if _, err := uuid.Parse(callID); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid call id")
+		return
+	}
+	userID := middleware.GetUserID(r.Context())
+
+	var req callStatsRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err, "invalid body")
+		return
+	}
+	if req.AvgBitrateKbps < 0 || req.PacketLossPct < 0 || req.PacketLossPct > 100 || req.JitterMs < 0 {
+		writeError(w, http.StatusBadRequest, "stats out of range")
+		return
+	}
+	if len(req.EndReason) > 32 {
+		writeError(w, http.StatusBadRequest, "end_reason too long")
+		return
+	}
+
+	call, err := h.statsRepo.GetCall(r.Context(), callID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "call not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to get call")
+		return
+	}
+	peerID := call.Peer(userID)
+	if peerID == "" {
+		writeError(w, http.StatusForbidden, "not a call participant")
+		return
+	}
+
+	now := time.Now().UTC()
+	stats := &model.CallStats{
+		CallID:         callID,
+		UserID:         userID,
+		PeerID:         peerID,
+		DurationSec:    call.DurationSec(now),
+		AvgBitrateKbps: req.AvgBitrateKbps,
+		PacketLossPct:  req.PacketLossPct,
+		JitterMs:       req.JitterMs,
+		EndReason:      req.EndReason,
+		CreatedAt:      now,
+	}
+	if err := h.statsRepo.Upsert(r.Context(), stats); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to save call stats")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// RecordCall принимает от call-сервиса состояние звонка: начало, принятие, завершение (POST /internal/calls).
+func (h *CallStatsHandler) RecordCall(w http.ResponseWriter, r *http.Request) {
+	var c model.CallRecord
+	if err := decodeJSON(r, &c); err != nil {
+		writeDecodeError(w, err, "invalid body")
+		return
+	}
+	if uuid.Validate(c.ID) != nil || uuid.Validate(c.CallerID) != nil || uuid.Validate(c.CalleeID) != nil {
+		writeError(w, http.StatusBadRequest, "invalid call")
+		return
+	}
+	if c.CreatedAt.IsZero() {
+		c.CreatedAt = time.Now().UTC()
+	}
+	if err := h.statsRepo.UpsertCall(r.Context(), &c); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to save call")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// GetSummary возвращает агрегат по отчётам за последние days дней (по умолчанию 7). Только для администратора.
+func (h *CallStatsHandler) GetSummary(w http.ResponseWriter, r *http.Request) {
+	perm, err := h.permRepo.GetByUserID(r.Context(), middleware.GetUserID(r.Context()))
+	if err != nil || !perm.Administrator {
+		writeError(w, http.StatusForbidden, "only administrator can view call stats")
+		return
+	}
+	days := queryInt(r, "days", 7)
+	if days < 1 || days > 365 {
+		days = 7
+	}
+	summary, err := h.statsRepo.Summary(r.Context(), time.Now().UTC().AddDate(0, 0, -days))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get call stats")
+		return
+	}
+	writeJSON(w, http.StatusOK, summary)
+}
@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/messenger/internal/logger"
+	"github.com/messenger/internal/middleware"
+	"github.com/messenger/internal/model"
+	"github.com/messenger/internal/repository"
+	"github.com/messenger/internal/ws"
+)
+
+// roleSubscriber — участник канала: читает и ставит реакции, но не пишет.
+const roleSubscriber = "subscriber"
+
+// CreateChannelRequest — создание канала; SubscriberIDs добавляются подписчиками.
+type CreateChannelRequest struct {
+	Name          string   `json:"name"`
+	Description   string   `json:"description"`
+	SubscriberIDs []string `json:"subscriber_ids"`
+}
+
+// newInviteToken — случайный токен ссылки-приглашения (128 бит, base64url).
+func newInviteToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CreateChannel создаёт канал: создатель — администратор, писать могут только администраторы.
+func (h *ChatHandler) CreateChannel(w http.ResponseWriter, r *http.Request) {
+	var req CreateChannelRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err, "invalid body")
+		return
+	}
+	if req.Name == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+
+	currentUserID := middleware.GetUserID(r.Context())
+	now := time.Now().UTC()
+	chat := &model.Chat{
+		ID:          uuid.New().String(),
+		ChatType:    model.ChatTypeChannel,
+		Name:        req.Name,
+		Description: req.Description,
+		CreatedBy:   currentUserID,
+		CreatedAt:   now,
+		PinPolicy:   model.PinPolicyAdmins,
+		SendPolicy:  model.SendPolicyAdmins,
+	}
+	if err := h.chatRepo.Create(r.Context(), chat); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to create channel")
+		return
+	}
+	if err := h.chatRepo.AddMember(r.Context(), &model.ChatMember{ChatID: chat.ID, UserID: currentUserID, Role: "admin", JoinedAt: now}); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to add admin member")
+		return
+	}
+	for _, uid := range req.SubscriberIDs {
+		if uid == currentUserID {
+			continue
+		}
+		if err := h.chatRepo.AddMember(r.Context(), &model.ChatMember{ChatID: chat.ID, UserID: uid, Role: roleSubscriber, JoinedAt: now}); err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to add subscriber")
+			return
+		}
+	}
+
+	enriched, err := h.enrichChat(r.Context(), chat, currentUserID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to enrich chat")
+		return
+	}
+	h.hub.BroadcastToChat(r.Context(), chat.ID, ws.OutgoingMessage{Type: ws.EventChatCreated, Payload: enriched})
+	writeJSON(w, http.StatusCreated, enriched)
+}
+
+// channelAdmin проверяет, что chatID — канал, а userID — его администратор; иначе пишет ошибку и возвращает false.
+func (h *ChatHandler) channelAdmin(w http.ResponseWriter, r *http.Request, chatID, userID string) bool {
+	chat, err := h.chatRepo.GetByID(r.Context(), chatID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "chat not found")
+		return false
+	}
+	if chat.ChatType != model.ChatTypeChannel {
+		writeError(w, http.StatusBadRequest, "invite links are available only for channels")
+		return false
+	}
+	role, err := h.chatRepo.GetMemberRole(r.Context(), chatID, userID)
+	if err != nil || role != "admin" {
+		writeError(w, http.StatusForbidden, "only admin can manage invite link")
+		return false
+	}
+	return true
+}
+
+// GetInviteLink возвращает токен ссылки-приглашения канала (создаёт при первом запросе). Только администратор.
+func (h *ChatHandler) GetInviteLink(w http.ResponseWriter, r *http.Request) {
+	chatID := chi.URLParam(r, "id")
+	if !h.channelAdmin(w, r, chatID, middleware.GetUserID(r.Context())) {
+		return
+	}
+	token, err := newInviteToken()
+	if err == nil {
+		token, err = h.chatRepo.InviteToken(r.Context(), chatID, token)
+	}
+	if err != nil {
+		logger.Errorf("invite link chat=%s: %v", chatID, err)
+		writeError(w, http.StatusInternalServerError, "failed to get invite link")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"invite_token": token})
+}
+
+// ResetInviteLink выдаёт новый токен приглашения; прежняя ссылка перестаёт работать. Только администратор.
+func (h *ChatHandler) ResetInviteLink(w http.ResponseWriter, r *http.Request) {
+	chatID := chi.URLParam(r, "id")
+	if !h.channelAdmin(w, r, chatID, middleware.GetUserID(r.Context())) {
+		return
+	}
+	token, err := newInviteToken()
+	if err == nil {
+		err = h.chatRepo.SetInviteToken(r.Context(), chatID, token)
+	}
+	if err != nil {
+		logger.Errorf("reset invite link chat=%s: %v", chatID, err)
+		writeError(w, http.StatusInternalServerError, "failed to reset invite link")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"invite_token": token})
+}
+
+// JoinByInvite подписывает текущего пользователя на канал по токену приглашения.
+func (h *ChatHandler) JoinByInvite(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+	userID := middleware.GetUserID(r.Context())
+	chatID, err := h.chatRepo.FindByInviteToken(r.Context(), token)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "invite link is invalid or expired")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to join channel")
+		return
+	}
+	chat, err := h.chatRepo.GetByID(r.Context(), chatID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to join channel")
+		return
+	}
+	isMember, err := h.chatRepo.IsMember(r.Context(), chatID, userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to check membership")
+		return
+	}
+	if !isMember {
+		if err := h.chatRepo.AddMember(r.Context(), &model.ChatMember{ChatID: chatID, UserID: userID, Role: roleSubscriber, JoinedAt: time.Now().UTC()}); err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to join channel")
+			return
+		}
+		username := ""
+		if u, _ := h.userRepo.GetByID(r.Context(), userID); u != nil {
+			username = u.Username
+		}
+		h.hub.BroadcastToChat(r.Context(), chatID, ws.OutgoingMessage{
+			Type:    ws.EventMemberAdded,
+			Payload: ws.MemberAddedPayload{ChatID: chatID, UserID: userID, Username: username, ActorID: userID, ActorName: username},
+		})
+	}
+	enriched, err := h.enrichChat(r.Context(), chat, userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to enrich chat")
+		return
+	}
+	writeJSON(w, http.StatusOK, enriched)
+}
@@ -2,8 +2,8 @@ package handler
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -13,6 +13,7 @@ import (
 	"github.com/messenger/internal/middleware"
 	"github.com/messenger/internal/model"
 	"github.com/messenger/internal/repository"
+	"github.com/messenger/internal/sysmsg"
 	"github.com/messenger/internal/ws"
 )
 
@@ -20,11 +21,31 @@ type ChatHandler struct {
 	chatRepo *repository.ChatRepository
 	userRepo *repository.UserRepository
 	msgRepo  *repository.MessageRepository
+	permRepo *repository.PermissionRepository
+	audit    *repository.AuditRepository
 	hub      *ws.Hub
+	// unreadIncludeSystem — считать служебные сообщения («X добавил Y») в счётчике непрочитанных.
+	unreadIncludeSystem bool
+	// systemLang — язык, на котором служебные сообщения сохраняются в content.
+	systemLang string
 }
 
-func NewChatHandler(chatRepo *repository.ChatRepository, userRepo *repository.UserRepository, msgRepo *repository.MessageRepository, hub *ws.Hub) *ChatHandler {
-	return &ChatHandler{chatRepo: chatRepo, userRepo: userRepo, msgRepo: msgRepo, hub: hub}
+func NewChatHandler(chatRepo *repository.ChatRepository, userRepo *repository.UserRepository, msgRepo *repository.MessageRepository, permRepo *repository.PermissionRepository, audit *repository.AuditRepository, hub *ws.Hub, unreadIncludeSystem bool, systemLang string) *ChatHandler {
+	return &ChatHandler{chatRepo: chatRepo, userRepo: userRepo, msgRepo: msgRepo, permRepo: permRepo, audit: audit, hub: hub, unreadIncludeSystem: unreadIncludeSystem, systemLang: systemLang}
+}
+
+// systemMessage — служебное сообщение с событием ev; content — текст на языке systemLang.
+func (h *ChatHandler) systemMessage(chatID, senderID string, ev *model.SystemEvent, now time.Time) *model.Message {
+	return &model.Message{
+		ID:          uuid.New().String(),
+		ChatID:      chatID,
+		SenderID:    senderID,
+		Content:     sysmsg.Render(h.systemLang, ev),
+		ContentType: model.ContentTypeSystem,
+		Status:      model.MessageStatusSent,
+		CreatedAt:   now,
+		SystemEvent: ev,
+	}
 }
 
 type CreatePersonalChatRequest struct {
@@ -38,8 +59,8 @@ type CreateGroupChatRequest struct {
 
 func (h *ChatHandler) CreatePersonalChat(w http.ResponseWriter, r *http.Request) {
 	var req CreatePersonalChatRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid body")
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err, "invalid body")
 		return
 	}
 
@@ -106,10 +127,39 @@ func (h *ChatHandler) CreatePersonalChat(w http.ResponseWriter, r *http.Request)
 	writeJSON(w, http.StatusCreated, enriched)
 }
 
+// memberNames проверяет, что пользователи существуют, и возвращает их имена; повторы и skipID отбрасываются.
+// Вызывается до WithTx, чтобы не занимать второе соединение пула при открытой транзакции.
+// repository.ErrNotFound — кого-то из пользователей нет.
+func (h *ChatHandler) memberNames(ctx context.Context, ids []string, skipID string) ([]string, map[string]string, error) {
+	unique := make([]string, 0, len(ids))
+	names := make(map[string]string, len(ids))
+	for _, uid := range ids {
+		if _, ok := names[uid]; ok || uid == skipID {
+			continue
+		}
+		u, err := h.userRepo.GetByID(ctx, uid)
+		if err != nil {
+			return nil, nil, fmt.Errorf("user %s: %w", uid, err)
+		}
+		unique = append(unique, uid)
+		names[uid] = u.Username
+	}
+	return unique, names, nil
+}
+
+// writeMemberNamesError отвечает на ошибку memberNames: несуществующий пользователь — ошибка запроса.
+func writeMemberNamesError(w http.ResponseWriter, err error) {
+	if errors.Is(err, repository.ErrNotFound) {
+		writeError(w, http.StatusBadRequest, "user not found")
+		return
+	}
+	writeError(w, http.StatusInternalServerError, "failed to get users")
+}
+
 func (h *ChatHandler) CreateGroupChat(w http.ResponseWriter, r *http.Request) {
 	var req CreateGroupChatRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid body")
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err, "invalid body")
 		return
 	}
 
@@ -119,6 +169,11 @@ func (h *ChatHandler) CreateGroupChat(w http.ResponseWriter, r *http.Request) {
 	}
 
 	currentUserID := middleware.GetUserID(r.Context())
+	memberIDs, _, err := h.memberNames(r.Context(), req.MemberIDs, currentUserID)
+	if err != nil {
+		writeMemberNamesError(w, err)
+		return
+	}
 	now := time.Now().UTC()
 	chat := &model.Chat{
 		ID:        uuid.New().String(),
@@ -128,36 +183,37 @@ func (h *ChatHandler) CreateGroupChat(w http.ResponseWriter, r *http.Request) {
 		CreatedAt: now,
 	}
 
-	if err := h.chatRepo.Create(r.Context(), chat); err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to create chat")
-		return
-	}
-
-	adminMember := &model.ChatMember{
-		ChatID:   chat.ID,
-		UserID:   currentUserID,
-		Role:     "admin",
-		JoinedAt: now,
-	}
-	if err := h.chatRepo.AddMember(r.Context(), adminMember); err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to add admin member")
-		return
-	}
-
-	for _, uid := range req.MemberIDs {
-		if uid == currentUserID {
-			continue
+	// Чат и участники создаются одной транзакцией: при ошибке не остаётся группы без части участников.
+	err = h.chatRepo.WithTx(r.Context(), func(ctx context.Context) error {
+		if err := h.chatRepo.Create(ctx, chat); err != nil {
+			return err
 		}
-		member := &model.ChatMember{
+		adminMember := &model.ChatMember{
 			ChatID:   chat.ID,
-			UserID:   uid,
-			Role:     "member",
+			UserID:   currentUserID,
+			Role:     "admin",
 			JoinedAt: now,
 		}
-		if err := h.chatRepo.AddMember(r.Context(), member); err != nil {
-			writeError(w, http.StatusInternalServerError, "failed to add member")
-			return
+		if err := h.chatRepo.AddMember(ctx, adminMember); err != nil {
+			return err
 		}
+		for _, uid := range memberIDs {
+			member := &model.ChatMember{
+				ChatID:   chat.ID,
+				UserID:   uid,
+				Role:     "member",
+				JoinedAt: now,
+			}
+			if err := h.chatRepo.AddMember(ctx, member); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Errorf("createGroupChat user=%s: %v", currentUserID, err)
+		writeError(w, http.StatusInternalServerError, "failed to create chat")
+		return
 	}
 
 	enriched, err := h.enrichChat(r.Context(), chat, currentUserID)
@@ -210,7 +266,13 @@ func (h *ChatHandler) GetUserChats(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	writeJSON(w, http.StatusOK, result)
+	pinned, err := h.chatRepo.GetPinnedChatIDs(ctx, userID)
+	if err != nil {
+		logger.Errorf("GetUserChats pinned chats: %v", err)
+	}
+	sortPinnedFirst(result, pinned)
+
+	writeList(w, r, result)
 }
 
 func (h *ChatHandler) GetChat(w http.ResponseWriter, r *http.Request) {
@@ -250,6 +312,12 @@ type UpdateChatRequest struct {
 	Name        string  `json:"name"`
 	Description string  `json:"description"`
 	AvatarURL   *string `json:"avatar_url,omitempty"`
+	// PinPolicy — "everyone" или "admins"; менять может только администратор группы.
+	PinPolicy *model.PinPolicy `json:"pin_policy,omitempty"`
+	// IsSensitive — хранить содержимое сообщений зашифрованным; менять может только администратор группы.
+	IsSensitive *bool `json:"is_sensitive,omitempty"`
+	// SendPolicy — "everyone" или "admins" (канал объявлений); менять может только администратор группы.
+	SendPolicy *model.SendPolicy `json:"send_policy,omitempty"`
 }
 
 func (h *ChatHandler) UpdateChat(w http.ResponseWriter, r *http.Request) {
@@ -257,8 +325,8 @@ func (h *ChatHandler) UpdateChat(w http.ResponseWriter, r *http.Request) {
 	userID := middleware.GetUserID(r.Context())
 
 	var req UpdateChatRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid body")
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err, "invalid body")
 		return
 	}
 
@@ -267,7 +335,7 @@ func (h *ChatHandler) UpdateChat(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusNotFound, "chat not found")
 		return
 	}
-	if chat.ChatType != model.ChatTypeGroup {
+	if chat.ChatType != model.ChatTypeGroup && chat.ChatType != model.ChatTypeChannel {
 		writeError(w, http.StatusBadRequest, "only group chats can be updated")
 		return
 	}
@@ -290,19 +358,83 @@ func (h *ChatHandler) UpdateChat(w http.ResponseWriter, r *http.Request) {
 	if req.AvatarURL != nil {
 		avatarURL = *req.AvatarURL
 	}
+	pinPolicy := chat.PinPolicy
+	if req.PinPolicy != nil && *req.PinPolicy != chat.PinPolicy {
+		if *req.PinPolicy != model.PinPolicyEveryone && *req.PinPolicy != model.PinPolicyAdmins {
+			writeError(w, http.StatusBadRequest, "pin_policy must be everyone or admins")
+			return
+		}
+		role, err := h.chatRepo.GetMemberRole(r.Context(), chatID, userID)
+		if err != nil || role != "admin" {
+			writeError(w, http.StatusForbidden, "only admin can change pin policy")
+			return
+		}
+		pinPolicy = *req.PinPolicy
+	}
+	sendPolicy := chat.SendPolicy
+	if req.SendPolicy != nil && *req.SendPolicy != chat.SendPolicy {
+		if chat.ChatType == model.ChatTypeChannel {
+			writeError(w, http.StatusBadRequest, "only admins can send messages in a channel")
+			return
+		}
+		if *req.SendPolicy != model.SendPolicyEveryone && *req.SendPolicy != model.SendPolicyAdmins {
+			writeError(w, http.StatusBadRequest, "send_policy must be everyone or admins")
+			return
+		}
+		role, err := h.chatRepo.GetMemberRole(r.Context(), chatID, userID)
+		if err != nil || role != "admin" {
+			writeError(w, http.StatusForbidden, "only admin can change send policy")
+			return
+		}
+		sendPolicy = *req.SendPolicy
+	}
+	sensitive := chat.IsSensitive
+	if req.IsSensitive != nil && *req.IsSensitive != chat.IsSensitive {
+		if *req.IsSensitive && !h.msgRepo.EncryptionEnabled() {
+			writeError(w, http.StatusBadRequest, "message encryption is not configured")
+			return
+		}
+		role, err := h.chatRepo.GetMemberRole(r.Context(), chatID, userID)
+		if err != nil || role != "admin" {
+			writeError(w, http.StatusForbidden, "only admin can change chat sensitivity")
+			return
+		}
+		sensitive = *req.IsSensitive
+	}
 
 	if err := h.chatRepo.UpdateChat(r.Context(), chatID, name, desc, avatarURL); err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to update chat")
 		return
 	}
+	if pinPolicy != chat.PinPolicy {
+		if err := h.chatRepo.SetPinPolicy(r.Context(), chatID, pinPolicy); err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to update chat")
+			return
+		}
+	}
+	if sendPolicy != chat.SendPolicy {
+		if err := h.chatRepo.SetSendPolicy(r.Context(), chatID, sendPolicy); err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to update chat")
+			return
+		}
+	}
+	if sensitive != chat.IsSensitive {
+		if err := h.chatRepo.SetSensitive(r.Context(), chatID, sensitive); err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to update chat")
+			return
+		}
+	}
 
 	h.hub.BroadcastToChat(r.Context(), chatID, ws.OutgoingMessage{
 		Type: ws.EventChatUpdated,
-		Payload: map[string]string{
-			"chat_id":     chatID,
-			"name":        name,
-			"description": desc,
-			"avatar_url":  avatarURL,
+		Payload: map[string]any{
+			"chat_id":      chatID,
+			"name":         name,
+			"description":  desc,
+			"avatar_url":   avatarURL,
+			"pin_policy":   string(pinPolicy),
+			"is_sensitive": sensitive,
+			"send_policy":  string(sendPolicy),
 		},
 	})
 
@@ -319,8 +451,8 @@ func (h *ChatHandler) AddMembers(w http.ResponseWriter, r *http.Request) {
 	userID := middleware.GetUserID(r.Context())
 
 	var req AddMembersRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid body")
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err, "invalid body")
 		return
 	}
 
@@ -329,61 +461,71 @@ func (h *ChatHandler) AddMembers(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusNotFound, "chat not found")
 		return
 	}
-	if chat.ChatType != model.ChatTypeGroup {
+	if chat.ChatType != model.ChatTypeGroup && chat.ChatType != model.ChatTypeChannel {
 		writeError(w, http.StatusBadRequest, "only group chats support adding members")
 		return
 	}
 
-	isMember, err := h.chatRepo.IsMember(r.Context(), chatID, userID)
-	if err != nil || !isMember {
+	role, err := h.chatRepo.GetMemberRole(r.Context(), chatID, userID)
+	if err != nil {
 		writeError(w, http.StatusForbidden, "not a member")
 		return
 	}
+	// В канал добавляет только администратор, и добавленные становятся подписчиками.
+	newRole := "member"
+	if chat.ChatType == model.ChatTypeChannel {
+		if role != "admin" {
+			writeError(w, http.StatusForbidden, "only admin can add subscribers")
+			return
+		}
+		newRole = roleSubscriber
+	}
 
+	memberIDs, names, err := h.memberNames(r.Context(), req.MemberIDs, "")
+	if err != nil {
+		writeMemberNamesError(w, err)
+		return
+	}
 	actor, _ := h.userRepo.GetByID(r.Context(), userID)
 	actorName := ""
 	if actor != nil {
 		actorName = actor.Username
 	}
 	now := time.Now().UTC()
-	for _, uid := range req.MemberIDs {
-		member := &model.ChatMember{ChatID: chatID, UserID: uid, Role: "member", JoinedAt: now}
-		if err := h.chatRepo.AddMember(r.Context(), member); err != nil {
-			logger.Errorf("addMember chat=%s user=%s: %v", chatID, uid, err)
-		} else {
-			added, _ := h.userRepo.GetByID(r.Context(), uid)
-			addedName := uid
-			if added != nil {
-				addedName = added.Username
+	// Участники и системные сообщения о них сохраняются одной транзакцией; события рассылаются после commit.
+	var events []ws.OutgoingMessage
+	err = h.chatRepo.WithTx(r.Context(), func(ctx context.Context) error {
+		for _, uid := range memberIDs {
+			member := &model.ChatMember{ChatID: chatID, UserID: uid, Role: newRole, JoinedAt: now}
+			if err := h.chatRepo.AddMember(ctx, member); err != nil {
+				return err
 			}
+			addedName := names[uid]
 			// Системное сообщение в чат: «Иван добавил(а) Марию в группу»
-			systemContent := actorName + " добавил(а) " + addedName + " в группу"
-			sysMsg := &model.Message{
-				ID:          uuid.New().String(),
-				ChatID:      chatID,
-				SenderID:    userID,
-				Content:     systemContent,
-				ContentType: model.ContentTypeSystem,
-				Status:      model.MessageStatusSent,
-				CreatedAt:   now,
+			sysMsg := h.systemMessage(chatID, userID, sysmsg.New(sysmsg.MemberAdded, actorName, addedName), now)
+			if err := h.msgRepo.Create(ctx, sysMsg); err != nil {
+				return err
 			}
-			if err := h.msgRepo.Create(r.Context(), sysMsg); err != nil {
-				logger.Errorf("addMember system message chat=%s: %v", chatID, err)
-			} else {
-				sysMsg.Sender = &model.UserPublic{ID: userID, Username: actorName}
-				h.hub.BroadcastToChat(r.Context(), chatID, ws.OutgoingMessage{
-					Type:    ws.EventNewMessage,
-					Payload: sysMsg,
+			sysMsg.Sender = &model.UserPublic{ID: userID, Username: actorName}
+			events = append(events,
+				ws.OutgoingMessage{Type: ws.EventNewMessage, Payload: sysMsg},
+				ws.OutgoingMessage{
+					Type: ws.EventMemberAdded,
+					Payload: ws.MemberAddedPayload{
+						ChatID: chatID, UserID: uid, Username: addedName,
+						ActorID: userID, ActorName: actorName,
+					},
 				})
-			}
-			h.hub.BroadcastToChat(r.Context(), chatID, ws.OutgoingMessage{
-				Type: ws.EventMemberAdded,
-				Payload: ws.MemberAddedPayload{
-					ChatID: chatID, UserID: uid, Username: addedName,
-					ActorID: userID, ActorName: actorName,
-				},
-			})
 		}
+		return nil
+	})
+	if err != nil {
+		logger.Errorf("addMembers chat=%s: %v", chatID, err)
+		writeError(w, http.StatusInternalServerError, "failed to add members")
+		return
+	}
+	for _, ev := range events {
+		h.hub.BroadcastToChat(r.Context(), chatID, ev)
 	}
 
 	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
@@ -400,7 +542,7 @@ func (h *ChatHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusNotFound, "chat not found")
 		return
 	}
-	if chat.ChatType != model.ChatTypeGroup {
+	if chat.ChatType != model.ChatTypeGroup && chat.ChatType != model.ChatTypeChannel {
 		writeError(w, http.StatusBadRequest, "only group chats support removing members")
 		return
 	}
@@ -432,33 +574,188 @@ func (h *ChatHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
 		actorName = actor.Username
 	}
 	now := time.Now().UTC()
-	sysContent := actorName + " исключил(а) " + removedName + " из группы"
-	sysMsg := &model.Message{
-		ID:          uuid.New().String(),
-		ChatID:      chatID,
-		SenderID:    userID,
-		Content:     sysContent,
-		ContentType: model.ContentTypeSystem,
-		Status:      model.MessageStatusSent,
-		CreatedAt:   now,
-	}
+	sysMsg := h.systemMessage(chatID, userID, sysmsg.New(sysmsg.MemberRemoved, actorName, removedName), now)
 	if err := h.msgRepo.Create(r.Context(), sysMsg); err != nil {
 		logger.Errorf("removeMember system message chat=%s: %v", chatID, err)
 	} else {
 		sysMsg.Sender = &model.UserPublic{ID: userID, Username: actorName}
 		h.hub.BroadcastToChat(r.Context(), chatID, ws.OutgoingMessage{Type: ws.EventNewMessage, Payload: sysMsg})
 	}
-	h.hub.BroadcastToChat(r.Context(), chatID, ws.OutgoingMessage{
+	removedEvent := ws.OutgoingMessage{
 		Type: ws.EventMemberRemoved,
 		Payload: ws.MemberRemovedPayload{
 			ChatID: chatID, UserID: memberID, Username: removedName,
 			IsLeave: false, ActorName: actorName,
 		},
+	}
+	h.hub.BroadcastToChat(r.Context(), chatID, removedEvent)
+	// Исключённый уже не в списке участников — уведомляем его отдельно, чтобы клиент сразу убрал чат.
+	h.hub.SendToUser(memberID, removedEvent)
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+type UpdateMemberRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// UpdateMemberRole меняет роль участника группы (admin/member) или канала (admin/subscriber). Только для администраторов.
+func (h *ChatHandler) UpdateMemberRole(w http.ResponseWriter, r *http.Request) {
+	chatID := chi.URLParam(r, "id")
+	memberID := chi.URLParam(r, "memberId")
+	userID := middleware.GetUserID(r.Context())
+
+	var req UpdateMemberRoleRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err, "invalid body")
+		return
+	}
+	chat, err := h.chatRepo.GetByID(r.Context(), chatID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "chat not found")
+		return
+	}
+	plainRole := "member"
+	switch chat.ChatType {
+	case model.ChatTypeGroup:
+	case model.ChatTypeChannel:
+		plainRole = roleSubscriber
+	default:
+		writeError(w, http.StatusBadRequest, "only group chats support member roles")
+		return
+	}
+	if req.Role != "admin" && req.Role != plainRole {
+		writeError(w, http.StatusBadRequest, "role must be admin or "+plainRole)
+		return
+	}
+	role, err := h.chatRepo.GetMemberRole(r.Context(), chatID, userID)
+	if err != nil {
+		writeError(w, http.StatusForbidden, "not a member")
+		return
+	}
+	if role != "admin" {
+		writeError(w, http.StatusForbidden, "only admin can change roles")
+		return
+	}
+
+	changed, err := h.chatRepo.SetMemberRole(r.Context(), chatID, memberID, req.Role)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			writeError(w, http.StatusNotFound, "member not found")
+		case errors.Is(err, repository.ErrLastAdmin):
+			writeError(w, http.StatusConflict, "chat must keep at least one admin")
+		default:
+			logger.Errorf("updateMemberRole chat=%s user=%s: %v", chatID, memberID, err)
+			writeError(w, http.StatusInternalServerError, "failed to update role")
+		}
+		return
+	}
+	if !changed {
+		// Роль уже такая — без системного сообщения и рассылки.
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		return
+	}
+
+	member, _ := h.userRepo.GetByID(r.Context(), memberID)
+	memberName := memberID
+	if member != nil {
+		memberName = member.Username
+	}
+	actor, _ := h.userRepo.GetByID(r.Context(), userID)
+	actorName := ""
+	if actor != nil {
+		actorName = actor.Username
+	}
+	// Системное сообщение: «Иван назначил(а) Марию администратором» / «Иван снял(а) с Марии права администратора»
+	code := sysmsg.MemberRoleGranted
+	if req.Role != "admin" {
+		code = sysmsg.MemberRoleRevoked
+	}
+	sysMsg := h.systemMessage(chatID, userID, sysmsg.New(code, actorName, memberName), time.Now().UTC())
+	if err := h.msgRepo.Create(r.Context(), sysMsg); err != nil {
+		logger.Errorf("updateMemberRole system message chat=%s: %v", chatID, err)
+	} else {
+		sysMsg.Sender = &model.UserPublic{ID: userID, Username: actorName}
+		h.hub.BroadcastToChat(r.Context(), chatID, ws.OutgoingMessage{Type: ws.EventNewMessage, Payload: sysMsg})
+	}
+	h.hub.BroadcastToChat(r.Context(), chatID, ws.OutgoingMessage{
+		Type: ws.EventMemberRoleChanged,
+		Payload: ws.MemberRoleChangedPayload{
+			ChatID: chatID, UserID: memberID, Username: memberName, Role: req.Role,
+			ActorID: userID, ActorName: actorName,
+		},
 	})
 
 	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 }
 
+type ChatStatsResponse struct {
+	ChatID       string `json:"chat_id"`
+	MembersCount int    `json:"members_count"`
+	*repository.ChatActivityStats
+}
+
+// chatStatsTopMembers — сколько самых активных участников возвращает GetChatStats.
+const chatStatsTopMembers = 5
+
+// GetChatStats возвращает статистику чата (сообщения, активные участники, медиа). Доступно участникам.
+func (h *ChatHandler) GetChatStats(w http.ResponseWriter, r *http.Request) {
+	chatID := chi.URLParam(r, "id")
+	userID := middleware.GetUserID(r.Context())
+
+	isMember, err := h.chatRepo.IsMember(r.Context(), chatID, userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to check membership")
+		return
+	}
+	if !isMember {
+		writeError(w, http.StatusForbidden, "not a member")
+		return
+	}
+	memberIDs, err := h.chatRepo.GetMemberIDs(r.Context(), chatID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get members")
+		return
+	}
+	stats, err := h.msgRepo.GetChatStats(r.Context(), chatID, chatStatsTopMembers)
+	if err != nil {
+		logger.Errorf("chat stats chat=%s: %v", chatID, err)
+		writeError(w, http.StatusInternalServerError, "failed to get stats")
+		return
+	}
+	writeJSON(w, http.StatusOK, ChatStatsResponse{ChatID: chatID, MembersCount: len(memberIDs), ChatActivityStats: stats})
+}
+
+// GetOnlineMembers returns ids of chat members currently connected via WebSocket.
+func (h *ChatHandler) GetOnlineMembers(w http.ResponseWriter, r *http.Request) {
+	chatID := chi.URLParam(r, "chatId")
+	userID := middleware.GetUserID(r.Context())
+
+	isMember, err := h.chatRepo.IsMember(r.Context(), chatID, userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to check membership")
+		return
+	}
+	if !isMember {
+		writeError(w, http.StatusForbidden, "not a member")
+		return
+	}
+
+	memberIDs, err := h.chatRepo.GetMemberIDs(r.Context(), chatID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get members")
+		return
+	}
+	online := h.hub.OnlineUsers(r.Context(), memberIDs)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"chat_id":       chatID,
+		"online":        online,
+		"online_count":  len(online),
+		"members_count": len(memberIDs),
+	})
+}
+
 // LeaveChat lets a user leave a group chat.
 func (h *ChatHandler) LeaveChat(w http.ResponseWriter, r *http.Request) {
 	chatID := chi.URLParam(r, "id")
@@ -481,30 +778,63 @@ func (h *ChatHandler) LeaveChat(w http.ResponseWriter, r *http.Request) {
 		leaverName = leaver.Username
 	}
 	now := time.Now().UTC()
-	sysContent := leaverName + " покинул(а) группу"
-	sysMsg := &model.Message{
-		ID:          uuid.New().String(),
-		ChatID:      chatID,
-		SenderID:    userID,
-		Content:     sysContent,
-		ContentType: model.ContentTypeSystem,
-		Status:      model.MessageStatusSent,
-		CreatedAt:   now,
-	}
+	sysMsg := h.systemMessage(chatID, userID, sysmsg.New(sysmsg.MemberLeft, leaverName, ""), now)
 	if err := h.msgRepo.Create(r.Context(), sysMsg); err != nil {
 		logger.Errorf("leaveChat system message chat=%s: %v", chatID, err)
 	} else {
 		sysMsg.Sender = &model.UserPublic{ID: userID, Username: leaverName}
 		h.hub.BroadcastToChat(r.Context(), chatID, ws.OutgoingMessage{Type: ws.EventNewMessage, Payload: sysMsg})
 	}
-	h.hub.BroadcastToChat(r.Context(), chatID, ws.OutgoingMessage{
+	leftEvent := ws.OutgoingMessage{
 		Type: ws.EventMemberRemoved,
 		Payload: ws.MemberRemovedPayload{
 			ChatID: chatID, UserID: userID, Username: leaverName,
 			IsLeave: true, ActorName: "",
 		},
-	})
+	}
+	h.hub.BroadcastToChat(r.Context(), chatID, leftEvent)
+	// Другие вкладки/устройства вышедшего пользователя тоже должны убрать чат.
+	h.hub.SendToUser(userID, leftEvent)
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// ClearHistory очищает историю чата только для текущего пользователя: сообщения до этого момента
+// он больше не видит, у остальных участников ничего не меняется. Новые сообщения видны как обычно.
+func (h *ChatHandler) ClearHistory(w http.ResponseWriter, r *http.Request) {
+	chatID := chi.URLParam(r, "id")
+	userID := middleware.GetUserID(r.Context())
+
+	clearedBefore, err := h.chatRepo.ClearHistory(r.Context(), chatID, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			writeError(w, http.StatusForbidden, "not a member")
+			return
+		}
+		logger.Errorf("clearHistory chat=%s user=%s: %v", chatID, userID, err)
+		writeError(w, http.StatusInternalServerError, "failed to clear history")
+		return
+	}
+	payload := ws.ChatClearedPayload{ChatID: chatID, ClearedBefore: clearedBefore}
+	h.hub.SendToUser(userID, ws.OutgoingMessage{Type: ws.EventChatCleared, Payload: payload})
+	writeJSON(w, http.StatusOK, payload)
+}
 
+// MarkUnread отмечает чат непрочитанным для текущего пользователя: счётчик непрочитанных не меньше 1,
+// пока чат не будет прочитан (read / mark_read). Другим участникам ничего не рассылается.
+func (h *ChatHandler) MarkUnread(w http.ResponseWriter, r *http.Request) {
+	chatID := chi.URLParam(r, "chatId")
+	userID := middleware.GetUserID(r.Context())
+
+	if err := h.chatRepo.MarkUnread(r.Context(), chatID, userID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			writeError(w, http.StatusForbidden, "not a member")
+			return
+		}
+		logger.Errorf("markUnread chat=%s user=%s: %v", chatID, userID, err)
+		writeError(w, http.StatusInternalServerError, "failed to mark chat unread")
+		return
+	}
 	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 }
 
@@ -519,20 +849,29 @@ func (h *ChatHandler) enrichChat(ctx context.Context, chat *model.Chat, userID s
 		pubMembers = append(pubMembers, m.ToPublic())
 	}
 
-	lastMsg, err := h.msgRepo.GetLastMessage(ctx, chat.ID)
+	lastMsg, err := h.msgRepo.GetLastMessage(ctx, chat.ID, userID)
 	if err != nil {
 		logger.Errorf("enrichChat get last message chat=%s: %v", chat.ID, err)
 	}
 
-	unread, err := h.chatRepo.GetUnreadCount(ctx, chat.ID, userID)
+	unread, err := h.chatRepo.GetUnreadCount(ctx, chat.ID, userID, h.unreadIncludeSystem)
 	if err != nil {
 		logger.Errorf("enrichChat get unread count chat=%s: %v", chat.ID, err)
 	}
 
+	var mentions int
+	if unread > 0 {
+		mentions, err = h.chatRepo.GetUnreadMentionCount(ctx, chat.ID, userID)
+		if err != nil {
+			logger.Errorf("enrichChat get unread mention count chat=%s: %v", chat.ID, err)
+		}
+	}
+
 	return &model.ChatWithLastMessage{
-		Chat:        *chat,
-		LastMessage: lastMsg,
-		Members:     pubMembers,
-		UnreadCount: unread,
+		Chat:               *chat,
+		LastMessage:        lastMsg,
+		Members:            pubMembers,
+		UnreadCount:        unread,
+		UnreadMentionCount: mentions,
 	}, nil
 }
@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/messenger/internal/middleware"
+	"github.com/messenger/internal/model"
+)
+
+// maxPinnedChats — сколько чатов пользователь может закрепить вверху списка.
+const maxPinnedChats = 20
+
+type pinnedChatsRequest struct {
+	ChatIDs []string `json:"chat_ids"`
+}
+
+// GetPinnedChats возвращает закреплённые текущим пользователем чаты в его порядке.
+func (h *ChatHandler) GetPinnedChats(w http.ResponseWriter, r *http.Request) {
+	ids, err := h.chatRepo.GetPinnedChatIDs(r.Context(), middleware.GetUserID(r.Context()))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get pinned chats")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"chat_ids": ids})
+}
+
+// SetPinnedChats задаёт закреплённые чаты и их порядок целиком: чаты, которых нет в списке, открепляются.
+func (h *ChatHandler) SetPinnedChats(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	var req pinnedChatsRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err, "invalid body")
+		return
+	}
+	if len(req.ChatIDs) > maxPinnedChats {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("too many pinned chats (max %d)", maxPinnedChats))
+		return
+	}
+	for i, id := range req.ChatIDs {
+		if uuid.Validate(id) != nil || slices.Contains(req.ChatIDs[:i], id) {
+			writeError(w, http.StatusBadRequest, "invalid or duplicate chat id")
+			return
+		}
+		if !h.checkMember(w, r, id, userID) {
+			return
+		}
+	}
+	if err := h.chatRepo.SetPinnedChats(r.Context(), userID, req.ChatIDs); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to pin chats")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"chat_ids": req.ChatIDs})
+}
+
+// PinChat закрепляет чат последним среди закреплённых.
+func (h *ChatHandler) PinChat(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	var req struct {
+		ChatID string `json:"chat_id"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err, "chat_id required")
+		return
+	}
+	if uuid.Validate(req.ChatID) != nil {
+		writeError(w, http.StatusBadRequest, "chat_id required")
+		return
+	}
+	if !h.checkMember(w, r, req.ChatID, userID) {
+		return
+	}
+	ids, err := h.chatRepo.GetPinnedChatIDs(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to pin chat")
+		return
+	}
+	if len(ids) >= maxPinnedChats && !slices.Contains(ids, req.ChatID) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("too many pinned chats (max %d)", maxPinnedChats))
+		return
+	}
+	if err := h.chatRepo.PinChat(r.Context(), userID, req.ChatID); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to pin chat")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (h *ChatHandler) UnpinChat(w http.ResponseWriter, r *http.Request) {
+	chatID := chi.URLParam(r, "chatId")
+	if uuid.Validate(chatID) != nil {
+		writeError(w, http.StatusBadRequest, "invalid chat id")
+		return
+	}
+	if err := h.chatRepo.UnpinChat(r.Context(), middleware.GetUserID(r.Context()), chatID); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to unpin chat")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// checkMember отвечает 403, если пользователь не участник чата; false — ответ уже отправлен.
+func (h *ChatHandler) checkMember(w http.ResponseWriter, r *http.Request, chatID, userID string) bool {
+	ok, err := h.chatRepo.IsMember(r.Context(), chatID, userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to check membership")
+		return false
+	}
+	if !ok {
+		writeError(w, http.StatusForbidden, "not a member")
+		return false
+	}
+	return true
+}
+
+// sortPinnedFirst ставит закреплённые чаты в начало в порядке пользователя и проставляет им sort_order;
+// остальные сохраняют прежний порядок.
+func sortPinnedFirst(chats []model.ChatWithLastMessage, pinnedIDs []string) {
+	if len(pinnedIDs) == 0 {
+		return
+	}
+	pos := make(map[string]int, len(pinnedIDs))
+	for i, id := range pinnedIDs {
+		pos[id] = i
+	}
+	for i := range chats {
+		if p, ok := pos[chats[i].Chat.ID]; ok {
+			chats[i].SortOrder = &p
+		}
+	}
+	slices.SortStableFunc(chats, func(a, b model.ChatWithLastMessage) int {
+		switch {
+		case a.SortOrder != nil && b.SortOrder != nil:
+			return *a.SortOrder - *b.SortOrder
+		case a.SortOrder != nil:
+			return -1
+		case b.SortOrder != nil:
+			return 1
+		}
+		return 0
+	})
+}
@@ -2,18 +2,25 @@ package handler
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/messenger/internal/config"
+	"github.com/messenger/internal/icehealth"
+	"github.com/messenger/internal/middleware"
+	"github.com/messenger/internal/repository"
+	"github.com/messenger/internal/ws"
 )
 
 // ConfigHandler отдаёт публичные параметры конфигурации (например, кеш для клиента).
 type ConfigHandler struct {
-	cfg *config.Config
+	cfg      *config.Config
+	ice      *icehealth.Checker
+	permRepo *repository.PermissionRepository
 }
 
-// NewConfigHandler создаёт обработчик конфигурации.
-func NewConfigHandler(cfg *config.Config) *ConfigHandler {
-	return &ConfigHandler{cfg: cfg}
+// NewConfigHandler создаёт обработчик конфигурации. ice может быть nil — тогда ICE-серверы отдаются как есть.
+func NewConfigHandler(cfg *config.Config, ice *icehealth.Checker, permRepo *repository.PermissionRepository) *ConfigHandler {
+	return &ConfigHandler{cfg: cfg, ice: ice, permRepo: permRepo}
 }
 
 // GetCacheConfig возвращает настройки кеша для клиента (без авторизации).
@@ -36,8 +43,55 @@ func (h *ConfigHandler) GetPushConfig(w http.ResponseWriter, r *http.Request) {
 }
 
 // GetCallConfig возвращает публичные настройки для звонков (ICE-серверы).
+// При включённой проверке — только доступные серверы, упорядоченные по задержке.
 func (h *ConfigHandler) GetCallConfig(w http.ResponseWriter, r *http.Request) {
+	servers := h.cfg.CallICEServers
+	if h.ice != nil {
+		servers = h.ice.Servers()
+	}
 	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"ice_servers": h.cfg.CallICEServers,
+		"ice_servers": servers,
+	})
+}
+
+// GetWSConfig возвращает параметры WebSocket-соединения, чтобы клиент подстроил под них свой keepalive
+// и размер сообщений: сервер шлёт ping раз в ping_interval_ms и закрывает соединение, если за
+// pong_timeout_ms от клиента ничего не пришло; сообщения больше max_message_size байт разрывают соединение;
+// idle_timeout_ms — закрытие при отсутствии сообщений (pong не в счёт), 0 — не закрывается.
+func (h *ConfigHandler) GetWSConfig(w http.ResponseWriter, r *http.Request) {
+	pongWait := time.Duration(h.cfg.WSPongTimeout) * time.Second
+	writeJSON(w, http.StatusOK, map[string]int64{
+		"ping_interval_ms": ws.PingInterval(pongWait).Milliseconds(),
+		"pong_timeout_ms":  pongWait.Milliseconds(),
+		"max_message_size": int64(h.cfg.WSMaxMessageSize),
+		"idle_timeout_ms":  (time.Duration(h.cfg.WSIdleTimeout) * time.Second).Milliseconds(),
 	})
 }
+
+// GetReactionsConfig возвращает список разрешённых реакций (allow_any — ограничений нет)
+// и лимит реакций одного пользователя на сообщение (max_per_user, 0 — без ограничения).
+func (h *ConfigHandler) GetReactionsConfig(w http.ResponseWriter, r *http.Request) {
+	allowed := h.cfg.AllowedReactions
+	if allowed == nil {
+		allowed = []string{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"allow_any":    len(allowed) == 0,
+		"allowed":      allowed,
+		"max_per_user": h.cfg.MaxReactionsPerUser,
+	})
+}
+
+// GetICEHealth возвращает состояние ICE-серверов по последней проверке. Только для администратора.
+func (h *ConfigHandler) GetICEHealth(w http.ResponseWriter, r *http.Request) {
+	perm, err := h.permRepo.GetByUserID(r.Context(), middleware.GetUserID(r.Context()))
+	if err != nil || !perm.Administrator {
+		writeError(w, http.StatusForbidden, "only administrator can view ice health")
+		return
+	}
+	if h.ice == nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"enabled": false, "servers": []any{}})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"enabled": true, "servers": h.ice.Health()})
+}
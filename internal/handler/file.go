@@ -1,29 +1,58 @@
 package handler
 
 import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/url"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/messenger/internal/blobstore"
+	"github.com/messenger/internal/clamav"
 	"github.com/messenger/internal/config"
 	"github.com/messenger/internal/fileserver"
+	"github.com/messenger/internal/logger"
+	"github.com/messenger/internal/middleware"
+	"github.com/messenger/internal/model"
+	"github.com/messenger/internal/repository"
+	"github.com/messenger/internal/ws"
 )
 
 type FileHandler struct {
 	cfg        *config.Config
+	uploadRepo *repository.UploadRepository
 	fileSvc    *fileserver.Service
 	fileClient *http.Client
 	fileBase   string
+	hub        *ws.Hub
+
+	// inFlight — число идущих загрузок по пользователям (ограничение MaxConcurrentUploads).
+	inFlightMu sync.Mutex
+	inFlight   map[string]int
 }
 
-func NewFileHandler(cfg *config.Config) *FileHandler {
-	h := &FileHandler{cfg: cfg}
+// NewFileHandler: store — хранилище для обработки файлов в API; не используется, если задан FileServiceURL.
+func NewFileHandler(cfg *config.Config, uploadRepo *repository.UploadRepository, store blobstore.Storage, hub *ws.Hub) *FileHandler {
+	h := &FileHandler{cfg: cfg, uploadRepo: uploadRepo, hub: hub, inFlight: make(map[string]int)}
 	if cfg.FileServiceURL == "" {
-		h.fileSvc = fileserver.New(cfg.UploadDir, cfg.MaxUploadSize)
+		h.fileSvc = fileserver.New(store, cfg.Storage.Gzip, cfg.MaxUploadSize)
+		h.fileSvc.ContentTypes = cfg.FileContentTypes
+		if cfg.ClamAVAddr != "" {
+			h.fileSvc.Scanner = clamav.New(cfg.ClamAVAddr, cfg.ClamAVFailOpen)
+			h.fileSvc.ScanAsync = cfg.ClamAVAsync
+		}
 	} else {
 		h.fileClient = &http.Client{Timeout: 60 * time.Second}
 		h.fileBase = strings.TrimSuffix(cfg.FileServiceURL, "/")
@@ -36,20 +65,101 @@ type FileUploadResponse struct {
 	FileName    string `json:"file_name"`
 	FileSize    int64  `json:"file_size"`
 	ContentType string `json:"content_type"`
+	ScanStatus  string `json:"scan_status,omitempty"`
+	Width       int    `json:"width,omitempty"`
+	Height      int    `json:"height,omitempty"`
+	BlurHash    string `json:"blurhash,omitempty"`
 }
 
+// quotaExceededResponse — ответ 413 с текущим использованием, чтобы клиент мог показать, сколько осталось.
+type quotaExceededResponse struct {
+	Error string `json:"error"`
+	model.StorageUsage
+}
+
+// Upload загружает файл с учётом квоты пользователя и лимита одновременных загрузок.
 func (h *FileHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	if !h.acquireUpload(userID) {
+		writeError(w, http.StatusTooManyRequests, "too many concurrent uploads")
+		return
+	}
+	defer h.releaseUpload(userID)
+
+	// Предварительная проверка по Content-Length, чтобы не принимать заведомо не помещающийся файл;
+	// окончательная — атомарно при учёте (Record) по фактическому размеру.
+	if h.cfg.UploadQuota > 0 {
+		usage, err := h.usage(r.Context(), userID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to check upload quota")
+			return
+		}
+		if usage.UsedBytes+max(r.ContentLength, 0) > usage.QuotaBytes {
+			writeJSON(w, http.StatusRequestEntityTooLarge, quotaExceededResponse{Error: "upload quota exceeded", StorageUsage: usage})
+			return
+		}
+	}
+
+	rec := newBufferedResponse()
 	if h.fileSvc != nil {
 		r.Body = http.MaxBytesReader(w, r.Body, h.cfg.MaxUploadSize)
-		h.fileSvc.Upload(w, r)
+		h.fileSvc.Upload(rec, r)
+	} else if !h.proxyUpload(w, rec, r) {
 		return
 	}
-	// Прокси на микросервис файлов (Content-Length обязателен для корректного парсинга multipart)
+
+	if rec.code == http.StatusOK {
+		var up FileUploadResponse
+		if err := json.Unmarshal(rec.body.Bytes(), &up); err == nil && up.URL != "" {
+			name := path.Base(up.URL)
+			if err := h.uploadRepo.Record(r.Context(), userID, name, up.FileSize, h.cfg.UploadQuota, model.UploadMeta{
+				ScanStatus: up.ScanStatus, Width: up.Width, Height: up.Height, BlurHash: up.BlurHash,
+			}); err != nil {
+				h.removeStored(name)
+				if errors.Is(err, repository.ErrQuotaExceeded) {
+					usage, _ := h.usage(r.Context(), userID)
+					writeJSON(w, http.StatusRequestEntityTooLarge, quotaExceededResponse{Error: "upload quota exceeded", StorageUsage: usage})
+					return
+				}
+				writeError(w, http.StatusInternalServerError, "failed to record upload")
+				return
+			}
+			if up.ScanStatus == model.ScanPending {
+				go h.scanInBackground(userID, name)
+			}
+		}
+	}
+	for k, v := range rec.Header() {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(rec.code)
+	io.Copy(w, &rec.body)
+}
+
+// bufferedResponse накапливает ответ сервиса файлов, чтобы учесть загрузку до отправки ответа клиенту.
+type bufferedResponse struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func newBufferedResponse() *bufferedResponse {
+	return &bufferedResponse{header: make(http.Header), code: http.StatusOK}
+}
+
+func (b *bufferedResponse) Header() http.Header         { return b.header }
+func (b *bufferedResponse) Write(p []byte) (int, error) { return b.body.Write(p) }
+func (b *bufferedResponse) WriteHeader(code int)        { b.code = code }
+
+// proxyUpload проксирует загрузку на микросервис файлов; ответ сервиса пишется в rec.
+// false — ошибка уже отправлена клиенту в w.
+func (h *FileHandler) proxyUpload(w http.ResponseWriter, rec *bufferedResponse, r *http.Request) bool {
+	// Content-Length обязателен для корректного парсинга multipart
 	proxyURL := h.fileBase + "/upload"
 	proxyReq, err := http.NewRequestWithContext(r.Context(), http.MethodPost, proxyURL, nil)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "internal error")
-		return
+		return false
 	}
 	proxyReq.Header.Set("Content-Type", r.Header.Get("Content-Type"))
 	proxyReq.Body = http.MaxBytesReader(w, r.Body, h.cfg.MaxUploadSize)
@@ -59,30 +169,339 @@ func (h *FileHandler) Upload(w http.ResponseWriter, r *http.Request) {
 	resp, err := h.fileClient.Do(proxyReq)
 	if err != nil {
 		writeError(w, http.StatusBadGateway, "file service unavailable")
-		return
+		return false
 	}
 	defer resp.Body.Close()
 	for k, v := range resp.Header {
-		if strings.EqualFold(k, "Content-Length") || strings.EqualFold(k, "Content-Type") ||
-			strings.EqualFold(k, "Content-Disposition") {
-			w.Header()[k] = v
+		if strings.EqualFold(k, "Content-Type") || strings.EqualFold(k, "Content-Disposition") {
+			rec.Header()[k] = v
 		}
 	}
-	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
+	rec.WriteHeader(resp.StatusCode)
+	io.Copy(rec, resp.Body)
+	return true
+}
+
+// GetUsage возвращает занятое текущим пользователем место и квоту.
+func (h *FileHandler) GetUsage(w http.ResponseWriter, r *http.Request) {
+	usage, err := h.usage(r.Context(), middleware.GetUserID(r.Context()))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get usage")
+		return
+	}
+	writeJSON(w, http.StatusOK, usage)
+}
+
+// Delete удаляет загруженный текущим пользователем файл и освобождает место в квоте.
+// Файл, на который ещё ссылаются сообщения, не удаляется (409): иначе вложение сломается у всех участников чата.
+func (h *FileHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	filename := filepath.Base(chi.URLParam(r, "filename"))
+	used, err := h.uploadRepo.IsReferenced(r.Context(), filename)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to delete file")
+		return
+	}
+	if used {
+		writeError(w, http.StatusConflict, "file is attached to messages")
+		return
+	}
+	if err := h.uploadRepo.Delete(r.Context(), middleware.GetUserID(r.Context()), filename); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "file not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to delete file")
+		return
+	}
+	h.removeStored(filename)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *FileHandler) usage(ctx context.Context, userID string) (model.StorageUsage, error) {
+	usage, err := h.uploadRepo.Usage(ctx, userID)
+	usage.QuotaBytes = h.cfg.UploadQuota
+	return usage, err
+}
+
+// removeStored удаляет файл из хранилища (локально или через микросервис); ошибки только логируются.
+func (h *FileHandler) removeStored(filename string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if h.fileSvc != nil {
+		if _, err := h.fileSvc.Remove(ctx, filename); err != nil {
+			logger.Errorf("file delete %s: %v", filename, err)
+		}
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, h.fileBase+"/files/"+url.PathEscape(filename), nil)
+	if err != nil {
+		logger.Errorf("file delete %s: %v", filename, err)
+		return
+	}
+	resp, err := h.fileClient.Do(req)
+	if err != nil {
+		logger.Errorf("file delete %s: %v", filename, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotFound {
+		logger.Errorf("file delete %s: status %d", filename, resp.StatusCode)
+	}
+}
+
+func (h *FileHandler) acquireUpload(userID string) bool {
+	if h.cfg.MaxConcurrentUploads <= 0 {
+		return true
+	}
+	h.inFlightMu.Lock()
+	defer h.inFlightMu.Unlock()
+	if h.inFlight[userID] >= h.cfg.MaxConcurrentUploads {
+		return false
+	}
+	h.inFlight[userID]++
+	return true
+}
+
+func (h *FileHandler) releaseUpload(userID string) {
+	if h.cfg.MaxConcurrentUploads <= 0 {
+		return
+	}
+	h.inFlightMu.Lock()
+	defer h.inFlightMu.Unlock()
+	if h.inFlight[userID] <= 1 {
+		delete(h.inFlight, userID)
+		return
+	}
+	h.inFlight[userID]--
+}
+
+// Повторы фоновой проверки, пока clamd недоступен: пауза растёт от scanRetryMin до scanRetryMax;
+// после scanMaxAttempts файл остаётся pending до следующего запуска API (RescanPending).
+const (
+	scanRetryMin    = 10 * time.Second
+	scanRetryMax    = 10 * time.Minute
+	scanMaxAttempts = 10
+)
+
+// RescanPending запускает проверку файлов, оставшихся pending (API перезапустился до результата
+// или clamd был недоступен дольше всех повторов). Вызывается при старте API с CLAMAV_ASYNC.
+func (h *FileHandler) RescanPending(ctx context.Context) {
+	if h.fileSvc == nil || h.fileSvc.Scanner == nil || !h.fileSvc.ScanAsync {
+		return
+	}
+	pending, err := h.uploadRepo.PendingScans(ctx)
+	if err != nil {
+		logger.Errorf("file rescan pending: %v", err)
+		return
+	}
+	if len(pending) > 0 {
+		logger.Infof("file rescan pending: %d files", len(pending))
+	}
+	for _, p := range pending {
+		go h.scanInBackground(p.UserID, p.FileName)
+	}
+}
+
+// scanInBackground проверяет файл антивирусом после ответа на загрузку (CLAMAV_ASYNC), сохраняет результат
+// и сообщает его загрузившему и чатам, где файл уже отправлен. Пока clamd недоступен, проверка повторяется
+// с растущей паузой; всё это время файл остаётся pending.
+func (h *FileHandler) scanInBackground(userID, filename string) {
+	var status string
+	wait := scanRetryMin
+	for attempt := 1; ; attempt++ {
+		scanCtx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		var err error
+		status, err = h.fileSvc.ScanStored(scanCtx, filename)
+		cancel()
+		if err == nil {
+			break
+		}
+		if errors.Is(err, blobstore.ErrNotFound) {
+			logger.Infof("file scan %s: file removed before scan", filename)
+			return
+		}
+		if attempt >= scanMaxAttempts {
+			logger.Errorf("file scan %s: %v (giving up after %d attempts, stays pending)", filename, err, attempt)
+			return
+		}
+		logger.Errorf("file scan %s: %v (retry in %s)", filename, err, wait)
+		time.Sleep(wait)
+		wait = min(wait*2, scanRetryMax)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if status == model.ScanInfected {
+		logger.Infof("file scan %s: infected, quarantined", filename)
+	}
+	if err := h.uploadRepo.SetScanStatus(ctx, filename, status); err != nil {
+		logger.Errorf("file scan %s: %v", filename, err)
+		return
+	}
+	ev := ws.OutgoingMessage{
+		Type:    ws.EventFileScanStatus,
+		Payload: ws.FileScanStatusPayload{FileURL: "/api/files/" + filename, ScanStatus: status},
+	}
+	h.hub.SendToUser(userID, ev)
+	chatIDs, err := h.uploadRepo.ChatIDsReferencing(ctx, filename)
+	if err != nil {
+		logger.Errorf("file scan %s: %v", filename, err)
+		return
+	}
+	for _, chatID := range chatIDs {
+		h.hub.BroadcastToChat(ctx, chatID, ev)
+	}
+}
+
+// GetFileMeta возвращает сведения о файле: статус проверки антивирусом (pending, clean, infected) — клиент
+// опрашивает его, пока файл pending, и включает скачивание после clean, — и размеры и BlurHash картинки.
+func (h *FileHandler) GetFileMeta(w http.ResponseWriter, r *http.Request) {
+	filename := filepath.Base(chi.URLParam(r, "filename"))
+	ok, err := h.uploadRepo.CanAccess(r.Context(), middleware.GetUserID(r.Context()), filename)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get file status")
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "file not found")
+		return
+	}
+	meta, err := h.uploadRepo.Meta(r.Context(), filename)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		writeError(w, http.StatusInternalServerError, "failed to get file status")
+		return
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		// Файл вне учёта (вложение, загруженное до учёта) — проверок не было, сведений нет.
+		meta.ScanStatus = model.ScanClean
+	}
+	writeJSON(w, http.StatusOK, meta)
 }
 
+// Serve отдаёт файл по сессии — только тем, кому он доступен (CanAccess). Без сессии файл открывается
+// лишь по подписанной ссылке (ServeSigned).
 func (h *FileHandler) Serve(w http.ResponseWriter, r *http.Request) {
 	filename := filepath.Base(chi.URLParam(r, "filename"))
+	ok, err := h.uploadRepo.CanAccess(r.Context(), middleware.GetUserID(r.Context()), filename)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get file")
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "file not found")
+		return
+	}
+	h.serveFile(w, r, filename)
+}
+
+// Подписанные ссылки: срок по умолчанию и максимальный.
+const (
+	defaultSignedURLTTL = time.Hour
+	maxSignedURLTTL     = 7 * 24 * time.Hour
+)
+
+type signedURLRequest struct {
+	ExpiresInSeconds int `json:"expires_in_seconds"`
+}
+
+// SignedURLResponse — ссылка на файл, открывающаяся без сессии до expires_at.
+type SignedURLResponse struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CreateSignedURL выдаёт временную ссылку на файл (например, для письма или внешнего просмотрщика).
+// Ссылку можно получить только на свой файл или вложение из своего чата.
+func (h *FileHandler) CreateSignedURL(w http.ResponseWriter, r *http.Request) {
+	if h.cfg.FileURLSigningKey == "" {
+		writeError(w, http.StatusServiceUnavailable, "signed urls are not configured")
+		return
+	}
+	var req signedURLRequest
+	if err := decodeJSON(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		writeDecodeError(w, err, "invalid body")
+		return
+	}
+	ttl := defaultSignedURLTTL
+	if req.ExpiresInSeconds < 0 {
+		writeError(w, http.StatusBadRequest, "expires_in_seconds must be positive")
+		return
+	}
+	if req.ExpiresInSeconds > 0 {
+		ttl = min(time.Duration(req.ExpiresInSeconds)*time.Second, maxSignedURLTTL)
+	}
+
+	filename := filepath.Base(chi.URLParam(r, "filename"))
+	ok, err := h.uploadRepo.CanAccess(r.Context(), middleware.GetUserID(r.Context()), filename)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to create signed url")
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "file not found")
+		return
+	}
+	expiresAt := time.Now().Add(ttl).UTC().Truncate(time.Second)
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	q := url.Values{"expires": {expires}, "sig": {h.fileSignature(filename, expires)}}
+	writeJSON(w, http.StatusOK, SignedURLResponse{
+		URL:       "/api/files/signed/" + url.PathEscape(filename) + "?" + q.Encode(),
+		ExpiresAt: expiresAt,
+	})
+}
+
+// ServeSigned отдаёт файл по подписанной ссылке без сессии: проверяются подпись (HMAC имени и срока) и срок.
+// Параметры name и disposition не подписываются — они влияют только на заголовки ответа.
+func (h *FileHandler) ServeSigned(w http.ResponseWriter, r *http.Request) {
+	if h.cfg.FileURLSigningKey == "" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	filename := filepath.Base(chi.URLParam(r, "filename"))
+	expires := r.URL.Query().Get("expires")
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		writeError(w, http.StatusForbidden, "link expired or invalid")
+		return
+	}
+	if !hmac.Equal([]byte(r.URL.Query().Get("sig")), []byte(h.fileSignature(filename, expires))) {
+		writeError(w, http.StatusForbidden, "link expired or invalid")
+		return
+	}
+	h.serveFile(w, r, filename)
+}
+
+func (h *FileHandler) fileSignature(filename, expires string) string {
+	m := hmac.New(sha256.New, []byte(h.cfg.FileURLSigningKey))
+	m.Write([]byte(filename + "\n" + expires))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+func (h *FileHandler) serveFile(w http.ResponseWriter, r *http.Request, filename string) {
+	status, err := h.uploadRepo.ScanStatus(r.Context(), filename)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get file")
+		return
+	}
+	switch status {
+	case model.ScanPending:
+		writeError(w, http.StatusConflict, "file is pending virus scan")
+		return
+	case model.ScanInfected:
+		writeError(w, http.StatusForbidden, "file quarantined by virus scan")
+		return
+	}
 	if h.fileSvc != nil {
 		h.fileSvc.Serve(w, r, filename)
 		return
 	}
 	// Прокси GET на микросервис файлов
-	rawQuery := ""
-	if name := r.URL.Query().Get("name"); name != "" {
-		rawQuery = "name=" + url.QueryEscape(name)
+	q := url.Values{}
+	for _, key := range []string{"name", "disposition"} {
+		if v := r.URL.Query().Get(key); v != "" {
+			q.Set(key, v)
+		}
 	}
+	rawQuery := q.Encode()
 	proxyURL := h.fileBase + "/files/" + url.PathEscape(filename)
 	if rawQuery != "" {
 		proxyURL += "?" + rawQuery
@@ -92,6 +511,7 @@ func (h *FileHandler) Serve(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, "internal error")
 		return
 	}
+	copyFileRequestHeaders(proxyReq.Header, r.Header)
 	resp, err := h.fileClient.Do(proxyReq)
 	if err != nil {
 		writeError(w, http.StatusBadGateway, "file service unavailable")
@@ -100,10 +520,27 @@ func (h *FileHandler) Serve(w http.ResponseWriter, r *http.Request) {
 	defer resp.Body.Close()
 	for k, v := range resp.Header {
 		if strings.EqualFold(k, "Content-Length") || strings.EqualFold(k, "Content-Type") ||
-			strings.EqualFold(k, "Content-Disposition") {
+			strings.EqualFold(k, "Content-Disposition") || strings.EqualFold(k, "X-Content-Type-Options") ||
+			strings.EqualFold(k, "Content-Security-Policy") || isFileResponseHeader(k) {
 			w.Header()[k] = v
 		}
 	}
 	w.WriteHeader(resp.StatusCode)
 	io.Copy(w, resp.Body)
 }
+
+// copyFileRequestHeaders передаёт сервису файлов условия запроса (для 304) и Accept-Encoding: заданный явно,
+// он отключает распаковку в http.Client, и сжатый файл идёт клиенту как есть.
+func copyFileRequestHeaders(dst, src http.Header) {
+	for _, k := range []string{"If-None-Match", "If-Modified-Since", "Accept-Encoding"} {
+		if v := src.Get(k); v != "" {
+			dst.Set(k, v)
+		}
+	}
+}
+
+// isFileResponseHeader — заголовки кеширования и кодирования из ответа сервиса файлов, которые проксируются клиенту.
+func isFileResponseHeader(k string) bool {
+	return strings.EqualFold(k, "ETag") || strings.EqualFold(k, "Last-Modified") || strings.EqualFold(k, "Cache-Control") ||
+		strings.EqualFold(k, "Content-Encoding") || strings.EqualFold(k, "Vary")
+}
@@ -2,8 +2,10 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/messenger/internal/logger"
 )
@@ -24,6 +26,30 @@ func writeError(w http.ResponseWriter, status int, msg string) {
 	writeJSON(w, status, errorResponse{Error: msg})
 }
 
+// decodeJSON читает тело запроса в v. Неизвестные поля — ошибка: опечатка клиента ("chatId" вместо "chat_id")
+// иначе молча терялась бы и превращалась в непонятное "required".
+func decodeJSON(r *http.Request, v any) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// writeDecodeError отвечает на ошибку decodeJSON: 413 — тело больше лимита, 400 с именем поля — неизвестное поле,
+// иначе 400 с msg.
+func writeDecodeError(w http.ResponseWriter, err error, msg string) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+		return
+	}
+	// encoding/json не экспортирует тип этой ошибки: `json: unknown field "chatId"`.
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		writeError(w, http.StatusBadRequest, "unknown field "+field)
+		return
+	}
+	writeError(w, http.StatusBadRequest, msg)
+}
+
 func queryInt(r *http.Request, key string, defaultVal int) int {
 	v := r.URL.Query().Get(key)
 	if v == "" {
@@ -35,3 +61,83 @@ func queryInt(r *http.Request, key string, defaultVal int) int {
 	}
 	return n
 }
+
+// Page — конверт ответа списковых эндпоинтов. Отдаётся при ?envelope=1,
+// иначе — голый массив (обратная совместимость со старыми клиентами).
+// Списки с курсором вместо offset отдают NextCursor; Total — общее число по фильтру, если он считается.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	HasMore    bool   `json:"has_more"`
+	NextOffset *int   `json:"next_offset,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Total      *int   `json:"total,omitempty"`
+}
+
+func wantsEnvelope(r *http.Request) bool {
+	v := r.URL.Query().Get("envelope")
+	return v == "1" || v == "true"
+}
+
+// pageParams читает limit/offset из query: limit ограничен [1, maxLimit], offset >= 0.
+func pageParams(r *http.Request, defaultLimit, maxLimit int) (limit, offset int) {
+	limit = queryInt(r, "limit", defaultLimit)
+	if limit < 1 {
+		limit = defaultLimit
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	offset = queryInt(r, "offset", 0)
+	if offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+// writePage отдаёт список, запрошенный из БД с limit+1: лишний элемент означает, что есть следующая страница,
+// и в ответ не попадает.
+func writePage[T any](w http.ResponseWriter, r *http.Request, items []T, limit, offset int) {
+	hasMore := len(items) > limit
+	if hasMore {
+		items = items[:limit]
+	}
+	writePageItems(w, r, items, hasMore, limit, offset)
+}
+
+// writeList отдаёт непагинируемый список: с ?envelope=1 — в той же обёртке Page, целиком и без has_more.
+func writeList[T any](w http.ResponseWriter, r *http.Request, items []T) {
+	writePageItems(w, r, items, false, len(items), 0)
+}
+
+// writeCursorPage — как writePageItems, но следующая страница задаётся курсором next (при hasMore).
+func writeCursorPage[T any](w http.ResponseWriter, r *http.Request, items []T, hasMore bool, next string) {
+	if items == nil {
+		items = []T{}
+	}
+	if !wantsEnvelope(r) {
+		writeJSON(w, http.StatusOK, items)
+		return
+	}
+	page := Page[T]{Items: items, HasMore: hasMore}
+	if hasMore {
+		page.NextCursor = next
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// writePageItems — для списков, отфильтрованных после запроса (has_more определён заранее по limit+1).
+func writePageItems[T any](w http.ResponseWriter, r *http.Request, items []T, hasMore bool, limit, offset int) {
+	if items == nil {
+		items = []T{}
+	}
+	if !wantsEnvelope(r) {
+		writeJSON(w, http.StatusOK, items)
+		return
+	}
+	page := Page[T]{Items: items, HasMore: hasMore}
+	if hasMore {
+		next := offset + limit
+		page.NextOffset = &next
+	}
+	writeJSON(w, http.StatusOK, page)
+}
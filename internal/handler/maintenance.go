@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/messenger/internal/logger"
+	"github.com/messenger/internal/maintenance"
+	"github.com/messenger/internal/middleware"
+	"github.com/messenger/internal/repository"
+)
+
+type MaintenanceHandler struct {
+	mode     *maintenance.Mode
+	permRepo *repository.PermissionRepository
+}
+
+func NewMaintenanceHandler(mode *maintenance.Mode, permRepo *repository.PermissionRepository) *MaintenanceHandler {
+	return &MaintenanceHandler{mode: mode, permRepo: permRepo}
+}
+
+// GetStatus отдаёт состояние режима обслуживания (без авторизации) — клиент показывает баннер при загрузке.
+func (h *MaintenanceHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.mode.Status())
+}
+
+type setMaintenanceRequest struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message"`
+}
+
+// SetStatus включает или выключает режим обслуживания. Только для администраторов.
+func (h *MaintenanceHandler) SetStatus(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	perm, err := h.permRepo.GetByUserID(r.Context(), userID)
+	if err != nil || !perm.Administrator {
+		writeError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+	var req setMaintenanceRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err, "invalid request body")
+		return
+	}
+	if !req.Enabled && h.mode.Forced() {
+		writeError(w, http.StatusConflict, "Режим обслуживания включён в конфигурации (MAINTENANCE_MODE)")
+		return
+	}
+	status, err := h.mode.Set(r.Context(), req.Enabled, req.Message)
+	if err != nil {
+		logger.Errorf("set maintenance mode user=%s: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "failed to set maintenance mode")
+		return
+	}
+	logger.Infof("maintenance mode set to %v by user=%s", status.Enabled, userID)
+	writeJSON(w, http.StatusOK, status)
+}
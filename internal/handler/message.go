@@ -1,11 +1,20 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 	"github.com/messenger/internal/middleware"
+	"github.com/messenger/internal/model"
 	"github.com/messenger/internal/repository"
+	"github.com/messenger/internal/sysmsg"
+	"github.com/messenger/internal/ws"
 )
 
 type MessageHandler struct {
@@ -13,6 +22,11 @@ type MessageHandler struct {
 	chatRepo   *repository.ChatRepository
 	reactRepo  *repository.ReactionRepository
 	pinnedRepo *repository.PinnedRepository
+	hub        *ws.Hub
+	// maxOffset — наибольший offset в GetMessages (0 — без ограничения).
+	maxOffset int
+	// maxPinned — наибольший limit в GetPinnedMessages.
+	maxPinned int
 }
 
 func NewMessageHandler(
@@ -20,8 +34,14 @@ func NewMessageHandler(
 	chatRepo *repository.ChatRepository,
 	reactRepo *repository.ReactionRepository,
 	pinnedRepo *repository.PinnedRepository,
+	hub *ws.Hub,
+	maxOffset int,
+	maxPinned int,
 ) *MessageHandler {
-	return &MessageHandler{msgRepo: msgRepo, chatRepo: chatRepo, reactRepo: reactRepo, pinnedRepo: pinnedRepo}
+	if maxPinned <= 0 {
+		maxPinned = defaultPinnedLimit
+	}
+	return &MessageHandler{msgRepo: msgRepo, chatRepo: chatRepo, reactRepo: reactRepo, pinnedRepo: pinnedRepo, hub: hub, maxOffset: maxOffset, maxPinned: maxPinned}
 }
 
 func (h *MessageHandler) GetMessages(w http.ResponseWriter, r *http.Request) {
@@ -38,36 +58,152 @@ func (h *MessageHandler) GetMessages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	limit := queryInt(r, "limit", 50)
-	offset := queryInt(r, "offset", 0)
-	if limit > 100 {
-		limit = 100
+	limit, offset := pageParams(r, 50, 100)
+	if before := r.URL.Query().Get("before"); before != "" {
+		h.getMessagesBefore(w, r, chatID, userID, before, limit)
+		return
+	}
+	if h.maxOffset > 0 && offset > h.maxOffset {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("offset too large (max %d): page deeper history with ?before=<message_id>", h.maxOffset))
+		return
 	}
 
-	messages, err := h.msgRepo.GetChatMessages(r.Context(), chatID, limit, offset)
+	messages, err := h.msgRepo.GetChatMessages(r.Context(), chatID, userID, limit+1, offset)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to get messages")
 		return
 	}
+	// Лишнюю (limit+1) строку отбрасываем до обогащения, чтобы не запрашивать для неё реакции и ответ.
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
 
-	// Enrich with reactions and reply-to
-	for i := range messages {
-		reactions, err := h.reactRepo.GetByMessage(r.Context(), messages[i].ID)
-		if err == nil && len(reactions) > 0 {
-			messages[i].Reactions = reactions
-		}
+	h.msgRepo.AttachReactionsAndReplies(r.Context(), h.reactRepo, messages)
+	sysmsg.Localize(sysmsg.RequestLang(r), messages)
 
-		if messages[i].ReplyToID != nil {
-			replyMsg, err := h.msgRepo.GetByID(r.Context(), *messages[i].ReplyToID)
-			if err == nil {
-				messages[i].ReplyTo = replyMsg
-			}
-		}
+	writePageItems(w, r, messages, hasMore, limit, offset)
+}
+
+// getMessagesBefore — страница истории старше сообщения before (курсор, без ограничения глубины):
+// next_cursor в конверте — id последнего сообщения страницы.
+func (h *MessageHandler) getMessagesBefore(w http.ResponseWriter, r *http.Request, chatID, userID, before string, limit int) {
+	if uuid.Validate(before) != nil {
+		writeError(w, http.StatusBadRequest, "invalid before")
+		return
+	}
+	cursor, err := h.msgRepo.GetByID(r.Context(), before)
+	if err != nil || cursor.ChatID != chatID {
+		writeError(w, http.StatusBadRequest, "invalid before")
+		return
+	}
+	messages, err := h.msgRepo.GetChatMessagesBefore(r.Context(), chatID, userID, &cursor.CreatedAt, cursor.ID, limit+1)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get messages")
+		return
+	}
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+
+	h.msgRepo.AttachReactionsAndReplies(r.Context(), h.reactRepo, messages)
+	sysmsg.Localize(sysmsg.RequestLang(r), messages)
+
+	next := ""
+	if len(messages) > 0 {
+		next = messages[len(messages)-1].ID
+	}
+	writeCursorPage(w, r, messages, hasMore, next)
+}
+
+// GetUnreadMessages — сообщения других участников после позиции прочтения пользователя (last_read_at; если чат
+// ни разу не читали — с момента вступления), новые первыми, не больше limit. Чат, отмеченный непрочитанным
+// без новых сообщений, отдаёт последнее сообщение собеседников. has_more в конверте — непрочитанных больше:
+// более старые догружаются через GET .../messages?before=<next_cursor>. Разделитель «новые сообщения» —
+// перед самым старым из полученных, если has_more нет.
+func (h *MessageHandler) GetUnreadMessages(w http.ResponseWriter, r *http.Request) {
+	chatID := chi.URLParam(r, "chatId")
+	userID := middleware.GetUserID(r.Context())
+
+	isMember, err := h.chatRepo.IsMember(r.Context(), chatID, userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to check membership")
+		return
+	}
+	if !isMember {
+		writeError(w, http.StatusForbidden, "not a member")
+		return
+	}
+
+	limit, _ := pageParams(r, 100, 200)
+	messages, err := h.msgRepo.GetUnreadMessages(r.Context(), chatID, userID, limit+1)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get messages")
+		return
+	}
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+
+	h.msgRepo.AttachReactionsAndReplies(r.Context(), h.reactRepo, messages)
+	sysmsg.Localize(sysmsg.RequestLang(r), messages)
+
+	next := ""
+	if len(messages) > 0 {
+		next = messages[len(messages)-1].ID
 	}
+	writeCursorPage(w, r, messages, hasMore, next)
+}
 
-	writeJSON(w, http.StatusOK, messages)
+// SendMessageRequest — тело POST /api/chats/{chatId}/messages; поля как у WebSocket-события new_message.
+type SendMessageRequest struct {
+	Content       string             `json:"content"`
+	ContentType   model.ContentType  `json:"content_type"`
+	FileURL       string             `json:"file_url"`
+	FileName      string             `json:"file_name"`
+	FileSize      int64              `json:"file_size"`
+	Attachments   []model.Attachment `json:"attachments"`
+	Location      *model.Location    `json:"location"`
+	ContactUserID string             `json:"contact_user_id"`
+	ReplyToID     string             `json:"reply_to_id"`
 }
 
+// SendMessage отправляет сообщение в чат по REST — для ботов (API-ключ) и клиентов без WebSocket.
+// Проверки и рассылка те же, что у new_message по WebSocket.
+func (h *MessageHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
+	var req SendMessageRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err, "invalid body")
+		return
+	}
+	m, sendErr := h.hub.PostMessage(r.Context(), middleware.GetUserID(r.Context()), ws.IncomingMessage{
+		Type:          ws.EventNewMessage,
+		ChatID:        chi.URLParam(r, "chatId"),
+		Content:       req.Content,
+		ContentType:   req.ContentType,
+		FileURL:       req.FileURL,
+		FileName:      req.FileName,
+		FileSize:      req.FileSize,
+		Attachments:   req.Attachments,
+		Location:      req.Location,
+		ContactUserID: req.ContactUserID,
+		ReplyToID:     req.ReplyToID,
+	})
+	if sendErr != nil {
+		writeError(w, sendErr.Status, sendErr.Msg)
+		return
+	}
+	writeJSON(w, http.StatusCreated, m)
+}
+
+type markReadRequest struct {
+	// MessageID — прочитано до этого сообщения включительно; пусто — весь чат.
+	MessageID string `json:"message_id"`
+}
+
+// MarkAsRead отмечает чат прочитанным. Тело необязательно: {"message_id": "..."} — «прочитано до сюда».
 func (h *MessageHandler) MarkAsRead(w http.ResponseWriter, r *http.Request) {
 	chatID := chi.URLParam(r, "chatId")
 	userID := middleware.GetUserID(r.Context())
@@ -82,7 +218,18 @@ func (h *MessageHandler) MarkAsRead(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.msgRepo.MarkAsRead(r.Context(), chatID, userID); err != nil {
+	var req markReadRequest
+	if r.ContentLength != 0 {
+		if err := decodeJSON(r, &req); err != nil && !errors.Is(err, io.EOF) {
+			writeDecodeError(w, err, "invalid body")
+			return
+		}
+	}
+	if err := h.hub.MarkRead(r.Context(), chatID, userID, req.MessageID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "message not found")
+			return
+		}
 		writeError(w, http.StatusInternalServerError, "failed to mark as read")
 		return
 	}
@@ -91,29 +238,116 @@ func (h *MessageHandler) MarkAsRead(w http.ResponseWriter, r *http.Request) {
 }
 
 // SearchMessages searches messages across the user's chats.
+// Optional filters: chat_id, sender_id, content_type, from, to (RFC3339 or YYYY-MM-DD; a date-only "to" is inclusive).
 func (h *MessageHandler) SearchMessages(w http.ResponseWriter, r *http.Request) {
 	userID := middleware.GetUserID(r.Context())
-	query := r.URL.Query().Get("q")
-	if query == "" {
-		writeJSON(w, http.StatusOK, []any{})
+	q := r.URL.Query()
+	query := q.Get("q")
+
+	filter := repository.SearchFilter{
+		ChatID:      q.Get("chat_id"),
+		SenderID:    q.Get("sender_id"),
+		ContentType: model.ContentType(q.Get("content_type")),
+	}
+	switch filter.ContentType {
+	case "", model.ContentTypeText, model.ContentTypeImage, model.ContentTypeFile, model.ContentTypeVoice, model.ContentTypeSystem,
+		model.ContentTypeLocation, model.ContentTypeContact:
+	default:
+		writeError(w, http.StatusBadRequest, "invalid content_type: expected text, image, file, voice, system, location or contact")
+		return
+	}
+	if v := q.Get("from"); v != "" {
+		t, _, err := parseSearchDate(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid from: expected RFC3339 or YYYY-MM-DD")
+			return
+		}
+		filter.From = &t
+	}
+	if v := q.Get("to"); v != "" {
+		t, dateOnly, err := parseSearchDate(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid to: expected RFC3339 or YYYY-MM-DD")
+			return
+		}
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		filter.To = &t
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		writeError(w, http.StatusBadRequest, "from must be before to")
 		return
 	}
 
-	limit := queryInt(r, "limit", 30)
-	if limit > 50 {
-		limit = 50
+	limit, offset := pageParams(r, 30, 50)
+	if query == "" && filter.IsEmpty() {
+		writePage(w, r, []model.Message{}, limit, offset)
+		return
 	}
-	chatID := r.URL.Query().Get("chat_id")
 
-	messages, err := h.msgRepo.SearchMessages(r.Context(), userID, query, limit, chatID)
+	messages, err := h.msgRepo.SearchMessages(r.Context(), userID, query, limit+1, offset, filter)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "search failed")
 		return
 	}
-	writeJSON(w, http.StatusOK, messages)
+	sysmsg.Localize(sysmsg.RequestLang(r), messages)
+	writePage(w, r, messages, limit, offset)
+}
+
+// parseSearchDate parses RFC3339 or YYYY-MM-DD (UTC). dateOnly is true for the second form.
+func parseSearchDate(v string) (t time.Time, dateOnly bool, err error) {
+	if t, err = time.Parse(time.RFC3339, v); err == nil {
+		return t, false, nil
+	}
+	if t, err = time.Parse("2006-01-02", v); err == nil {
+		return t, true, nil
+	}
+	return time.Time{}, false, err
+}
+
+// GetChatMedia returns media messages of a chat for the "shared media" tab.
+// Query: type=image|file|voice (default: all three), limit, offset.
+func (h *MessageHandler) GetChatMedia(w http.ResponseWriter, r *http.Request) {
+	chatID := chi.URLParam(r, "chatId")
+	userID := middleware.GetUserID(r.Context())
+
+	isMember, err := h.chatRepo.IsMember(r.Context(), chatID, userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to check membership")
+		return
+	}
+	if !isMember {
+		writeError(w, http.StatusForbidden, "not a member")
+		return
+	}
+
+	var types []model.ContentType
+	switch t := model.ContentType(r.URL.Query().Get("type")); t {
+	case "":
+		types = []model.ContentType{model.ContentTypeImage, model.ContentTypeFile, model.ContentTypeVoice}
+	case model.ContentTypeImage, model.ContentTypeFile, model.ContentTypeVoice:
+		types = []model.ContentType{t}
+	default:
+		writeError(w, http.StatusBadRequest, "invalid type: expected image, file or voice")
+		return
+	}
+
+	limit, offset := pageParams(r, 50, 100)
+
+	messages, err := h.msgRepo.GetChatMedia(r.Context(), chatID, userID, types, limit+1, offset)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get media")
+		return
+	}
+	writePage(w, r, messages, limit, offset)
 }
 
-// GetPinnedMessages returns pinned messages for a chat.
+// defaultPinnedLimit — сколько закреплённых сообщений отдаётся без ?limit=.
+const defaultPinnedLimit = 20
+
+// GetPinnedMessages returns pinned messages for a chat, most recently pinned first (limit/offset).
+// С ?envelope=1 в total — сколько всего закреплено.
 func (h *MessageHandler) GetPinnedMessages(w http.ResponseWriter, r *http.Request) {
 	chatID := chi.URLParam(r, "chatId")
 	userID := middleware.GetUserID(r.Context())
@@ -128,12 +362,58 @@ func (h *MessageHandler) GetPinnedMessages(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	pinned, err := h.pinnedRepo.GetPinned(r.Context(), chatID)
+	limit, offset := pageParams(r, defaultPinnedLimit, h.maxPinned)
+	pinned, err := h.pinnedRepo.GetPinned(r.Context(), chatID, limit+1, offset)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to get pinned messages")
 		return
 	}
-	writeJSON(w, http.StatusOK, pinned)
+	if !wantsEnvelope(r) {
+		writePage(w, r, pinned, limit, offset)
+		return
+	}
+	total, err := h.pinnedRepo.Count(r.Context(), chatID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get pinned messages")
+		return
+	}
+	page := Page[model.PinnedMessage]{Items: pinned, Total: &total}
+	if len(pinned) > limit {
+		page.Items = pinned[:limit]
+		page.HasMore = true
+		next := offset + limit
+		page.NextOffset = &next
+	}
+	if page.Items == nil {
+		page.Items = []model.PinnedMessage{}
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// GetReceipts возвращает, кто из участников получил и прочитал сообщение и когда. Доступно участникам чата.
+func (h *MessageHandler) GetReceipts(w http.ResponseWriter, r *http.Request) {
+	messageID := chi.URLParam(r, "messageId")
+	userID := middleware.GetUserID(r.Context())
+	msg, err := h.msgRepo.GetByID(r.Context(), messageID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "message not found")
+		return
+	}
+	isMember, err := h.chatRepo.IsMember(r.Context(), msg.ChatID, userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to check membership")
+		return
+	}
+	if !isMember {
+		writeError(w, http.StatusForbidden, "not a member")
+		return
+	}
+	receipts, err := h.msgRepo.GetReceipts(r.Context(), messageID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get receipts")
+		return
+	}
+	writeJSON(w, http.StatusOK, receipts)
 }
 
 // GetReactions returns reactions for a message.
@@ -146,3 +426,90 @@ func (h *MessageHandler) GetReactions(w http.ResponseWriter, r *http.Request) {
 	}
 	writeJSON(w, http.StatusOK, reactions)
 }
+
+// GetThread возвращает ветку сообщения: прямые ответы на него от старых к новым
+// (limit/offset, как у истории чата). Доступно участникам чата.
+func (h *MessageHandler) GetThread(w http.ResponseWriter, r *http.Request) {
+	messageID := chi.URLParam(r, "messageId")
+	userID := middleware.GetUserID(r.Context())
+	if uuid.Validate(messageID) != nil {
+		writeError(w, http.StatusNotFound, "message not found")
+		return
+	}
+	root, err := h.msgRepo.GetByID(r.Context(), messageID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "message not found")
+		return
+	}
+	isMember, err := h.chatRepo.IsMember(r.Context(), root.ChatID, userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to check membership")
+		return
+	}
+	if !isMember {
+		writeError(w, http.StatusForbidden, "not a member")
+		return
+	}
+
+	limit, offset := pageParams(r, 100, 500)
+	messages, err := h.msgRepo.GetThread(r.Context(), root.ID, userID, limit+1, offset)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get thread")
+		return
+	}
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+	h.msgRepo.AttachReactionsAndReplies(r.Context(), h.reactRepo, messages)
+	sysmsg.Localize(sysmsg.RequestLang(r), messages)
+
+	writePageItems(w, r, messages, hasMore, limit, offset)
+}
+
+// maxReactionBatch — сколько сообщений можно запросить в GetChatReactions (как наибольшая страница истории).
+const maxReactionBatch = 100
+
+// GetChatReactions возвращает сгруппированные реакции сразу для нескольких сообщений чата:
+// GET /api/chats/{chatId}/reactions?message_ids=id1,id2,... → {"<message_id>": [{emoji, count, users}]}.
+// Сообщения без реакций и чужих чатов в ответ не попадают.
+func (h *MessageHandler) GetChatReactions(w http.ResponseWriter, r *http.Request) {
+	chatID := chi.URLParam(r, "chatId")
+	userID := middleware.GetUserID(r.Context())
+
+	var ids []string
+	for _, id := range strings.Split(r.URL.Query().Get("message_ids"), ",") {
+		if id = strings.TrimSpace(id); id == "" {
+			continue
+		}
+		if uuid.Validate(id) != nil {
+			writeError(w, http.StatusBadRequest, "invalid message_ids")
+			return
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		writeError(w, http.StatusBadRequest, "message_ids required")
+		return
+	}
+	if len(ids) > maxReactionBatch {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("too many message_ids (max %d)", maxReactionBatch))
+		return
+	}
+
+	isMember, err := h.chatRepo.IsMember(r.Context(), chatID, userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to check membership")
+		return
+	}
+	if !isMember {
+		writeError(w, http.StatusForbidden, "not a member")
+		return
+	}
+	groups, err := h.reactRepo.GetGroupedByMessages(r.Context(), chatID, ids)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get reactions")
+		return
+	}
+	writeJSON(w, http.StatusOK, groups)
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/messenger/internal/logger"
+	"github.com/messenger/internal/middleware"
+	"github.com/messenger/internal/repository"
+	"github.com/messenger/internal/ws"
+)
+
+// maxResyncTargets — сколько чатов и пользователей вместе можно указать в одном запросе ForceResync.
+const maxResyncTargets = 1000
+
+type forceResyncRequest struct {
+	ChatIDs []string `json:"chat_ids"`
+	UserIDs []string `json:"user_ids"`
+	Reason  string   `json:"reason"`
+}
+
+// ForceResync рассылает resync_required участникам чатов chat_ids (перечитать эти чаты) и пользователям
+// user_ids (перечитать всё) — после изменений данных в обход API. Только для администратора; пишется в журнал.
+func (h *ChatHandler) ForceResync(w http.ResponseWriter, r *http.Request) {
+	actorID := middleware.GetUserID(r.Context())
+	perm, err := h.permRepo.GetByUserID(r.Context(), actorID)
+	if err != nil || !perm.Administrator {
+		writeError(w, http.StatusForbidden, "only administrator can force resync")
+		return
+	}
+	var req forceResyncRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err, "chat_ids or user_ids required")
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if len(req.ChatIDs) == 0 && len(req.UserIDs) == 0 {
+		writeError(w, http.StatusBadRequest, "chat_ids or user_ids required")
+		return
+	}
+	if len(req.ChatIDs)+len(req.UserIDs) > maxResyncTargets {
+		writeError(w, http.StatusBadRequest, "too many targets")
+		return
+	}
+	for _, id := range append(append([]string(nil), req.ChatIDs...), req.UserIDs...) {
+		if uuid.Validate(id) != nil {
+			writeError(w, http.StatusBadRequest, "invalid id: "+id)
+			return
+		}
+	}
+
+	for _, chatID := range req.ChatIDs {
+		h.hub.BroadcastToChat(r.Context(), chatID, ws.OutgoingMessage{
+			Type:    ws.EventResyncRequired,
+			Payload: ws.ResyncPayload{ChatIDs: []string{chatID}, Reason: req.Reason},
+		})
+	}
+	for _, userID := range req.UserIDs {
+		h.hub.SendToUser(userID, ws.OutgoingMessage{Type: ws.EventResyncRequired, Payload: ws.ResyncPayload{Reason: req.Reason}})
+	}
+
+	if err := h.audit.Record(r.Context(), actorID, repository.AuditForceResync, "", map[string]any{
+		"chat_ids": req.ChatIDs,
+		"user_ids": req.UserIDs,
+		"reason":   req.Reason,
+	}); err != nil {
+		logger.Errorf("forceResync: audit: %v", err)
+	}
+	logger.Infof("force resync by user=%s chats=%d users=%d", actorID, len(req.ChatIDs), len(req.UserIDs))
+	writeJSON(w, http.StatusOK, map[string]int{"chats": len(req.ChatIDs), "users": len(req.UserIDs)})
+}
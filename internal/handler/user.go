@@ -1,32 +1,33 @@
 package handler
 
 import (
-	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
-	"net/mail"
-	"regexp"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/messenger/internal/logger"
 	"github.com/messenger/internal/middleware"
 	"github.com/messenger/internal/model"
 	"github.com/messenger/internal/repository"
+	"github.com/messenger/internal/ws"
 )
 
-// phoneRe — международный формат: + и 8–15 цифр (E.164).
-var phoneRe = regexp.MustCompile(`^\+\d{8,15}$`)
-
 type UserHandler struct {
-	userRepo *repository.UserRepository
-	msgRepo  *repository.MessageRepository
-	permRepo *repository.PermissionRepository
+	userRepo   *repository.UserRepository
+	msgRepo    *repository.MessageRepository
+	permRepo   *repository.PermissionRepository
+	auditRepo  *repository.AuditRepository
+	hub        *ws.Hub
+	phoneRules PhoneRules
 }
 
-func NewUserHandler(userRepo *repository.UserRepository, msgRepo *repository.MessageRepository, permRepo *repository.PermissionRepository) *UserHandler {
-	return &UserHandler{userRepo: userRepo, msgRepo: msgRepo, permRepo: permRepo}
+func NewUserHandler(userRepo *repository.UserRepository, msgRepo *repository.MessageRepository, permRepo *repository.PermissionRepository, auditRepo *repository.AuditRepository, hub *ws.Hub, phoneRules PhoneRules) *UserHandler {
+	return &UserHandler{userRepo: userRepo, msgRepo: msgRepo, permRepo: permRepo, auditRepo: auditRepo, hub: hub, phoneRules: phoneRules}
 }
 
 func (h *UserHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
@@ -49,6 +50,68 @@ func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, user.ToPublic())
 }
 
+// maxPresenceBatch — сколько пользователей можно запросить в одном POST /api/users/presence.
+const maxPresenceBatch = 200
+
+type presenceBatchRequest struct {
+	UserIDs []string `json:"user_ids"`
+}
+
+// GetPresenceBatch возвращает онлайн-статус и last_seen_at для списка пользователей одним запросом.
+// Флаг is_online берётся из хаба: живые соединения этого экземпляра плюс свежий heartbeat остальных.
+// last_seen_at не отдаётся для пользователей, скрывших его (PUT /api/users/me/privacy).
+func (h *UserHandler) GetPresenceBatch(w http.ResponseWriter, r *http.Request) {
+	var req presenceBatchRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err, "invalid body")
+		return
+	}
+	ids := make([]string, 0, len(req.UserIDs))
+	seen := make(map[string]struct{}, len(req.UserIDs))
+	for _, id := range req.UserIDs {
+		if _, err := uuid.Parse(id); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid user id")
+			return
+		}
+		if _, dup := seen[id]; dup {
+			continue
+		}
+		seen[id] = struct{}{}
+		ids = append(ids, id)
+	}
+	if len(ids) > maxPresenceBatch {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("too many user_ids (max %d)", maxPresenceBatch))
+		return
+	}
+
+	list, err := h.userRepo.GetPresenceBatch(r.Context(), middleware.GetUserID(r.Context()), ids)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get presence")
+		return
+	}
+	online := make(map[string]struct{})
+	for _, id := range h.hub.OnlineUsers(r.Context(), ids) {
+		online[id] = struct{}{}
+	}
+	for i := range list {
+		p := &list[i]
+		_, p.IsOnline = online[p.UserID]
+		switch {
+		case !p.IsOnline:
+			p.Presence = model.PresenceOffline
+		case p.Presence == model.PresenceOffline:
+			p.Presence = model.PresenceOnline
+		}
+		if p.IsOnline {
+			p.LastSeenAt = nil
+		}
+	}
+	if list == nil {
+		list = []model.UserPresenceInfo{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
 // UserStatsResponse combines user profile with activity stats.
 type UserStatsResponse struct {
 	User           model.UserPublic `json:"user"`
@@ -78,11 +141,16 @@ func (h *UserHandler) GetUserStats(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *UserHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
-	users, err := h.userRepo.ListAll(r.Context(), 500)
+	limit, offset := pageParams(r, 500, 500)
+	users, err := h.userRepo.ListAll(r.Context(), limit+1, offset)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "list users failed")
 		return
 	}
+	hasMore := len(users) > limit
+	if hasMore {
+		users = users[:limit]
+	}
 	currentUserID := middleware.GetUserID(r.Context())
 	result := make([]model.UserPublic, 0, len(users))
 	for _, u := range users {
@@ -90,7 +158,7 @@ func (h *UserHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
 			result = append(result, u.ToPublic())
 		}
 	}
-	writeJSON(w, http.StatusOK, result)
+	writePageItems(w, r, result, hasMore, limit, offset)
 }
 
 // GetEmployees возвращает всех пользователей (список сотрудников). Только для администратора.
@@ -101,7 +169,7 @@ func (h *UserHandler) GetEmployees(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusForbidden, "only administrator can list employees")
 		return
 	}
-	users, err := h.userRepo.ListAll(r.Context(), 2000)
+	users, err := h.userRepo.ListAll(r.Context(), 2000, 0)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "list employees failed")
 		return
@@ -140,23 +208,29 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	var req CreateUserRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid body")
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err, "invalid body")
 		return
 	}
 	emailNorm := strings.TrimSpace(strings.ToLower(req.Email))
 	username := strings.TrimSpace(req.Username)
-	if emailNorm == "" || username == "" {
-		writeError(w, http.StatusBadRequest, "email and username required")
-		return
-	}
-	if _, err := mail.ParseAddress(req.Email); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid email format")
-		return
+	phone := normalizePhone(req.Phone)
+	var fieldErrs []FieldError
+	if emailNorm == "" {
+		fieldErrs = append(fieldErrs, FieldError{Field: "email", Code: codeRequired, Message: "email required"})
+	} else if fe := validateEmail("email", req.Email); fe != nil {
+		fieldErrs = append(fieldErrs, *fe)
+	}
+	if username == "" {
+		fieldErrs = append(fieldErrs, FieldError{Field: "username", Code: codeRequired, Message: "username required"})
+	}
+	if phone != "" {
+		if fe := h.phoneRules.validate("phone", phone); fe != nil {
+			fieldErrs = append(fieldErrs, *fe)
+		}
 	}
-	phone := strings.TrimSpace(req.Phone)
-	if phone != "" && !phoneRe.MatchString(phone) {
-		writeError(w, http.StatusBadRequest, "invalid phone: use international format (+ and 8–15 digits)")
+	if len(fieldErrs) > 0 {
+		writeValidationErrors(w, fieldErrs)
 		return
 	}
 	_, err = h.userRepo.GetByEmail(r.Context(), emailNorm)
@@ -180,6 +254,9 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 		CreatedAt:    time.Now().UTC(),
 	}
 	if err := h.userRepo.Create(r.Context(), u); err != nil {
+		if writeProfileConflict(w, err) {
+			return
+		}
 		writeError(w, http.StatusInternalServerError, "failed to create user")
 		return
 	}
@@ -219,16 +296,21 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 
 func (h *UserHandler) SearchUsers(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query().Get("q")
+	limit, offset := pageParams(r, 20, 50)
 	if query == "" {
-		writeJSON(w, http.StatusOK, []model.UserPublic{})
+		writePageItems(w, r, []model.UserPublic{}, false, limit, offset)
 		return
 	}
 
-	users, err := h.userRepo.SearchByUsername(r.Context(), query, 20)
+	users, err := h.userRepo.SearchByUsername(r.Context(), query, limit+1, offset)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "search failed")
 		return
 	}
+	hasMore := len(users) > limit
+	if hasMore {
+		users = users[:limit]
+	}
 
 	currentUserID := middleware.GetUserID(r.Context())
 	result := make([]model.UserPublic, 0, len(users))
@@ -237,7 +319,107 @@ func (h *UserHandler) SearchUsers(w http.ResponseWriter, r *http.Request) {
 			result = append(result, u.ToPublic())
 		}
 	}
-	writeJSON(w, http.StatusOK, result)
+	writePageItems(w, r, result, hasMore, limit, offset)
+}
+
+// SetStatusRequest — пользовательский статус. Срок: expires_at (RFC3339) или expires_in_minutes; без срока — бессрочно.
+type SetStatusRequest struct {
+	StatusEmoji      string     `json:"status_emoji"`
+	StatusText       string     `json:"status_text"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	ExpiresInMinutes int        `json:"expires_in_minutes,omitempty"`
+}
+
+const (
+	maxStatusEmojiLen = 16  // в символах: эмодзи бывают составными (флаги, ZWJ-последовательности)
+	maxStatusTextLen  = 100 // в символах
+)
+
+// SetStatus задаёт статус текущего пользователя и рассылает его участникам общих чатов.
+func (h *UserHandler) SetStatus(w http.ResponseWriter, r *http.Request) {
+	var req SetStatusRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err, "invalid body")
+		return
+	}
+	emoji := strings.TrimSpace(req.StatusEmoji)
+	text := strings.TrimSpace(req.StatusText)
+	if emoji == "" && text == "" {
+		writeError(w, http.StatusBadRequest, "status_emoji or status_text required")
+		return
+	}
+	if utf8.RuneCountInString(emoji) > maxStatusEmojiLen {
+		writeError(w, http.StatusBadRequest, "status_emoji too long")
+		return
+	}
+	if utf8.RuneCountInString(text) > maxStatusTextLen {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("status_text too long (max %d characters)", maxStatusTextLen))
+		return
+	}
+	expiresAt := req.ExpiresAt
+	if expiresAt == nil && req.ExpiresInMinutes != 0 {
+		if req.ExpiresInMinutes < 0 {
+			writeError(w, http.StatusBadRequest, "expires_in_minutes must be positive")
+			return
+		}
+		t := time.Now().UTC().Add(time.Duration(req.ExpiresInMinutes) * time.Minute)
+		expiresAt = &t
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		writeError(w, http.StatusBadRequest, "expires_at must be in the future")
+		return
+	}
+
+	userID := middleware.GetUserID(r.Context())
+	if err := h.userRepo.SetCustomStatus(r.Context(), userID, emoji, text, expiresAt); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to set status")
+		return
+	}
+	payload := ws.UserStatusTextPayload{UserID: userID, StatusEmoji: emoji, StatusText: text, StatusExpiresAt: expiresAt}
+	go h.hub.BroadcastToContacts(userID, ws.OutgoingMessage{Type: ws.EventUserStatusTextChanged, Payload: payload})
+	writeJSON(w, http.StatusOK, payload)
+}
+
+// ClearStatus снимает статус текущего пользователя.
+func (h *UserHandler) ClearStatus(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	if err := h.userRepo.SetCustomStatus(r.Context(), userID, "", "", nil); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to clear status")
+		return
+	}
+	go h.hub.BroadcastToContacts(userID, ws.OutgoingMessage{Type: ws.EventUserStatusTextChanged, Payload: ws.UserStatusTextPayload{UserID: userID}})
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// SetPrivacyRequest — настройки приватности текущего пользователя.
+type SetPrivacyRequest struct {
+	HideLastSeen bool `json:"hide_last_seen"`
+}
+
+// GetPrivacy возвращает настройки приватности текущего пользователя.
+func (h *UserHandler) GetPrivacy(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	hide, err := h.userRepo.GetHideLastSeen(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get privacy settings")
+		return
+	}
+	writeJSON(w, http.StatusOK, SetPrivacyRequest{HideLastSeen: hide})
+}
+
+// SetPrivacy сохраняет настройки приватности (скрытие last_seen_at во всех ответах для других пользователей).
+func (h *UserHandler) SetPrivacy(w http.ResponseWriter, r *http.Request) {
+	var req SetPrivacyRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err, "invalid body")
+		return
+	}
+	userID := middleware.GetUserID(r.Context())
+	if err := h.userRepo.SetHideLastSeen(r.Context(), userID, req.HideLastSeen); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to update privacy settings")
+		return
+	}
+	writeJSON(w, http.StatusOK, req)
 }
 
 type UpdateProfileRequest struct {
@@ -249,27 +431,16 @@ type UpdateProfileRequest struct {
 
 func (h *UserHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 	var req UpdateProfileRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid body")
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err, "invalid body")
 		return
 	}
 
-	// Валидация email (если передан)
-	reqEmail := strings.TrimSpace(req.Email)
-	if reqEmail != "" {
-		if _, err := mail.ParseAddress(reqEmail); err != nil {
-			writeError(w, http.StatusBadRequest, "invalid email format")
-			return
-		}
-	}
-
-	// Валидация телефона (если передан): строго +993XXXXXXXX
-	reqPhone := strings.TrimSpace(req.Phone)
-	if reqPhone != "" {
-		if !phoneRe.MatchString(reqPhone) {
-			writeError(w, http.StatusBadRequest, "invalid phone: use international format (+ and 8–15 digits)")
-			return
-		}
+	// Валидация email и телефона (если переданы)
+	reqEmail, reqPhone, fieldErrs := h.validateProfileContacts(req)
+	if len(fieldErrs) > 0 {
+		writeValidationErrors(w, fieldErrs)
+		return
 	}
 
 	userID := middleware.GetUserID(r.Context())
@@ -297,6 +468,9 @@ func (h *UserHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.userRepo.UpdateProfile(r.Context(), userID, username, avatarURL, email, phone); err != nil {
+		if writeProfileConflict(w, err) {
+			return
+		}
 		writeError(w, http.StatusInternalServerError, "failed to update profile")
 		return
 	}
@@ -308,6 +482,24 @@ func (h *UserHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, user.ToPublic())
 }
 
+// validateProfileContacts проверяет email и телефон из запроса на изменение профиля (пустые — не меняются).
+// Возвращает очищенные значения: email без пробелов в нижнем регистре (как при создании), телефон без разделителей.
+func (h *UserHandler) validateProfileContacts(req UpdateProfileRequest) (email, phone string, errs []FieldError) {
+	email = strings.ToLower(strings.TrimSpace(req.Email))
+	if email != "" {
+		if fe := validateEmail("email", email); fe != nil {
+			errs = append(errs, *fe)
+		}
+	}
+	phone = normalizePhone(req.Phone)
+	if phone != "" {
+		if fe := h.phoneRules.validate("phone", phone); fe != nil {
+			errs = append(errs, *fe)
+		}
+	}
+	return email, phone, errs
+}
+
 // UpdateUserProfile обновляет профиль пользователя по id. Своё — всегда, чужое — только администратор.
 func (h *UserHandler) UpdateUserProfile(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
@@ -324,23 +516,14 @@ func (h *UserHandler) UpdateUserProfile(w http.ResponseWriter, r *http.Request)
 		}
 	}
 	var req UpdateProfileRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid body")
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err, "invalid body")
 		return
 	}
-	reqEmail := strings.TrimSpace(req.Email)
-	if reqEmail != "" {
-		if _, err := mail.ParseAddress(reqEmail); err != nil {
-			writeError(w, http.StatusBadRequest, "invalid email format")
-			return
-		}
-	}
-	reqPhone := strings.TrimSpace(req.Phone)
-	if reqPhone != "" {
-		if !phoneRe.MatchString(reqPhone) {
-			writeError(w, http.StatusBadRequest, "invalid phone: use international format (+ and 8–15 digits)")
-			return
-		}
+	reqEmail, reqPhone, fieldErrs := h.validateProfileContacts(req)
+	if len(fieldErrs) > 0 {
+		writeValidationErrors(w, fieldErrs)
+		return
 	}
 	user, err := h.userRepo.GetByID(r.Context(), id)
 	if err != nil {
@@ -368,6 +551,9 @@ func (h *UserHandler) UpdateUserProfile(w http.ResponseWriter, r *http.Request)
 		phone = reqPhone
 	}
 	if err := h.userRepo.UpdateProfile(r.Context(), id, username, avatarURL, email, phone); err != nil {
+		if writeProfileConflict(w, err) {
+			return
+		}
 		writeError(w, http.StatusInternalServerError, "failed to update profile")
 		return
 	}
@@ -393,7 +579,11 @@ func (h *UserHandler) AddFavorite(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		ChatID string `json:"chat_id"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ChatID == "" {
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err, "chat_id required")
+		return
+	}
+	if req.ChatID == "" {
 		writeError(w, http.StatusBadRequest, "chat_id required")
 		return
 	}
@@ -475,8 +665,8 @@ func (h *UserHandler) UpdateUserPermissions(w http.ResponseWriter, r *http.Reque
 		}
 	}
 	var req UpdatePermissionsRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid body")
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err, "invalid body")
 		return
 	}
 	perm, err := h.permRepo.GetByUserID(r.Context(), id)
@@ -543,13 +733,68 @@ func (h *UserHandler) SetUserDisabled(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	var req SetUserDisabledRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid body")
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err, "invalid body")
 		return
 	}
 	if err := h.userRepo.SetDisabled(r.Context(), id, req.Disabled); err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to update user")
 		return
 	}
+	if req.Disabled {
+		// Новые подключения отклоняет auth (validate), текущие закрываем сразу.
+		h.hub.DisconnectUser(id)
+	}
 	writeJSON(w, http.StatusOK, map[string]bool{"disabled": req.Disabled})
 }
+
+// MergeUser переносит данные пользователя {id} на {targetId} и удаляет {id} (только администратор).
+// Нужен для дублей, созданных входом по email с опечаткой или после смены адреса.
+func (h *UserHandler) MergeUser(w http.ResponseWriter, r *http.Request) {
+	sourceID := chi.URLParam(r, "id")
+	targetID := chi.URLParam(r, "targetId")
+	currentUserID := middleware.GetUserID(r.Context())
+	myPerm, err := h.permRepo.GetByUserID(r.Context(), currentUserID)
+	if err != nil || !myPerm.Administrator {
+		writeError(w, http.StatusForbidden, "only administrator can merge users")
+		return
+	}
+	if sourceID == targetID {
+		writeError(w, http.StatusBadRequest, "cannot merge user into itself")
+		return
+	}
+	if sourceID == currentUserID {
+		writeError(w, http.StatusBadRequest, "нельзя удалить самого себя слиянием")
+		return
+	}
+	source, err := h.userRepo.GetByID(r.Context(), sourceID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to get user")
+		return
+	}
+	res, err := h.userRepo.MergeInto(r.Context(), sourceID, targetID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		logger.Errorf("merge user %s into %s: %v", sourceID, targetID, err)
+		writeError(w, http.StatusInternalServerError, "failed to merge users")
+		return
+	}
+	if err := h.auditRepo.Record(r.Context(), currentUserID, repository.AuditUserMerge, targetID, map[string]any{
+		"source_id":       sourceID,
+		"source_email":    source.Email,
+		"source_username": source.Username,
+		"result":          res,
+	}); err != nil {
+		logger.Errorf("merge user %s into %s: audit: %v", sourceID, targetID, err)
+	}
+	// Сессии source теперь принадлежат target: клиенты переподключатся уже под ним.
+	h.hub.DisconnectUser(sourceID)
+	writeJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/messenger/internal/logger"
+	"github.com/messenger/internal/middleware"
+	"github.com/messenger/internal/model"
+	"github.com/messenger/internal/repository"
+	"github.com/messenger/internal/sysmsg"
+	"github.com/messenger/internal/ws"
+)
+
+// canManageUserGroups — просматривать и менять членство других пользователей в группах может
+// администратор или пользователь с правом AdminAllGroups.
+func (h *ChatHandler) canManageUserGroups(r *http.Request) bool {
+	perm, err := h.permRepo.GetByUserID(r.Context(), middleware.GetUserID(r.Context()))
+	return err == nil && (perm.Administrator || perm.AdminAllGroups)
+}
+
+// GetUserGroups возвращает группы и каналы пользователя {id} с его ролью — для администраторов
+// (например, перед отключением сотрудника). Личные чаты не раскрываются, отдаётся только их число.
+func (h *ChatHandler) GetUserGroups(w http.ResponseWriter, r *http.Request) {
+	if !h.canManageUserGroups(r) {
+		writeError(w, http.StatusForbidden, "only administrator can view user groups")
+		return
+	}
+	targetID := chi.URLParam(r, "id")
+	if _, err := h.userRepo.GetByID(r.Context(), targetID); err != nil {
+		writeError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	groups, err := h.chatRepo.GetUserGroupMemberships(r.Context(), targetID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get user groups")
+		return
+	}
+	personal, err := h.chatRepo.CountPersonalChats(r.Context(), targetID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get user groups")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"user_id":        targetID,
+		"groups":         groups,
+		"personal_chats": personal,
+	})
+}
+
+// RemoveUserFromGroups исключает пользователя {id} из всех групп и каналов — шаг offboarding при
+// отключении сотрудника. Если пользователь был единственным администратором группы, администратором
+// становится самый давний из оставшихся участников. Исключение, системные сообщения и запись журнала
+// сохраняются одной транзакцией, события рассылаются после commit. Повторный вызов ничего не меняет и возвращает removed: 0.
+func (h *ChatHandler) RemoveUserFromGroups(w http.ResponseWriter, r *http.Request) {
+	if !h.canManageUserGroups(r) {
+		writeError(w, http.StatusForbidden, "only administrator can remove user from groups")
+		return
+	}
+	actorID := middleware.GetUserID(r.Context())
+	targetID := chi.URLParam(r, "id")
+	target, err := h.userRepo.GetByID(r.Context(), targetID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	actor, _ := h.userRepo.GetByID(r.Context(), actorID)
+	actorName := ""
+	if actor != nil {
+		actorName = actor.Username
+	}
+
+	now := time.Now().UTC()
+	type chatEvents struct {
+		chatID string
+		events []ws.OutgoingMessage
+	}
+	var removed []chatEvents
+	chatIDs := []string{}
+	err = h.chatRepo.WithTx(r.Context(), func(ctx context.Context) error {
+		groups, err := h.chatRepo.GetUserGroupMemberships(ctx, targetID)
+		if err != nil {
+			return err
+		}
+		promoted := map[string]string{}
+		for _, g := range groups {
+			chatID := g.Chat.ID
+			promotedID, err := h.chatRepo.RemoveMemberKeepAdmin(ctx, chatID, targetID)
+			if err != nil {
+				return err
+			}
+			sysMsg := h.systemMessage(chatID, actorID, sysmsg.New(sysmsg.MemberRemoved, actorName, target.Username), now)
+			if err := h.msgRepo.Create(ctx, sysMsg); err != nil {
+				return err
+			}
+			sysMsg.Sender = &model.UserPublic{ID: actorID, Username: actorName}
+			// Событие об исключении — последним: его же получает сам исключённый.
+			var events []ws.OutgoingMessage
+			events = append(events, ws.OutgoingMessage{Type: ws.EventNewMessage, Payload: sysMsg})
+			if promotedID != "" {
+				promoted[chatID] = promotedID
+				promotedName := promotedID
+				if u, err := h.userRepo.GetByID(ctx, promotedID); err == nil {
+					promotedName = u.Username
+				}
+				roleMsg := h.systemMessage(chatID, actorID, sysmsg.New(sysmsg.MemberRoleGranted, actorName, promotedName), now)
+				if err := h.msgRepo.Create(ctx, roleMsg); err != nil {
+					return err
+				}
+				roleMsg.Sender = sysMsg.Sender
+				events = append(events,
+					ws.OutgoingMessage{Type: ws.EventNewMessage, Payload: roleMsg},
+					ws.OutgoingMessage{
+						Type: ws.EventMemberRoleChanged,
+						Payload: ws.MemberRoleChangedPayload{
+							ChatID: chatID, UserID: promotedID, Username: promotedName, Role: "admin",
+							ActorID: actorID, ActorName: actorName,
+						},
+					})
+			}
+			events = append(events, ws.OutgoingMessage{
+				Type: ws.EventMemberRemoved,
+				Payload: ws.MemberRemovedPayload{
+					ChatID: chatID, UserID: targetID, Username: target.Username,
+					IsLeave: false, ActorName: actorName,
+				},
+			})
+			removed = append(removed, chatEvents{chatID: chatID, events: events})
+			chatIDs = append(chatIDs, chatID)
+		}
+		if len(chatIDs) == 0 {
+			return nil
+		}
+		return h.audit.Record(ctx, actorID, repository.AuditUserRemoveFromGroups, targetID, map[string]any{
+			"chat_ids": chatIDs,
+			"promoted": promoted,
+		})
+	})
+	if err != nil {
+		logger.Errorf("removeUserFromGroups user=%s: %v", targetID, err)
+		writeError(w, http.StatusInternalServerError, "failed to remove user from groups")
+		return
+	}
+	for _, c := range removed {
+		for _, ev := range c.events {
+			h.hub.BroadcastToChat(r.Context(), c.chatID, ev)
+		}
+		// Исключённый уже не в списке участников — уведомляем его отдельно.
+		h.hub.SendToUser(targetID, c.events[len(c.events)-1])
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"removed": len(chatIDs), "chat_ids": chatIDs})
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"github.com/messenger/internal/repository"
+)
+
+// Коды ошибок валидации полей (FieldError.Code) — стабильны, клиент может по ним выбирать текст.
+const (
+	codeRequired          = "required"
+	codeInvalidFormat     = "invalid_format"
+	codeCountryNotAllowed = "country_not_allowed"
+	codeAlreadyInUse      = "already_in_use"
+)
+
+// FieldError — ошибка валидации одного поля запроса.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type validationErrorResponse struct {
+	// Error — текст первой ошибки, для клиентов, которые читают только "error".
+	Error  string       `json:"error"`
+	Fields []FieldError `json:"fields"`
+}
+
+// writeValidationErrors отвечает 400 со списком ошибок по полям.
+func writeValidationErrors(w http.ResponseWriter, errs []FieldError) {
+	writeJSON(w, http.StatusBadRequest, validationErrorResponse{Error: errs[0].Message, Fields: errs})
+}
+
+// writeProfileConflict отвечает 409, если err — занятый другим пользователем email, имя или телефон.
+// Возвращает true, если ответ записан.
+func writeProfileConflict(w http.ResponseWriter, err error) bool {
+	var fe FieldError
+	switch {
+	case errors.Is(err, repository.ErrEmailTaken):
+		fe = FieldError{Field: "email", Code: codeAlreadyInUse, Message: "email already in use"}
+	case errors.Is(err, repository.ErrUsernameTaken):
+		fe = FieldError{Field: "username", Code: codeAlreadyInUse, Message: "username already in use"}
+	case errors.Is(err, repository.ErrPhoneTaken):
+		fe = FieldError{Field: "phone", Code: codeAlreadyInUse, Message: "phone already in use"}
+	default:
+		return false
+	}
+	writeJSON(w, http.StatusConflict, validationErrorResponse{Error: fe.Message, Fields: []FieldError{fe}})
+	return true
+}
+
+// e164Re — E.164: "+", код страны не с нуля, всего 7–15 цифр.
+var e164Re = regexp.MustCompile(`^\+[1-9]\d{6,14}$`)
+
+// phoneSeparators — символы, которые пользователи вставляют для читаемости: "+993 (65) 12-34-56".
+var phoneSeparators = strings.NewReplacer(" ", "", "\u00a0", "", "-", "", "(", "", ")", "", ".", "")
+
+// PhoneRules — правила проверки телефона. AllowedPrefixes пуст — принимается любой номер E.164.
+type PhoneRules struct {
+	AllowedPrefixes []string
+}
+
+// normalizePhone убирает разделители; результат сохраняется в профиль.
+func normalizePhone(phone string) string {
+	return phoneSeparators.Replace(strings.TrimSpace(phone))
+}
+
+// validate проверяет уже нормализованный номер; nil — номер допустим.
+func (p PhoneRules) validate(field, phone string) *FieldError {
+	if !e164Re.MatchString(phone) {
+		return &FieldError{Field: field, Code: codeInvalidFormat, Message: "invalid phone: use international format (+ and 7–15 digits)"}
+	}
+	if len(p.AllowedPrefixes) == 0 {
+		return nil
+	}
+	for _, prefix := range p.AllowedPrefixes {
+		if strings.HasPrefix(phone, prefix) {
+			return nil
+		}
+	}
+	return &FieldError{Field: field, Code: codeCountryNotAllowed, Message: "phone number country code is not allowed: " + strings.Join(p.AllowedPrefixes, ", ")}
+}
+
+func validateEmail(field, email string) *FieldError {
+	if _, err := mail.ParseAddress(email); err != nil {
+		return &FieldError{Field: field, Code: codeInvalidFormat, Message: "invalid email format"}
+	}
+	return nil
+}
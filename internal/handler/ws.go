@@ -3,40 +3,63 @@ package handler
 import (
 	"context"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/gorilla/websocket"
 	"github.com/messenger/internal/logger"
 	"github.com/messenger/internal/middleware"
+	"github.com/messenger/internal/sysmsg"
 	"github.com/messenger/internal/ws"
 )
 
 type WSHandler struct {
-	hub             *ws.Hub
-	allowedOrigins  string
+	hub            *ws.Hub
+	allowedOrigins []string
 }
 
-// NewWSHandler создаёт обработчик WebSocket. allowedOrigins — как в CORS (через запятую или "*").
-func NewWSHandler(hub *ws.Hub, allowedOrigins string) *WSHandler {
-	return &WSHandler{hub: hub, allowedOrigins: strings.TrimSpace(allowedOrigins)}
+// NewWSHandler создаёт обработчик WebSocket. allowedOrigins — тот же список, что и для CORS
+// (config.CORSOrigins): "*", точные origins или поддомены вида "https://*.example.com".
+func NewWSHandler(hub *ws.Hub, allowedOrigins []string) *WSHandler {
+	return &WSHandler{hub: hub, allowedOrigins: allowedOrigins}
 }
 
 func (h *WSHandler) checkOrigin(r *http.Request) bool {
-	if h.allowedOrigins == "*" || h.allowedOrigins == "" {
+	if len(h.allowedOrigins) == 0 || slices.Contains(h.allowedOrigins, "*") {
 		return true
 	}
 	origin := strings.TrimSpace(r.Header.Get("Origin"))
 	if origin == "" {
 		return true
 	}
-	for _, o := range strings.Split(h.allowedOrigins, ",") {
-		if strings.TrimSpace(o) == origin {
+	for _, o := range h.allowedOrigins {
+		if originMatches(o, origin) {
 			return true
 		}
 	}
 	return false
 }
 
+// originMatches сравнивает origin с шаблоном без учёта регистра; "*" в шаблоне — любой непустой префикс поддомена.
+func originMatches(pattern, origin string) bool {
+	pattern, origin = strings.ToLower(pattern), strings.ToLower(origin)
+	prefix, suffix, wildcard := strings.Cut(pattern, "*")
+	if !wildcard {
+		return pattern == origin
+	}
+	return len(origin) > len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix)
+}
+
+// upgradeRequired отвечает 426 на запрос, который нельзя перевести на WebSocket, и пишет в лог вероятную
+// причину: обычно прокси перед API не пробрасывает заголовки Upgrade/Connection или ходит к нему по HTTP/2.
+func upgradeRequired(w http.ResponseWriter, r *http.Request, reason, hint string) {
+	logger.Errorf("ws upgrade: %s (upgrade=%q connection=%q proto=%s remote=%s) — %s",
+		reason, r.Header.Get("Upgrade"), r.Header.Get("Connection"), r.Proto, r.RemoteAddr, hint)
+	w.Header().Set("Upgrade", "websocket")
+	w.Header().Set("Connection", "Upgrade")
+	writeError(w, http.StatusUpgradeRequired, "websocket upgrade failed: "+reason)
+}
+
 func (h *WSHandler) ServeWS(w http.ResponseWriter, r *http.Request) {
 	userID := middleware.GetUserID(r.Context())
 	if userID == "" {
@@ -47,11 +70,32 @@ func (h *WSHandler) ServeWS(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "forbidden", http.StatusForbidden)
 		return
 	}
+	// Без этих проверок gorilla отвечает невнятными 400/500, и по ним не видно, что виноват прокси.
+	if !websocket.IsWebSocketUpgrade(r) {
+		upgradeRequired(w, r, "missing Upgrade/Connection headers",
+			"check that the reverse proxy forwards them (nginx: proxy_http_version 1.1; proxy_set_header Upgrade $http_upgrade; proxy_set_header Connection \"upgrade\")")
+		return
+	}
+	if _, ok := w.(http.Hijacker); !ok {
+		upgradeRequired(w, r, "connection cannot be hijacked",
+			"the request likely came over HTTP/2 or through a middleware that wraps the ResponseWriter without http.Hijacker")
+		return
+	}
 
 	upgrader := websocket.Upgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
 		CheckOrigin:     func(r *http.Request) bool { return h.checkOrigin(r) },
+		Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+			// gorilla отдаёт ошибку Hijack только текстом (HandshakeError).
+			if reason.Error() == http.ErrNotSupported.Error() {
+				upgradeRequired(w, r, "connection cannot be hijacked",
+					"a ResponseWriter wrapper forwards Hijack, but the underlying connection does not support it (HTTP/2?)")
+				return
+			}
+			w.Header().Set("Sec-Websocket-Version", "13")
+			writeError(w, status, reason.Error())
+		},
 	}
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -60,7 +104,35 @@ func (h *WSHandler) ServeWS(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
-	client := ws.NewClient(h.hub, conn, userID)
+	client := ws.NewClient(h.hub, conn, userID, middleware.GetSessionID(r.Context()), sysmsg.RequestLang(r))
 	client.Start(ctx, cancel)
 	h.hub.Register(client)
 }
+
+type revokeSessionsRequest struct {
+	UserID     string   `json:"user_id"`
+	SessionIDs []string `json:"session_ids"`
+}
+
+// RevokeSessions закрывает WebSocket-соединения отозванных сессий. Вызывается микросервисом auth (internal).
+func (h *WSHandler) RevokeSessions(w http.ResponseWriter, r *http.Request) {
+	var req revokeSessionsRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err, "user_id and session_ids required")
+		return
+	}
+	if req.UserID == "" {
+		writeError(w, http.StatusBadRequest, "user_id and session_ids required")
+		return
+	}
+	closed := 0
+	for _, sid := range req.SessionIDs {
+		if sid != "" {
+			closed += h.hub.CloseUserSession(req.UserID, sid)
+		}
+	}
+	if closed > 0 {
+		logger.Infof("ws revoke sessions user=%s closed=%d", req.UserID, closed)
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"closed": closed})
+}
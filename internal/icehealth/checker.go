@@ -0,0 +1,285 @@
+// Package icehealth периодически проверяет доступность STUN/TURN-серверов,
+// чтобы клиенты получали в конфиге звонков только живые ICE-серверы.
+package icehealth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/messenger/internal/config"
+	"github.com/messenger/internal/logger"
+)
+
+// Status — состояние ICE-сервера по результатам последней проверки.
+type Status string
+
+const (
+	StatusUnknown  Status = "unknown"  // ещё не проверялся
+	StatusHealthy  Status = "healthy"  // все URL отвечают
+	StatusDegraded Status = "degraded" // часть URL не отвечает или ответ медленный
+	StatusDown     Status = "down"     // ни один URL не отвечает
+)
+
+// slowThreshold — задержка, выше которой сервер считается деградировавшим.
+const slowThreshold = 500 * time.Millisecond
+
+// URLResult — результат проверки одного URL сервера.
+type URLResult struct {
+	URL       string `json:"url"`
+	OK        bool   `json:"ok"`
+	LatencyMs int64  `json:"latency_ms,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ServerHealth — состояние одного ICE-сервера (без учётных данных).
+type ServerHealth struct {
+	URLs      []string    `json:"urls"`
+	Status    Status      `json:"status"`
+	LatencyMs int64       `json:"latency_ms,omitempty"`
+	CheckedAt *time.Time  `json:"checked_at,omitempty"`
+	Results   []URLResult `json:"results,omitempty"`
+}
+
+// Checker хранит список ICE-серверов и результаты их проверки.
+type Checker struct {
+	servers []config.IceServer
+	timeout time.Duration
+
+	mu     sync.RWMutex
+	health []ServerHealth
+}
+
+// NewChecker создаёт проверку для списка серверов. timeout — на один probe.
+func NewChecker(servers []config.IceServer, timeout time.Duration) *Checker {
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+	health := make([]ServerHealth, len(servers))
+	for i, s := range servers {
+		health[i] = ServerHealth{URLs: s.URLs, Status: StatusUnknown}
+	}
+	return &Checker{servers: servers, timeout: timeout, health: health}
+}
+
+// Run проверяет серверы сразу и затем каждые interval, пока ctx не отменён.
+func (c *Checker) Run(ctx context.Context, interval time.Duration) {
+	c.CheckNow(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.CheckNow(ctx)
+		}
+	}
+}
+
+// CheckNow проверяет все серверы параллельно и сохраняет результат.
+func (c *Checker) CheckNow(ctx context.Context) {
+	health := make([]ServerHealth, len(c.servers))
+	var wg sync.WaitGroup
+	for i, s := range c.servers {
+		wg.Add(1)
+		go func(i int, s config.IceServer) {
+			defer wg.Done()
+			health[i] = c.checkServer(ctx, s)
+		}(i, s)
+	}
+	wg.Wait()
+
+	c.mu.Lock()
+	prev := c.health
+	c.health = health
+	c.mu.Unlock()
+
+	for i, h := range health {
+		if i < len(prev) && prev[i].Status != h.Status && h.Status != StatusHealthy {
+			logger.Errorf("icehealth: %s is %s", strings.Join(h.URLs, ","), h.Status)
+		}
+	}
+}
+
+func (c *Checker) checkServer(ctx context.Context, s config.IceServer) ServerHealth {
+	now := time.Now()
+	h := ServerHealth{URLs: s.URLs, CheckedAt: &now, Results: make([]URLResult, 0, len(s.URLs))}
+	okCount := 0
+	var best time.Duration
+	for _, u := range s.URLs {
+		latency, err := c.probe(ctx, u)
+		res := URLResult{URL: u, OK: err == nil}
+		if err != nil {
+			res.Error = err.Error()
+		} else {
+			res.LatencyMs = latency.Milliseconds()
+			if okCount == 0 || latency < best {
+				best = latency
+			}
+			okCount++
+		}
+		h.Results = append(h.Results, res)
+	}
+	switch {
+	case okCount == 0:
+		h.Status = StatusDown
+	case okCount < len(s.URLs) || best > slowThreshold:
+		h.Status = StatusDegraded
+		h.LatencyMs = best.Milliseconds()
+	default:
+		h.Status = StatusHealthy
+		h.LatencyMs = best.Milliseconds()
+	}
+	return h
+}
+
+// probe проверяет один URL вида stun:host[:port], turn:host[:port][?transport=udp|tcp], turns:host[:port].
+// UDP — STUN Binding Request (TURN-серверы тоже на него отвечают), TCP/TLS — установка TCP-соединения.
+func (c *Checker) probe(ctx context.Context, rawURL string) (time.Duration, error) {
+	scheme, hostport, transport, err := parseICEURL(rawURL)
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	start := time.Now()
+	if scheme == "turns" || transport == "tcp" {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", hostport)
+		if err != nil {
+			return 0, err
+		}
+		conn.Close()
+		return time.Since(start), nil
+	}
+	if err := stunBinding(ctx, hostport); err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
+
+func parseICEURL(raw string) (scheme, hostport, transport string, err error) {
+	idx := strings.Index(raw, ":")
+	if idx <= 0 {
+		return "", "", "", fmt.Errorf("invalid ice url %q", raw)
+	}
+	scheme = strings.ToLower(raw[:idx])
+	rest := raw[idx+1:]
+	transport = "udp"
+	if q := strings.Index(rest, "?"); q >= 0 {
+		for _, kv := range strings.Split(rest[q+1:], "&") {
+			if v, ok := strings.CutPrefix(kv, "transport="); ok {
+				transport = strings.ToLower(v)
+			}
+		}
+		rest = rest[:q]
+	}
+	defaultPort := "3478"
+	switch scheme {
+	case "stun", "turn":
+	case "stuns", "turns":
+		defaultPort = "5349"
+		scheme = "turns"
+	default:
+		return "", "", "", fmt.Errorf("unsupported ice url scheme %q", scheme)
+	}
+	if _, _, splitErr := net.SplitHostPort(rest); splitErr != nil {
+		rest = net.JoinHostPort(strings.Trim(rest, "[]"), defaultPort)
+	}
+	return scheme, rest, transport, nil
+}
+
+const stunMagicCookie = 0x2112A442
+
+// stunBinding отправляет STUN Binding Request (RFC 5389) и ждёт ответ с тем же transaction id.
+func stunBinding(ctx context.Context, hostport string) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", hostport)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	req := make([]byte, 20)
+	binary.BigEndian.PutUint16(req[0:2], 0x0001) // Binding Request
+	binary.BigEndian.PutUint16(req[2:4], 0)
+	binary.BigEndian.PutUint32(req[4:8], stunMagicCookie)
+	if _, err := rand.Read(req[8:20]); err != nil {
+		return err
+	}
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return err
+		}
+		if n < 20 || binary.BigEndian.Uint32(buf[4:8]) != stunMagicCookie || string(buf[8:20]) != string(req[8:20]) {
+			continue
+		}
+		// 0x0101 — Binding Success Response, 0x0111 — Binding Error Response (сервер жив, но ответил ошибкой).
+		switch binary.BigEndian.Uint16(buf[0:2]) {
+		case 0x0101:
+			return nil
+		case 0x0111:
+			return errors.New("stun binding error response")
+		}
+	}
+}
+
+// Health возвращает копию текущего состояния всех серверов.
+func (c *Checker) Health() []ServerHealth {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	out := make([]ServerHealth, len(c.health))
+	copy(out, c.health)
+	return out
+}
+
+// Servers возвращает серверы для клиента: сначала здоровые, затем деградировавшие (по задержке),
+// недоступные исключаются. Если проверок ещё не было или все серверы недоступны — отдаём исходный список,
+// чтобы не оставить клиента совсем без ICE.
+func (c *Checker) Servers() []config.IceServer {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	type ranked struct {
+		srv    config.IceServer
+		status Status
+		lat    int64
+	}
+	list := make([]ranked, 0, len(c.servers))
+	for i, s := range c.servers {
+		h := c.health[i]
+		if h.Status == StatusHealthy || h.Status == StatusDegraded {
+			list = append(list, ranked{srv: s, status: h.Status, lat: h.LatencyMs})
+		}
+	}
+	if len(list) == 0 {
+		return c.servers
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].status != list[j].status {
+			return list[i].status == StatusHealthy
+		}
+		return list[i].lat < list[j].lat
+	})
+	out := make([]config.IceServer, len(list))
+	for i, r := range list {
+		out[i] = r.srv
+	}
+	return out
+}
@@ -17,6 +17,8 @@ var (
 	logLevel = levelInfo
 	ch       chan string
 	once     sync.Once
+	// durationObserver получает каждое измерение LogDuration (метрики); задаётся при старте сервиса.
+	durationObserver func(fn string, elapsed time.Duration)
 )
 
 type level int
@@ -76,6 +78,12 @@ func Infof(format string, v ...any) {
 	enqueue(tag() + fmt.Sprintf(format, v...))
 }
 
+// DebugEnabled — включён ли LOG_LEVEL=debug (для отладочных логов, которые дорого собирать).
+func DebugEnabled() bool {
+	once.Do(initWorker)
+	return logLevel == levelDebug
+}
+
 // Error пишет ошибку с префиксом (асинхронно).
 func Error(v ...any) {
 	enqueue(tag() + "ERROR: " + fmt.Sprint(v...))
@@ -90,11 +98,20 @@ func Errorf(format string, v ...any) {
 // При LOG_LEVEL=info логирует только вызовы дольше 100ms; при LOG_LEVEL=debug — все.
 func LogDuration(fn string, start time.Time) {
 	elapsed := time.Since(start)
+	if durationObserver != nil {
+		durationObserver(fn, elapsed)
+	}
 	if logLevel == levelDebug || elapsed >= 100*time.Millisecond {
 		enqueue(fmt.Sprintf("%sfn=%s duration_ms=%d", tag(), fn, elapsed.Milliseconds()))
 	}
 }
 
+// SetDurationObserver передаёт все измерения LogDuration в fn (например, в гистограммы метрик).
+// Вызывается один раз при старте, до обработки запросов.
+func SetDurationObserver(fn func(fn string, elapsed time.Duration)) {
+	durationObserver = fn
+}
+
 // DeferLogDuration возвращает функцию для вызова в defer: defer logger.DeferLogDuration("HandlerName", time.Now())().
 func DeferLogDuration(fn string, start time.Time) func() {
 	return func() { LogDuration(fn, start) }
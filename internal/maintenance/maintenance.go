@@ -0,0 +1,126 @@
+// Package maintenance — режим обслуживания (только чтение): пока он включён, изменяющие запросы
+// обычных пользователей отклоняются с 503, чтение работает. Администраторы не ограничены.
+package maintenance
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/messenger/internal/logger"
+	"github.com/messenger/internal/repository"
+)
+
+// DefaultMessage — текст для клиентов, если администратор не указал свой.
+const DefaultMessage = "Идут технические работы. Отправка сообщений и изменения временно недоступны."
+
+// Status — текущее состояние режима (отдаётся клиентам и в событии EventMaintenance).
+type Status struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message,omitempty"`
+}
+
+// Mode хранит состояние режима. Источник истины — таблица maintenance_mode (общая для всех экземпляров API);
+// Run периодически перечитывает её, чтобы переключение на одном экземпляре дошло до остальных.
+type Mode struct {
+	repo     *repository.MaintenanceRepository
+	permRepo *repository.PermissionRepository
+	// forced — режим включён конфигурацией (MAINTENANCE_MODE) и не выключается через API.
+	forced bool
+
+	mu       sync.RWMutex
+	status   Status
+	onChange func(Status)
+}
+
+// New создаёт режим; forced включает его независимо от значения в БД.
+func New(repo *repository.MaintenanceRepository, permRepo *repository.PermissionRepository, forced bool) *Mode {
+	return &Mode{repo: repo, permRepo: permRepo, forced: forced, status: Status{Enabled: forced, Message: DefaultMessage}}
+}
+
+// OnChange задаёт обработчик смены состояния (рассылка EventMaintenance подключённым клиентам).
+func (m *Mode) OnChange(fn func(Status)) {
+	m.mu.Lock()
+	m.onChange = fn
+	m.mu.Unlock()
+}
+
+func (m *Mode) Status() Status {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.status
+}
+
+func (m *Mode) Enabled() bool {
+	return m.Status().Enabled
+}
+
+// Forced сообщает, что режим включён конфигурацией.
+func (m *Mode) Forced() bool {
+	return m.forced
+}
+
+// Set сохраняет состояние в БД и применяет его на этом экземпляре сразу.
+func (m *Mode) Set(ctx context.Context, enabled bool, message string) (Status, error) {
+	if err := m.repo.Set(ctx, enabled, message); err != nil {
+		return Status{}, err
+	}
+	return m.apply(enabled, message), nil
+}
+
+// Load перечитывает состояние из БД.
+func (m *Mode) Load(ctx context.Context) error {
+	enabled, message, err := m.repo.Get(ctx)
+	if err != nil {
+		return err
+	}
+	m.apply(enabled, message)
+	return nil
+}
+
+// Run перечитывает состояние каждые interval до отмены ctx.
+func (m *Mode) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			loadCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			if err := m.Load(loadCtx); err != nil && ctx.Err() == nil {
+				logger.Errorf("maintenance: load state: %v", err)
+			}
+			cancel()
+		}
+	}
+}
+
+func (m *Mode) apply(enabled bool, message string) Status {
+	next := Status{Enabled: enabled || m.forced, Message: message}
+	if next.Message == "" {
+		next.Message = DefaultMessage
+	}
+	m.mu.Lock()
+	changed := next != m.status
+	m.status = next
+	onChange := m.onChange
+	m.mu.Unlock()
+	if changed {
+		logger.Infof("maintenance: enabled=%v", next.Enabled)
+		if onChange != nil {
+			onChange(next)
+		}
+	}
+	return next
+}
+
+// Blocks сообщает, что изменения от userID сейчас запрещены: режим включён и пользователь не администратор.
+// При ошибке чтения прав изменения запрещаются.
+func (m *Mode) Blocks(ctx context.Context, userID string) bool {
+	if !m.Enabled() {
+		return false
+	}
+	perm, err := m.permRepo.GetByUserID(ctx, userID)
+	return err != nil || !perm.Administrator
+}
@@ -0,0 +1,100 @@
+// Package metrics — счётчики и гистограммы длительности вызовов (репозитории, обработчики WebSocket)
+// и показатели пула подключений к БД в текстовом формате Prometheus (GET /metrics).
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// buckets — верхние границы корзин гистограммы, в секундах.
+var buckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+type histogram struct {
+	counts []uint64 // по корзинам buckets, не накопительно
+	count  uint64
+	sum    float64
+}
+
+type gauge struct {
+	name, help string
+	value      func() float64
+}
+
+var (
+	mu     sync.Mutex
+	series = map[string]*histogram{}
+	gauges []gauge
+)
+
+// ObserveDuration учитывает вызов fn длительностью elapsed. Подходит для logger.SetDurationObserver:
+// имена с пробелом ("http GET /api/chats/<id>") пропускаются — в них путь с идентификаторами, и число рядов
+// росло бы без ограничения.
+func ObserveDuration(fn string, elapsed time.Duration) {
+	if strings.ContainsRune(fn, ' ') {
+		return
+	}
+	sec := elapsed.Seconds()
+	mu.Lock()
+	defer mu.Unlock()
+	h := series[fn]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(buckets))}
+		series[fn] = h
+	}
+	for i, le := range buckets {
+		if sec <= le {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += sec
+}
+
+// RegisterGauge добавляет показатель, значение которого читается при каждом запросе /metrics.
+func RegisterGauge(name, help string, value func() float64) {
+	mu.Lock()
+	gauges = append(gauges, gauge{name: name, help: help, value: value})
+	mu.Unlock()
+}
+
+// Handler отдаёт все метрики в текстовом формате Prometheus.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		write(w)
+	})
+}
+
+func write(w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+	names := make([]string, 0, len(series))
+	for name := range series {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "# HELP messenger_call_duration_seconds Duration of instrumented calls (repository methods, WebSocket handlers).")
+	fmt.Fprintln(w, "# TYPE messenger_call_duration_seconds histogram")
+	for _, name := range names {
+		h := series[name]
+		var cumulative uint64
+		for i, le := range buckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(w, "messenger_call_duration_seconds_bucket{fn=%q,le=\"%g\"} %d\n", name, le, cumulative)
+		}
+		fmt.Fprintf(w, "messenger_call_duration_seconds_bucket{fn=%q,le=\"+Inf\"} %d\n", name, h.count)
+		fmt.Fprintf(w, "messenger_call_duration_seconds_sum{fn=%q} %g\n", name, h.sum)
+		fmt.Fprintf(w, "messenger_call_duration_seconds_count{fn=%q} %d\n", name, h.count)
+	}
+	for _, g := range gauges {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n", g.name, g.help, g.name, g.name, g.value())
+	}
+}
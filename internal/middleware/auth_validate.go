@@ -71,7 +71,20 @@ func AuthServiceValidate(authServiceURL string, client *http.Client) func(http.H
 				return
 			}
 			defer resp.Body.Close()
+			if resp.StatusCode == http.StatusServiceUnavailable {
+				// Хранилище сессий временно недоступно — не 401, иначе клиент сбросит сессию.
+				w.Header().Set("Retry-After", "5")
+				http.Error(w, `{"error":"service temporarily unavailable"}`, http.StatusServiceUnavailable)
+				return
+			}
 			if resp.StatusCode != http.StatusOK {
+				var authErr struct {
+					Code string `json:"code"`
+				}
+				if json.NewDecoder(resp.Body).Decode(&authErr) == nil && authErr.Code == CodeClockSkew {
+					WriteClockSkew(w)
+					return
+				}
 				http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
 				return
 			}
@@ -83,6 +96,7 @@ func AuthServiceValidate(authServiceURL string, client *http.Client) func(http.H
 				return
 			}
 			ctx := context.WithValue(r.Context(), UserIDKey, result.UserID)
+			ctx = context.WithValue(ctx, SessionIDKey, sessionID)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// MaxBody ограничивает размер тела запроса limit байтами (http.MaxBytesReader), чтобы огромный JSON
+// не исчерпал память в json.Decode. Тело с известной длиной больше limit отклоняется сразу с 413.
+// Пути из exempt (загрузки файлов) пропускаются: у них свои, большие лимиты. limit <= 0 — без ограничения.
+func MaxBody(limit int64, exempt ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limit <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Body == nil || r.Body == http.NoBody || bodyLimitExempt(r.URL.Path, exempt) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if r.ContentLength > limit {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				json.NewEncoder(w).Encode(map[string]string{"error": "request body too large"})
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func bodyLimitExempt(path string, exempt []string) bool {
+	for _, p := range exempt {
+		if strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
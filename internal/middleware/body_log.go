@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"math/rand/v2"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/messenger/internal/logger"
+)
+
+// sensitiveJSONField — значения полей JSON, в имени которых есть secret, token, key, sig или password
+// (session_secret, api_key, signature, ...), а также code, otp, auth, p256dh и session_id, в логе тел
+// заменяются на "***"; у вложенных объектов скрываются поля внутри. Работает и на обрезанном теле.
+var sensitiveJSONField = regexp.MustCompile(`(?i)("(?:[^"]*(?:secret|token|key|sig|password)[^"]*|code|otp|auth|p256dh|session_id)"\s*:\s*)` +
+	`("(?:[^"\\]|\\.)*"?|\[[^\[\]{}]*\]?|[^,{}\[\]\s"][^,}\]\s]*)`)
+
+// signedURLParam — подпись в ссылках (подписанные URL файлов: ...?expires=...&sig=...).
+var signedURLParam = regexp.MustCompile(`(?i)([?&](?:sig|signature|token)=)[^&"\s]*`)
+
+// neverLogBodies — пути, тела которых не пишутся никогда: вход и сессии (коды, секреты сессий).
+var neverLogBodies = []string{"/api/auth/"}
+
+// RedactBody скрывает значения чувствительных полей в JSON-теле (в том числе вложенных) и подписи в ссылках.
+func RedactBody(body []byte) string {
+	s := sensitiveJSONField.ReplaceAllString(string(body), `$1"***"`)
+	return signedURLParam.ReplaceAllString(s, `$1***`)
+}
+
+// LogBodies пишет в лог тела запросов и ответов API для отладки: только при LOG_LEVEL=debug, только для
+// samplePercent% запросов и только JSON/text — не больше maxBytes байт каждого, чувствительные поля скрыты
+// (RedactBody). Пути из exempt (загрузки файлов), /api/auth/*, multipart и WebSocket не логируются никогда;
+// query не пишется.
+func LogBodies(samplePercent, maxBytes int, exempt ...string) func(http.Handler) http.Handler {
+	if samplePercent <= 0 || maxBytes <= 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	if !logger.DebugEnabled() {
+		logger.Infof("body logging requested but LOG_LEVEL is not debug — disabled")
+		return func(next http.Handler) http.Handler { return next }
+	}
+	logger.Infof("body logging enabled: sample=%d%% max_bytes=%d", samplePercent, maxBytes)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if bodyLimitExempt(r.URL.Path, exempt) || bodyLimitExempt(r.URL.Path, neverLogBodies) || strings.EqualFold(r.Header.Get("Upgrade"), "websocket") ||
+				(r.Body != nil && r.Body != http.NoBody && !loggableBody(r.Header.Get("Content-Type"))) ||
+				rand.IntN(100) >= samplePercent {
+				next.ServeHTTP(w, r)
+				return
+			}
+			var reqBody []byte
+			if r.Body != nil && r.Body != http.NoBody {
+				// Читается только начало тела; обработчик получает его целиком.
+				reqBody, _ = io.ReadAll(io.LimitReader(r.Body, int64(maxBytes)))
+				r.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(reqBody), r.Body), Closer: r.Body}
+			}
+			bw := &bodyLogWriter{ResponseWriter: w, max: maxBytes, status: http.StatusOK}
+			next.ServeHTTP(bw, r)
+
+			resp := "<" + bw.Header().Get("Content-Type") + ">"
+			if loggableBody(bw.Header().Get("Content-Type")) {
+				resp = RedactBody(bw.buf.Bytes())
+			}
+			logger.Infof("http body method=%s path=%s status=%d req=%q resp=%q",
+				r.Method, r.URL.Path, bw.status, RedactBody(reqBody), resp)
+		})
+	}
+}
+
+// loggableBody — тело такого типа можно писать в лог (JSON и простой текст).
+func loggableBody(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || mediaType == "text/plain"
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// bodyLogWriter запоминает статус и первые max байт ответа, ничего не меняя в самом ответе.
+type bodyLogWriter struct {
+	http.ResponseWriter
+	max    int
+	status int
+	buf    bytes.Buffer
+}
+
+func (bw *bodyLogWriter) WriteHeader(status int) {
+	bw.status = status
+	bw.ResponseWriter.WriteHeader(status)
+}
+
+func (bw *bodyLogWriter) Write(p []byte) (int, error) {
+	if room := bw.max - bw.buf.Len(); room > 0 {
+		bw.buf.Write(p[:min(room, len(p))])
+	}
+	return bw.ResponseWriter.Write(p)
+}
+
+func (bw *bodyLogWriter) Flush() {
+	if f, ok := bw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (bw *bodyLogWriter) Unwrap() http.ResponseWriter {
+	return bw.ResponseWriter
+}
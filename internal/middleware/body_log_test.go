@@ -0,0 +1,29 @@
+package middleware
+
+import "testing"
+
+func TestRedactBody(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"otp code", `{"email":"a@b.c","code":"123456"}`, `{"email":"a@b.c","code":"***"}`},
+		{"numeric code", `{"code": 123456,"x":1}`, `{"code": "***","x":1}`},
+		{"session secret", `{"session_id":"abc","session_secret":"SUPERSECRET"}`, `{"session_id":"***","session_secret":"***"}`},
+		{"password hash", `{"password_hash":"h"}`, `{"password_hash":"***"}`},
+		{"signature header value", `{"signature":"deadbeef"}`, `{"signature":"***"}`},
+		{"api key", `{"name":"bot","api_key":"k1"}`, `{"name":"bot","api_key":"***"}`},
+		{"tokens", `{"access_token":"a","refreshToken":"b"}`, `{"access_token":"***","refreshToken":"***"}`},
+		{"push keys nested", `{"keys":{"p256dh":"abc\"d","auth":"zz"},"endpoint":"e"}`, `{"keys":{"p256dh":"***","auth":"***"},"endpoint":"e"}`},
+		{"array of keys", `{"api_keys":["k1","k2"],"n":2}`, `{"api_keys":"***","n":2}`},
+		{"truncated body", `{"password":"abcdefgh`, `{"password":"***"`},
+		{"signed url", `{"url":"/api/files/signed/a.png?expires=1700000000&sig=abcdef"}`, `{"url":"/api/files/signed/a.png?expires=1700000000&sig=***"}`},
+		{"plain fields untouched", `{"content":"hello","chat_id":"c1"}`, `{"content":"hello","chat_id":"c1"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RedactBody([]byte(tt.in)); got != tt.want {
+				t.Errorf("RedactBody(%s) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/messenger/internal/logger"
+	"github.com/messenger/internal/repository"
+)
+
+// BotKeyIDKey — id API-ключа, которым авторизован запрос бота; для запросов по сессии не задаётся.
+var BotKeyIDKey contextKey = "bot_key_id"
+
+// GetBotKeyID возвращает id API-ключа бота из контекста (пусто — запрос от пользователя по сессии).
+func GetBotKeyID(ctx context.Context) string {
+	v, _ := ctx.Value(BotKeyIDKey).(string)
+	return v
+}
+
+// botKeyAuthenticator — проверка API-ключа по хешу (repository.BotRepository).
+type botKeyAuthenticator interface {
+	Authenticate(ctx context.Context, keyHash string) (userID, keyID string, err error)
+}
+
+// BotKeyAuth авторизует запросы с заголовком Authorization: Bearer <ключ> по API-ключам ботов, остальные
+// передаёт в sessionAuth. Подключается только к маршрутам, доступным ботам (отправка и чтение сообщений);
+// остальные маршруты ключ не принимают.
+func BotKeyAuth(bots botKeyAuthenticator, sessionAuth func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		withSession := sessionAuth(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok {
+				withSession.ServeHTTP(w, r)
+				return
+			}
+			userID, keyID, err := bots.Authenticate(r.Context(), repository.HashBotKey(strings.TrimSpace(key)))
+			if errors.Is(err, repository.ErrNotFound) {
+				http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				logger.Errorf("bot key auth: %v", err)
+				http.Error(w, `{"error":"internal"}`, http.StatusInternalServerError)
+				return
+			}
+			ctx := context.WithValue(r.Context(), UserIDKey, userID)
+			ctx = context.WithValue(ctx, BotKeyIDKey, keyID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
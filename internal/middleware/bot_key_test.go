@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/messenger/internal/repository"
+)
+
+// fakeBotKeys — действующие ключи по хешу; revoked — отозванные (Authenticate их не находит, как и репозиторий).
+type fakeBotKeys struct {
+	keys    map[string][2]string
+	revoked map[string]bool
+	err     error
+}
+
+func (f *fakeBotKeys) Authenticate(_ context.Context, keyHash string) (string, string, error) {
+	if f.err != nil {
+		return "", "", f.err
+	}
+	k, ok := f.keys[keyHash]
+	if !ok || f.revoked[keyHash] {
+		return "", "", repository.ErrNotFound
+	}
+	return k[0], k[1], nil
+}
+
+func TestBotKeyAuth(t *testing.T) {
+	bots := &fakeBotKeys{
+		keys: map[string][2]string{
+			repository.HashBotKey("mbot_valid"):   {"bot-1", "key-1"},
+			repository.HashBotKey("mbot_revoked"): {"bot-1", "key-2"},
+			repository.HashBotKey("mbot_other"):   {"bot-2", "key-3"},
+		},
+		revoked: map[string]bool{repository.HashBotKey("mbot_revoked"): true},
+	}
+	session := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), UserIDKey, "session-user")))
+		})
+	}
+	var gotUser, gotKey string
+	h := BotKeyAuth(bots, session)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUser, gotKey = GetUserID(r.Context()), GetBotKeyID(r.Context())
+	}))
+
+	tests := []struct {
+		name   string
+		auth   string
+		status int
+		user   string
+		keyID  string
+	}{
+		{"valid key", "Bearer mbot_valid", http.StatusOK, "bot-1", "key-1"},
+		{"other bot key", "Bearer mbot_other", http.StatusOK, "bot-2", "key-3"},
+		{"revoked key", "Bearer mbot_revoked", http.StatusUnauthorized, "", ""},
+		{"unknown key", "Bearer mbot_unknown", http.StatusUnauthorized, "", ""},
+		{"no bearer uses session", "", http.StatusOK, "session-user", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotUser, gotKey = "", ""
+			req := httptest.NewRequest(http.MethodGet, "/api/chats/c/messages", nil)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if gotUser != tt.user || gotKey != tt.keyID {
+				t.Errorf("user, key = %q, %q; want %q, %q", gotUser, gotKey, tt.user, tt.keyID)
+			}
+		})
+	}
+
+	bots.err = errors.New("db down")
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer mbot_valid")
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("repository error: status = %d, want 500", rec.Code)
+	}
+}
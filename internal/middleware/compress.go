@@ -0,0 +1,169 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// compressibleTypes — типы ответов, которые сжимаются; картинки, видео, аудио и архивы уже сжаты.
+var compressibleTypes = []string{
+	"text/",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/manifest+json",
+	"image/svg+xml",
+}
+
+// Compress сжимает ответы gzip с уровнем level (1–9; 0 — сжатие выключено), если клиент это принимает,
+// тип ответа текстовый (compressibleTypes) и тело не меньше minSize байт. Начало ответа буферизуется до
+// minSize, чтобы решить, стоит ли сжимать. WebSocket-запросы не оборачиваются: обёртка не реализует
+// http.Hijacker, и upgrade бы не удался.
+func Compress(level, minSize int) func(http.Handler) http.Handler {
+	if level < gzip.BestSpeed || level > gzip.BestCompression {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	pool := &sync.Pool{New: func() any {
+		gz, _ := gzip.NewWriterLevel(io.Discard, level)
+		return gz
+	}}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || !acceptsGzip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			cw := &compressWriter{ResponseWriter: w, pool: pool, minSize: minSize, status: http.StatusOK}
+			// Без defer: при панике несжатый буфер отбрасывается, и RecoverJSON сам пишет ответ 500.
+			next.ServeHTTP(cw, r)
+			cw.close()
+		})
+	}
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		enc, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.EqualFold(strings.TrimSpace(enc), "gzip") {
+			return strings.ReplaceAll(params, " ", "") != "q=0"
+		}
+	}
+	return false
+}
+
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range compressibleTypes {
+		if strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t) || mediaType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// compressWriter копит начало ответа, пока не станет ясно, сжимать ли его (decide), затем пишет
+// либо через gzip, либо напрямую.
+type compressWriter struct {
+	http.ResponseWriter
+	pool    *sync.Pool
+	minSize int
+	status  int
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if !cw.decided {
+		cw.status = status
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) < cw.minSize {
+			return len(p), nil
+		}
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if cw.gz != nil {
+		return cw.gz.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// decide отправляет заголовки и накопленный буфер; large — тело достигло minSize.
+func (cw *compressWriter) decide(large bool) error {
+	cw.decided = true
+	h := cw.Header()
+	ct := h.Get("Content-Type")
+	if ct == "" && len(cw.buf) > 0 {
+		// Как net/http: тип определяется по началу тела — пока оно ещё не сжато.
+		ct = http.DetectContentType(cw.buf)
+		h.Set("Content-Type", ct)
+	}
+	if compressible(ct) {
+		h.Add("Vary", "Accept-Encoding")
+		if large && h.Get("Content-Encoding") == "" && cw.status != http.StatusPartialContent &&
+			cw.status != http.StatusNoContent && cw.status != http.StatusNotModified {
+			h.Set("Content-Encoding", "gzip")
+			h.Del("Content-Length")
+			cw.gz = cw.pool.Get().(*gzip.Writer)
+			cw.gz.Reset(cw.ResponseWriter)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.gz != nil {
+		_, err = cw.gz.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush — для потоковых ответов: решение принимается по уже записанному, затем данные уходят клиенту.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		_ = cw.decide(len(cw.buf) >= cw.minSize)
+	}
+	if cw.gz != nil {
+		_ = cw.gz.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		// Ответ меньше minSize (или без тела) — отдаётся как есть.
+		_ = cw.decide(false)
+	}
+	if cw.gz != nil {
+		_ = cw.gz.Close()
+		cw.gz.Reset(io.Discard)
+		cw.pool.Put(cw.gz)
+		cw.gz = nil
+	}
+}
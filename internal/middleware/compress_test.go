@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serveCompressed прогоняет запрос через Compress(6, 100) с обработчиком h.
+func serveCompressed(t *testing.T, method string, h http.HandlerFunc) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	Compress(6, 100)(h).ServeHTTP(rec, req)
+	return rec
+}
+
+func gunzip(t *testing.T, body io.Reader) string {
+	t.Helper()
+	gz, err := gzip.NewReader(body)
+	if err != nil {
+		t.Fatalf("gzip reader: %v", err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("gunzip: %v", err)
+	}
+	return string(data)
+}
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat(`{"k":"v"},`, 50)
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		gzipped     bool
+	}{
+		{"large json", "application/json", large, true},
+		{"below min size", "application/json", `{"k":"v"}`, false},
+		{"image", "image/png", large, false},
+		{"zip", "application/zip", large, false},
+		{"detected text", "", strings.Repeat("hello ", 50), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveCompressed(t, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				// Запись частями: решение принимается, когда буфер дорастает до minSize.
+				for i := 0; i < len(tt.body); i += 30 {
+					io.WriteString(w, tt.body[i:min(i+30, len(tt.body))])
+				}
+			})
+			gzipped := rec.Header().Get("Content-Encoding") == "gzip"
+			if gzipped != tt.gzipped {
+				t.Fatalf("gzipped = %v, want %v", gzipped, tt.gzipped)
+			}
+			got := rec.Body.String()
+			if gzipped {
+				got = gunzip(t, rec.Body)
+			}
+			if got != tt.body {
+				t.Errorf("body = %q, want %q", got, tt.body)
+			}
+		})
+	}
+}
+
+func TestCompressNotAccepted(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip;q=0, br")
+	rec := httptest.NewRecorder()
+	Compress(6, 10)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, strings.Repeat("a", 100))
+	})).ServeHTTP(rec, req)
+	if ce := rec.Header().Get("Content-Encoding"); ce != "" {
+		t.Errorf("Content-Encoding = %q, want none", ce)
+	}
+}
+
+func TestCompressFlush(t *testing.T) {
+	rec := serveCompressed(t, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: 1\n\n")
+		// Flush до minSize: ответ уходит клиенту без сжатия, а не ждёт накопления буфера.
+		w.(http.Flusher).Flush()
+		io.WriteString(w, strings.Repeat("data: 2\n\n", 20))
+	})
+	if ce := rec.Header().Get("Content-Encoding"); ce != "" {
+		t.Errorf("Content-Encoding = %q, want none", ce)
+	}
+	if !rec.Flushed {
+		t.Error("response was not flushed")
+	}
+	if want := "data: 1\n\n" + strings.Repeat("data: 2\n\n", 20); rec.Body.String() != want {
+		t.Errorf("body = %q", rec.Body.String())
+	}
+
+	rec = serveCompressed(t, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, strings.Repeat("data: 1\n\n", 20))
+		w.(http.Flusher).Flush()
+		io.WriteString(w, "data: 2\n\n")
+	})
+	if ce := rec.Header().Get("Content-Encoding"); ce != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", ce)
+	}
+	if got, want := gunzip(t, rec.Body), strings.Repeat("data: 1\n\n", 20)+"data: 2\n\n"; got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+}
+
+func TestCompressNoBody(t *testing.T) {
+	t.Run("head", func(t *testing.T) {
+		rec := serveCompressed(t, http.MethodHead, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Length", "500")
+		})
+		if ce := rec.Header().Get("Content-Encoding"); ce != "" {
+			t.Errorf("Content-Encoding = %q, want none", ce)
+		}
+		if cl := rec.Header().Get("Content-Length"); cl != "500" {
+			t.Errorf("Content-Length = %q, want 500", cl)
+		}
+	})
+	for _, status := range []int{http.StatusNoContent, http.StatusNotModified} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			rec := serveCompressed(t, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(status)
+			})
+			if rec.Code != status {
+				t.Errorf("status = %d, want %d", rec.Code, status)
+			}
+			if ce := rec.Header().Get("Content-Encoding"); ce != "" {
+				t.Errorf("Content-Encoding = %q, want none", ce)
+			}
+			if rec.Body.Len() != 0 {
+				t.Errorf("body = %q, want empty", rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/messenger/internal/maintenance"
+)
+
+// Maintenance отклоняет изменяющие запросы с 503, пока включён режим обслуживания.
+// Ставится после AuthServiceValidate: администраторы (по user_id из контекста) не ограничены.
+func Maintenance(mode *maintenance.Mode) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isReadOnlyRequest(r) || !mode.Blocks(r.Context(), GetUserID(r.Context())) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]any{"error": mode.Status().Message, "maintenance": true})
+		})
+	}
+}
+
+// isReadOnlyRequest — запрос ничего не меняет: безопасные методы и POST-запросы на чтение.
+func isReadOnlyRequest(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return r.URL.Path == "/api/users/presence" ||
+		(strings.HasPrefix(r.URL.Path, "/api/files/") && strings.HasSuffix(r.URL.Path, "/signed-url"))
+}
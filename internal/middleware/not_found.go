@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Коды ошибок роутера — в том же JSON-конверте {"error": ...}, что и ответы обработчиков.
+const (
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+)
+
+// NotFound — обработчик несуществующих маршрутов для chi (r.NotFound) вместо текстового ответа по умолчанию.
+func NotFound(w http.ResponseWriter, _ *http.Request) {
+	writeRouteError(w, http.StatusNotFound, "not found", CodeNotFound)
+}
+
+// MethodNotAllowed — обработчик маршрутов с неподходящим методом для chi (r.MethodNotAllowed).
+func MethodNotAllowed(w http.ResponseWriter, _ *http.Request) {
+	writeRouteError(w, http.StatusMethodNotAllowed, "method not allowed", CodeMethodNotAllowed)
+}
+
+func writeRouteError(w http.ResponseWriter, status int, msg, code string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": msg, "code": code})
+}
@@ -1,9 +1,18 @@
 package middleware
 
 import (
+	"context"
+	"net"
 	"net/http"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/messenger/internal/logger"
 )
 
 const (
@@ -12,6 +21,11 @@ const (
 	rateLimitMaxUser = 100
 )
 
+// limiter решает, можно ли пропустить ещё один запрос с данным ключом.
+type limiter interface {
+	allow(ctx context.Context, key string) bool
+}
+
 type rateLimiter struct {
 	mu     sync.Mutex
 	times  map[string][]time.Time
@@ -23,7 +37,7 @@ func newRateLimiter(max int, window time.Duration) *rateLimiter {
 	return &rateLimiter{times: make(map[string][]time.Time), max: max, window: window}
 }
 
-func (r *rateLimiter) allow(key string) bool {
+func (r *rateLimiter) allow(_ context.Context, key string) bool {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	now := time.Now()
@@ -44,26 +58,80 @@ func (r *rateLimiter) allow(key string) bool {
 	return true
 }
 
+// slidingWindowScript — скользящее окно на sorted set: удаляет устаревшие отметки, и если их меньше
+// лимита — добавляет новую. Атомарно, поэтому лимит общий для всех экземпляров API.
+var slidingWindowScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[1] - ARGV[2])
+if redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[3]) then
+	return 0
+end
+redis.call('ZADD', KEYS[1], ARGV[1], ARGV[4])
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return 1
+`)
+
+// redisRateLimiter — лимитер в Redis; при ошибке Redis решение принимает локальный fallback.
+type redisRateLimiter struct {
+	cli      *redis.Client
+	prefix   string
+	max      int
+	window   time.Duration
+	fallback *rateLimiter
+	// lastErrLog — unix-время последней записи об ошибке Redis (не чаще раза в минуту).
+	lastErrLog atomic.Int64
+}
+
+func (r *redisRateLimiter) allow(ctx context.Context, key string) bool {
+	now := time.Now().UnixMilli()
+	res, err := slidingWindowScript.Run(ctx, r.cli, []string{r.prefix + key},
+		now, r.window.Milliseconds(), r.max, strconv.FormatInt(now, 10)+":"+uuid.NewString()).Int()
+	if err != nil {
+		if t := time.Now().Unix(); t-r.lastErrLog.Load() >= 60 {
+			r.lastErrLog.Store(t)
+			logger.Errorf("rate limit redis: %v (using in-process limiter)", err)
+		}
+		return r.fallback.allow(ctx, key)
+	}
+	return res == 1
+}
+
 var (
 	apiRateByIP   = newRateLimiter(rateLimitMaxIP, rateLimitWindow)
 	apiRateByUser = newRateLimiter(rateLimitMaxUser, rateLimitWindow)
 )
 
 // RateLimitAPI ограничивает запросы к /api/* по IP и по user_id (если есть в контексте). 429 при превышении.
+// Лимит считается в памяти процесса — для нескольких экземпляров API используйте NewRateLimitAPI.
 func RateLimitAPI(next http.Handler) http.Handler {
+	return rateLimitHandler(next, apiRateByIP, apiRateByUser)
+}
+
+// NewRateLimitAPI — RateLimitAPI с лимитами в Redis, общими для всех экземпляров API.
+// rdb == nil — обычный RateLimitAPI в памяти процесса.
+func NewRateLimitAPI(rdb *redis.Client) func(http.Handler) http.Handler {
+	if rdb == nil {
+		return RateLimitAPI
+	}
+	byIP := &redisRateLimiter{cli: rdb, prefix: "ratelimit:api:ip:", max: rateLimitMaxIP, window: rateLimitWindow, fallback: apiRateByIP}
+	byUser := &redisRateLimiter{cli: rdb, prefix: "ratelimit:api:", max: rateLimitMaxUser, window: rateLimitWindow, fallback: apiRateByUser}
+	return func(next http.Handler) http.Handler {
+		return rateLimitHandler(next, byIP, byUser)
+	}
+}
+
+func rateLimitHandler(next http.Handler, byIP, byUser limiter) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// RemoteAddr уже подменён RealIP по X-Real-Ip от прокси; X-Forwarded-For клиента не учитывается.
 		ip := r.RemoteAddr
-		if x := r.Header.Get("X-Real-Ip"); x != "" {
-			ip = x
-		} else if x := r.Header.Get("X-Forwarded-For"); x != "" {
-			ip = x
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
 		}
-		if !apiRateByIP.allow(ip) {
+		if !byIP.allow(r.Context(), ip) {
 			http.Error(w, "too many requests", http.StatusTooManyRequests)
 			return
 		}
 		if userID := GetUserID(r.Context()); userID != "" {
-			if !apiRateByUser.allow("u:"+userID) {
+			if !byUser.allow(r.Context(), "u:"+userID) {
 				http.Error(w, "too many requests", http.StatusTooManyRequests)
 				return
 			}
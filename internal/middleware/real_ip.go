@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// RealIP подставляет в RemoteAddr адрес из X-Real-Ip — его выставляет наш прокси (nginx, authProxyHandler
+// в api), перезаписывая присланное клиентом. True-Client-IP и X-Forwarded-For не учитываются: в отличие от
+// chimw.RealIP, клиент не может подменить ими свой адрес для лимитов и журнала входов.
+func RealIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip := strings.TrimSpace(r.Header.Get("X-Real-Ip")); ip != "" && net.ParseIP(ip) != nil {
+			r.RemoteAddr = ip
+		}
+		next.ServeHTTP(w, r)
+	})
+}
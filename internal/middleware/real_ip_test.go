@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRealIP(t *testing.T) {
+	cases := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{"no headers", nil, "10.0.0.5:4321"},
+		{"proxy header", map[string]string{"X-Real-Ip": "203.0.113.7"}, "203.0.113.7"},
+		{"spoofed true-client-ip", map[string]string{"True-Client-IP": "1.2.3.4", "X-Real-Ip": "203.0.113.7"}, "203.0.113.7"},
+		{"spoofed forwarded-for only", map[string]string{"X-Forwarded-For": "1.2.3.4"}, "10.0.0.5:4321"},
+		{"spoofed true-client-ip only", map[string]string{"True-Client-IP": "1.2.3.4"}, "10.0.0.5:4321"},
+		{"garbage x-real-ip", map[string]string{"X-Real-Ip": "not-an-ip"}, "10.0.0.5:4321"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got string
+			h := RealIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { got = r.RemoteAddr }))
+			req := httptest.NewRequest(http.MethodPost, "/api/auth/verify-code", nil)
+			req.RemoteAddr = "10.0.0.5:4321"
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), req)
+			if got != tc.want {
+				t.Errorf("RemoteAddr = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -3,9 +3,13 @@ package middleware
 import (
 	"bufio"
 	"encoding/json"
+	"fmt"
 	"net"
 	"net/http"
+	"os"
+	"runtime/debug"
 
+	chimw "github.com/go-chi/chi/v5/middleware"
 	"github.com/messenger/internal/logger"
 )
 
@@ -34,17 +38,28 @@ func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	return nil, nil, http.ErrNotSupported
 }
 
-// RecoverJSON при панике в handler логирует её и отдаёт клиенту JSON 500 (если ответ ещё не отправлен).
+// RecoverJSON при панике в handler логирует её со стеком, методом, путём и request id (если есть)
+// и отдаёт клиенту JSON 500 (если ответ ещё не отправлен). Вне production при DEBUG в ответ добавляется значение паники.
 func RecoverJSON(next http.Handler) http.Handler {
+	exposePanic := os.Getenv("APP_ENV") != "production" && os.Getenv("DEBUG") != ""
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		wrap := &responseWriter{ResponseWriter: w, status: http.StatusOK}
 		defer func() {
 			if err := recover(); err != nil {
-				logger.Errorf("panic recovered: %v", err)
+				if err == http.ErrAbortHandler {
+					// Штатный обрыв ответа: net/http сам закроет соединение без лога.
+					panic(err)
+				}
+				logger.Errorf("panic recovered: %v method=%s path=%s request_id=%s\n%s",
+					err, r.Method, r.URL.Path, chimw.GetReqID(r.Context()), debug.Stack())
 				if !wrap.wrote {
+					body := map[string]string{"error": "internal server error"}
+					if exposePanic {
+						body["panic"] = fmt.Sprint(err)
+					}
 					wrap.ResponseWriter.Header().Set("Content-Type", "application/json; charset=utf-8")
 					wrap.ResponseWriter.WriteHeader(http.StatusInternalServerError)
-					_ = json.NewEncoder(wrap.ResponseWriter).Encode(map[string]string{"error": "internal server error"})
+					_ = json.NewEncoder(wrap.ResponseWriter).Encode(body)
 				}
 			}
 		}()
@@ -5,8 +5,9 @@ import (
 	"context"
 	"crypto/hmac"
 	"crypto/sha256"
-	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"strconv"
@@ -19,6 +20,21 @@ import (
 
 const TimestampSkew = 30 * time.Second
 
+// CodeClockSkew — код ошибки 401, когда X-Timestamp вне окна TimestampSkew: клиенту нужно
+// сверить часы по GET /api/time и повторить запрос, а не выходить из аккаунта.
+const CodeClockSkew = "clock_skew"
+
+// WriteClockSkew отвечает 401 с кодом CodeClockSkew и текущим временем сервера.
+func WriteClockSkew(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusUnauthorized)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"error":       "request timestamp out of allowed window",
+		"code":        CodeClockSkew,
+		"server_time": time.Now().Unix(),
+	})
+}
+
 func SessionAuth(sessionRepo *repository.SessionRepository, store storage.SessionOTPStore) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -45,7 +61,7 @@ func SessionAuth(sessionRepo *repository.SessionRepository, store storage.Sessio
 			}
 			reqTime := time.Unix(ts, 0)
 			if time.Since(reqTime) > TimestampSkew || time.Until(reqTime) > TimestampSkew {
-				http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+				WriteClockSkew(w)
 				return
 			}
 			var body []byte
@@ -57,22 +73,20 @@ func SessionAuth(sessionRepo *repository.SessionRepository, store storage.Sessio
 				}
 				r.Body = io.NopCloser(bytes.NewReader(body))
 			}
-			// session_secret хранится в store (Redis или in-memory в -dev).
-			secretB64, err := store.GetSessionSecret(r.Context(), sessionID)
-			if err != nil || secretB64 == "" {
-				http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+			// session_secret хранится в store (Redis или in-memory в -dev). После ротации
+			// в течение окна перекрытия принимается и подпись прежним секретом.
+			secrets, err := storage.SessionSecrets(r.Context(), store, sessionID)
+			if errors.Is(err, storage.ErrUnavailable) {
+				w.Header().Set("Retry-After", "5")
+				http.Error(w, `{"error":"service temporarily unavailable"}`, http.StatusServiceUnavailable)
 				return
 			}
-			secret, err := base64.StdEncoding.DecodeString(secretB64)
-			if err != nil || len(secret) != 32 {
+			if err != nil || len(secrets) == 0 {
 				http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
 				return
 			}
 			payload := r.Method + r.URL.Path + string(body) + timestampStr
-			mac := hmac.New(sha256.New, secret)
-			mac.Write([]byte(payload))
-			expected := hex.EncodeToString(mac.Sum(nil))
-			if !hmac.Equal([]byte(signature), []byte(expected)) {
+			if !signatureMatches(secrets, payload, signature) {
 				http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
 				return
 			}
@@ -91,6 +105,19 @@ func SessionAuth(sessionRepo *repository.SessionRepository, store storage.Sessio
 	}
 }
 
+// signatureMatches проверяет HMAC-SHA256 подписи payload любым из секретов.
+func signatureMatches(secrets [][]byte, payload, signature string) bool {
+	for _, secret := range secrets {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(payload))
+		expected := hex.EncodeToString(mac.Sum(nil))
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return true
+		}
+	}
+	return false
+}
+
 var SessionIDKey contextKey = "session_id"
 
 func GetSessionID(ctx context.Context) string {
@@ -0,0 +1,16 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditEntry — запись журнала действий администраторов (admin_audit_log).
+type AuditEntry struct {
+	ID        int64           `json:"id"`
+	ActorID   *string         `json:"actor_id"`
+	Action    string          `json:"action"`
+	TargetID  *string         `json:"target_id"`
+	Details   json.RawMessage `json:"details"`
+	CreatedAt time.Time       `json:"created_at"`
+}
@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// Bot — служебная учётная запись: пользователь, который авторизуется API-ключом, а не кодом на email.
+type Bot struct {
+	User      UserPublic `json:"user"`
+	CreatedBy *string    `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// BotAPIKey — метаданные ключа бота. Сам ключ показывается один раз при создании; Prefix — его начало,
+// чтобы отличать ключи в списке.
+type BotAPIKey struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	CreatedBy  *string    `json:"created_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
@@ -0,0 +1,65 @@
+package model
+
+import "time"
+
+// CallStats — сводка качества звонка от одного участника.
+type CallStats struct {
+	CallID         string    `json:"call_id"`
+	UserID         string    `json:"user_id"`
+	PeerID         string    `json:"peer_id"`
+	DurationSec    int       `json:"duration_sec"`
+	AvgBitrateKbps int       `json:"avg_bitrate_kbps"`
+	PacketLossPct  float64   `json:"packet_loss_pct"`
+	JitterMs       float64   `json:"jitter_ms"`
+	EndReason      string    `json:"end_reason"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// CallRecord — звонок по данным сигнализации call-сервиса (POST /internal/calls).
+type CallRecord struct {
+	ID         string     `json:"id"`
+	CallerID   string     `json:"caller_id"`
+	CalleeID   string     `json:"callee_id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+	EndedAt    *time.Time `json:"ended_at,omitempty"`
+}
+
+// Peer возвращает собеседника userID в звонке или "", если userID не участник.
+func (c *CallRecord) Peer(userID string) string {
+	switch userID {
+	case c.CallerID:
+		return c.CalleeID
+	case c.CalleeID:
+		return c.CallerID
+	}
+	return ""
+}
+
+// DurationSec — длительность разговора от принятия до завершения (до now, если отбоя ещё не было); 0 — не принят.
+func (c *CallRecord) DurationSec(now time.Time) int {
+	if c.AcceptedAt == nil {
+		return 0
+	}
+	end := now
+	if c.EndedAt != nil {
+		end = *c.EndedAt
+	}
+	if d := end.Sub(*c.AcceptedAt); d > 0 {
+		return int(d / time.Second)
+	}
+	return 0
+}
+
+// CallStatsSummary — агрегат по отчётам о звонках за период.
+type CallStatsSummary struct {
+	Since            time.Time      `json:"since"`
+	Reports          int            `json:"reports"`
+	Calls            int            `json:"calls"`
+	AvgDurationSec   float64        `json:"avg_duration_sec"`
+	AvgBitrateKbps   float64        `json:"avg_bitrate_kbps"`
+	AvgPacketLossPct float64        `json:"avg_packet_loss_pct"`
+	AvgJitterMs      float64        `json:"avg_jitter_ms"`
+	PoorQualityPct   float64        `json:"poor_quality_pct"` // доля отчётов с потерями > 5%
+	EndReasons       map[string]int `json:"end_reasons"`
+}
@@ -8,6 +8,24 @@ const (
 	ChatTypePersonal ChatType = "personal"
 	ChatTypeGroup    ChatType = "group"
 	ChatTypeNotes    ChatType = "notes"
+	// ChatTypeChannel — канал: пишут администраторы, подписчики (роль subscriber) читают и ставят реакции.
+	ChatTypeChannel ChatType = "channel"
+)
+
+// PinPolicy — кто может закреплять сообщения в группе.
+type PinPolicy string
+
+const (
+	PinPolicyEveryone PinPolicy = "everyone"
+	PinPolicyAdmins   PinPolicy = "admins"
+)
+
+// SendPolicy — кто может отправлять сообщения в группу; admins — канал объявлений.
+type SendPolicy string
+
+const (
+	SendPolicyEveryone SendPolicy = "everyone"
+	SendPolicyAdmins   SendPolicy = "admins"
 )
 
 type Chat struct {
@@ -18,6 +36,11 @@ type Chat struct {
 	AvatarURL   string    `json:"avatar_url"`
 	CreatedBy   string    `json:"created_by"`
 	CreatedAt   time.Time `json:"created_at"`
+	PinPolicy   PinPolicy `json:"pin_policy"`
+	// IsSensitive — содержимое сообщений чата хранится в БД зашифрованным (если на сервере настроен ключ).
+	IsSensitive bool `json:"is_sensitive"`
+	// SendPolicy — "admins": писать могут только администраторы, остальные читают и ставят реакции.
+	SendPolicy SendPolicy `json:"send_policy"`
 }
 
 type ChatMember struct {
@@ -28,9 +51,19 @@ type ChatMember struct {
 	LastReadAt time.Time `json:"last_read_at"`
 }
 
+// UserGroupMembership — групповой чат или канал пользователя и его роль в нём (для администраторов).
+type UserGroupMembership struct {
+	Chat     Chat      `json:"chat"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
 type ChatWithLastMessage struct {
-	Chat        Chat         `json:"chat"`
-	LastMessage *Message     `json:"last_message,omitempty"`
-	Members     []UserPublic `json:"members"`
-	UnreadCount int          `json:"unread_count"`
+	Chat               Chat         `json:"chat"`
+	LastMessage        *Message     `json:"last_message,omitempty"`
+	Members            []UserPublic `json:"members"`
+	UnreadCount        int          `json:"unread_count"`
+	UnreadMentionCount int          `json:"unread_mention_count"`
+	// SortOrder — позиция чата среди закреплённых пользователем вверху списка; nil — не закреплён.
+	SortOrder *int `json:"sort_order,omitempty"`
 }
@@ -10,6 +10,10 @@ const (
 	ContentTypeFile   ContentType = "file"
 	ContentTypeVoice  ContentType = "voice"
 	ContentTypeSystem ContentType = "system"
+	// ContentTypeLocation — геопозиция (поле Location).
+	ContentTypeLocation ContentType = "location"
+	// ContentTypeContact — карточка пользователя (поле Contact).
+	ContentTypeContact ContentType = "contact"
 )
 
 type MessageStatus string
@@ -29,6 +33,9 @@ type Message struct {
 	FileURL     string        `json:"file_url,omitempty"`
 	FileName    string        `json:"file_name,omitempty"`
 	FileSize    int64         `json:"file_size,omitempty"`
+	Width       int           `json:"width,omitempty"`
+	Height      int           `json:"height,omitempty"`
+	BlurHash    string        `json:"blurhash,omitempty"`
 	Status      MessageStatus `json:"status"`
 	ReplyToID   *string       `json:"reply_to_id,omitempty"`
 	EditedAt    *time.Time    `json:"edited_at,omitempty"`
@@ -36,7 +43,80 @@ type Message struct {
 	CreatedAt   time.Time     `json:"created_at"`
 	Sender      *UserPublic   `json:"sender,omitempty"`
 	ReplyTo     *Message      `json:"reply_to,omitempty"`
-	Reactions   []Reaction    `json:"reactions,omitempty"`
+	// ReplyCount — сколько неудалённых прямых ответов на сообщение; заполняется в истории чата.
+	ReplyCount int        `json:"reply_count,omitempty"`
+	Reactions  []Reaction `json:"reactions,omitempty"`
+	// Attachments — файлы альбома (несколько фото/файлов в одном сообщении). Первый дублируется в FileURL/FileName/FileSize.
+	Attachments []Attachment `json:"attachments,omitempty"`
+	// Location — координаты для content_type "location".
+	Location *Location `json:"location,omitempty"`
+	// Contact — карточка пользователя для content_type "contact".
+	Contact *ContactCard `json:"contact,omitempty"`
+	// Receipts — сводка доставки/прочтения по участникам группы; в группе Status выводится из неё.
+	Receipts *ReceiptSummary `json:"receipts,omitempty"`
+	// SystemEvent — событие служебного сообщения (content_type "system"); клиент может собрать текст сам.
+	// Content таких сообщений в HTTP-ответах и событиях WebSocket — на языке запроса (?lang= или
+	// Accept-Language; для WebSocket — запроса подключения), без языка — на языке по умолчанию.
+	SystemEvent *SystemEvent `json:"system_event,omitempty"`
+}
+
+// SystemEvent — служебное сообщение без привязки к языку: код («member_added») и параметры (actor, target).
+type SystemEvent struct {
+	Code   string            `json:"code"`
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// ReceiptSummary — сколько получателей (участников кроме отправителя) получили и прочитали сообщение.
+type ReceiptSummary struct {
+	Recipients int `json:"recipients"`
+	Delivered  int `json:"delivered"`
+	Read       int `json:"read"`
+}
+
+// MessageReceipt — доставка и прочтение сообщения одним получателем (для «прочитано в 14:32» в группах).
+type MessageReceipt struct {
+	User        UserPublic `json:"user"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+	ReadAt      *time.Time `json:"read_at,omitempty"`
+}
+
+// Status — общий статус: прочитано, когда прочитали все получатели; доставлено — когда всем доставлено.
+func (s ReceiptSummary) Status() MessageStatus {
+	switch {
+	case s.Recipients > 0 && s.Read >= s.Recipients:
+		return MessageStatusRead
+	case s.Recipients > 0 && s.Delivered >= s.Recipients:
+		return MessageStatusDelivered
+	}
+	return MessageStatusSent
+}
+
+// ContactCard — пользователь, которым поделились в сообщении. Username/AvatarURL — снимок на момент отправки,
+// чтобы карточка отображалась и после переименования; User — актуальные данные, если пользователь ещё существует.
+type ContactCard struct {
+	UserID    string      `json:"user_id"`
+	Username  string      `json:"username"`
+	AvatarURL string      `json:"avatar_url,omitempty"`
+	User      *UserPublic `json:"user,omitempty"`
+}
+
+// Location — точка на карте с необязательной подписью (адрес, название места).
+type Location struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Label     string  `json:"label,omitempty"`
+}
+
+// Attachment — один файл сообщения.
+type Attachment struct {
+	ContentType ContentType `json:"content_type"`
+	FileURL     string      `json:"file_url"`
+	FileName    string      `json:"file_name,omitempty"`
+	FileSize    int64       `json:"file_size,omitempty"`
+	// Width, Height и BlurHash заполняет сервер по данным загрузки (для картинок).
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
+	BlurHash string `json:"blurhash,omitempty"`
 }
 
 type Reaction struct {
@@ -12,3 +12,10 @@ type Session struct {
 	CreatedAt  time.Time  `json:"created_at"`
 	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
 }
+
+// AuthActivity — событие входа по коду из журнала auth_activity (email не хранится, только его хеш).
+type AuthActivity struct {
+	Event     string    `json:"event"`
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,24 @@
+package model
+
+// Статусы проверки загрузки антивирусом (user_uploads.scan_status).
+const (
+	ScanPending  = "pending"
+	ScanClean    = "clean"
+	ScanInfected = "infected"
+)
+
+// StorageUsage — сколько места занимают файлы пользователя; QuotaBytes = 0 — без ограничения.
+type StorageUsage struct {
+	UsedBytes  int64 `json:"used_bytes"`
+	Files      int   `json:"files"`
+	QuotaBytes int64 `json:"quota_bytes"`
+}
+
+// UploadMeta — сведения о загруженном файле: статус проверки антивирусом и, для картинок, размеры и BlurHash.
+type UploadMeta struct {
+	FileName   string `json:"file_name"`
+	ScanStatus string `json:"scan_status"`
+	Width      int    `json:"width,omitempty"`
+	Height     int    `json:"height,omitempty"`
+	BlurHash   string `json:"blurhash,omitempty"`
+}
@@ -2,39 +2,70 @@ package model
 
 import "time"
 
+// PresenceStatus — статус присутствия пользователя.
+type PresenceStatus string
+
+const (
+	PresenceOnline  PresenceStatus = "online"
+	PresenceAway    PresenceStatus = "away"
+	PresenceDND     PresenceStatus = "dnd" // не беспокоить: push-уведомления не отправляются
+	PresenceOffline PresenceStatus = "offline"
+)
+
 type User struct {
-	ID           string     `json:"id"`
-	Username     string     `json:"username"`
-	Email        string     `json:"email"`
-	Phone        string     `json:"phone"`
-	PasswordHash string     `json:"-"`
-	AvatarURL    string     `json:"avatar_url"`
-	LastSeenAt   time.Time  `json:"last_seen_at"`
-	IsOnline     bool       `json:"is_online"`
-	CreatedAt    time.Time  `json:"created_at"`
-	DisabledAt   *time.Time `json:"-"` // не null = пользователь отключён, не может войти
+	ID           string         `json:"id"`
+	Username     string         `json:"username"`
+	Email        string         `json:"email"`
+	Phone        string         `json:"phone"`
+	PasswordHash string         `json:"-"`
+	AvatarURL    string         `json:"avatar_url"`
+	LastSeenAt   time.Time      `json:"last_seen_at,omitzero"` // нулевое — скрыто настройкой hide_last_seen
+	IsOnline     bool           `json:"is_online"`
+	Presence     PresenceStatus `json:"presence"`
+	CreatedAt    time.Time      `json:"created_at"`
+	DisabledAt   *time.Time     `json:"-"` // не null = пользователь отключён, не может войти
+	// Пользовательский статус ("🏖 В отпуске"); по StatusExpiresAt снимается автоматически.
+	StatusEmoji     string     `json:"status_emoji"`
+	StatusText      string     `json:"status_text"`
+	StatusExpiresAt *time.Time `json:"status_expires_at,omitempty"`
 }
 
 type UserPublic struct {
-	ID         string     `json:"id"`
-	Username   string     `json:"username"`
-	Email      string     `json:"email"`
-	Phone      string     `json:"phone"`
-	AvatarURL  string     `json:"avatar_url"`
-	IsOnline   bool       `json:"is_online"`
-	LastSeenAt time.Time  `json:"last_seen_at"`
-	DisabledAt *time.Time `json:"disabled_at,omitempty"` // не null = отключён администратором
+	ID              string         `json:"id"`
+	Username        string         `json:"username"`
+	Email           string         `json:"email"`
+	Phone           string         `json:"phone"`
+	AvatarURL       string         `json:"avatar_url"`
+	IsOnline        bool           `json:"is_online"`
+	Presence        PresenceStatus `json:"presence,omitempty"`
+	LastSeenAt      time.Time      `json:"last_seen_at,omitzero"` // нулевое — скрыто настройкой hide_last_seen
+	DisabledAt      *time.Time     `json:"disabled_at,omitempty"` // не null = отключён администратором
+	StatusEmoji     string         `json:"status_emoji,omitempty"`
+	StatusText      string         `json:"status_text,omitempty"`
+	StatusExpiresAt *time.Time     `json:"status_expires_at,omitempty"`
+}
+
+// UserPresenceInfo — присутствие одного пользователя в ответе пакетного запроса.
+type UserPresenceInfo struct {
+	UserID     string         `json:"user_id"`
+	IsOnline   bool           `json:"is_online"`
+	Presence   PresenceStatus `json:"presence"`
+	LastSeenAt *time.Time     `json:"last_seen_at,omitempty"`
 }
 
 func (u *User) ToPublic() UserPublic {
 	return UserPublic{
-		ID:         u.ID,
-		Username:   u.Username,
-		Email:      u.Email,
-		Phone:      u.Phone,
-		AvatarURL:  u.AvatarURL,
-		IsOnline:   u.IsOnline,
-		LastSeenAt: u.LastSeenAt,
-		DisabledAt: u.DisabledAt,
+		ID:              u.ID,
+		Username:        u.Username,
+		Email:           u.Email,
+		Phone:           u.Phone,
+		AvatarURL:       u.AvatarURL,
+		IsOnline:        u.IsOnline,
+		Presence:        u.Presence,
+		LastSeenAt:      u.LastSeenAt,
+		DisabledAt:      u.DisabledAt,
+		StatusEmoji:     u.StatusEmoji,
+		StatusText:      u.StatusText,
+		StatusExpiresAt: u.StatusExpiresAt,
 	}
 }
@@ -0,0 +1,111 @@
+// Package msgcrypt шифрует содержимое сообщений "чувствительных" чатов (AES-256-GCM) ключом из конфигурации.
+// Формат шифротекста: base64(версия ключа [1 байт] || nonce || ciphertext). Версия позволяет ротацию:
+// новые сообщения шифруются текущим ключом, старые расшифровываются ключом своей версии.
+package msgcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrUnknownKeyVersion = errors.New("msgcrypt: unknown key version")
+
+// Cipher хранит ключи по версиям и текущую версию для шифрования.
+type Cipher struct {
+	current byte
+	aeads   map[byte]cipher.AEAD
+}
+
+// New создаёт шифратор. keys — версия -> 32-байтный ключ; current — версия для новых сообщений.
+func New(keys map[byte][]byte, current byte) (*Cipher, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("msgcrypt: no key for current version %d", current)
+	}
+	c := &Cipher{current: current, aeads: make(map[byte]cipher.AEAD, len(keys))}
+	for v, k := range keys {
+		if len(k) != 32 {
+			return nil, fmt.Errorf("msgcrypt: key version %d must be 32 bytes, got %d", v, len(k))
+		}
+		block, err := aes.NewCipher(k)
+		if err != nil {
+			return nil, fmt.Errorf("msgcrypt: key version %d: %w", v, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("msgcrypt: key version %d: %w", v, err)
+		}
+		c.aeads[v] = aead
+	}
+	return c, nil
+}
+
+// ParseKeys разбирает строку вида "1:<base64>,2:<base64>". Текущей считается наибольшая версия.
+func ParseKeys(raw string) (map[byte][]byte, byte, error) {
+	keys := make(map[byte][]byte)
+	var current byte
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		verStr, keyStr, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, 0, fmt.Errorf("msgcrypt: expected version:base64key, got %q", part)
+		}
+		ver, err := strconv.ParseUint(strings.TrimSpace(verStr), 10, 8)
+		if err != nil || ver == 0 {
+			return nil, 0, fmt.Errorf("msgcrypt: invalid key version %q", verStr)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(keyStr))
+		if err != nil {
+			return nil, 0, fmt.Errorf("msgcrypt: key version %d: invalid base64", ver)
+		}
+		keys[byte(ver)] = key
+		if byte(ver) > current {
+			current = byte(ver)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, 0, errors.New("msgcrypt: no keys")
+	}
+	return keys, current, nil
+}
+
+// Encrypt шифрует текст текущим ключом.
+func (c *Cipher) Encrypt(plain string) (string, error) {
+	aead := c.aeads[c.current]
+	buf := make([]byte, 1+aead.NonceSize(), 1+aead.NonceSize()+len(plain)+aead.Overhead())
+	buf[0] = c.current
+	if _, err := rand.Read(buf[1:]); err != nil {
+		return "", fmt.Errorf("msgcrypt: nonce: %w", err)
+	}
+	out := aead.Seal(buf, buf[1:], []byte(plain), nil)
+	return base64.StdEncoding.EncodeToString(out), nil
+}
+
+// Decrypt расшифровывает текст, зашифрованный Encrypt (любой известной версией ключа).
+func (c *Cipher) Decrypt(enc string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(enc)
+	if err != nil || len(raw) < 1 {
+		return "", errors.New("msgcrypt: malformed ciphertext")
+	}
+	aead, ok := c.aeads[raw[0]]
+	if !ok {
+		return "", ErrUnknownKeyVersion
+	}
+	ns := aead.NonceSize()
+	if len(raw) < 1+ns+aead.Overhead() {
+		return "", errors.New("msgcrypt: malformed ciphertext")
+	}
+	plain, err := aead.Open(nil, raw[1:1+ns], raw[1+ns:], nil)
+	if err != nil {
+		return "", fmt.Errorf("msgcrypt: decrypt: %w", err)
+	}
+	return string(plain), nil
+}
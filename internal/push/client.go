@@ -124,3 +124,60 @@ func (c *Client) Notify(ctx context.Context, userID, title, body string, data ma
 		logger.Errorf("push notify: %d", resp.StatusCode)
 	}
 }
+
+// NotifyBatchRequest — одно уведомление для нескольких пользователей.
+type NotifyBatchRequest struct {
+	UserIDs []string          `json:"user_ids"`
+	Title   string            `json:"title"`
+	Body    string            `json:"body"`
+	Data    map[string]string `json:"data,omitempty"`
+}
+
+// NotifyBatch отправляет одно уведомление нескольким пользователям одним запросом к push-сервису
+// (он сам раздаёт его по подпискам). Исключения (DND и т.п.) вызывающий применяет до вызова.
+func (c *Client) NotifyBatch(ctx context.Context, userIDs []string, title, body string, data map[string]string) {
+	if c.baseURL == "" || len(userIDs) == 0 {
+		return
+	}
+	payload := NotifyBatchRequest{UserIDs: userIDs, Title: title, Body: body, Data: data}
+	bodyBytes, _ := json.Marshal(payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/notify-batch", bytes.NewReader(bodyBytes))
+	if err != nil {
+		logger.Errorf("push notify-batch request: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		logger.Errorf("push notify-batch: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		logger.Errorf("push notify-batch: %d", resp.StatusCode)
+	}
+}
+
+// ChatRead сообщает push-сервису, что пользователь прочитал чат: сохранённые для повторной отправки
+// уведомления из этого чата удаляются.
+func (c *Client) ChatRead(ctx context.Context, userID, chatID string) {
+	if c.baseURL == "" {
+		return
+	}
+	bodyBytes, _ := json.Marshal(map[string]string{"user_id": userID, "chat_id": chatID})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/chat-read", bytes.NewReader(bodyBytes))
+	if err != nil {
+		logger.Errorf("push chat-read request: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		logger.Errorf("push chat-read: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		logger.Errorf("push chat-read: %d", resp.StatusCode)
+	}
+}
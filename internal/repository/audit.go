@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/messenger/internal/logger"
+	"github.com/messenger/internal/model"
+)
+
+// Действия администраторов, записываемые в журнал (admin_audit_log.action).
+const (
+	AuditUserMerge = "user.merge"
+	// AuditUserRemoveFromGroups — пользователь исключён из всех групп и каналов (offboarding).
+	AuditUserRemoveFromGroups = "user.remove_from_groups"
+	// AuditBotKeyCreate, AuditBotKeyRevoke — выпуск и отзыв API-ключа бота (target — бот).
+	AuditBotKeyCreate = "bot.key_create"
+	AuditBotKeyRevoke = "bot.key_revoke"
+	// AuditForceResync — администратор попросил клиентов перечитать чаты после изменений в обход API.
+	AuditForceResync = "admin.force_resync"
+)
+
+// AuditRepository пишет журнал действий администраторов.
+type AuditRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewAuditRepository(pool *pgxpool.Pool) *AuditRepository {
+	return &AuditRepository{pool: pool}
+}
+
+// Record добавляет запись; details сериализуется в JSON (nil — пустой объект). Внутри WithTx запись
+// попадает в ту же транзакцию, что и само действие.
+func (r *AuditRepository) Record(ctx context.Context, actorID, action, targetID string, details any) error {
+	defer logger.DeferLogDuration("audit.Record", time.Now())()
+	raw := []byte(`{}`)
+	if details != nil {
+		var err error
+		if raw, err = json.Marshal(details); err != nil {
+			return fmt.Errorf("auditRepo.Record: %w", err)
+		}
+	}
+	_, err := conn(ctx, r.pool).Exec(ctx,
+		`INSERT INTO admin_audit_log (actor_id, action, target_id, details) VALUES ($1, $2, NULLIF($3, '')::uuid, $4)`,
+		actorID, action, targetID, raw,
+	)
+	if err != nil {
+		return fmt.Errorf("auditRepo.Record: %w", err)
+	}
+	return nil
+}
+
+// AuditFilter — условия выборки журнала; пустые поля не фильтруют. BeforeID — курсор: записи с id меньше него.
+type AuditFilter struct {
+	ActorID  string
+	Action   string
+	TargetID string
+	From, To time.Time
+	BeforeID int64
+}
+
+// where собирает условие WHERE и аргументы; withCursor — учитывать BeforeID (для Count не нужен).
+func (f AuditFilter) where(withCursor bool) (string, []any) {
+	var conds []string
+	var args []any
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if f.ActorID != "" {
+		add("actor_id = $%d", f.ActorID)
+	}
+	if f.Action != "" {
+		add("action = $%d", f.Action)
+	}
+	if f.TargetID != "" {
+		add("target_id = $%d", f.TargetID)
+	}
+	if !f.From.IsZero() {
+		add("created_at >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		add("created_at < $%d", f.To)
+	}
+	if withCursor && f.BeforeID > 0 {
+		add("id < $%d", f.BeforeID)
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// List возвращает до limit записей по фильтру, новые первыми.
+func (r *AuditRepository) List(ctx context.Context, f AuditFilter, limit int) ([]model.AuditEntry, error) {
+	defer logger.DeferLogDuration("audit.List", time.Now())()
+	where, args := f.where(true)
+	args = append(args, limit)
+	rows, err := r.pool.Query(ctx,
+		`SELECT id, actor_id, action, target_id, details, created_at FROM admin_audit_log`+where+
+			fmt.Sprintf(` ORDER BY id DESC LIMIT $%d`, len(args)),
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("auditRepo.List: %w", err)
+	}
+	defer rows.Close()
+	var list []model.AuditEntry
+	for rows.Next() {
+		var e model.AuditEntry
+		if err := rows.Scan(&e.ID, &e.ActorID, &e.Action, &e.TargetID, &e.Details, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("auditRepo.List scan: %w", err)
+		}
+		list = append(list, e)
+	}
+	return list, rows.Err()
+}
+
+// Count — число записей по фильтру без учёта курсора.
+func (r *AuditRepository) Count(ctx context.Context, f AuditFilter) (int, error) {
+	defer logger.DeferLogDuration("audit.Count", time.Now())()
+	where, args := f.where(false)
+	var n int
+	if err := r.pool.QueryRow(ctx, `SELECT COUNT(*) FROM admin_audit_log`+where, args...).Scan(&n); err != nil {
+		return 0, fmt.Errorf("auditRepo.Count: %w", err)
+	}
+	return n, nil
+}
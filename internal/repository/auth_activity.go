@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/messenger/internal/logger"
+	"github.com/messenger/internal/model"
+)
+
+// AuthActivityRepository хранит журнал попыток входа по коду (таблица auth_activity).
+type AuthActivityRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewAuthActivityRepository(pool *pgxpool.Pool) *AuthActivityRepository {
+	return &AuthActivityRepository{pool: pool}
+}
+
+func (r *AuthActivityRepository) Record(ctx context.Context, emailHash, event, ip string) error {
+	defer logger.DeferLogDuration("authActivity.Record", time.Now())()
+	_, err := r.pool.Exec(ctx,
+		`INSERT INTO auth_activity (email_hash, event, ip) VALUES ($1, $2, $3)`,
+		emailHash, event, ip,
+	)
+	if err != nil {
+		return fmt.Errorf("authActivityRepo.Record: %w", err)
+	}
+	return nil
+}
+
+// ListByEmailHash возвращает последние limit событий для адреса, новые первыми.
+func (r *AuthActivityRepository) ListByEmailHash(ctx context.Context, emailHash string, limit int) ([]model.AuthActivity, error) {
+	defer logger.DeferLogDuration("authActivity.ListByEmailHash", time.Now())()
+	rows, err := r.pool.Query(ctx,
+		`SELECT event, ip, created_at FROM auth_activity
+		 WHERE email_hash = $1 ORDER BY created_at DESC, id DESC LIMIT $2`,
+		emailHash, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("authActivityRepo.ListByEmailHash: %w", err)
+	}
+	defer rows.Close()
+	var list []model.AuthActivity
+	for rows.Next() {
+		var a model.AuthActivity
+		if err := rows.Scan(&a.Event, &a.IP, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("authActivityRepo.ListByEmailHash scan: %w", err)
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
+
+// DeleteOlderThan удаляет записи, созданные раньше before; возвращает число удалённых.
+func (r *AuthActivityRepository) DeleteOlderThan(ctx context.Context, before time.Time) (int64, error) {
+	defer logger.DeferLogDuration("authActivity.DeleteOlderThan", time.Now())()
+	tag, err := r.pool.Exec(ctx, `DELETE FROM auth_activity WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("authActivityRepo.DeleteOlderThan: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/messenger/internal/logger"
+	"github.com/messenger/internal/model"
+)
+
+// BotRepository хранит служебные учётные записи (bot_accounts) и их API-ключи (bot_api_keys).
+type BotRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewBotRepository(pool *pgxpool.Pool) *BotRepository {
+	return &BotRepository{pool: pool}
+}
+
+// WithTx — repository.WithTx на пуле репозитория.
+func (r *BotRepository) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return WithTx(ctx, r.pool, fn)
+}
+
+// HashBotKey — хеш API-ключа для хранения и поиска. Ключи случайные и длинные, поэтому достаточно SHA-256.
+func HashBotKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// MarkBot делает пользователя userID служебной учётной записью.
+func (r *BotRepository) MarkBot(ctx context.Context, userID, createdBy string) error {
+	defer logger.DeferLogDuration("bot.MarkBot", time.Now())()
+	_, err := conn(ctx, r.pool).Exec(ctx,
+		`INSERT INTO bot_accounts (user_id, created_by) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+		userID, createdBy,
+	)
+	if err != nil {
+		return fmt.Errorf("botRepo.MarkBot: %w", err)
+	}
+	return nil
+}
+
+// IsBot сообщает, является ли пользователь служебной учётной записью.
+func (r *BotRepository) IsBot(ctx context.Context, userID string) (bool, error) {
+	defer logger.DeferLogDuration("bot.IsBot", time.Now())()
+	var ok bool
+	err := r.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM bot_accounts WHERE user_id = $1)`, userID).Scan(&ok)
+	if err != nil {
+		return false, fmt.Errorf("botRepo.IsBot: %w", err)
+	}
+	return ok, nil
+}
+
+// List возвращает все служебные учётные записи, новые первыми.
+func (r *BotRepository) List(ctx context.Context) ([]model.Bot, error) {
+	defer logger.DeferLogDuration("bot.List", time.Now())()
+	rows, err := r.pool.Query(ctx,
+		`SELECT u.id, u.username, u.avatar_url, b.created_by, b.created_at
+		 FROM bot_accounts b
+		 JOIN users u ON u.id = b.user_id
+		 ORDER BY b.created_at DESC`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("botRepo.List: %w", err)
+	}
+	defer rows.Close()
+	bots := []model.Bot{}
+	for rows.Next() {
+		var b model.Bot
+		if err := rows.Scan(&b.User.ID, &b.User.Username, &b.User.AvatarURL, &b.CreatedBy, &b.CreatedAt); err != nil {
+			return nil, fmt.Errorf("botRepo.List scan: %w", err)
+		}
+		bots = append(bots, b)
+	}
+	return bots, rows.Err()
+}
+
+// CreateKey сохраняет ключ с хешем keyHash.
+func (r *BotRepository) CreateKey(ctx context.Context, k *model.BotAPIKey, keyHash string) error {
+	defer logger.DeferLogDuration("bot.CreateKey", time.Now())()
+	_, err := conn(ctx, r.pool).Exec(ctx,
+		`INSERT INTO bot_api_keys (id, user_id, name, key_prefix, key_hash, created_by, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		k.ID, k.UserID, k.Name, k.Prefix, keyHash, k.CreatedBy, k.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("botRepo.CreateKey: %w", err)
+	}
+	return nil
+}
+
+// ListKeys возвращает ключи бота (включая отозванные), новые первыми.
+func (r *BotRepository) ListKeys(ctx context.Context, userID string) ([]model.BotAPIKey, error) {
+	defer logger.DeferLogDuration("bot.ListKeys", time.Now())()
+	rows, err := r.pool.Query(ctx,
+		`SELECT id, user_id, name, key_prefix, created_by, created_at, last_used_at, revoked_at
+		 FROM bot_api_keys WHERE user_id = $1 ORDER BY created_at DESC`, userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("botRepo.ListKeys: %w", err)
+	}
+	defer rows.Close()
+	keys := []model.BotAPIKey{}
+	for rows.Next() {
+		var k model.BotAPIKey
+		if err := rows.Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, &k.CreatedBy, &k.CreatedAt, &k.LastUsedAt, &k.RevokedAt); err != nil {
+			return nil, fmt.Errorf("botRepo.ListKeys scan: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeKey отзывает ключ keyID бота userID. ErrNotFound — такого действующего ключа нет.
+func (r *BotRepository) RevokeKey(ctx context.Context, userID, keyID string) error {
+	defer logger.DeferLogDuration("bot.RevokeKey", time.Now())()
+	tag, err := conn(ctx, r.pool).Exec(ctx,
+		`UPDATE bot_api_keys SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`,
+		keyID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("botRepo.RevokeKey: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Authenticate находит действующий ключ по хешу и отмечает его использование. Возвращает id бота и ключа;
+// ErrNotFound — ключ неизвестен, отозван или бот отключён.
+func (r *BotRepository) Authenticate(ctx context.Context, keyHash string) (userID, keyID string, err error) {
+	defer logger.DeferLogDuration("bot.Authenticate", time.Now())()
+	err = r.pool.QueryRow(ctx,
+		`UPDATE bot_api_keys k SET last_used_at = NOW()
+		 FROM users u
+		 WHERE k.key_hash = $1 AND k.revoked_at IS NULL AND u.id = k.user_id AND u.disabled_at IS NULL
+		 RETURNING k.user_id, k.id`, keyHash,
+	).Scan(&userID, &keyID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", "", ErrNotFound
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("botRepo.Authenticate: %w", err)
+	}
+	return userID, keyID, nil
+}
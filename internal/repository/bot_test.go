@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/messenger/internal/model"
+)
+
+func TestBotKeyAuthenticateAndRevoke(t *testing.T) {
+	pool := testPool(t)
+	repo := NewBotRepository(pool)
+	ctx := context.Background()
+	adminID := testUser(t, pool)
+	botID, otherBotID := testUser(t, pool), testUser(t, pool)
+	for _, id := range []string{botID, otherBotID} {
+		if err := repo.MarkBot(ctx, id, adminID); err != nil {
+			t.Fatalf("MarkBot: %v", err)
+		}
+	}
+	k := &model.BotAPIKey{ID: uuid.NewString(), UserID: botID, Prefix: "mbot_test", CreatedBy: &adminID, CreatedAt: time.Now().UTC()}
+	hash := HashBotKey("mbot_" + k.ID)
+	if err := repo.CreateKey(ctx, k, hash); err != nil {
+		t.Fatalf("CreateKey: %v", err)
+	}
+
+	userID, keyID, err := repo.Authenticate(ctx, hash)
+	if err != nil || userID != botID || keyID != k.ID {
+		t.Fatalf("Authenticate = %q, %q, %v; want %q, %q", userID, keyID, err, botID, k.ID)
+	}
+	if _, _, err := repo.Authenticate(ctx, HashBotKey("mbot_unknown")); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("unknown key: err = %v, want ErrNotFound", err)
+	}
+
+	// Ключ чужого бота не отзывается и продолжает работать.
+	if err := repo.RevokeKey(ctx, otherBotID, k.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("RevokeKey(wrong bot): err = %v, want ErrNotFound", err)
+	}
+	if _, _, err := repo.Authenticate(ctx, hash); err != nil {
+		t.Fatalf("Authenticate after wrong-bot revoke: %v", err)
+	}
+
+	if err := repo.RevokeKey(ctx, botID, k.ID); err != nil {
+		t.Fatalf("RevokeKey: %v", err)
+	}
+	if _, _, err := repo.Authenticate(ctx, hash); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("revoked key: err = %v, want ErrNotFound", err)
+	}
+	if err := repo.RevokeKey(ctx, botID, k.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("second RevokeKey: err = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/messenger/internal/logger"
+	"github.com/messenger/internal/model"
+)
+
+type CallStatsRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewCallStatsRepository(pool *pgxpool.Pool) *CallStatsRepository {
+	return &CallStatsRepository{pool: pool}
+}
+
+// Upsert сохраняет (или перезаписывает) отчёт участника о звонке.
+func (r *CallStatsRepository) Upsert(ctx context.Context, s *model.CallStats) error {
+	defer logger.DeferLogDuration("callStats.Upsert", time.Now())()
+	_, err := r.pool.Exec(ctx,
+		`INSERT INTO call_stats (call_id, user_id, peer_id, duration_sec, avg_bitrate_kbps, packet_loss_pct, jitter_ms, end_reason, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		 ON CONFLICT (call_id, user_id) DO UPDATE SET
+		   duration_sec = EXCLUDED.duration_sec, avg_bitrate_kbps = EXCLUDED.avg_bitrate_kbps,
+		   packet_loss_pct = EXCLUDED.packet_loss_pct, jitter_ms = EXCLUDED.jitter_ms, end_reason = EXCLUDED.end_reason`,
+		s.CallID, s.UserID, s.PeerID, s.DurationSec, s.AvgBitrateKbps, s.PacketLossPct, s.JitterMs, s.EndReason, s.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("callStatsRepo.Upsert: %w", err)
+	}
+	return nil
+}
+
+// UpsertCall сохраняет звонок из сигнализации. Участники фиксируются первой записью; время принятия
+// и завершения заполняется один раз и больше не меняется.
+func (r *CallStatsRepository) UpsertCall(ctx context.Context, c *model.CallRecord) error {
+	defer logger.DeferLogDuration("callStats.UpsertCall", time.Now())()
+	_, err := r.pool.Exec(ctx,
+		`INSERT INTO calls (id, caller_id, callee_id, created_at, accepted_at, ended_at)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 ON CONFLICT (id) DO UPDATE SET
+		   accepted_at = COALESCE(calls.accepted_at, EXCLUDED.accepted_at),
+		   ended_at = COALESCE(calls.ended_at, EXCLUDED.ended_at)`,
+		c.ID, c.CallerID, c.CalleeID, c.CreatedAt, c.AcceptedAt, c.EndedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("callStatsRepo.UpsertCall: %w", err)
+	}
+	return nil
+}
+
+// GetCall возвращает звонок по id; ErrNotFound — сигнализация о нём не сообщала.
+func (r *CallStatsRepository) GetCall(ctx context.Context, id string) (*model.CallRecord, error) {
+	defer logger.DeferLogDuration("callStats.GetCall", time.Now())()
+	c := &model.CallRecord{}
+	err := r.pool.QueryRow(ctx,
+		`SELECT id, caller_id, callee_id, created_at, accepted_at, ended_at FROM calls WHERE id = $1`, id,
+	).Scan(&c.ID, &c.CallerID, &c.CalleeID, &c.CreatedAt, &c.AcceptedAt, &c.EndedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("callStatsRepo.GetCall: %w", err)
+	}
+	return c, nil
+}
+
+// Summary агрегирует отчёты, созданные начиная с since.
+func (r *CallStatsRepository) Summary(ctx context.Context, since time.Time) (*model.CallStatsSummary, error) {
+	defer logger.DeferLogDuration("callStats.Summary", time.Now())()
+	s := &model.CallStatsSummary{Since: since, EndReasons: map[string]int{}}
+	err := r.pool.QueryRow(ctx,
+		`SELECT COUNT(*), COUNT(DISTINCT call_id),
+		        COALESCE(AVG(duration_sec), 0), COALESCE(AVG(avg_bitrate_kbps), 0),
+		        COALESCE(AVG(packet_loss_pct), 0), COALESCE(AVG(jitter_ms), 0),
+		        COALESCE(100.0 * AVG(CASE WHEN packet_loss_pct > 5 THEN 1 ELSE 0 END), 0)
+		 FROM call_stats WHERE created_at >= $1`, since,
+	).Scan(&s.Reports, &s.Calls, &s.AvgDurationSec, &s.AvgBitrateKbps, &s.AvgPacketLossPct, &s.AvgJitterMs, &s.PoorQualityPct)
+	if err != nil {
+		return nil, fmt.Errorf("callStatsRepo.Summary: %w", err)
+	}
+
+	rows, err := r.pool.Query(ctx,
+		`SELECT end_reason, COUNT(*) FROM call_stats WHERE created_at >= $1 GROUP BY end_reason`, since)
+	if err != nil {
+		return nil, fmt.Errorf("callStatsRepo.Summary reasons: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var reason string
+		var n int
+		if err := rows.Scan(&reason, &n); err != nil {
+			return nil, fmt.Errorf("callStatsRepo.Summary reasons scan: %w", err)
+		}
+		s.EndReasons[reason] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("callStatsRepo.Summary reasons rows: %w", err)
+	}
+	return s, nil
+}
@@ -21,12 +21,23 @@ func NewChatRepository(pool *pgxpool.Pool) *ChatRepository {
 	return &ChatRepository{pool: pool}
 }
 
+// WithTx — repository.WithTx на пуле репозитория.
+func (r *ChatRepository) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return WithTx(ctx, r.pool, fn)
+}
+
 func (r *ChatRepository) Create(ctx context.Context, c *model.Chat) error {
 	defer logger.DeferLogDuration("chat.Create", time.Now())()
-	_, err := r.pool.Exec(ctx,
-		`INSERT INTO chats (id, chat_type, name, description, avatar_url, created_by, created_at)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
-		c.ID, c.ChatType, c.Name, c.Description, c.AvatarURL, c.CreatedBy, c.CreatedAt,
+	if c.PinPolicy == "" {
+		c.PinPolicy = model.PinPolicyEveryone
+	}
+	if c.SendPolicy == "" {
+		c.SendPolicy = model.SendPolicyEveryone
+	}
+	_, err := conn(ctx, r.pool).Exec(ctx,
+		`INSERT INTO chats (id, chat_type, name, description, avatar_url, created_by, created_at, pin_policy, is_sensitive, send_policy)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		c.ID, c.ChatType, c.Name, c.Description, c.AvatarURL, c.CreatedBy, c.CreatedAt, c.PinPolicy, c.IsSensitive, c.SendPolicy,
 	)
 	if err != nil {
 		return fmt.Errorf("chatRepo.Create: %w", err)
@@ -38,9 +49,9 @@ func (r *ChatRepository) GetByID(ctx context.Context, id string) (*model.Chat, e
 	defer logger.DeferLogDuration("chat.GetByID", time.Now())()
 	c := &model.Chat{}
 	err := r.pool.QueryRow(ctx,
-		`SELECT id, chat_type, name, COALESCE(description,''), avatar_url, created_by, created_at
+		`SELECT id, chat_type, name, COALESCE(description,''), avatar_url, created_by, created_at, pin_policy, is_sensitive, send_policy
 		 FROM chats WHERE id = $1`, id,
-	).Scan(&c.ID, &c.ChatType, &c.Name, &c.Description, &c.AvatarURL, &c.CreatedBy, &c.CreatedAt)
+	).Scan(&c.ID, &c.ChatType, &c.Name, &c.Description, &c.AvatarURL, &c.CreatedBy, &c.CreatedAt, &c.PinPolicy, &c.IsSensitive, &c.SendPolicy)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, ErrNotFound
 	}
@@ -62,9 +73,40 @@ func (r *ChatRepository) UpdateChat(ctx context.Context, id, name, description,
 	return nil
 }
 
+// SetPinPolicy меняет политику закрепления сообщений в чате.
+func (r *ChatRepository) SetPinPolicy(ctx context.Context, id string, policy model.PinPolicy) error {
+	defer logger.DeferLogDuration("chat.SetPinPolicy", time.Now())()
+	_, err := r.pool.Exec(ctx, `UPDATE chats SET pin_policy = $1 WHERE id = $2`, policy, id)
+	if err != nil {
+		return fmt.Errorf("chatRepo.SetPinPolicy: %w", err)
+	}
+	return nil
+}
+
+// SetSendPolicy меняет, кто может отправлять сообщения в чат.
+func (r *ChatRepository) SetSendPolicy(ctx context.Context, id string, policy model.SendPolicy) error {
+	defer logger.DeferLogDuration("chat.SetSendPolicy", time.Now())()
+	_, err := r.pool.Exec(ctx, `UPDATE chats SET send_policy = $1 WHERE id = $2`, policy, id)
+	if err != nil {
+		return fmt.Errorf("chatRepo.SetSendPolicy: %w", err)
+	}
+	return nil
+}
+
+// SetSensitive включает/выключает шифрование содержимого новых сообщений чата.
+// Уже сохранённые сообщения не перешифровываются — их формат определяет messages.content_encrypted.
+func (r *ChatRepository) SetSensitive(ctx context.Context, id string, sensitive bool) error {
+	defer logger.DeferLogDuration("chat.SetSensitive", time.Now())()
+	_, err := r.pool.Exec(ctx, `UPDATE chats SET is_sensitive = $1 WHERE id = $2`, sensitive, id)
+	if err != nil {
+		return fmt.Errorf("chatRepo.SetSensitive: %w", err)
+	}
+	return nil
+}
+
 func (r *ChatRepository) AddMember(ctx context.Context, m *model.ChatMember) error {
 	defer logger.DeferLogDuration("chat.AddMember", time.Now())()
-	_, err := r.pool.Exec(ctx,
+	_, err := conn(ctx, r.pool).Exec(ctx,
 		`INSERT INTO chat_members (chat_id, user_id, role, joined_at)
 		 VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING`,
 		m.ChatID, m.UserID, m.Role, m.JoinedAt,
@@ -75,9 +117,58 @@ func (r *ChatRepository) AddMember(ctx context.Context, m *model.ChatMember) err
 	return nil
 }
 
+// ErrLastAdmin — смена роли оставила бы чат без администраторов.
+var ErrLastAdmin = errors.New("chat must keep at least one admin")
+
+// SetMemberRole меняет роль участника; changed — false, если роль уже такая. ErrNotFound — пользователь
+// не участник чата; ErrLastAdmin — это единственный администратор, и его нельзя понизить. Строка чата
+// блокируется до конца транзакции, поэтому параллельные понижения не оставят чат без администратора.
+func (r *ChatRepository) SetMemberRole(ctx context.Context, chatID, userID, role string) (changed bool, err error) {
+	defer logger.DeferLogDuration("chat.SetMemberRole", time.Now())()
+	err = r.WithTx(ctx, func(ctx context.Context) error {
+		q := conn(ctx, r.pool)
+		if _, err := q.Exec(ctx, `SELECT 1 FROM chats WHERE id = $1 FOR UPDATE`, chatID); err != nil {
+			return err
+		}
+		var current string
+		var otherAdmins bool
+		err := q.QueryRow(ctx,
+			`SELECT role, EXISTS (SELECT 1 FROM chat_members WHERE chat_id = $1 AND role = 'admin' AND user_id <> $2)
+			 FROM chat_members WHERE chat_id = $1 AND user_id = $2`,
+			chatID, userID,
+		).Scan(&current, &otherAdmins)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if current == role {
+			return nil
+		}
+		if current == "admin" && !otherAdmins {
+			return ErrLastAdmin
+		}
+		if _, err := q.Exec(ctx,
+			`UPDATE chat_members SET role = $3 WHERE chat_id = $1 AND user_id = $2`, chatID, userID, role,
+		); err != nil {
+			return err
+		}
+		changed = true
+		return nil
+	})
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrLastAdmin) {
+		return false, err
+	}
+	if err != nil {
+		return false, fmt.Errorf("chatRepo.SetMemberRole: %w", err)
+	}
+	return changed, nil
+}
+
 func (r *ChatRepository) RemoveMember(ctx context.Context, chatID, userID string) error {
 	defer logger.DeferLogDuration("chat.RemoveMember", time.Now())()
-	_, err := r.pool.Exec(ctx,
+	_, err := conn(ctx, r.pool).Exec(ctx,
 		`DELETE FROM chat_members WHERE chat_id = $1 AND user_id = $2`,
 		chatID, userID,
 	)
@@ -87,10 +178,41 @@ func (r *ChatRepository) RemoveMember(ctx context.Context, chatID, userID string
 	return nil
 }
 
+// RemoveMemberKeepAdmin исключает участника; если в чате не осталось администраторов, администратором
+// становится самый давний из оставшихся участников — его id возвращается (иначе ""). Строка чата
+// блокируется до конца транзакции, чтобы параллельные исключения и смены ролей не оставили чат без администратора.
+func (r *ChatRepository) RemoveMemberKeepAdmin(ctx context.Context, chatID, userID string) (promotedID string, err error) {
+	defer logger.DeferLogDuration("chat.RemoveMemberKeepAdmin", time.Now())()
+	err = r.WithTx(ctx, func(ctx context.Context) error {
+		q := conn(ctx, r.pool)
+		if _, err := q.Exec(ctx, `SELECT 1 FROM chats WHERE id = $1 FOR UPDATE`, chatID); err != nil {
+			return err
+		}
+		if _, err := q.Exec(ctx, `DELETE FROM chat_members WHERE chat_id = $1 AND user_id = $2`, chatID, userID); err != nil {
+			return err
+		}
+		err := q.QueryRow(ctx,
+			`UPDATE chat_members SET role = 'admin'
+			 WHERE chat_id = $1
+			   AND user_id = (SELECT user_id FROM chat_members WHERE chat_id = $1 ORDER BY joined_at, user_id LIMIT 1)
+			   AND NOT EXISTS (SELECT 1 FROM chat_members WHERE chat_id = $1 AND role = 'admin')
+			 RETURNING user_id`, chatID,
+		).Scan(&promotedID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("chatRepo.RemoveMemberKeepAdmin: %w", err)
+	}
+	return promotedID, nil
+}
+
 func (r *ChatRepository) GetMembers(ctx context.Context, chatID string) ([]model.User, error) {
 	defer logger.DeferLogDuration("chat.GetMembers", time.Now())()
 	rows, err := r.pool.Query(ctx,
-		`SELECT u.id, u.username, u.email, u.password_hash, u.avatar_url, u.last_seen_at, u.is_online, u.created_at
+		`SELECT u.id, u.username, u.email, u.password_hash, u.avatar_url, `+uLastSeenSQL+`, `+uOnlineSQL+`, u.created_at
 		 FROM users u
 		 JOIN chat_members cm ON cm.user_id = u.id
 		 WHERE cm.chat_id = $1
@@ -152,6 +274,47 @@ func (r *ChatRepository) IsMember(ctx context.Context, chatID, userID string) (b
 	return exists, nil
 }
 
+// InviteToken возвращает токен ссылки-приглашения чата; если его ещё нет, сохраняет newToken.
+func (r *ChatRepository) InviteToken(ctx context.Context, chatID, newToken string) (string, error) {
+	defer logger.DeferLogDuration("chat.InviteToken", time.Now())()
+	var token string
+	err := r.pool.QueryRow(ctx,
+		`UPDATE chats SET invite_token = COALESCE(invite_token, $2) WHERE id = $1 RETURNING invite_token`,
+		chatID, newToken,
+	).Scan(&token)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("chatRepo.InviteToken: %w", err)
+	}
+	return token, nil
+}
+
+// SetInviteToken заменяет токен ссылки-приглашения (прежняя ссылка перестаёт действовать).
+func (r *ChatRepository) SetInviteToken(ctx context.Context, chatID, token string) error {
+	defer logger.DeferLogDuration("chat.SetInviteToken", time.Now())()
+	_, err := r.pool.Exec(ctx, `UPDATE chats SET invite_token = $2 WHERE id = $1`, chatID, token)
+	if err != nil {
+		return fmt.Errorf("chatRepo.SetInviteToken: %w", err)
+	}
+	return nil
+}
+
+// FindByInviteToken возвращает id чата по токену приглашения; ErrNotFound — ссылка недействительна.
+func (r *ChatRepository) FindByInviteToken(ctx context.Context, token string) (string, error) {
+	defer logger.DeferLogDuration("chat.FindByInviteToken", time.Now())()
+	var chatID string
+	err := r.pool.QueryRow(ctx, `SELECT id FROM chats WHERE invite_token = $1`, token).Scan(&chatID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("chatRepo.FindByInviteToken: %w", err)
+	}
+	return chatID, nil
+}
+
 func (r *ChatRepository) GetMemberRole(ctx context.Context, chatID, userID string) (string, error) {
 	defer logger.DeferLogDuration("chat.GetMemberRole", time.Now())()
 	var role string
@@ -171,7 +334,7 @@ func (r *ChatRepository) GetMemberRole(ctx context.Context, chatID, userID strin
 func (r *ChatRepository) GetUserChats(ctx context.Context, userID string) ([]model.Chat, error) {
 	defer logger.DeferLogDuration("chat.GetUserChats", time.Now())()
 	rows, err := r.pool.Query(ctx,
-		`SELECT c.id, c.chat_type, c.name, COALESCE(c.description,''), c.avatar_url, c.created_by, c.created_at
+		`SELECT c.id, c.chat_type, c.name, COALESCE(c.description,''), c.avatar_url, c.created_by, c.created_at, c.pin_policy, c.is_sensitive, c.send_policy
 		 FROM chats c
 		 JOIN chat_members cm ON cm.chat_id = c.id
 		 WHERE cm.user_id = $1
@@ -185,7 +348,7 @@ func (r *ChatRepository) GetUserChats(ctx context.Context, userID string) ([]mod
 	chats := make([]model.Chat, 0, 16)
 	for rows.Next() {
 		var c model.Chat
-		if err := rows.Scan(&c.ID, &c.ChatType, &c.Name, &c.Description, &c.AvatarURL, &c.CreatedBy, &c.CreatedAt); err != nil {
+		if err := rows.Scan(&c.ID, &c.ChatType, &c.Name, &c.Description, &c.AvatarURL, &c.CreatedBy, &c.CreatedAt, &c.PinPolicy, &c.IsSensitive, &c.SendPolicy); err != nil {
 			return nil, fmt.Errorf("chatRepo.GetUserChats scan: %w", err)
 		}
 		chats = append(chats, c)
@@ -196,17 +359,64 @@ func (r *ChatRepository) GetUserChats(ctx context.Context, userID string) ([]mod
 	return chats, nil
 }
 
+// GetUserGroupMemberships — группы и каналы, в которых состоит пользователь, с его ролью. Личные чаты и
+// «Избранное» не возвращаются.
+func (r *ChatRepository) GetUserGroupMemberships(ctx context.Context, userID string) ([]model.UserGroupMembership, error) {
+	defer logger.DeferLogDuration("chat.GetUserGroupMemberships", time.Now())()
+	rows, err := conn(ctx, r.pool).Query(ctx,
+		`SELECT c.id, c.chat_type, c.name, COALESCE(c.description,''), c.avatar_url, c.created_by, c.created_at, c.pin_policy, c.is_sensitive, c.send_policy,
+		        cm.role, cm.joined_at
+		 FROM chats c
+		 JOIN chat_members cm ON cm.chat_id = c.id
+		 WHERE cm.user_id = $1 AND c.chat_type IN ('group', 'channel')
+		 ORDER BY c.name, c.id`, userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("chatRepo.GetUserGroupMemberships query: %w", err)
+	}
+	defer rows.Close()
+
+	list := make([]model.UserGroupMembership, 0, 16)
+	for rows.Next() {
+		var m model.UserGroupMembership
+		c := &m.Chat
+		if err := rows.Scan(&c.ID, &c.ChatType, &c.Name, &c.Description, &c.AvatarURL, &c.CreatedBy, &c.CreatedAt, &c.PinPolicy, &c.IsSensitive, &c.SendPolicy,
+			&m.Role, &m.JoinedAt); err != nil {
+			return nil, fmt.Errorf("chatRepo.GetUserGroupMemberships scan: %w", err)
+		}
+		list = append(list, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("chatRepo.GetUserGroupMemberships rows: %w", err)
+	}
+	return list, nil
+}
+
+// CountPersonalChats — число личных чатов пользователя (сами чаты администратору не показываются).
+func (r *ChatRepository) CountPersonalChats(ctx context.Context, userID string) (int, error) {
+	defer logger.DeferLogDuration("chat.CountPersonalChats", time.Now())()
+	var n int
+	err := r.pool.QueryRow(ctx,
+		`SELECT COUNT(*) FROM chat_members cm JOIN chats c ON c.id = cm.chat_id
+		 WHERE cm.user_id = $1 AND c.chat_type = 'personal'`, userID,
+	).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("chatRepo.CountPersonalChats: %w", err)
+	}
+	return n, nil
+}
+
 func (r *ChatRepository) FindPersonalChat(ctx context.Context, userID1, userID2 string) (*model.Chat, error) {
 	defer logger.DeferLogDuration("chat.FindPersonalChat", time.Now())()
 	c := &model.Chat{}
 	err := r.pool.QueryRow(ctx,
-		`SELECT c.id, c.chat_type, c.name, COALESCE(c.description,''), c.avatar_url, c.created_by, c.created_at
+		`SELECT c.id, c.chat_type, c.name, COALESCE(c.description,''), c.avatar_url, c.created_by, c.created_at, c.pin_policy, c.is_sensitive, c.send_policy
 		 FROM chats c
 		 WHERE c.chat_type = 'personal'
 		   AND EXISTS (SELECT 1 FROM chat_members WHERE chat_id = c.id AND user_id = $1)
 		   AND EXISTS (SELECT 1 FROM chat_members WHERE chat_id = c.id AND user_id = $2)`,
 		userID1, userID2,
-	).Scan(&c.ID, &c.ChatType, &c.Name, &c.Description, &c.AvatarURL, &c.CreatedBy, &c.CreatedAt)
+	).Scan(&c.ID, &c.ChatType, &c.Name, &c.Description, &c.AvatarURL, &c.CreatedBy, &c.CreatedAt, &c.PinPolicy, &c.IsSensitive, &c.SendPolicy)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, ErrNotFound
 	}
@@ -221,13 +431,13 @@ func (r *ChatRepository) FindNotesChat(ctx context.Context, userID string) (*mod
 	defer logger.DeferLogDuration("chat.FindNotesChat", time.Now())()
 	c := &model.Chat{}
 	err := r.pool.QueryRow(ctx,
-		`SELECT c.id, c.chat_type, c.name, COALESCE(c.description,''), c.avatar_url, c.created_by, c.created_at
+		`SELECT c.id, c.chat_type, c.name, COALESCE(c.description,''), c.avatar_url, c.created_by, c.created_at, c.pin_policy, c.is_sensitive, c.send_policy
 		 FROM chats c
 		 WHERE c.chat_type = 'notes'
 		   AND EXISTS (SELECT 1 FROM chat_members WHERE chat_id = c.id AND user_id = $1)
 		   AND (SELECT COUNT(*) FROM chat_members WHERE chat_id = c.id) = 1`,
 		userID,
-	).Scan(&c.ID, &c.ChatType, &c.Name, &c.Description, &c.AvatarURL, &c.CreatedBy, &c.CreatedAt)
+	).Scan(&c.ID, &c.ChatType, &c.Name, &c.Description, &c.AvatarURL, &c.CreatedBy, &c.CreatedAt, &c.PinPolicy, &c.IsSensitive, &c.SendPolicy)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, ErrNotFound
 	}
@@ -276,11 +486,34 @@ func (r *ChatRepository) GetOrCreateNotesChat(ctx context.Context, userID string
 	return c, nil
 }
 
-// UpdateMemberLastRead updates the last_read_at timestamp for a member.
+// memberReadSinceSQL — с какого момента сообщения считаются непрочитанными для участника cm.
+// last_read_at бывает NULL у участников, добавленных до появления колонки или в обход значения по умолчанию.
+// Сообщения до очистки истории (cleared_before) непрочитанными не считаются.
+const memberReadSinceSQL = `GREATEST(COALESCE(cm.last_read_at, cm.joined_at, 'epoch'::timestamptz), COALESCE(cm.cleared_before, 'epoch'::timestamptz))`
+
+// ClearHistory скрывает от участника все текущие сообщения чата («очистить историю у себя»).
+// Возвращает новую границу; ErrNotFound — пользователь не участник чата.
+func (r *ChatRepository) ClearHistory(ctx context.Context, chatID, userID string) (time.Time, error) {
+	defer logger.DeferLogDuration("chat.ClearHistory", time.Now())()
+	var clearedBefore time.Time
+	err := r.pool.QueryRow(ctx,
+		`UPDATE chat_members SET cleared_before = NOW() WHERE chat_id = $1 AND user_id = $2 RETURNING cleared_before`,
+		chatID, userID,
+	).Scan(&clearedBefore)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.Time{}, ErrNotFound
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("chatRepo.ClearHistory: %w", err)
+	}
+	return clearedBefore, nil
+}
+
+// UpdateMemberLastRead updates the last_read_at timestamp for a member and clears the "marked unread" flag.
 func (r *ChatRepository) UpdateMemberLastRead(ctx context.Context, chatID, userID string, t time.Time) error {
 	defer logger.DeferLogDuration("chat.UpdateMemberLastRead", time.Now())()
 	_, err := r.pool.Exec(ctx,
-		`UPDATE chat_members SET last_read_at = $1 WHERE chat_id = $2 AND user_id = $3`,
+		`UPDATE chat_members SET last_read_at = $1, marked_unread = false WHERE chat_id = $2 AND user_id = $3`,
 		t, chatID, userID,
 	)
 	if err != nil {
@@ -289,18 +522,126 @@ func (r *ChatRepository) UpdateMemberLastRead(ctx context.Context, chatID, userI
 	return nil
 }
 
-// GetUnreadCount counts messages in a chat created after the user's last_read_at.
-func (r *ChatRepository) GetUnreadCount(ctx context.Context, chatID, userID string) (int, error) {
+// GetUnreadCount counts messages in a chat created after the user's last_read_at
+// (or joined_at, if the member has never read the chat). System messages ("X added Y")
+// are counted only when includeSystem is set. A chat marked unread (MarkUnread) counts at least one.
+func (r *ChatRepository) GetUnreadCount(ctx context.Context, chatID, userID string, includeSystem bool) (int, error) {
 	defer logger.DeferLogDuration("chat.GetUnreadCount", time.Now())()
 	var count int
 	err := r.pool.QueryRow(ctx,
-		`SELECT COUNT(*) FROM messages m
+		`SELECT GREATEST(
+		     (SELECT COUNT(*) FROM messages m
+		      JOIN chat_members cm ON cm.chat_id = m.chat_id AND cm.user_id = $2
+		      WHERE m.chat_id = $1 AND m.sender_id != $2 AND m.created_at > `+memberReadSinceSQL+` AND m.is_deleted = false
+		        AND ($3 OR m.content_type != 'system')),
+		     (SELECT 1 FROM chat_members WHERE chat_id = $1 AND user_id = $2 AND marked_unread))`,
+		chatID, userID, includeSystem,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("chatRepo.GetUnreadCount: %w", err)
+	}
+	return count, nil
+}
+
+// MarkUnread отмечает чат непрочитанным для пользователя (до следующего прочтения); другие участники
+// и квитанции сообщений не меняются. ErrNotFound — пользователь не участник чата.
+func (r *ChatRepository) MarkUnread(ctx context.Context, chatID, userID string) error {
+	defer logger.DeferLogDuration("chat.MarkUnread", time.Now())()
+	tag, err := r.pool.Exec(ctx,
+		`UPDATE chat_members SET marked_unread = true WHERE chat_id = $1 AND user_id = $2`,
+		chatID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("chatRepo.MarkUnread: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetUnreadMentionCount counts unread messages in a chat that mention the user. Mentions are recorded
+// in message_mentions when a message is sent, so encrypted content does not need to be searched.
+func (r *ChatRepository) GetUnreadMentionCount(ctx context.Context, chatID, userID string) (int, error) {
+	defer logger.DeferLogDuration("chat.GetUnreadMentionCount", time.Now())()
+	var count int
+	err := r.pool.QueryRow(ctx,
+		`SELECT COUNT(*) FROM message_mentions mm
+		 JOIN messages m ON m.id = mm.message_id
 		 JOIN chat_members cm ON cm.chat_id = m.chat_id AND cm.user_id = $2
-		 WHERE m.chat_id = $1 AND m.sender_id != $2 AND m.created_at > cm.last_read_at AND m.is_deleted = false`,
+		 WHERE mm.user_id = $2 AND m.chat_id = $1 AND m.sender_id != $2
+		   AND m.created_at > `+memberReadSinceSQL+` AND m.is_deleted = false`,
 		chatID, userID,
 	).Scan(&count)
 	if err != nil {
-		return 0, fmt.Errorf("chatRepo.GetUnreadCount: %w", err)
+		return 0, fmt.Errorf("chatRepo.GetUnreadMentionCount: %w", err)
 	}
 	return count, nil
 }
+
+// GetPinnedChatIDs — закреплённые пользователем чаты в его порядке.
+func (r *ChatRepository) GetPinnedChatIDs(ctx context.Context, userID string) ([]string, error) {
+	defer logger.DeferLogDuration("chat.GetPinnedChatIDs", time.Now())()
+	rows, err := r.pool.Query(ctx,
+		`SELECT chat_id FROM user_chat_order WHERE user_id = $1 ORDER BY position, chat_id`, userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("chatRepo.GetPinnedChatIDs: %w", err)
+	}
+	defer rows.Close()
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("chatRepo.GetPinnedChatIDs scan: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// SetPinnedChats заменяет закреплённые чаты пользователя списком chatIDs (порядок — как в списке).
+func (r *ChatRepository) SetPinnedChats(ctx context.Context, userID string, chatIDs []string) error {
+	defer logger.DeferLogDuration("chat.SetPinnedChats", time.Now())()
+	return WithTx(ctx, r.pool, func(ctx context.Context) error {
+		q := conn(ctx, r.pool)
+		if _, err := q.Exec(ctx, `DELETE FROM user_chat_order WHERE user_id = $1`, userID); err != nil {
+			return fmt.Errorf("chatRepo.SetPinnedChats delete: %w", err)
+		}
+		if _, err := q.Exec(ctx,
+			`INSERT INTO user_chat_order (user_id, chat_id, position)
+			 SELECT $1, id, pos - 1 FROM unnest($2::uuid[]) WITH ORDINALITY AS t(id, pos)`,
+			userID, chatIDs,
+		); err != nil {
+			return fmt.Errorf("chatRepo.SetPinnedChats insert: %w", err)
+		}
+		return nil
+	})
+}
+
+// PinChat закрепляет чат последним в списке пользователя; уже закреплённый остаётся на своём месте.
+func (r *ChatRepository) PinChat(ctx context.Context, userID, chatID string) error {
+	defer logger.DeferLogDuration("chat.PinChat", time.Now())()
+	_, err := r.pool.Exec(ctx,
+		`INSERT INTO user_chat_order (user_id, chat_id, position)
+		 SELECT $1, $2, COALESCE(MAX(position) + 1, 0) FROM user_chat_order WHERE user_id = $1
+		 ON CONFLICT (user_id, chat_id) DO NOTHING`,
+		userID, chatID,
+	)
+	if err != nil {
+		return fmt.Errorf("chatRepo.PinChat: %w", err)
+	}
+	return nil
+}
+
+func (r *ChatRepository) UnpinChat(ctx context.Context, userID, chatID string) error {
+	defer logger.DeferLogDuration("chat.UnpinChat", time.Now())()
+	_, err := r.pool.Exec(ctx,
+		`DELETE FROM user_chat_order WHERE user_id = $1 AND chat_id = $2`,
+		userID, chatID,
+	)
+	if err != nil {
+		return fmt.Errorf("chatRepo.UnpinChat: %w", err)
+	}
+	return nil
+}
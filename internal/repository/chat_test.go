@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// testUser создаёт пользователя, который удаляется по завершении теста.
+func testUser(t *testing.T, pool *pgxpool.Pool) string {
+	t.Helper()
+	userID := uuid.NewString()
+	if _, err := pool.Exec(context.Background(),
+		`INSERT INTO users (id, username, email, password_hash) VALUES ($1, $2, $3, '')`,
+		userID, "t_"+userID[:8], userID+"@test.local",
+	); err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+	t.Cleanup(func() { pool.Exec(context.Background(), `DELETE FROM users WHERE id = $1`, userID) })
+	return userID
+}
+
+func TestGetUnreadCountNullLastRead(t *testing.T) {
+	pool := testPool(t)
+	repo := NewChatRepository(pool)
+	ctx := context.Background()
+	messageID, senderID := testMessage(t, pool)
+	var chatID string
+	if err := pool.QueryRow(ctx, `SELECT chat_id FROM messages WHERE id = $1`, messageID).Scan(&chatID); err != nil {
+		t.Fatalf("chat id: %v", err)
+	}
+	// Участник, который ещё ни разу не читал чат: last_read_at = NULL, вступил до сообщения.
+	readerID := testUser(t, pool)
+	if _, err := pool.Exec(ctx,
+		`INSERT INTO chat_members (chat_id, user_id, role, joined_at, last_read_at) VALUES ($1, $2, 'member', NOW() - INTERVAL '1 hour', NULL)`,
+		chatID, readerID,
+	); err != nil {
+		t.Fatalf("insert member: %v", err)
+	}
+
+	n, err := repo.GetUnreadCount(ctx, chatID, readerID, false)
+	if err != nil {
+		t.Fatalf("GetUnreadCount: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("unread = %d, want 1", n)
+	}
+	// Отправителю собственные сообщения непрочитанными не считаются.
+	if _, err := pool.Exec(ctx, `INSERT INTO chat_members (chat_id, user_id, role, last_read_at) VALUES ($1, $2, 'admin', NULL)`, chatID, senderID); err != nil {
+		t.Fatalf("insert sender member: %v", err)
+	}
+	if n, err := repo.GetUnreadCount(ctx, chatID, senderID, false); err != nil || n != 0 {
+		t.Fatalf("sender unread = %d (%v), want 0", n, err)
+	}
+}
+
+func TestGetUnreadCountSystemMessages(t *testing.T) {
+	pool := testPool(t)
+	repo := NewChatRepository(pool)
+	ctx := context.Background()
+	actorID, readerID := testUser(t, pool), testUser(t, pool)
+	chatID := uuid.NewString()
+	if _, err := pool.Exec(ctx, `INSERT INTO chats (id, chat_type, created_by) VALUES ($1, 'group', $2)`, chatID, actorID); err != nil {
+		t.Fatalf("insert chat: %v", err)
+	}
+	t.Cleanup(func() { pool.Exec(context.Background(), `DELETE FROM chats WHERE id = $1`, chatID) })
+	if _, err := pool.Exec(ctx,
+		`INSERT INTO chat_members (chat_id, user_id, role, joined_at) VALUES ($1, $2, 'admin', NOW() - INTERVAL '1 hour'), ($1, $3, 'member', NOW() - INTERVAL '1 hour')`,
+		chatID, actorID, readerID,
+	); err != nil {
+		t.Fatalf("insert members: %v", err)
+	}
+	if _, err := pool.Exec(ctx, `UPDATE chat_members SET last_read_at = NOW() - INTERVAL '1 minute' WHERE chat_id = $1`, chatID); err != nil {
+		t.Fatalf("set last_read_at: %v", err)
+	}
+	// В тихой группе после прочтения появилось только служебное сообщение.
+	if _, err := pool.Exec(ctx,
+		`INSERT INTO messages (chat_id, sender_id, content, content_type) VALUES ($1, $2, 'added a member', 'system')`,
+		chatID, actorID,
+	); err != nil {
+		t.Fatalf("insert system message: %v", err)
+	}
+
+	if n, err := repo.GetUnreadCount(ctx, chatID, readerID, false); err != nil || n != 0 {
+		t.Fatalf("unread without system = %d (%v), want 0", n, err)
+	}
+	if n, err := repo.GetUnreadCount(ctx, chatID, readerID, true); err != nil || n != 1 {
+		t.Fatalf("unread with system = %d (%v), want 1", n, err)
+	}
+	// Превью списка чатов по-прежнему показывает служебное сообщение, если оно последнее.
+	last, err := NewMessageRepository(pool, nil).GetLastMessage(ctx, chatID, readerID)
+	if err != nil || last == nil || last.ContentType != "system" {
+		t.Fatalf("last message = %+v (%v), want the system message", last, err)
+	}
+}
@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/messenger/internal/testdb"
+)
+
+// TestMain при TEST_EMBEDDED_POSTGRES=1 (и без TEST_DATABASE_URL) поднимает встроенный PostgreSQL
+// на время тестов пакета; testPool подключается к нему через TEST_DATABASE_URL.
+func TestMain(m *testing.M) {
+	if os.Getenv("TEST_DATABASE_URL") != "" || os.Getenv("TEST_EMBEDDED_POSTGRES") != "1" {
+		os.Exit(m.Run())
+	}
+	db, err := testdb.Start(context.Background())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Setenv("TEST_DATABASE_URL", db.URL)
+	code := m.Run()
+	db.Close()
+	os.Exit(code)
+}
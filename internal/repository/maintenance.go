@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/messenger/internal/logger"
+)
+
+// MaintenanceRepository хранит флаг режима обслуживания (таблица maintenance_mode, одна строка).
+type MaintenanceRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewMaintenanceRepository(pool *pgxpool.Pool) *MaintenanceRepository {
+	return &MaintenanceRepository{pool: pool}
+}
+
+func (r *MaintenanceRepository) Get(ctx context.Context) (enabled bool, message string, err error) {
+	defer logger.DeferLogDuration("maintenance.Get", time.Now())()
+	err = r.pool.QueryRow(ctx, `SELECT enabled, message FROM maintenance_mode WHERE id`).Scan(&enabled, &message)
+	if err != nil {
+		return false, "", fmt.Errorf("maintenanceRepo.Get: %w", err)
+	}
+	return enabled, message, nil
+}
+
+func (r *MaintenanceRepository) Set(ctx context.Context, enabled bool, message string) error {
+	defer logger.DeferLogDuration("maintenance.Set", time.Now())()
+	_, err := r.pool.Exec(ctx,
+		`INSERT INTO maintenance_mode (id, enabled, message, updated_at) VALUES (true, $1, $2, NOW())
+		 ON CONFLICT (id) DO UPDATE SET enabled = EXCLUDED.enabled, message = EXCLUDED.message, updated_at = NOW()`,
+		enabled, message,
+	)
+	if err != nil {
+		return fmt.Errorf("maintenanceRepo.Set: %w", err)
+	}
+	return nil
+}
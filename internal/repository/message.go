@@ -4,48 +4,385 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/messenger/internal/logger"
 	"github.com/messenger/internal/model"
+	"github.com/messenger/internal/msgcrypt"
 )
 
 type MessageRepository struct {
-	pool *pgxpool.Pool
+	pool   *pgxpool.Pool
+	cipher *msgcrypt.Cipher
 }
 
-func NewMessageRepository(pool *pgxpool.Pool) *MessageRepository {
-	return &MessageRepository{pool: pool}
+// NewMessageRepository creates the repository. cipher may be nil — then content of sensitive chats
+// is stored as plain text (encryption at rest is disabled).
+func NewMessageRepository(pool *pgxpool.Pool, cipher *msgcrypt.Cipher) *MessageRepository {
+	return &MessageRepository{pool: pool, cipher: cipher}
+}
+
+// EncryptionEnabled reports whether a key for encrypting sensitive chats is configured.
+func (r *MessageRepository) EncryptionEnabled() bool {
+	return r.cipher != nil
+}
+
+// storedContent returns content as it should be written to the DB for the chat:
+// encrypted if the chat is flagged sensitive and a key is configured.
+func (r *MessageRepository) storedContent(ctx context.Context, chatID, content string) (string, bool, error) {
+	if r.cipher == nil || content == "" {
+		return content, false, nil
+	}
+	var sensitive bool
+	if err := conn(ctx, r.pool).QueryRow(ctx, `SELECT is_sensitive FROM chats WHERE id = $1`, chatID).Scan(&sensitive); err != nil {
+		return "", false, fmt.Errorf("chat sensitivity: %w", err)
+	}
+	if !sensitive {
+		return content, false, nil
+	}
+	enc, err := r.cipher.Encrypt(content)
+	if err != nil {
+		return "", false, err
+	}
+	return enc, true, nil
+}
+
+// decryptContent replaces encrypted content with plain text. On failure (no key, unknown key version)
+// content is cleared so ciphertext never reaches clients.
+func (r *MessageRepository) decryptContent(m *model.Message, encrypted bool) {
+	if !encrypted {
+		return
+	}
+	if r.cipher == nil {
+		logger.Errorf("msgRepo: message %s is encrypted but no key configured", m.ID)
+		m.Content = ""
+		return
+	}
+	plain, err := r.cipher.Decrypt(m.Content)
+	if err != nil {
+		logger.Errorf("msgRepo: decrypt message %s: %v", m.ID, err)
+		m.Content = ""
+		return
+	}
+	m.Content = plain
 }
 
 func (r *MessageRepository) Create(ctx context.Context, m *model.Message) error {
 	defer logger.DeferLogDuration("msg.Create", time.Now())()
-	_, err := r.pool.Exec(ctx,
-		`INSERT INTO messages (id, chat_id, sender_id, content, content_type, file_url, file_name, file_size, status, reply_to_id, created_at)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
-		m.ID, m.ChatID, m.SenderID, m.Content, m.ContentType, m.FileURL, m.FileName, m.FileSize, m.Status, m.ReplyToID, m.CreatedAt,
-	)
+	content, encrypted, err := r.storedContent(ctx, m.ChatID, m.Content)
+	if err != nil {
+		return fmt.Errorf("msgRepo.Create: %w", err)
+	}
+	args := []any{m.ID, m.ChatID, m.SenderID, content, m.ContentType, m.FileURL, m.FileName, m.FileSize, m.Status, m.ReplyToID, m.CreatedAt, encrypted,
+		uploadFileName(m.FileURL)}
+	mayMention := strings.Contains(m.Content, "@")
+	if len(m.Attachments) == 0 && m.Location == nil && m.Contact == nil && m.SystemEvent == nil && !mayMention {
+		if err := conn(ctx, r.pool).QueryRow(ctx, insertMessageSQL, args...).Scan(&m.Width, &m.Height, &m.BlurHash); err != nil {
+			return fmt.Errorf("msgRepo.Create: %w", err)
+		}
+		return nil
+	}
+
+	// Альбом, геопозиция, контакт, служебное событие, упоминания: сообщение и его данные сохраняются атомарно.
+	// Внутри WithTx Begin открывает точку сохранения во внешней транзакции.
+	tx, err := conn(ctx, r.pool).Begin(ctx)
 	if err != nil {
+		return fmt.Errorf("msgRepo.Create begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if err := tx.QueryRow(ctx, insertMessageSQL, args...).Scan(&m.Width, &m.Height, &m.BlurHash); err != nil {
 		return fmt.Errorf("msgRepo.Create: %w", err)
 	}
+	for i := range m.Attachments {
+		a := &m.Attachments[i]
+		// Размеры и BlurHash берутся из учёта загрузки (user_uploads), а не от клиента.
+		if err := tx.QueryRow(ctx,
+			`INSERT INTO message_attachments (message_id, position, content_type, file_url, file_name, file_size, width, height, blurhash)
+			 SELECT $1, $2, $3, $4, $5, $6, COALESCE(u.width, 0), COALESCE(u.height, 0), COALESCE(u.blurhash, '')
+			 FROM (SELECT 1) one LEFT JOIN user_uploads u ON u.file_name = $7
+			 RETURNING width, height, blurhash`,
+			m.ID, i, a.ContentType, a.FileURL, a.FileName, a.FileSize, uploadFileName(a.FileURL),
+		).Scan(&a.Width, &a.Height, &a.BlurHash); err != nil {
+			return fmt.Errorf("msgRepo.Create attachment: %w", err)
+		}
+	}
+	if m.Location != nil {
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO message_locations (message_id, latitude, longitude, label) VALUES ($1, $2, $3, $4)`,
+			m.ID, m.Location.Latitude, m.Location.Longitude, m.Location.Label,
+		); err != nil {
+			return fmt.Errorf("msgRepo.Create location: %w", err)
+		}
+	}
+	if m.Contact != nil {
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO message_contacts (message_id, user_id, username, avatar_url) VALUES ($1, $2, $3, $4)`,
+			m.ID, m.Contact.UserID, m.Contact.Username, m.Contact.AvatarURL,
+		); err != nil {
+			return fmt.Errorf("msgRepo.Create contact: %w", err)
+		}
+	}
+	if m.SystemEvent != nil {
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO message_system_events (message_id, code, params) VALUES ($1, $2, $3)`,
+			m.ID, m.SystemEvent.Code, m.SystemEvent.Params,
+		); err != nil {
+			return fmt.Errorf("msgRepo.Create system event: %w", err)
+		}
+	}
+	if mayMention {
+		if err := recordMentions(ctx, tx, m.ID, m.ChatID, m.SenderID, m.Content); err != nil {
+			return fmt.Errorf("msgRepo.Create: %w", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("msgRepo.Create commit: %w", err)
+	}
+	return nil
+}
+
+// recordMentions сохраняет в message_mentions участников чата, упомянутых в тексте как @username
+// (без учёта регистра, целым словом). Текст передаётся открытым параметром и нигде не сохраняется,
+// поэтому упоминания работают и в чатах с шифрованием.
+func recordMentions(ctx context.Context, tx pgx.Tx, messageID, chatID, senderID, content string) error {
+	_, err := tx.Exec(ctx,
+		`INSERT INTO message_mentions (message_id, user_id)
+		 SELECT $1, u.id FROM chat_members cm
+		 JOIN users u ON u.id = cm.user_id
+		 WHERE cm.chat_id = $2 AND u.id != $3 AND u.username != ''
+		   AND $4 ~* ('(^|[^[:alnum:]_])@' || regexp_replace(u.username, '([^[:alnum:]])', '\\\1', 'g') || '($|[^[:alnum:]_])')
+		 ON CONFLICT DO NOTHING`,
+		messageID, chatID, senderID, content,
+	)
+	if err != nil {
+		return fmt.Errorf("mentions: %w", err)
+	}
 	return nil
 }
 
+// insertMessageSQL: размеры и BlurHash картинки в file_url берутся из учёта загрузки ($13 — имя файла), как у вложений.
+const insertMessageSQL = `INSERT INTO messages (id, chat_id, sender_id, content, content_type, file_url, file_name, file_size, status, reply_to_id, created_at, content_encrypted,
+	  width, height, blurhash)
+	SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, COALESCE(u.width, 0), COALESCE(u.height, 0), COALESCE(u.blurhash, '')
+	FROM (SELECT 1) one LEFT JOIN user_uploads u ON u.file_name = $13
+	RETURNING width, height, blurhash`
+
+// loadDetails заполняет данные сообщений из отдельных таблиц (вложения альбомов, геопозиции, контакты,
+// служебные события)
+// — по одному запросу на страницу сообщений.
+func (r *MessageRepository) loadDetails(ctx context.Context, msgs []model.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	ids := make([]string, len(msgs))
+	idx := make(map[string]int, len(msgs))
+	for i := range msgs {
+		ids[i] = msgs[i].ID
+		idx[msgs[i].ID] = i
+	}
+	if err := r.loadAttachments(ctx, msgs, ids, idx); err != nil {
+		return err
+	}
+	if err := r.loadImageMeta(ctx, msgs, ids, idx); err != nil {
+		return err
+	}
+	if err := r.loadLocations(ctx, msgs, ids, idx); err != nil {
+		return err
+	}
+	if err := r.loadReceipts(ctx, msgs, ids, idx); err != nil {
+		return err
+	}
+	if err := r.loadSystemEvents(ctx, msgs, ids, idx); err != nil {
+		return err
+	}
+	return r.loadContacts(ctx, msgs, ids, idx)
+}
+
+func (r *MessageRepository) loadSystemEvents(ctx context.Context, msgs []model.Message, ids []string, idx map[string]int) error {
+	rows, err := r.pool.Query(ctx,
+		`SELECT message_id, code, params FROM message_system_events WHERE message_id = ANY($1)`, ids,
+	)
+	if err != nil {
+		return fmt.Errorf("system events query: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var msgID string
+		ev := &model.SystemEvent{}
+		if err := rows.Scan(&msgID, &ev.Code, &ev.Params); err != nil {
+			return fmt.Errorf("system events scan: %w", err)
+		}
+		if i, ok := idx[msgID]; ok {
+			msgs[i].SystemEvent = ev
+		}
+	}
+	return rows.Err()
+}
+
+// loadReceipts считает квитанции сообщений групповых чатов и выводит из них Status. Получатели — текущие
+// участники, вступившие до отправки сообщения; квитанции вышедших не учитываются, иначе доставлено/прочитано
+// могло бы превысить число получателей. В личных чатах остаётся messages.status. Каналы пропускаются:
+// подписчики не видят друг друга, отправителю нужен не статус «прочитано всеми», а просмотры, и подсчёт
+// по всем подписчикам для каждого сообщения слишком дорог.
+func (r *MessageRepository) loadReceipts(ctx context.Context, msgs []model.Message, ids []string, idx map[string]int) error {
+	rows, err := r.pool.Query(ctx,
+		`SELECT m.id,
+		        COUNT(rcm.user_id),
+		        COUNT(mr.user_id) FILTER (WHERE mr.delivered_at IS NOT NULL),
+		        COUNT(mr.user_id) FILTER (WHERE mr.read_at IS NOT NULL)
+		 FROM messages m
+		 JOIN chats c ON c.id = m.chat_id AND c.chat_type = 'group'
+		 LEFT JOIN chat_members rcm ON rcm.chat_id = m.chat_id AND rcm.user_id IS DISTINCT FROM m.sender_id
+		      AND COALESCE(rcm.joined_at, 'epoch'::timestamptz) <= m.created_at
+		 LEFT JOIN message_receipts mr ON mr.message_id = m.id AND mr.user_id = rcm.user_id
+		 WHERE m.id = ANY($1)
+		 GROUP BY m.id`, ids,
+	)
+	if err != nil {
+		return fmt.Errorf("receipts query: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var msgID string
+		var s model.ReceiptSummary
+		if err := rows.Scan(&msgID, &s.Recipients, &s.Delivered, &s.Read); err != nil {
+			return fmt.Errorf("receipts scan: %w", err)
+		}
+		if i, ok := idx[msgID]; ok {
+			msgs[i].Receipts = &s
+			msgs[i].Status = s.Status()
+		}
+	}
+	return rows.Err()
+}
+
+func (r *MessageRepository) loadAttachments(ctx context.Context, msgs []model.Message, ids []string, idx map[string]int) error {
+	rows, err := r.pool.Query(ctx,
+		`SELECT message_id, content_type, file_url, file_name, file_size, width, height, blurhash
+		 FROM message_attachments
+		 WHERE message_id = ANY($1)
+		 ORDER BY message_id, position`, ids,
+	)
+	if err != nil {
+		return fmt.Errorf("attachments query: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var msgID string
+		var a model.Attachment
+		if err := rows.Scan(&msgID, &a.ContentType, &a.FileURL, &a.FileName, &a.FileSize, &a.Width, &a.Height, &a.BlurHash); err != nil {
+			return fmt.Errorf("attachments scan: %w", err)
+		}
+		if i, ok := idx[msgID]; ok {
+			msgs[i].Attachments = append(msgs[i].Attachments, a)
+		}
+	}
+	return rows.Err()
+}
+
+// loadImageMeta заполняет размеры и BlurHash картинок в file_url (только у сообщений, где они известны).
+func (r *MessageRepository) loadImageMeta(ctx context.Context, msgs []model.Message, ids []string, idx map[string]int) error {
+	rows, err := r.pool.Query(ctx,
+		`SELECT id, width, height, blurhash FROM messages WHERE id = ANY($1) AND width > 0`, ids,
+	)
+	if err != nil {
+		return fmt.Errorf("image meta query: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var msgID string
+		var width, height int
+		var blur string
+		if err := rows.Scan(&msgID, &width, &height, &blur); err != nil {
+			return fmt.Errorf("image meta scan: %w", err)
+		}
+		if i, ok := idx[msgID]; ok {
+			msgs[i].Width, msgs[i].Height, msgs[i].BlurHash = width, height, blur
+		}
+	}
+	return rows.Err()
+}
+
+// uploadFileName — имя файла в user_uploads для ссылки "/api/files/<имя>[?...]"; "" — файл не наш.
+func uploadFileName(fileURL string) string {
+	name, ok := strings.CutPrefix(fileURL, "/api/files/")
+	if !ok {
+		return ""
+	}
+	name, _, _ = strings.Cut(name, "?")
+	return name
+}
+
+func (r *MessageRepository) loadLocations(ctx context.Context, msgs []model.Message, ids []string, idx map[string]int) error {
+	rows, err := r.pool.Query(ctx,
+		`SELECT message_id, latitude, longitude, label FROM message_locations WHERE message_id = ANY($1)`, ids,
+	)
+	if err != nil {
+		return fmt.Errorf("locations query: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var msgID string
+		loc := &model.Location{}
+		if err := rows.Scan(&msgID, &loc.Latitude, &loc.Longitude, &loc.Label); err != nil {
+			return fmt.Errorf("locations scan: %w", err)
+		}
+		if i, ok := idx[msgID]; ok {
+			msgs[i].Location = loc
+		}
+	}
+	return rows.Err()
+}
+
+func (r *MessageRepository) loadContacts(ctx context.Context, msgs []model.Message, ids []string, idx map[string]int) error {
+	rows, err := r.pool.Query(ctx,
+		`SELECT mc.message_id, COALESCE(mc.user_id::text, ''), mc.username, mc.avatar_url,
+		        u.id, u.username, u.avatar_url, `+uOnlineSQL+`, `+uLastSeenSQL+`
+		 FROM message_contacts mc
+		 LEFT JOIN users u ON u.id = mc.user_id
+		 WHERE mc.message_id = ANY($1)`, ids,
+	)
+	if err != nil {
+		return fmt.Errorf("contacts query: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var msgID string
+		var userID, username, avatarURL *string
+		var isOnline *bool
+		var lastSeen *time.Time
+		card := &model.ContactCard{}
+		if err := rows.Scan(&msgID, &card.UserID, &card.Username, &card.AvatarURL,
+			&userID, &username, &avatarURL, &isOnline, &lastSeen); err != nil {
+			return fmt.Errorf("contacts scan: %w", err)
+		}
+		if userID != nil {
+			card.User = &model.UserPublic{ID: *userID, Username: *username, AvatarURL: *avatarURL, IsOnline: *isOnline, LastSeenAt: *lastSeen}
+		}
+		if i, ok := idx[msgID]; ok {
+			msgs[i].Contact = card
+		}
+	}
+	return rows.Err()
+}
+
 func (r *MessageRepository) GetByID(ctx context.Context, id string) (*model.Message, error) {
 	defer logger.DeferLogDuration("msg.GetByID", time.Now())()
 	m := &model.Message{}
+	var encrypted bool
 	sender := &model.UserPublic{}
 	err := r.pool.QueryRow(ctx,
 		`SELECT m.id, m.chat_id, m.sender_id, m.content, m.content_type, m.file_url, m.file_name, m.file_size, m.status,
-		        m.reply_to_id, m.edited_at, m.is_deleted, m.created_at,
-		        u.id, u.username, u.avatar_url, u.is_online, u.last_seen_at
+		        m.reply_to_id, m.edited_at, m.is_deleted, m.created_at, m.content_encrypted,
+		        u.id, u.username, u.avatar_url, `+uOnlineSQL+`, `+uLastSeenSQL+`
 		 FROM messages m
 		 JOIN users u ON u.id = m.sender_id
 		 WHERE m.id = $1`, id,
 	).Scan(&m.ID, &m.ChatID, &m.SenderID, &m.Content, &m.ContentType, &m.FileURL, &m.FileName, &m.FileSize, &m.Status,
-		&m.ReplyToID, &m.EditedAt, &m.IsDeleted, &m.CreatedAt,
+		&m.ReplyToID, &m.EditedAt, &m.IsDeleted, &m.CreatedAt, &encrypted,
 		&sender.ID, &sender.Username, &sender.AvatarURL, &sender.IsOnline, &sender.LastSeenAt)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, ErrNotFound
@@ -54,20 +391,76 @@ func (r *MessageRepository) GetByID(ctx context.Context, id string) (*model.Mess
 		return nil, fmt.Errorf("msgRepo.GetByID: %w", err)
 	}
 	m.Sender = sender
+	r.decryptContent(m, encrypted)
+	one := []model.Message{*m}
+	if err := r.loadDetails(ctx, one); err != nil {
+		return nil, fmt.Errorf("msgRepo.GetByID: %w", err)
+	}
+	m.Attachments, m.Location, m.Contact, m.SystemEvent = one[0].Attachments, one[0].Location, one[0].Contact, one[0].SystemEvent
 	return m, nil
 }
 
-func (r *MessageRepository) GetChatMessages(ctx context.Context, chatID string, limit, offset int) ([]model.Message, error) {
+// GetByIDs — GetByID для нескольких сообщений одним запросом (плюс загрузка вложений и т.п. на всю пачку):
+// id → сообщение. Ненайденных id в результате нет.
+func (r *MessageRepository) GetByIDs(ctx context.Context, ids []string) (map[string]*model.Message, error) {
+	defer logger.DeferLogDuration("msg.GetByIDs", time.Now())()
+	result := make(map[string]*model.Message, len(ids))
+	if len(ids) == 0 {
+		return result, nil
+	}
+	rows, err := r.pool.Query(ctx,
+		`SELECT m.id, m.chat_id, m.sender_id, m.content, m.content_type, m.file_url, m.file_name, m.file_size, m.status,
+		        m.reply_to_id, m.edited_at, m.is_deleted, m.created_at, m.content_encrypted,
+		        u.id, u.username, u.avatar_url, `+uOnlineSQL+`, `+uLastSeenSQL+`
+		 FROM messages m
+		 JOIN users u ON u.id = m.sender_id
+		 WHERE m.id = ANY($1)`, ids,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("msgRepo.GetByIDs: %w", err)
+	}
+	defer rows.Close()
+	var msgs []model.Message
+	for rows.Next() {
+		var m model.Message
+		var encrypted bool
+		sender := &model.UserPublic{}
+		if err := rows.Scan(&m.ID, &m.ChatID, &m.SenderID, &m.Content, &m.ContentType, &m.FileURL, &m.FileName, &m.FileSize, &m.Status,
+			&m.ReplyToID, &m.EditedAt, &m.IsDeleted, &m.CreatedAt, &encrypted,
+			&sender.ID, &sender.Username, &sender.AvatarURL, &sender.IsOnline, &sender.LastSeenAt); err != nil {
+			return nil, fmt.Errorf("msgRepo.GetByIDs scan: %w", err)
+		}
+		m.Sender = sender
+		r.decryptContent(&m, encrypted)
+		msgs = append(msgs, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("msgRepo.GetByIDs: %w", err)
+	}
+	if err := r.loadDetails(ctx, msgs); err != nil {
+		return nil, fmt.Errorf("msgRepo.GetByIDs: %w", err)
+	}
+	for i := range msgs {
+		result[msgs[i].ID] = &msgs[i]
+	}
+	return result, nil
+}
+
+// GetChatMessages returns chat messages newest-first, excluding messages hidden by userID ("delete for me")
+// and messages before the user's cleared_before ("clear history").
+func (r *MessageRepository) GetChatMessages(ctx context.Context, chatID, userID string, limit, offset int) ([]model.Message, error) {
 	defer logger.DeferLogDuration("msg.GetChatMessages", time.Now())()
 	rows, err := r.pool.Query(ctx,
 		`SELECT m.id, m.chat_id, m.sender_id, m.content, m.content_type, m.file_url, m.file_name, m.file_size, m.status,
-		        m.reply_to_id, m.edited_at, m.is_deleted, m.created_at,
-		        u.id, u.username, u.avatar_url, u.is_online, u.last_seen_at
+		        m.reply_to_id, m.edited_at, m.is_deleted, m.created_at, m.content_encrypted,
+		        u.id, u.username, u.avatar_url, `+uOnlineSQL+`, `+uLastSeenSQL+`
 		 FROM messages m
 		 JOIN users u ON u.id = m.sender_id
 		 WHERE m.chat_id = $1
+		   AND NOT EXISTS (SELECT 1 FROM hidden_messages hm WHERE hm.message_id = m.id AND hm.user_id = $2)
+		   AND `+notClearedSQL("$2")+`
 		 ORDER BY m.created_at DESC
-		 LIMIT $2 OFFSET $3`, chatID, limit, offset,
+		 LIMIT $3 OFFSET $4`, chatID, userID, limit, offset,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("msgRepo.GetChatMessages query: %w", err)
@@ -77,36 +470,202 @@ func (r *MessageRepository) GetChatMessages(ctx context.Context, chatID string,
 	messages := make([]model.Message, 0, limit)
 	for rows.Next() {
 		var m model.Message
+		var encrypted bool
 		sender := &model.UserPublic{}
 		if err := rows.Scan(&m.ID, &m.ChatID, &m.SenderID, &m.Content, &m.ContentType, &m.FileURL, &m.FileName, &m.FileSize, &m.Status,
-			&m.ReplyToID, &m.EditedAt, &m.IsDeleted, &m.CreatedAt,
+			&m.ReplyToID, &m.EditedAt, &m.IsDeleted, &m.CreatedAt, &encrypted,
 			&sender.ID, &sender.Username, &sender.AvatarURL, &sender.IsOnline, &sender.LastSeenAt); err != nil {
 			return nil, fmt.Errorf("msgRepo.GetChatMessages scan: %w", err)
 		}
 		m.Sender = sender
+		r.decryptContent(&m, encrypted)
 		messages = append(messages, m)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("msgRepo.GetChatMessages rows: %w", err)
 	}
+	rows.Close()
+	if err := r.loadDetails(ctx, messages); err != nil {
+		return nil, fmt.Errorf("msgRepo.GetChatMessages: %w", err)
+	}
+	return messages, nil
+}
+
+// GetUnreadMessages returns up to limit messages from other members newer than the user's read position
+// (last_read_at, or joined_at if the chat was never read, and not before cleared_before), newest-first,
+// excluding hidden messages. A chat marked unread (MarkUnread) with nothing newer returns its latest message
+// from another member, matching the unread count of one.
+func (r *MessageRepository) GetUnreadMessages(ctx context.Context, chatID, userID string, limit int) ([]model.Message, error) {
+	defer logger.DeferLogDuration("msg.GetUnreadMessages", time.Now())()
+	messages, err := r.queryUnread(ctx, `m.created_at > `+memberReadSinceSQL, chatID, userID, limit)
+	if err != nil || len(messages) > 0 {
+		return messages, err
+	}
+	return r.queryUnread(ctx,
+		`cm.marked_unread AND m.created_at > COALESCE(cm.cleared_before, 'epoch'::timestamptz)`, chatID, userID, 1)
+}
+
+// queryUnread — сообщения других участников чата по условию cond (над m и cm), новые первыми.
+func (r *MessageRepository) queryUnread(ctx context.Context, cond, chatID, userID string, limit int) ([]model.Message, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT m.id, m.chat_id, m.sender_id, m.content, m.content_type, m.file_url, m.file_name, m.file_size, m.status,
+		        m.reply_to_id, m.edited_at, m.is_deleted, m.created_at, m.content_encrypted,
+		        u.id, u.username, u.avatar_url, `+uOnlineSQL+`, `+uLastSeenSQL+`
+		 FROM messages m
+		 JOIN users u ON u.id = m.sender_id
+		 JOIN chat_members cm ON cm.chat_id = m.chat_id AND cm.user_id = $2
+		 WHERE m.chat_id = $1 AND m.sender_id != $2 AND `+cond+`
+		   AND NOT EXISTS (SELECT 1 FROM hidden_messages hm WHERE hm.message_id = m.id AND hm.user_id = $2)
+		 ORDER BY m.created_at DESC, m.id DESC
+		 LIMIT $3`, chatID, userID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("msgRepo.GetUnreadMessages query: %w", err)
+	}
+	defer rows.Close()
+
+	messages := make([]model.Message, 0, limit)
+	for rows.Next() {
+		var m model.Message
+		var encrypted bool
+		sender := &model.UserPublic{}
+		if err := rows.Scan(&m.ID, &m.ChatID, &m.SenderID, &m.Content, &m.ContentType, &m.FileURL, &m.FileName, &m.FileSize, &m.Status,
+			&m.ReplyToID, &m.EditedAt, &m.IsDeleted, &m.CreatedAt, &encrypted,
+			&sender.ID, &sender.Username, &sender.AvatarURL, &sender.IsOnline, &sender.LastSeenAt); err != nil {
+			return nil, fmt.Errorf("msgRepo.GetUnreadMessages scan: %w", err)
+		}
+		m.Sender = sender
+		r.decryptContent(&m, encrypted)
+		messages = append(messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("msgRepo.GetUnreadMessages rows: %w", err)
+	}
+	rows.Close()
+	if err := r.loadDetails(ctx, messages); err != nil {
+		return nil, fmt.Errorf("msgRepo.GetUnreadMessages: %w", err)
+	}
 	return messages, nil
 }
 
-func (r *MessageRepository) GetLastMessage(ctx context.Context, chatID string) (*model.Message, error) {
+// GetChatMessagesBefore returns chat messages older than the cursor (beforeAt, beforeID), newest-first,
+// excluding messages hidden by userID. A nil beforeAt starts from the newest message.
+func (r *MessageRepository) GetChatMessagesBefore(ctx context.Context, chatID, userID string, beforeAt *time.Time, beforeID string, limit int) ([]model.Message, error) {
+	defer logger.DeferLogDuration("msg.GetChatMessagesBefore", time.Now())()
+	var cursorID *string
+	if beforeAt != nil {
+		cursorID = &beforeID
+	}
+	rows, err := r.pool.Query(ctx,
+		`SELECT m.id, m.chat_id, m.sender_id, m.content, m.content_type, m.file_url, m.file_name, m.file_size, m.status,
+		        m.reply_to_id, m.edited_at, m.is_deleted, m.created_at, m.content_encrypted,
+		        u.id, u.username, u.avatar_url, `+uOnlineSQL+`, `+uLastSeenSQL+`
+		 FROM messages m
+		 JOIN users u ON u.id = m.sender_id
+		 WHERE m.chat_id = $1
+		   AND NOT EXISTS (SELECT 1 FROM hidden_messages hm WHERE hm.message_id = m.id AND hm.user_id = $2)
+		   AND `+notClearedSQL("$2")+`
+		   AND ($3::timestamptz IS NULL OR (m.created_at, m.id) < ($3, $4::uuid))
+		 ORDER BY m.created_at DESC, m.id DESC
+		 LIMIT $5`, chatID, userID, beforeAt, cursorID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("msgRepo.GetChatMessagesBefore query: %w", err)
+	}
+	defer rows.Close()
+
+	messages := make([]model.Message, 0, limit)
+	for rows.Next() {
+		var m model.Message
+		var encrypted bool
+		sender := &model.UserPublic{}
+		if err := rows.Scan(&m.ID, &m.ChatID, &m.SenderID, &m.Content, &m.ContentType, &m.FileURL, &m.FileName, &m.FileSize, &m.Status,
+			&m.ReplyToID, &m.EditedAt, &m.IsDeleted, &m.CreatedAt, &encrypted,
+			&sender.ID, &sender.Username, &sender.AvatarURL, &sender.IsOnline, &sender.LastSeenAt); err != nil {
+			return nil, fmt.Errorf("msgRepo.GetChatMessagesBefore scan: %w", err)
+		}
+		m.Sender = sender
+		r.decryptContent(&m, encrypted)
+		messages = append(messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("msgRepo.GetChatMessagesBefore rows: %w", err)
+	}
+	rows.Close()
+	if err := r.loadDetails(ctx, messages); err != nil {
+		return nil, fmt.Errorf("msgRepo.GetChatMessagesBefore: %w", err)
+	}
+	return messages, nil
+}
+
+// GetChatMedia returns non-deleted media messages of a chat (newest first) with the given content types.
+func (r *MessageRepository) GetChatMedia(ctx context.Context, chatID, userID string, types []model.ContentType, limit, offset int) ([]model.Message, error) {
+	defer logger.DeferLogDuration("msg.GetChatMedia", time.Now())()
+	typeStrs := make([]string, len(types))
+	for i, t := range types {
+		typeStrs[i] = string(t)
+	}
+	rows, err := r.pool.Query(ctx,
+		`SELECT m.id, m.chat_id, m.sender_id, m.content, m.content_type, m.file_url, m.file_name, m.file_size, m.status,
+		        m.reply_to_id, m.edited_at, m.is_deleted, m.created_at, m.content_encrypted,
+		        u.id, u.username, u.avatar_url, `+uOnlineSQL+`, `+uLastSeenSQL+`
+		 FROM messages m
+		 JOIN users u ON u.id = m.sender_id
+		 WHERE m.chat_id = $1 AND m.is_deleted = false AND m.content_type = ANY($2)
+		   AND NOT EXISTS (SELECT 1 FROM hidden_messages hm WHERE hm.message_id = m.id AND hm.user_id = $5)
+		   AND `+notClearedSQL("$5")+`
+		 ORDER BY m.created_at DESC
+		 LIMIT $3 OFFSET $4`, chatID, typeStrs, limit, offset, userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("msgRepo.GetChatMedia query: %w", err)
+	}
+	defer rows.Close()
+
+	messages := make([]model.Message, 0, limit)
+	for rows.Next() {
+		var m model.Message
+		var encrypted bool
+		sender := &model.UserPublic{}
+		if err := rows.Scan(&m.ID, &m.ChatID, &m.SenderID, &m.Content, &m.ContentType, &m.FileURL, &m.FileName, &m.FileSize, &m.Status,
+			&m.ReplyToID, &m.EditedAt, &m.IsDeleted, &m.CreatedAt, &encrypted,
+			&sender.ID, &sender.Username, &sender.AvatarURL, &sender.IsOnline, &sender.LastSeenAt); err != nil {
+			return nil, fmt.Errorf("msgRepo.GetChatMedia scan: %w", err)
+		}
+		m.Sender = sender
+		r.decryptContent(&m, encrypted)
+		messages = append(messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("msgRepo.GetChatMedia rows: %w", err)
+	}
+	rows.Close()
+	if err := r.loadDetails(ctx, messages); err != nil {
+		return nil, fmt.Errorf("msgRepo.GetChatMedia: %w", err)
+	}
+	return messages, nil
+}
+
+// GetLastMessage возвращает последнее сообщение чата для превью в списке чатов: не удалённое, не скрытое
+// пользователем userID («удалить у себя») и не из очищенной им истории. Если таких нет — nil.
+func (r *MessageRepository) GetLastMessage(ctx context.Context, chatID, userID string) (*model.Message, error) {
 	defer logger.DeferLogDuration("msg.GetLastMessage", time.Now())()
 	m := &model.Message{}
+	var encrypted bool
 	sender := &model.UserPublic{}
 	err := r.pool.QueryRow(ctx,
 		`SELECT m.id, m.chat_id, m.sender_id, m.content, m.content_type, m.file_url, m.file_name, m.file_size, m.status,
-		        m.reply_to_id, m.edited_at, m.is_deleted, m.created_at,
-		        u.id, u.username, u.avatar_url, u.is_online, u.last_seen_at
+		        m.reply_to_id, m.edited_at, m.is_deleted, m.created_at, m.content_encrypted,
+		        u.id, u.username, u.avatar_url, `+uOnlineSQL+`, `+uLastSeenSQL+`
 		 FROM messages m
 		 JOIN users u ON u.id = m.sender_id
-		 WHERE m.chat_id = $1
+		 WHERE m.chat_id = $1 AND NOT m.is_deleted
+		   AND NOT EXISTS (SELECT 1 FROM hidden_messages hm WHERE hm.message_id = m.id AND hm.user_id = $2)
+		   AND `+notClearedSQL("$2")+`
 		 ORDER BY m.created_at DESC
-		 LIMIT 1`, chatID,
+		 LIMIT 1`, chatID, userID,
 	).Scan(&m.ID, &m.ChatID, &m.SenderID, &m.Content, &m.ContentType, &m.FileURL, &m.FileName, &m.FileSize, &m.Status,
-		&m.ReplyToID, &m.EditedAt, &m.IsDeleted, &m.CreatedAt,
+		&m.ReplyToID, &m.EditedAt, &m.IsDeleted, &m.CreatedAt, &encrypted,
 		&sender.ID, &sender.Username, &sender.AvatarURL, &sender.IsOnline, &sender.LastSeenAt)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, nil
@@ -115,13 +674,121 @@ func (r *MessageRepository) GetLastMessage(ctx context.Context, chatID string) (
 		return nil, fmt.Errorf("msgRepo.GetLastMessage: %w", err)
 	}
 	m.Sender = sender
+	r.decryptContent(m, encrypted)
 	return m, nil
 }
 
+// CanReplyTo сообщает, можно ли пользователю userID ответить в чате chatID на сообщение messageID:
+// оно из этого же чата, не удалено и видно пользователю (не скрыто им и не в очищенной истории).
+func (r *MessageRepository) CanReplyTo(ctx context.Context, messageID, chatID, userID string) (bool, error) {
+	defer logger.DeferLogDuration("msg.CanReplyTo", time.Now())()
+	var ok bool
+	err := r.pool.QueryRow(ctx,
+		`SELECT EXISTS (
+		   SELECT 1 FROM messages m
+		   WHERE m.id = $1 AND m.chat_id = $2 AND NOT m.is_deleted
+		     AND NOT EXISTS (SELECT 1 FROM hidden_messages hm WHERE hm.message_id = m.id AND hm.user_id = $3)
+		     AND `+notClearedSQL("$3")+`
+		 )`, messageID, chatID, userID,
+	).Scan(&ok)
+	if err != nil {
+		return false, fmt.Errorf("msgRepo.CanReplyTo: %w", err)
+	}
+	return ok, nil
+}
+
+// MarkReadUpTo отмечает прочитанными чужие сообщения чата до messageID включительно и сдвигает
+// last_read_at участника на время этого сообщения (назад не сдвигается). Возвращает время сообщения
+// (позицию прочтения) и момент прочтения — тот же, что записан в квитанции;
+// ErrNotFound — сообщения нет в этом чате.
+func (r *MessageRepository) MarkReadUpTo(ctx context.Context, chatID, userID, messageID string) (readAt, seenAt time.Time, err error) {
+	defer logger.DeferLogDuration("msg.MarkReadUpTo", time.Now())()
+	err = r.pool.QueryRow(ctx,
+		`WITH target AS (
+		     SELECT created_at FROM messages WHERE id = $3 AND chat_id = $1
+		 ), receipts AS (
+		     `+insertReadReceiptsSQL+` AND m.created_at <= (SELECT created_at FROM target)
+		     `+onReceiptConflictSQL+`
+		 ), marked AS (
+		     UPDATE messages SET status = 'read'
+		     WHERE chat_id = $1 AND sender_id != $2 AND status != 'read'
+		       AND created_at <= (SELECT created_at FROM target)
+		 ), member AS (
+		     UPDATE chat_members SET last_read_at = GREATEST(COALESCE(last_read_at, 'epoch'::timestamptz), (SELECT created_at FROM target)),
+		                             marked_unread = false
+		     WHERE chat_id = $1 AND user_id = $2 AND EXISTS (SELECT 1 FROM target)
+		 )
+		 SELECT created_at, NOW() FROM target`,
+		chatID, userID, messageID,
+	).Scan(&readAt, &seenAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.Time{}, time.Time{}, ErrNotFound
+	}
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("msgRepo.MarkReadUpTo: %w", err)
+	}
+	return readAt, seenAt, nil
+}
+
+// GetReceipts возвращает квитанции сообщения по получателям: кто и когда получил и прочитал его.
+// Сначала прочитавшие (по времени прочтения), затем получившие.
+func (r *MessageRepository) GetReceipts(ctx context.Context, messageID string) ([]model.MessageReceipt, error) {
+	defer logger.DeferLogDuration("msg.GetReceipts", time.Now())()
+	rows, err := r.pool.Query(ctx,
+		`SELECT u.id, u.username, u.avatar_url, mr.delivered_at, mr.read_at
+		 FROM message_receipts mr
+		 JOIN users u ON u.id = mr.user_id
+		 WHERE mr.message_id = $1
+		 ORDER BY mr.read_at NULLS LAST, mr.delivered_at NULLS LAST, u.username`, messageID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("msgRepo.GetReceipts: %w", err)
+	}
+	defer rows.Close()
+	receipts := []model.MessageReceipt{}
+	for rows.Next() {
+		var rc model.MessageReceipt
+		if err := rows.Scan(&rc.User.ID, &rc.User.Username, &rc.User.AvatarURL, &rc.DeliveredAt, &rc.ReadAt); err != nil {
+			return nil, fmt.Errorf("msgRepo.GetReceipts scan: %w", err)
+		}
+		receipts = append(receipts, rc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("msgRepo.GetReceipts: %w", err)
+	}
+	return receipts, nil
+}
+
+// notClearedSQL — условие «сообщение m не попадает в очищенную пользователем историю»;
+// userParam — номер параметра с id пользователя ("$2").
+func notClearedSQL(userParam string) string {
+	return `NOT EXISTS (SELECT 1 FROM chat_members cl WHERE cl.chat_id = m.chat_id AND cl.user_id = ` + userParam +
+		` AND cl.cleared_before >= m.created_at)`
+}
+
+// insertReadReceiptsSQL — квитанции о прочтении пользователем $2 сообщений чата $1, пришедших после
+// его прежней позиции прочтения (раньше квитанции уже записаны). Дополняется условием на m.created_at.
+const insertReadReceiptsSQL = `INSERT INTO message_receipts (message_id, user_id, delivered_at, read_at)
+		     SELECT m.id, $2, NOW(), NOW()
+		     FROM messages m
+		     JOIN chat_members cm ON cm.chat_id = m.chat_id AND cm.user_id = $2
+		     WHERE m.chat_id = $1 AND m.sender_id != $2 AND NOT m.is_deleted
+		       AND m.created_at > ` + memberReadSinceSQL
+
+const onReceiptConflictSQL = `ON CONFLICT (message_id, user_id) DO UPDATE
+		     SET read_at = COALESCE(message_receipts.read_at, EXCLUDED.read_at),
+		         delivered_at = COALESCE(message_receipts.delivered_at, EXCLUDED.delivered_at)`
+
+// MarkAsRead отмечает прочитанными все чужие сообщения чата и пишет квитанции о прочтении.
+// last_read_at участника обновляет вызывающий (ChatRepository.UpdateMemberLastRead).
 func (r *MessageRepository) MarkAsRead(ctx context.Context, chatID, userID string) error {
 	defer logger.DeferLogDuration("msg.MarkAsRead", time.Now())()
 	_, err := r.pool.Exec(ctx,
-		`UPDATE messages SET status = 'read'
+		`WITH receipts AS (
+		     `+insertReadReceiptsSQL+`
+		     `+onReceiptConflictSQL+`
+		 )
+		 UPDATE messages SET status = 'read'
 		 WHERE chat_id = $1 AND sender_id != $2 AND status != 'read'`,
 		chatID, userID,
 	)
@@ -131,28 +798,235 @@ func (r *MessageRepository) MarkAsRead(ctx context.Context, chatID, userID strin
 	return nil
 }
 
+// MarkDelivered записывает доставку сообщения пользователям userIDs (получившим его по WebSocket).
+func (r *MessageRepository) MarkDelivered(ctx context.Context, messageID string, userIDs []string) error {
+	defer logger.DeferLogDuration("msg.MarkDelivered", time.Now())()
+	if len(userIDs) == 0 {
+		return nil
+	}
+	_, err := r.pool.Exec(ctx,
+		`INSERT INTO message_receipts (message_id, user_id, delivered_at)
+		 SELECT $1, uid, NOW() FROM unnest($2::uuid[]) AS uid
+		 ON CONFLICT (message_id, user_id) DO NOTHING`,
+		messageID, userIDs,
+	)
+	if err != nil {
+		return fmt.Errorf("msgRepo.MarkDelivered: %w", err)
+	}
+	return nil
+}
+
+// AttachReactionsAndReplies дополняет страницу сообщений реакциями и цитируемыми сообщениями.
+// Общая для REST (GetMessages) и WebSocket (fetch_messages); реакции, цитаты и счётчики ответов всей
+// страницы — по одному запросу. Ошибки пропускаются: страница отдаётся без реакций / цитат.
+func (r *MessageRepository) AttachReactionsAndReplies(ctx context.Context, reactRepo *ReactionRepository, msgs []model.Message) {
+	ids := make([]string, len(msgs))
+	var replyIDs []string
+	seen := make(map[string]struct{})
+	for i := range msgs {
+		ids[i] = msgs[i].ID
+		if id := msgs[i].ReplyToID; id != nil {
+			if _, ok := seen[*id]; !ok {
+				seen[*id] = struct{}{}
+				replyIDs = append(replyIDs, *id)
+			}
+		}
+	}
+	reactions, err := reactRepo.GetByMessages(ctx, ids)
+	if err != nil {
+		logger.Errorf("attach reactions: %v", err)
+	}
+	replies, err := r.GetByIDs(ctx, replyIDs)
+	if err != nil {
+		logger.Errorf("attach replies: %v", err)
+	}
+	replyCounts, err := r.ReplyCounts(ctx, ids)
+	if err != nil {
+		logger.Errorf("attach reply counts: %v", err)
+	}
+	for i := range msgs {
+		if rs := reactions[msgs[i].ID]; len(rs) > 0 {
+			msgs[i].Reactions = rs
+		}
+		msgs[i].ReplyCount = replyCounts[msgs[i].ID]
+		if msgs[i].ReplyToID != nil {
+			if reply, ok := replies[*msgs[i].ReplyToID]; ok {
+				msgs[i].ReplyTo = reply
+			}
+		}
+	}
+}
+
+// ReplyCounts возвращает число неудалённых прямых ответов на каждое сообщение из ids — один проход
+// по индексу idx_messages_reply_to, без обхода цепочек. Сообщений без ответов в результате нет.
+func (r *MessageRepository) ReplyCounts(ctx context.Context, ids []string) (map[string]int, error) {
+	defer logger.DeferLogDuration("msg.ReplyCounts", time.Now())()
+	counts := make(map[string]int)
+	if len(ids) == 0 {
+		return counts, nil
+	}
+	rows, err := r.pool.Query(ctx,
+		`SELECT reply_to_id::text, COUNT(*) FROM messages
+		 WHERE reply_to_id = ANY($1) AND NOT is_deleted
+		 GROUP BY reply_to_id`, ids,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("msgRepo.ReplyCounts: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		var n int
+		if err := rows.Scan(&id, &n); err != nil {
+			return nil, fmt.Errorf("msgRepo.ReplyCounts scan: %w", err)
+		}
+		counts[id] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("msgRepo.ReplyCounts: %w", err)
+	}
+	return counts, nil
+}
+
+// ReplyCount — ReplyCounts для одного сообщения.
+func (r *MessageRepository) ReplyCount(ctx context.Context, messageID string) (int, error) {
+	defer logger.DeferLogDuration("msg.ReplyCount", time.Now())()
+	var n int
+	err := r.pool.QueryRow(ctx,
+		`SELECT COUNT(*) FROM messages WHERE reply_to_id = $1 AND NOT is_deleted`, messageID,
+	).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("msgRepo.ReplyCount: %w", err)
+	}
+	return n, nil
+}
+
+// GetThread возвращает ветку сообщения rootID — прямые ответы на него от старых к новым (как и reply_count);
+// скрытые пользователем userID и очищенные им сообщения не возвращаются.
+func (r *MessageRepository) GetThread(ctx context.Context, rootID, userID string, limit, offset int) ([]model.Message, error) {
+	defer logger.DeferLogDuration("msg.GetThread", time.Now())()
+	rows, err := r.pool.Query(ctx,
+		`SELECT m.id, m.chat_id, m.sender_id, m.content, m.content_type, m.file_url, m.file_name, m.file_size, m.status,
+		        m.reply_to_id, m.edited_at, m.is_deleted, m.created_at, m.content_encrypted,
+		        u.id, u.username, u.avatar_url, `+uOnlineSQL+`, `+uLastSeenSQL+`
+		 FROM messages m
+		 JOIN users u ON u.id = m.sender_id
+		 WHERE m.reply_to_id = $1
+		   AND NOT EXISTS (SELECT 1 FROM hidden_messages hm WHERE hm.message_id = m.id AND hm.user_id = $2)
+		   AND `+notClearedSQL("$2")+`
+		 ORDER BY m.created_at, m.id
+		 LIMIT $3 OFFSET $4`, rootID, userID, limit, offset,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("msgRepo.GetThread query: %w", err)
+	}
+	defer rows.Close()
+
+	messages := make([]model.Message, 0, limit)
+	for rows.Next() {
+		var m model.Message
+		var encrypted bool
+		sender := &model.UserPublic{}
+		if err := rows.Scan(&m.ID, &m.ChatID, &m.SenderID, &m.Content, &m.ContentType, &m.FileURL, &m.FileName, &m.FileSize, &m.Status,
+			&m.ReplyToID, &m.EditedAt, &m.IsDeleted, &m.CreatedAt, &encrypted,
+			&sender.ID, &sender.Username, &sender.AvatarURL, &sender.IsOnline, &sender.LastSeenAt); err != nil {
+			return nil, fmt.Errorf("msgRepo.GetThread scan: %w", err)
+		}
+		m.Sender = sender
+		r.decryptContent(&m, encrypted)
+		messages = append(messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("msgRepo.GetThread rows: %w", err)
+	}
+	rows.Close()
+	if err := r.loadDetails(ctx, messages); err != nil {
+		return nil, fmt.Errorf("msgRepo.GetThread: %w", err)
+	}
+	return messages, nil
+}
+
 // UpdateContent edits a message's content and sets edited_at.
+// Упоминания пересчитываются по открытому тексту: в чувствительных чатах сохранённое содержимое зашифровано.
 func (r *MessageRepository) UpdateContent(ctx context.Context, id, content string, editedAt time.Time) error {
 	defer logger.DeferLogDuration("msg.UpdateContent", time.Now())()
+	var chatID, senderID string
+	if err := r.pool.QueryRow(ctx, `SELECT chat_id, sender_id FROM messages WHERE id = $1`, id).Scan(&chatID, &senderID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("msgRepo.UpdateContent: %w", err)
+	}
+	stored, encrypted, err := r.storedContent(ctx, chatID, content)
+	if err != nil {
+		return fmt.Errorf("msgRepo.UpdateContent: %w", err)
+	}
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("msgRepo.UpdateContent begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx,
+		`UPDATE messages SET content = $1, edited_at = $2, content_encrypted = $3 WHERE id = $4`,
+		stored, editedAt, encrypted, id,
+	); err != nil {
+		return fmt.Errorf("msgRepo.UpdateContent: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM message_mentions WHERE message_id = $1`, id); err != nil {
+		return fmt.Errorf("msgRepo.UpdateContent mentions: %w", err)
+	}
+	if strings.Contains(content, "@") {
+		if err := recordMentions(ctx, tx, id, chatID, senderID, content); err != nil {
+			return fmt.Errorf("msgRepo.UpdateContent: %w", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("msgRepo.UpdateContent commit: %w", err)
+	}
+	return nil
+}
+
+// HideForUser hides a message from one user's view only ("delete for me").
+func (r *MessageRepository) HideForUser(ctx context.Context, messageID, userID string) error {
+	defer logger.DeferLogDuration("msg.HideForUser", time.Now())()
 	_, err := r.pool.Exec(ctx,
-		`UPDATE messages SET content = $1, edited_at = $2 WHERE id = $3`,
-		content, editedAt, id,
+		`INSERT INTO hidden_messages (user_id, message_id, hidden_at) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`,
+		userID, messageID, time.Now().UTC(),
 	)
 	if err != nil {
-		return fmt.Errorf("msgRepo.UpdateContent: %w", err)
+		return fmt.Errorf("msgRepo.HideForUser: %w", err)
 	}
 	return nil
 }
 
 // SoftDelete marks a message as deleted and clears content.
+// Вместе с текстом удаляются файлы альбома, геопозиция и карточка контакта: иначе участники по-прежнему получали бы их.
 func (r *MessageRepository) SoftDelete(ctx context.Context, id string) error {
 	defer logger.DeferLogDuration("msg.SoftDelete", time.Now())()
-	_, err := r.pool.Exec(ctx,
-		`UPDATE messages SET is_deleted = true, content = '' WHERE id = $1`, id,
-	)
+	tx, err := r.pool.Begin(ctx)
 	if err != nil {
+		return fmt.Errorf("msgRepo.SoftDelete begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx,
+		`UPDATE messages SET is_deleted = true, content = '', content_encrypted = false,
+		        file_url = '', file_name = '', file_size = 0
+		 WHERE id = $1`, id,
+	); err != nil {
 		return fmt.Errorf("msgRepo.SoftDelete: %w", err)
 	}
+	if _, err := tx.Exec(ctx, `DELETE FROM message_attachments WHERE message_id = $1`, id); err != nil {
+		return fmt.Errorf("msgRepo.SoftDelete attachments: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM message_locations WHERE message_id = $1`, id); err != nil {
+		return fmt.Errorf("msgRepo.SoftDelete location: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM message_contacts WHERE message_id = $1`, id); err != nil {
+		return fmt.Errorf("msgRepo.SoftDelete contact: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("msgRepo.SoftDelete commit: %w", err)
+	}
 	return nil
 }
 
@@ -218,23 +1092,129 @@ func (r *MessageRepository) GetUserStats(ctx context.Context, userID string) (*U
 	return stats, nil
 }
 
-// SearchMessages searches messages in a user's chats using ILIKE. If chatID is not empty, limits to that chat.
-func (r *MessageRepository) SearchMessages(ctx context.Context, userID, query string, limit int, chatID string) ([]model.Message, error) {
+// ChatActivityStats — статистика чата; служебные и удалённые сообщения не учитываются.
+type ChatActivityStats struct {
+	TotalMessages int `json:"total_messages"`
+	MessagesWeek  int `json:"messages_week"`
+	// ActiveMembersWeek — сколько участников писали за последние 7 дней.
+	ActiveMembersWeek int                  `json:"active_members_week"`
+	Media             ChatMediaCounts      `json:"media"`
+	TopMembers        []ChatMemberActivity `json:"top_members"`
+}
+
+type ChatMediaCounts struct {
+	Images int `json:"images"`
+	Files  int `json:"files"`
+	Voice  int `json:"voice"`
+}
+
+// ChatMemberActivity — число сообщений участника за последние 7 дней.
+type ChatMemberActivity struct {
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+	Messages int    `json:"messages"`
+}
+
+// GetChatStats считает статистику чата chatID; topN — сколько самых активных участников вернуть.
+// Фильтры по дате идут по индексу messages(chat_id, created_at).
+func (r *MessageRepository) GetChatStats(ctx context.Context, chatID string, topN int) (*ChatActivityStats, error) {
+	defer logger.DeferLogDuration("msg.GetChatStats", time.Now())()
+	stats := &ChatActivityStats{TopMembers: []ChatMemberActivity{}}
+	err := r.pool.QueryRow(ctx,
+		`SELECT COUNT(*),
+		        COUNT(*) FILTER (WHERE created_at >= NOW() - INTERVAL '7 days'),
+		        COUNT(DISTINCT sender_id) FILTER (WHERE created_at >= NOW() - INTERVAL '7 days'),
+		        COUNT(*) FILTER (WHERE content_type = 'image'),
+		        COUNT(*) FILTER (WHERE content_type = 'file'),
+		        COUNT(*) FILTER (WHERE content_type = 'voice')
+		 FROM messages
+		 WHERE chat_id = $1 AND NOT is_deleted AND content_type <> 'system'`, chatID,
+	).Scan(&stats.TotalMessages, &stats.MessagesWeek, &stats.ActiveMembersWeek,
+		&stats.Media.Images, &stats.Media.Files, &stats.Media.Voice)
+	if err != nil {
+		return nil, fmt.Errorf("msgRepo.GetChatStats totals: %w", err)
+	}
+
+	rows, err := r.pool.Query(ctx,
+		`SELECT u.id, u.username, COUNT(*) AS n
+		 FROM messages m
+		 JOIN users u ON u.id = m.sender_id
+		 WHERE m.chat_id = $1 AND NOT m.is_deleted AND m.content_type <> 'system'
+		   AND m.created_at >= NOW() - INTERVAL '7 days'
+		 GROUP BY u.id, u.username
+		 ORDER BY n DESC, u.username
+		 LIMIT $2`, chatID, topN,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("msgRepo.GetChatStats top: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a ChatMemberActivity
+		if err := rows.Scan(&a.UserID, &a.Username, &a.Messages); err != nil {
+			return nil, fmt.Errorf("msgRepo.GetChatStats top scan: %w", err)
+		}
+		stats.TopMembers = append(stats.TopMembers, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("msgRepo.GetChatStats top: %w", err)
+	}
+	return stats, nil
+}
+
+// SearchFilter — необязательные фильтры поиска сообщений. Пустые поля не участвуют в запросе.
+type SearchFilter struct {
+	ChatID      string
+	SenderID    string
+	ContentType model.ContentType
+	From        *time.Time // created_at >= From
+	To          *time.Time // created_at < To
+}
+
+// IsEmpty reports whether no filter is set.
+func (f SearchFilter) IsEmpty() bool {
+	return f.ChatID == "" && f.SenderID == "" && f.ContentType == "" && f.From == nil && f.To == nil
+}
+
+// SearchMessages searches messages in a user's chats using ILIKE. Empty query matches any content;
+// filters from f are added as parameterized conditions.
+func (r *MessageRepository) SearchMessages(ctx context.Context, userID, query string, limit, offset int, f SearchFilter) ([]model.Message, error) {
 	defer logger.DeferLogDuration("msg.SearchMessages", time.Now())()
 	sql := `SELECT m.id, m.chat_id, m.sender_id, m.content, m.content_type, m.file_url, m.file_name, m.file_size, m.status,
-		        m.reply_to_id, m.edited_at, m.is_deleted, m.created_at,
-		        u.id, u.username, u.avatar_url, u.is_online, u.last_seen_at
+		        m.reply_to_id, m.edited_at, m.is_deleted, m.created_at, m.content_encrypted,
+		        u.id, u.username, u.avatar_url, ` + uOnlineSQL + `, ` + uLastSeenSQL + `
 		 FROM messages m
 		 JOIN users u ON u.id = m.sender_id
 		 JOIN chat_members cm ON cm.chat_id = m.chat_id AND cm.user_id = $1
-		 WHERE m.is_deleted = false AND m.content ILIKE '%' || $2 || '%'`
-	args := []interface{}{userID, query}
-	if chatID != "" {
-		sql += ` AND m.chat_id = $3`
-		args = append(args, chatID)
+		 WHERE m.is_deleted = false
+		   AND NOT EXISTS (SELECT 1 FROM hidden_messages hm WHERE hm.message_id = m.id AND hm.user_id = $1)
+		   AND (cm.cleared_before IS NULL OR m.created_at > cm.cleared_before)`
+	args := []interface{}{userID}
+	where := func(cond string, v interface{}) {
+		args = append(args, v)
+		sql += fmt.Sprintf(cond, len(args))
+	}
+	if query != "" {
+		// Зашифрованное содержимое (чувствительные чаты) по тексту не ищется.
+		where(` AND m.content_encrypted = false AND m.content ILIKE '%%' || $%d || '%%'`, query)
 	}
-	args = append(args, limit)
-	sql += ` ORDER BY m.created_at DESC LIMIT $` + fmt.Sprintf("%d", len(args))
+	if f.ChatID != "" {
+		where(` AND m.chat_id = $%d`, f.ChatID)
+	}
+	if f.SenderID != "" {
+		where(` AND m.sender_id = $%d`, f.SenderID)
+	}
+	if f.ContentType != "" {
+		where(` AND m.content_type = $%d`, f.ContentType)
+	}
+	if f.From != nil {
+		where(` AND m.created_at >= $%d`, *f.From)
+	}
+	if f.To != nil {
+		where(` AND m.created_at < $%d`, *f.To)
+	}
+	args = append(args, limit, offset)
+	sql += fmt.Sprintf(` ORDER BY m.created_at DESC LIMIT $%d OFFSET $%d`, len(args)-1, len(args))
 
 	rows, err := r.pool.Query(ctx, sql, args...)
 	if err != nil {
@@ -245,17 +1225,23 @@ func (r *MessageRepository) SearchMessages(ctx context.Context, userID, query st
 	msgs := make([]model.Message, 0, limit)
 	for rows.Next() {
 		var m model.Message
+		var encrypted bool
 		sender := &model.UserPublic{}
 		if err := rows.Scan(&m.ID, &m.ChatID, &m.SenderID, &m.Content, &m.ContentType, &m.FileURL, &m.FileName, &m.FileSize, &m.Status,
-			&m.ReplyToID, &m.EditedAt, &m.IsDeleted, &m.CreatedAt,
+			&m.ReplyToID, &m.EditedAt, &m.IsDeleted, &m.CreatedAt, &encrypted,
 			&sender.ID, &sender.Username, &sender.AvatarURL, &sender.IsOnline, &sender.LastSeenAt); err != nil {
 			return nil, fmt.Errorf("msgRepo.SearchMessages scan: %w", err)
 		}
 		m.Sender = sender
+		r.decryptContent(&m, encrypted)
 		msgs = append(msgs, m)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("msgRepo.SearchMessages rows: %w", err)
 	}
+	rows.Close()
+	if err := r.loadDetails(ctx, msgs); err != nil {
+		return nil, fmt.Errorf("msgRepo.SearchMessages: %w", err)
+	}
 	return msgs, nil
 }
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestGetLastMessageSkipsDeleted(t *testing.T) {
+	pool := testPool(t)
+	repo := NewMessageRepository(pool, nil)
+	ctx := context.Background()
+	firstID, userID := testMessage(t, pool)
+	var chatID string
+	if err := pool.QueryRow(ctx, `SELECT chat_id FROM messages WHERE id = $1`, firstID).Scan(&chatID); err != nil {
+		t.Fatalf("chat id: %v", err)
+	}
+	// Более позднее сообщение, удалённое отправителем, не должно попадать в превью.
+	if _, err := pool.Exec(ctx,
+		`INSERT INTO messages (id, chat_id, sender_id, content, is_deleted, created_at)
+		 VALUES ($1, $2, $3, '', true, NOW() + INTERVAL '1 second')`,
+		uuid.NewString(), chatID, userID,
+	); err != nil {
+		t.Fatalf("insert deleted message: %v", err)
+	}
+
+	last, err := repo.GetLastMessage(ctx, chatID, userID)
+	if err != nil {
+		t.Fatalf("GetLastMessage: %v", err)
+	}
+	if last == nil || last.ID != firstID {
+		t.Fatalf("last message = %+v, want %s", last, firstID)
+	}
+
+	// Все сообщения удалены — превью нет.
+	if _, err := pool.Exec(ctx, `UPDATE messages SET is_deleted = true WHERE id = $1`, firstID); err != nil {
+		t.Fatalf("delete message: %v", err)
+	}
+	last, err = repo.GetLastMessage(ctx, chatID, userID)
+	if err != nil {
+		t.Fatalf("GetLastMessage: %v", err)
+	}
+	if last != nil {
+		t.Fatalf("last message = %s, want nil", last.ID)
+	}
+}
+
+func TestCanReplyToRejectsOtherChat(t *testing.T) {
+	pool := testPool(t)
+	repo := NewMessageRepository(pool, nil)
+	ctx := context.Background()
+	messageID, userID := testMessage(t, pool)
+	otherMessageID, _ := testMessage(t, pool)
+	var chatID string
+	if err := pool.QueryRow(ctx, `SELECT chat_id FROM messages WHERE id = $1`, messageID).Scan(&chatID); err != nil {
+		t.Fatalf("chat id: %v", err)
+	}
+
+	if ok, err := repo.CanReplyTo(ctx, messageID, chatID, userID); err != nil || !ok {
+		t.Fatalf("reply in same chat = %v (%v), want true", ok, err)
+	}
+	// Сообщение из чата, где пользователя нет: ответ с его превью недопустим.
+	if ok, err := repo.CanReplyTo(ctx, otherMessageID, chatID, userID); err != nil || ok {
+		t.Fatalf("cross-chat reply = %v (%v), want false", ok, err)
+	}
+	// Скрытое у себя сообщение тоже нельзя цитировать.
+	if _, err := pool.Exec(ctx, `INSERT INTO hidden_messages (user_id, message_id) VALUES ($1, $2)`, userID, messageID); err != nil {
+		t.Fatalf("hide message: %v", err)
+	}
+	if ok, err := repo.CanReplyTo(ctx, messageID, chatID, userID); err != nil || ok {
+		t.Fatalf("reply to hidden message = %v (%v), want false", ok, err)
+	}
+}
@@ -12,10 +12,12 @@ import (
 
 type PinnedRepository struct {
 	pool *pgxpool.Pool
+	// msgRepo расшифровывает содержимое закреплённых сообщений чувствительных чатов.
+	msgRepo *MessageRepository
 }
 
-func NewPinnedRepository(pool *pgxpool.Pool) *PinnedRepository {
-	return &PinnedRepository{pool: pool}
+func NewPinnedRepository(pool *pgxpool.Pool, msgRepo *MessageRepository) *PinnedRepository {
+	return &PinnedRepository{pool: pool, msgRepo: msgRepo}
 }
 
 func (r *PinnedRepository) Pin(ctx context.Context, chatID, messageID, pinnedBy string) error {
@@ -43,17 +45,19 @@ func (r *PinnedRepository) Unpin(ctx context.Context, chatID, messageID string)
 	return nil
 }
 
-func (r *PinnedRepository) GetPinned(ctx context.Context, chatID string) ([]model.PinnedMessage, error) {
+// GetPinned возвращает закреплённые сообщения чата, последние закреплённые первыми.
+func (r *PinnedRepository) GetPinned(ctx context.Context, chatID string, limit, offset int) ([]model.PinnedMessage, error) {
 	defer logger.DeferLogDuration("pinned.GetPinned", time.Now())()
 	rows, err := r.pool.Query(ctx,
 		`SELECT pm.chat_id, pm.message_id, pm.pinned_by, pm.pinned_at,
-		        m.id, m.sender_id, m.content, m.content_type, m.created_at,
+		        m.id, m.sender_id, m.content, m.content_type, m.created_at, m.content_encrypted,
 		        u.id, u.username, u.avatar_url
 		 FROM pinned_messages pm
 		 JOIN messages m ON m.id = pm.message_id
 		 JOIN users u ON u.id = m.sender_id
 		 WHERE pm.chat_id = $1
-		 ORDER BY pm.pinned_at DESC`, chatID,
+		 ORDER BY pm.pinned_at DESC, pm.message_id
+		 LIMIT $2 OFFSET $3`, chatID, limit, offset,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("pinnedRepo.GetPinned query: %w", err)
@@ -65,12 +69,14 @@ func (r *PinnedRepository) GetPinned(ctx context.Context, chatID string) ([]mode
 		var p model.PinnedMessage
 		msg := &model.Message{}
 		sender := &model.UserPublic{}
+		var encrypted bool
 		if err := rows.Scan(&p.ChatID, &p.MessageID, &p.PinnedBy, &p.PinnedAt,
-			&msg.ID, &msg.SenderID, &msg.Content, &msg.ContentType, &msg.CreatedAt,
+			&msg.ID, &msg.SenderID, &msg.Content, &msg.ContentType, &msg.CreatedAt, &encrypted,
 			&sender.ID, &sender.Username, &sender.AvatarURL); err != nil {
 			return nil, fmt.Errorf("pinnedRepo.GetPinned scan: %w", err)
 		}
 		msg.Sender = sender
+		r.msgRepo.decryptContent(msg, encrypted)
 		p.Message = msg
 		pins = append(pins, p)
 	}
@@ -80,6 +86,18 @@ func (r *PinnedRepository) GetPinned(ctx context.Context, chatID string) ([]mode
 	return pins, nil
 }
 
+// Count — сколько сообщений закреплено в чате.
+func (r *PinnedRepository) Count(ctx context.Context, chatID string) (int, error) {
+	defer logger.DeferLogDuration("pinned.Count", time.Now())()
+	var n int
+	if err := r.pool.QueryRow(ctx,
+		`SELECT COUNT(*) FROM pinned_messages pm JOIN messages m ON m.id = pm.message_id WHERE pm.chat_id = $1`, chatID,
+	).Scan(&n); err != nil {
+		return 0, fmt.Errorf("pinnedRepo.Count: %w", err)
+	}
+	return n, nil
+}
+
 func (r *PinnedRepository) IsPinned(ctx context.Context, chatID, messageID string) (bool, error) {
 	defer logger.DeferLogDuration("pinned.IsPinned", time.Now())()
 	var exists bool
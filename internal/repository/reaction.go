@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -31,6 +32,54 @@ func (r *ReactionRepository) Add(ctx context.Context, messageID, userID, emoji s
 	return nil
 }
 
+// ErrReactionLimit — у пользователя уже максимум разных реакций на это сообщение.
+var ErrReactionLimit = errors.New("reaction limit reached")
+
+// AddLimited ставит реакцию, если у пользователя на этом сообщении меньше limit разных реакций (limit <= 0 — без
+// ограничения). Повторная постановка уже стоящей реакции не считается превышением. Проверка и вставка
+// выполняются под advisory-блокировкой пары (сообщение, пользователь), поэтому параллельные запросы лимит не обойдут.
+func (r *ReactionRepository) AddLimited(ctx context.Context, messageID, userID, emoji string, limit int) error {
+	defer logger.DeferLogDuration("reaction.AddLimited", time.Now())()
+	if limit <= 0 {
+		return r.Add(ctx, messageID, userID, emoji)
+	}
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("reactionRepo.AddLimited begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1 || ':' || $2))`, messageID, userID); err != nil {
+		return fmt.Errorf("reactionRepo.AddLimited lock: %w", err)
+	}
+	tag, err := tx.Exec(ctx,
+		`INSERT INTO message_reactions (message_id, user_id, emoji)
+		 SELECT $1, $2, $3
+		 WHERE EXISTS (SELECT 1 FROM message_reactions WHERE message_id = $1 AND user_id = $2 AND emoji = $3)
+		    OR (SELECT COUNT(*) FROM message_reactions WHERE message_id = $1 AND user_id = $2) < $4
+		 ON CONFLICT DO NOTHING`,
+		messageID, userID, emoji, limit,
+	)
+	if err != nil {
+		return fmt.Errorf("reactionRepo.AddLimited: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		var exists bool
+		if err := tx.QueryRow(ctx,
+			`SELECT EXISTS(SELECT 1 FROM message_reactions WHERE message_id = $1 AND user_id = $2 AND emoji = $3)`,
+			messageID, userID, emoji,
+		).Scan(&exists); err != nil {
+			return fmt.Errorf("reactionRepo.AddLimited exists: %w", err)
+		}
+		if !exists {
+			return ErrReactionLimit
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("reactionRepo.AddLimited commit: %w", err)
+	}
+	return nil
+}
+
 func (r *ReactionRepository) Remove(ctx context.Context, messageID, userID, emoji string) error {
 	defer logger.DeferLogDuration("reaction.Remove", time.Now())()
 	_, err := r.pool.Exec(ctx,
@@ -99,3 +148,69 @@ func (r *ReactionRepository) GetGroupedByMessage(ctx context.Context, messageID
 	}
 	return groups, nil
 }
+
+// GetByMessages возвращает реакции сразу для нескольких сообщений одним запросом: message_id → реакции
+// в порядке постановки. Сообщений без реакций в результате нет.
+func (r *ReactionRepository) GetByMessages(ctx context.Context, ids []string) (map[string][]model.Reaction, error) {
+	defer logger.DeferLogDuration("reaction.GetByMessages", time.Now())()
+	result := make(map[string][]model.Reaction)
+	if len(ids) == 0 {
+		return result, nil
+	}
+	rows, err := r.pool.Query(ctx,
+		`SELECT mr.message_id, mr.user_id, mr.emoji, u.username, mr.created_at
+		 FROM message_reactions mr
+		 JOIN users u ON u.id = mr.user_id
+		 WHERE mr.message_id = ANY($1)
+		 ORDER BY mr.message_id, mr.created_at`, ids,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("reactionRepo.GetByMessages query: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var rc model.Reaction
+		if err := rows.Scan(&rc.MessageID, &rc.UserID, &rc.Emoji, &rc.Username, &rc.CreatedAt); err != nil {
+			return nil, fmt.Errorf("reactionRepo.GetByMessages scan: %w", err)
+		}
+		result[rc.MessageID] = append(result[rc.MessageID], rc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reactionRepo.GetByMessages rows: %w", err)
+	}
+	return result, nil
+}
+
+// GetGroupedByMessages — то же, что GetGroupedByMessage, для нескольких сообщений чата chatID одним
+// запросом: message_id → группы. Сообщения других чатов и сообщения без реакций в результат не попадают.
+func (r *ReactionRepository) GetGroupedByMessages(ctx context.Context, chatID string, ids []string) (map[string][]model.ReactionGroup, error) {
+	defer logger.DeferLogDuration("reaction.GetGroupedByMessages", time.Now())()
+	result := make(map[string][]model.ReactionGroup)
+	if len(ids) == 0 {
+		return result, nil
+	}
+	rows, err := r.pool.Query(ctx,
+		`SELECT mr.message_id, mr.emoji, COUNT(*), array_agg(mr.user_id::text ORDER BY mr.created_at)
+		 FROM message_reactions mr
+		 JOIN messages m ON m.id = mr.message_id AND m.chat_id = $1
+		 WHERE mr.message_id = ANY($2)
+		 GROUP BY mr.message_id, mr.emoji
+		 ORDER BY mr.message_id, MIN(mr.created_at)`, chatID, ids,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("reactionRepo.GetGroupedByMessages query: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var msgID string
+		var g model.ReactionGroup
+		if err := rows.Scan(&msgID, &g.Emoji, &g.Count, &g.Users); err != nil {
+			return nil, fmt.Errorf("reactionRepo.GetGroupedByMessages scan: %w", err)
+		}
+		result[msgID] = append(result[msgID], g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reactionRepo.GetGroupedByMessages rows: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// testPool подключается к БД из TEST_DATABASE_URL (с применёнными миграциями); без неё тест пропускается.
+func testPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set (or run with TEST_EMBEDDED_POSTGRES=1)")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		t.Fatalf("ping: %v", err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+// testMessage создаёт пользователя, групповой чат и сообщение в нём; всё удаляется по завершении теста.
+func testMessage(t *testing.T, pool *pgxpool.Pool) (messageID, userID string) {
+	t.Helper()
+	ctx := context.Background()
+	userID, chatID, messageID := uuid.NewString(), uuid.NewString(), uuid.NewString()
+	if _, err := pool.Exec(ctx,
+		`INSERT INTO users (id, username, email, password_hash) VALUES ($1, $2, $3, '')`,
+		userID, "t_"+userID[:8], userID+"@test.local",
+	); err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+	t.Cleanup(func() { pool.Exec(context.Background(), `DELETE FROM users WHERE id = $1`, userID) })
+	if _, err := pool.Exec(ctx, `INSERT INTO chats (id, chat_type, created_by) VALUES ($1, 'group', $2)`, chatID, userID); err != nil {
+		t.Fatalf("insert chat: %v", err)
+	}
+	t.Cleanup(func() { pool.Exec(context.Background(), `DELETE FROM chats WHERE id = $1`, chatID) })
+	if _, err := pool.Exec(ctx, `INSERT INTO messages (id, chat_id, sender_id, content) VALUES ($1, $2, $3, 'hi')`, messageID, chatID, userID); err != nil {
+		t.Fatalf("insert message: %v", err)
+	}
+	return messageID, userID
+}
+
+func countReactions(t *testing.T, pool *pgxpool.Pool, messageID, userID string) int {
+	t.Helper()
+	var n int
+	if err := pool.QueryRow(context.Background(),
+		`SELECT COUNT(*) FROM message_reactions WHERE message_id = $1 AND user_id = $2`, messageID, userID,
+	).Scan(&n); err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	return n
+}
+
+func TestReactionAddLimitedBoundary(t *testing.T) {
+	pool := testPool(t)
+	repo := NewReactionRepository(pool)
+	ctx := context.Background()
+	const limit = 3
+	messageID, userID := testMessage(t, pool)
+
+	emojis := []string{"👍", "❤️", "😂", "🔥"}
+	// N-1 и N: помещаются в лимит.
+	for i := 0; i < limit; i++ {
+		if err := repo.AddLimited(ctx, messageID, userID, emojis[i], limit); err != nil {
+			t.Fatalf("reaction %d of %d: %v", i+1, limit, err)
+		}
+	}
+	// N+1: отклоняется.
+	if err := repo.AddLimited(ctx, messageID, userID, emojis[limit], limit); !errors.Is(err, ErrReactionLimit) {
+		t.Fatalf("reaction %d: got %v, want ErrReactionLimit", limit+1, err)
+	}
+	// Повтор уже стоящей реакции на лимите — не ошибка и не новая строка.
+	if err := repo.AddLimited(ctx, messageID, userID, emojis[0], limit); err != nil {
+		t.Fatalf("re-adding existing reaction at cap: %v", err)
+	}
+	if n := countReactions(t, pool, messageID, userID); n != limit {
+		t.Fatalf("reactions = %d, want %d", n, limit)
+	}
+}
+
+func TestReactionAddLimitedConcurrent(t *testing.T) {
+	pool := testPool(t)
+	repo := NewReactionRepository(pool)
+	const limit = 3
+	messageID, userID := testMessage(t, pool)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := repo.AddLimited(context.Background(), messageID, userID, fmt.Sprintf("e%d", i), limit)
+			if err != nil && !errors.Is(err, ErrReactionLimit) {
+				t.Errorf("reaction %d: %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := countReactions(t, pool, messageID, userID); n != limit {
+		t.Fatalf("reactions = %d, want %d", n, limit)
+	}
+}
@@ -137,6 +137,79 @@ func (r *SessionRepository) RevokeByUserID(ctx context.Context, userID string) (
 	return ids, nil
 }
 
+// RevokeOthers отзывает все сессии пользователя, кроме keepSessionID. Возвращает id отозванных сессий для очистки Redis.
+func (r *SessionRepository) RevokeOthers(ctx context.Context, userID, keepSessionID string) ([]string, error) {
+	defer logger.DeferLogDuration("session.RevokeOthers", time.Now())()
+	rows, err := r.pool.Query(ctx,
+		`UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL RETURNING id`,
+		userID, keepSessionID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("sessionRepo.RevokeOthers: %w", err)
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("sessionRepo.RevokeOthers scan: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sessionRepo.RevokeOthers: %w", err)
+	}
+	return ids, nil
+}
+
+// CountActive возвращает число неотозванных сессий пользователя, не считая устройства excludeDeviceID
+// (его сессия при входе заменяется, а не добавляется).
+func (r *SessionRepository) CountActive(ctx context.Context, userID, excludeDeviceID string) (int, error) {
+	defer logger.DeferLogDuration("session.CountActive", time.Now())()
+	var n int
+	err := r.pool.QueryRow(ctx,
+		`SELECT COUNT(*) FROM sessions WHERE user_id = $1 AND device_id <> $2 AND revoked_at IS NULL`,
+		userID, excludeDeviceID,
+	).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("sessionRepo.CountActive: %w", err)
+	}
+	return n, nil
+}
+
+// RevokeOldest отзывает неотозванные сессии пользователя (кроме устройства excludeDeviceID) сверх keep самых
+// недавно активных (по last_seen_at). Возвращает id отозванных сессий для очистки Redis.
+func (r *SessionRepository) RevokeOldest(ctx context.Context, userID, excludeDeviceID string, keep int) ([]string, error) {
+	defer logger.DeferLogDuration("session.RevokeOldest", time.Now())()
+	rows, err := r.pool.Query(ctx,
+		`UPDATE sessions SET revoked_at = NOW()
+		 WHERE id IN (
+		   SELECT id FROM sessions
+		   WHERE user_id = $1 AND device_id <> $2 AND revoked_at IS NULL
+		   ORDER BY last_seen_at DESC NULLS LAST, created_at DESC
+		   OFFSET $3
+		 )
+		 RETURNING id`,
+		userID, excludeDeviceID, keep,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("sessionRepo.RevokeOldest: %w", err)
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("sessionRepo.RevokeOldest scan: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sessionRepo.RevokeOldest: %w", err)
+	}
+	return ids, nil
+}
+
 func (r *SessionRepository) Delete(ctx context.Context, sessionID string) error {
 	defer logger.DeferLogDuration("session.Delete", time.Now())()
 	_, err := r.pool.Exec(ctx, `DELETE FROM sessions WHERE id = $1`, sessionID)
@@ -167,6 +240,16 @@ func (r *SessionRepository) DeleteByUserIDAndSessionID(ctx context.Context, user
 	return tag.RowsAffected() > 0, nil
 }
 
+// UpdateSecretHash заменяет хеш секрета активной сессии пользователя (ротация секрета).
+func (r *SessionRepository) UpdateSecretHash(ctx context.Context, userID, sessionID, secretHash string) (bool, error) {
+	defer logger.DeferLogDuration("session.UpdateSecretHash", time.Now())()
+	tag, err := r.pool.Exec(ctx, `UPDATE sessions SET secret_hash = $1 WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL`, secretHash, sessionID, userID)
+	if err != nil {
+		return false, fmt.Errorf("sessionRepo.UpdateSecretHash: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
 // SetSessionSecret сохраняет session_secret для сессии (используется в -dev для сохранения сессий после перезапуска).
 func (r *SessionRepository) SetSessionSecret(ctx context.Context, sessionID, secret string) error {
 	defer logger.DeferLogDuration("session.SetSessionSecret", time.Now())()
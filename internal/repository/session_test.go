@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/messenger/internal/model"
+)
+
+func TestRevokeOldestKeepsMostRecent(t *testing.T) {
+	pool := testPool(t)
+	repo := NewSessionRepository(pool)
+	ctx := context.Background()
+	userID := testUser(t, pool)
+
+	const limit = 3
+	base := time.Now().UTC().Add(-time.Hour)
+	ids := make([]string, limit+2)
+	for i := range ids {
+		ids[i] = uuid.NewString()
+		s := &model.Session{
+			ID: ids[i], UserID: userID, DeviceID: fmt.Sprintf("device-%d", i), SecretHash: "x",
+			LastSeenAt: base.Add(time.Duration(i) * time.Minute), CreatedAt: base,
+		}
+		if err := repo.Create(ctx, s); err != nil {
+			t.Fatalf("create session %d: %v", i, err)
+		}
+	}
+
+	// Вход с нового устройства: остаются limit-1 самых свежих, чтобы новая сессия уложилась в лимит.
+	revoked, err := repo.RevokeOldest(ctx, userID, "device-new", limit-1)
+	if err != nil {
+		t.Fatalf("RevokeOldest: %v", err)
+	}
+	if len(revoked) != len(ids)-(limit-1) {
+		t.Fatalf("revoked %d sessions, want %d", len(revoked), len(ids)-(limit-1))
+	}
+	for _, id := range ids[:len(ids)-(limit-1)] {
+		if _, err := repo.GetByID(ctx, id); err == nil {
+			t.Fatalf("old session %s still active", id)
+		}
+	}
+	n, err := repo.CountActive(ctx, userID, "device-new")
+	if err != nil || n != limit-1 {
+		t.Fatalf("active = %d (%v), want %d", n, err, limit-1)
+	}
+
+	// Повторный вход с уже известного устройства его сессию не отзывает.
+	revoked, err = repo.RevokeOldest(ctx, userID, fmt.Sprintf("device-%d", len(ids)-1), 0)
+	if err != nil {
+		t.Fatalf("RevokeOldest same device: %v", err)
+	}
+	if len(revoked) != limit-2 {
+		t.Fatalf("revoked %d sessions, want %d", len(revoked), limit-2)
+	}
+	if _, err := repo.GetByID(ctx, ids[len(ids)-1]); err != nil {
+		t.Fatalf("current device session revoked: %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/messenger/internal/logger"
+)
+
+// SlowQueryTracer логирует SQL запросов дольше threshold. Значения аргументов не пишутся (в них
+// тексты сообщений, email и т.п.) — только их типы и длины. Подключается через pgx.ConnConfig.Tracer.
+type SlowQueryTracer struct {
+	threshold time.Duration
+}
+
+func NewSlowQueryTracer(threshold time.Duration) *SlowQueryTracer {
+	return &SlowQueryTracer{threshold: threshold}
+}
+
+type slowQueryKey struct{}
+
+type slowQueryStart struct {
+	at   time.Time
+	sql  string
+	args []any
+}
+
+func (t *SlowQueryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, slowQueryKey{}, slowQueryStart{at: time.Now(), sql: data.SQL, args: data.Args})
+}
+
+func (t *SlowQueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	start, ok := ctx.Value(slowQueryKey{}).(slowQueryStart)
+	if !ok {
+		return
+	}
+	elapsed := time.Since(start.at)
+	if elapsed < t.threshold {
+		return
+	}
+	status := "ok"
+	if data.Err != nil {
+		status = "error"
+	}
+	logger.Infof("slow query duration_ms=%d status=%s sql=%q args=[%s]",
+		elapsed.Milliseconds(), status, strings.Join(strings.Fields(start.sql), " "), redactArgs(start.args))
+}
+
+// redactArgs описывает аргументы без значений: "$1=string(36) $2=int".
+func redactArgs(args []any) string {
+	parts := make([]string, len(args))
+	for i, a := range args {
+		var desc string
+		switch v := a.(type) {
+		case nil:
+			desc = "null"
+		case string:
+			desc = fmt.Sprintf("string(%d)", len(v))
+		case []byte:
+			desc = fmt.Sprintf("bytes(%d)", len(v))
+		case []string:
+			desc = fmt.Sprintf("[]string(%d)", len(v))
+		default:
+			desc = fmt.Sprintf("%T", v)
+		}
+		parts[i] = fmt.Sprintf("$%d=%s", i+1, desc)
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// querier — общее у *pgxpool.Pool и pgx.Tx: методы репозиториев выполняют запросы через conn(ctx, r.pool)
+// и так работают как отдельно, так и внутри WithTx.
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+type txKey struct{}
+
+// WithTx выполняет fn в транзакции: методы репозиториев, вызванные с переданным в fn контекстом и
+// выполняющие запросы через conn(ctx, r.pool), пишут в неё. Ошибка fn — откат,
+// иначе commit. Рассылки по WebSocket делаются после WithTx, чтобы клиенты не увидели откаченные данные.
+// Вложенный вызов выполняется в уже открытой транзакции.
+func WithTx(ctx context.Context, pool *pgxpool.Pool, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return fn(ctx)
+	}
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("withTx begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("withTx commit: %w", err)
+	}
+	return nil
+}
+
+// conn — транзакция из контекста WithTx или пул.
+func conn(ctx context.Context, pool *pgxpool.Pool) querier {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return tx
+	}
+	return pool
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/messenger/internal/model"
+)
+
+func TestWithTxCommitAndRollback(t *testing.T) {
+	pool := testPool(t)
+	repo := NewChatRepository(pool)
+	ctx := context.Background()
+	ownerID := testUser(t, pool)
+	newChat := func() *model.Chat {
+		c := &model.Chat{ID: uuid.NewString(), ChatType: model.ChatTypeGroup, Name: "tx", CreatedBy: ownerID, CreatedAt: time.Now().UTC()}
+		t.Cleanup(func() { pool.Exec(context.Background(), `DELETE FROM chats WHERE id = $1`, c.ID) })
+		return c
+	}
+
+	committed := newChat()
+	err := repo.WithTx(ctx, func(ctx context.Context) error {
+		if err := repo.Create(ctx, committed); err != nil {
+			return err
+		}
+		// Вложенный WithTx выполняется в той же транзакции.
+		return repo.WithTx(ctx, func(ctx context.Context) error {
+			return repo.AddMember(ctx, &model.ChatMember{ChatID: committed.ID, UserID: ownerID, Role: "admin", JoinedAt: committed.CreatedAt})
+		})
+	})
+	if err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+	if ok, err := repo.IsMember(ctx, committed.ID, ownerID); err != nil || !ok {
+		t.Fatalf("committed member: %v, %v", ok, err)
+	}
+
+	rolledBack := newChat()
+	errBoom := errors.New("boom")
+	err = repo.WithTx(ctx, func(ctx context.Context) error {
+		if err := repo.Create(ctx, rolledBack); err != nil {
+			return err
+		}
+		return errBoom
+	})
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("WithTx error = %v, want %v", err, errBoom)
+	}
+	if _, err := repo.GetByID(ctx, rolledBack.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("rolled back chat: err = %v, want ErrNotFound", err)
+	}
+}
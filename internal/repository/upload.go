@@ -0,0 +1,244 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/messenger/internal/logger"
+	"github.com/messenger/internal/model"
+)
+
+// ErrQuotaExceeded — файл не помещается в квоту пользователя.
+var ErrQuotaExceeded = errors.New("upload quota exceeded")
+
+// UploadRepository ведёт учёт загруженных файлов и счётчик занятого места по пользователям.
+type UploadRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewUploadRepository(pool *pgxpool.Pool) *UploadRepository {
+	return &UploadRepository{pool: pool}
+}
+
+// Usage возвращает занятое пользователем место (QuotaBytes заполняет вызывающий).
+func (r *UploadRepository) Usage(ctx context.Context, userID string) (model.StorageUsage, error) {
+	defer logger.DeferLogDuration("upload.Usage", time.Now())()
+	var u model.StorageUsage
+	err := r.pool.QueryRow(ctx,
+		`SELECT used_bytes, files FROM user_upload_usage WHERE user_id = $1`, userID,
+	).Scan(&u.UsedBytes, &u.Files)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return u, fmt.Errorf("uploadRepo.Usage: %w", err)
+	}
+	return u, nil
+}
+
+// Record учитывает загруженный файл со сведениями meta (пустой ScanStatus — clean). Если quota > 0 и файл
+// в неё не помещается — ErrQuotaExceeded (проверка и увеличение счётчика атомарны, параллельные загрузки
+// квоту не превысят).
+func (r *UploadRepository) Record(ctx context.Context, userID, fileName string, size, quota int64, meta model.UploadMeta) error {
+	defer logger.DeferLogDuration("upload.Record", time.Now())()
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("uploadRepo.Record begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	tag, err := tx.Exec(ctx,
+		`INSERT INTO user_upload_usage (user_id, used_bytes, files) VALUES ($1, $2, 1)
+		 ON CONFLICT (user_id) DO UPDATE
+		   SET used_bytes = user_upload_usage.used_bytes + EXCLUDED.used_bytes,
+		       files = user_upload_usage.files + 1, updated_at = NOW()
+		   WHERE $3 <= 0 OR user_upload_usage.used_bytes + EXCLUDED.used_bytes <= $3`,
+		userID, size, quota,
+	)
+	if err != nil {
+		return fmt.Errorf("uploadRepo.Record usage: %w", err)
+	}
+	if tag.RowsAffected() == 0 || (quota > 0 && size > quota) {
+		return ErrQuotaExceeded
+	}
+	if _, err := tx.Exec(ctx,
+		`INSERT INTO user_uploads (file_name, user_id, size_bytes, scan_status, width, height, blurhash)
+		 VALUES ($1, $2, $3, COALESCE(NULLIF($4, ''), 'clean'), $5, $6, $7)`,
+		fileName, userID, size, meta.ScanStatus, meta.Width, meta.Height, meta.BlurHash,
+	); err != nil {
+		return fmt.Errorf("uploadRepo.Record file: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("uploadRepo.Record commit: %w", err)
+	}
+	return nil
+}
+
+// Delete снимает файл пользователя с учёта и уменьшает счётчик. ErrNotFound — файла нет или он чужой.
+func (r *UploadRepository) Delete(ctx context.Context, userID, fileName string) error {
+	defer logger.DeferLogDuration("upload.Delete", time.Now())()
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("uploadRepo.Delete begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	var size int64
+	err = tx.QueryRow(ctx,
+		`DELETE FROM user_uploads WHERE file_name = $1 AND user_id = $2 RETURNING size_bytes`,
+		fileName, userID,
+	).Scan(&size)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("uploadRepo.Delete: %w", err)
+	}
+	if _, err := tx.Exec(ctx,
+		`UPDATE user_upload_usage SET used_bytes = GREATEST(used_bytes - $2, 0), files = GREATEST(files - 1, 0), updated_at = NOW()
+		 WHERE user_id = $1`,
+		userID, size,
+	); err != nil {
+		return fmt.Errorf("uploadRepo.Delete usage: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("uploadRepo.Delete commit: %w", err)
+	}
+	return nil
+}
+
+// IsReferenced сообщает, ссылается ли на файл хотя бы одно неудалённое сообщение (в том числе вложение альбома).
+func (r *UploadRepository) IsReferenced(ctx context.Context, fileName string) (bool, error) {
+	defer logger.DeferLogDuration("upload.IsReferenced", time.Now())()
+	fileURL := "/api/files/" + fileName
+	var used bool
+	err := r.pool.QueryRow(ctx,
+		`SELECT EXISTS(SELECT 1 FROM messages WHERE (file_url = $1 OR file_url LIKE $1 || '?%') AND is_deleted = false)
+		     OR EXISTS(SELECT 1 FROM message_attachments WHERE file_url = $1 OR file_url LIKE $1 || '?%')`,
+		fileURL,
+	).Scan(&used)
+	if err != nil {
+		return false, fmt.Errorf("uploadRepo.IsReferenced: %w", err)
+	}
+	return used, nil
+}
+
+// CanAccess сообщает, может ли пользователь получить файл: он его загрузил, файл вложен в неудалённое
+// сообщение чата, где пользователь состоит, или это аватар пользователя либо аватар его чата.
+func (r *UploadRepository) CanAccess(ctx context.Context, userID, fileName string) (bool, error) {
+	defer logger.DeferLogDuration("upload.CanAccess", time.Now())()
+	fileURL := "/api/files/" + fileName
+	var ok bool
+	err := r.pool.QueryRow(ctx,
+		`SELECT EXISTS(SELECT 1 FROM user_uploads WHERE file_name = $2 AND user_id = $3)
+		     OR EXISTS(SELECT 1 FROM messages m
+		               JOIN chat_members cm ON cm.chat_id = m.chat_id AND cm.user_id = $3
+		               WHERE (m.file_url = $1 OR m.file_url LIKE $1 || '?%') AND m.is_deleted = false)
+		     OR EXISTS(SELECT 1 FROM message_attachments a
+		               JOIN messages m ON m.id = a.message_id AND m.is_deleted = false
+		               JOIN chat_members cm ON cm.chat_id = m.chat_id AND cm.user_id = $3
+		               WHERE a.file_url = $1 OR a.file_url LIKE $1 || '?%')
+		     OR EXISTS(SELECT 1 FROM users WHERE avatar_url = $1 OR avatar_url LIKE $1 || '?%')
+		     OR EXISTS(SELECT 1 FROM chats c
+		               JOIN chat_members cm ON cm.chat_id = c.id AND cm.user_id = $3
+		               WHERE c.avatar_url = $1 OR c.avatar_url LIKE $1 || '?%')`,
+		fileURL, fileName, userID,
+	).Scan(&ok)
+	if err != nil {
+		return false, fmt.Errorf("uploadRepo.CanAccess: %w", err)
+	}
+	return ok, nil
+}
+
+// PendingScan — файл, ожидающий проверки антивирусом.
+type PendingScan struct {
+	FileName string
+	UserID   string
+}
+
+// PendingScans возвращает файлы со статусом pending (для повторной проверки при старте API).
+func (r *UploadRepository) PendingScans(ctx context.Context) ([]PendingScan, error) {
+	defer logger.DeferLogDuration("upload.PendingScans", time.Now())()
+	rows, err := r.pool.Query(ctx, `SELECT file_name, user_id FROM user_uploads WHERE scan_status = 'pending'`)
+	if err != nil {
+		return nil, fmt.Errorf("uploadRepo.PendingScans: %w", err)
+	}
+	defer rows.Close()
+	var out []PendingScan
+	for rows.Next() {
+		var p PendingScan
+		if err := rows.Scan(&p.FileName, &p.UserID); err != nil {
+			return nil, fmt.Errorf("uploadRepo.PendingScans scan: %w", err)
+		}
+		out = append(out, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("uploadRepo.PendingScans rows: %w", err)
+	}
+	return out, nil
+}
+
+// SetScanStatus сохраняет результат проверки файла антивирусом.
+func (r *UploadRepository) SetScanStatus(ctx context.Context, fileName, status string) error {
+	defer logger.DeferLogDuration("upload.SetScanStatus", time.Now())()
+	_, err := r.pool.Exec(ctx, `UPDATE user_uploads SET scan_status = $2 WHERE file_name = $1`, fileName, status)
+	if err != nil {
+		return fmt.Errorf("uploadRepo.SetScanStatus: %w", err)
+	}
+	return nil
+}
+
+// ScanStatus возвращает статус проверки файла. Файлы вне учёта (голосовые, загруженные до учёта) — clean.
+func (r *UploadRepository) ScanStatus(ctx context.Context, fileName string) (string, error) {
+	defer logger.DeferLogDuration("upload.ScanStatus", time.Now())()
+	var status string
+	err := r.pool.QueryRow(ctx, `SELECT scan_status FROM user_uploads WHERE file_name = $1`, fileName).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.ScanClean, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("uploadRepo.ScanStatus: %w", err)
+	}
+	return status, nil
+}
+
+// Meta возвращает сведения о файле из учёта; ErrNotFound — файл не учтён.
+func (r *UploadRepository) Meta(ctx context.Context, fileName string) (model.UploadMeta, error) {
+	defer logger.DeferLogDuration("upload.Meta", time.Now())()
+	m := model.UploadMeta{FileName: fileName}
+	err := r.pool.QueryRow(ctx,
+		`SELECT scan_status, width, height, blurhash FROM user_uploads WHERE file_name = $1`, fileName,
+	).Scan(&m.ScanStatus, &m.Width, &m.Height, &m.BlurHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return m, ErrNotFound
+	}
+	if err != nil {
+		return m, fmt.Errorf("uploadRepo.Meta: %w", err)
+	}
+	return m, nil
+}
+
+// ChatIDsReferencing — чаты с неудалёнными сообщениями (или вложениями альбомов), ссылающимися на файл.
+func (r *UploadRepository) ChatIDsReferencing(ctx context.Context, fileName string) ([]string, error) {
+	defer logger.DeferLogDuration("upload.ChatIDsReferencing", time.Now())()
+	fileURL := "/api/files/" + fileName
+	rows, err := r.pool.Query(ctx,
+		`SELECT chat_id FROM messages WHERE (file_url = $1 OR file_url LIKE $1 || '?%') AND is_deleted = false
+		 UNION
+		 SELECT m.chat_id FROM message_attachments a JOIN messages m ON m.id = a.message_id AND m.is_deleted = false
+		 WHERE a.file_url = $1 OR a.file_url LIKE $1 || '?%'`,
+		fileURL,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("uploadRepo.ChatIDsReferencing: %w", err)
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("uploadRepo.ChatIDsReferencing scan: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
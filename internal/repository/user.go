@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/messenger/internal/logger"
 	"github.com/messenger/internal/model"
@@ -14,8 +15,53 @@ import (
 
 var ErrNotFound = errors.New("not found")
 
-// userCols — список колонок для SELECT, включая phone и disabled_at.
-const userCols = `id, username, email, COALESCE(phone,''), password_hash, avatar_url, last_seen_at, is_online, created_at, disabled_at`
+// Ошибки уникальности профиля: email, имя пользователя или телефон уже заняты другим пользователем.
+var (
+	ErrEmailTaken    = errors.New("email already in use")
+	ErrUsernameTaken = errors.New("username already in use")
+	ErrPhoneTaken    = errors.New("phone already in use")
+)
+
+// userConflict переводит нарушение уникального ограничения users в ErrEmailTaken/ErrUsernameTaken/ErrPhoneTaken;
+// для прочих ошибок возвращает nil.
+func userConflict(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != "23505" {
+		return nil
+	}
+	switch pgErr.ConstraintName {
+	case "users_email_key":
+		return ErrEmailTaken
+	case "users_username_key":
+		return ErrUsernameTaken
+	case "idx_users_phone_unique":
+		return ErrPhoneTaken
+	}
+	return nil
+}
+
+// PresenceTTL — сколько пользователь считается онлайн после последнего heartbeat (users.last_ping_at).
+// Хаб обновляет last_ping_at живых соединений чаще (см. Hub.RunHeartbeat), поэтому после падения
+// процесса пользователь сам «уходит» в offline. Каждый экземпляр API ведёт свою строку в
+// user_presence_pings, чтобы отключение на одном экземпляре не затирало соединения на другом.
+const PresenceTTL = 90 * time.Second
+
+var (
+	// presenceTTLSQL — PresenceTTL в виде SQL-интервала.
+	presenceTTLSQL = fmt.Sprintf("INTERVAL '%d seconds'", int(PresenceTTL/time.Second))
+	// onlineSQL — is_online, вычисляемый по свежести heartbeat; uOnlineSQL — то же для алиаса u.
+	onlineSQL  = `COALESCE(last_ping_at > NOW() - ` + presenceTTLSQL + `, false)`
+	uOnlineSQL = `COALESCE(u.last_ping_at > NOW() - ` + presenceTTLSQL + `, false)`
+	// lastSeenSQL — last_seen_at с учётом настройки hide_last_seen: у скрывших отдаётся нулевое время
+	// (time.Time{}), и поле опускается в JSON. Все выборки пользователей для других идут через него;
+	// uLastSeenSQL — то же для алиаса u.
+	lastSeenSQL  = `CASE WHEN hide_last_seen THEN '0001-01-01 00:00:00+00'::timestamptz ELSE last_seen_at END`
+	uLastSeenSQL = `CASE WHEN u.hide_last_seen THEN '0001-01-01 00:00:00+00'::timestamptz ELSE u.last_seen_at END`
+
+	// userCols — список колонок для SELECT, включая phone и disabled_at. is_online и presence выводятся из heartbeat.
+	userCols = `id, username, email, COALESCE(phone,''), password_hash, avatar_url, ` + lastSeenSQL + `, ` + onlineSQL + `, created_at, disabled_at, ` +
+		`CASE WHEN ` + onlineSQL + ` THEN presence ELSE 'offline' END, status_emoji, status_text, status_expires_at`
+)
 
 type UserRepository struct {
 	pool *pgxpool.Pool
@@ -26,18 +72,27 @@ func NewUserRepository(pool *pgxpool.Pool) *UserRepository {
 }
 
 // scanUser сканирует строку в model.User (порядок соответствует userCols).
+// Истёкший, но ещё не снятый фоновой задачей статус не отдаётся.
 func scanUser(s interface{ Scan(dest ...any) error }, u *model.User) error {
-	return s.Scan(&u.ID, &u.Username, &u.Email, &u.Phone, &u.PasswordHash, &u.AvatarURL, &u.LastSeenAt, &u.IsOnline, &u.CreatedAt, &u.DisabledAt)
+	err := s.Scan(&u.ID, &u.Username, &u.Email, &u.Phone, &u.PasswordHash, &u.AvatarURL, &u.LastSeenAt, &u.IsOnline, &u.CreatedAt, &u.DisabledAt, &u.Presence,
+		&u.StatusEmoji, &u.StatusText, &u.StatusExpiresAt)
+	if err == nil && u.StatusExpiresAt != nil && !u.StatusExpiresAt.After(time.Now()) {
+		u.StatusEmoji, u.StatusText, u.StatusExpiresAt = "", "", nil
+	}
+	return err
 }
 
 func (r *UserRepository) Create(ctx context.Context, u *model.User) error {
 	defer logger.DeferLogDuration("user.Create", time.Now())()
-	_, err := r.pool.Exec(ctx,
+	_, err := conn(ctx, r.pool).Exec(ctx,
 		`INSERT INTO users (id, username, email, phone, password_hash, avatar_url, last_seen_at, is_online, created_at, disabled_at)
 		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
 		u.ID, u.Username, u.Email, u.Phone, u.PasswordHash, u.AvatarURL, u.LastSeenAt, u.IsOnline, u.CreatedAt, u.DisabledAt,
 	)
 	if err != nil {
+		if conflict := userConflict(err); conflict != nil {
+			return conflict
+		}
 		return fmt.Errorf("userRepo.Create: %w", err)
 	}
 	return nil
@@ -46,7 +101,7 @@ func (r *UserRepository) Create(ctx context.Context, u *model.User) error {
 func (r *UserRepository) GetByID(ctx context.Context, id string) (*model.User, error) {
 	defer logger.DeferLogDuration("user.GetByID", time.Now())()
 	u := &model.User{}
-	row := r.pool.QueryRow(ctx, `SELECT `+userCols+` FROM users WHERE id = $1`, id)
+	row := conn(ctx, r.pool).QueryRow(ctx, `SELECT `+userCols+` FROM users WHERE id = $1`, id)
 	if err := scanUser(row, u); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, ErrNotFound
@@ -82,11 +137,11 @@ func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*model.U
 	return u, nil
 }
 
-func (r *UserRepository) ListAll(ctx context.Context, limit int) ([]model.User, error) {
+func (r *UserRepository) ListAll(ctx context.Context, limit, offset int) ([]model.User, error) {
 	defer logger.DeferLogDuration("user.ListAll", time.Now())()
 	rows, err := r.pool.Query(ctx,
-		`SELECT `+userCols+` FROM users ORDER BY username LIMIT $1`,
-		limit,
+		`SELECT `+userCols+` FROM users ORDER BY username LIMIT $1 OFFSET $2`,
+		limit, offset,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("userRepo.ListAll: %w", err)
@@ -106,11 +161,11 @@ func (r *UserRepository) ListAll(ctx context.Context, limit int) ([]model.User,
 	return users, nil
 }
 
-func (r *UserRepository) SearchByUsername(ctx context.Context, query string, limit int) ([]model.User, error) {
+func (r *UserRepository) SearchByUsername(ctx context.Context, query string, limit, offset int) ([]model.User, error) {
 	defer logger.DeferLogDuration("user.SearchByUsername", time.Now())()
 	rows, err := r.pool.Query(ctx,
-		`SELECT `+userCols+` FROM users WHERE username ILIKE $1 ORDER BY username LIMIT $2`,
-		"%"+query+"%", limit,
+		`SELECT `+userCols+` FROM users WHERE username ILIKE $1 ORDER BY username LIMIT $2 OFFSET $3`,
+		"%"+query+"%", limit, offset,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("userRepo.SearchByUsername query: %w", err)
@@ -131,18 +186,320 @@ func (r *UserRepository) SearchByUsername(ctx context.Context, query string, lim
 	return users, nil
 }
 
-func (r *UserRepository) SetOnline(ctx context.Context, userID string, online bool) error {
+// SetOnline отмечает подключение пользователя к экземпляру instanceID и возвращает итоговый статус
+// присутствия: offline → online (или dnd, если включён «не беспокоить»), away/dnd сохраняются.
+func (r *UserRepository) SetOnline(ctx context.Context, userID, instanceID string) (model.PresenceStatus, error) {
 	defer logger.DeferLogDuration("user.SetOnline", time.Now())()
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return "", fmt.Errorf("userRepo.SetOnline begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx,
+		`INSERT INTO user_presence_pings (user_id, instance_id, last_ping_at) VALUES ($1, $2, NOW())
+		 ON CONFLICT (user_id, instance_id) DO UPDATE SET last_ping_at = NOW()`,
+		userID, instanceID,
+	); err != nil {
+		return "", fmt.Errorf("userRepo.SetOnline ping: %w", err)
+	}
+	var presence model.PresenceStatus
+	err = tx.QueryRow(ctx,
+		`UPDATE users SET is_online = true, last_seen_at = NOW(), last_ping_at = NOW(),
+		        presence = CASE
+		          WHEN presence_dnd THEN 'dnd'
+		          WHEN presence = 'offline' THEN 'online'
+		          ELSE presence END
+		 WHERE id = $1
+		 RETURNING presence`,
+		userID,
+	).Scan(&presence)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("userRepo.SetOnline: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return "", fmt.Errorf("userRepo.SetOnline commit: %w", err)
+	}
+	return presence, nil
+}
+
+// SetOffline отмечает, что у пользователя не осталось соединений с экземпляром instanceID.
+// Если другой экземпляр держит свежий heartbeat, пользователь остаётся онлайн и возвращается false;
+// иначе он переводится в offline и возвращается true.
+func (r *UserRepository) SetOffline(ctx context.Context, userID, instanceID string) (bool, error) {
+	defer logger.DeferLogDuration("user.SetOffline", time.Now())()
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("userRepo.SetOffline begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	// Блокировка строки пользователя упорядочивает одновременные подключения/отключения на разных экземплярах.
+	if _, err := tx.Exec(ctx, `SELECT 1 FROM users WHERE id = $1 FOR UPDATE`, userID); err != nil {
+		return false, fmt.Errorf("userRepo.SetOffline lock: %w", err)
+	}
+	if _, err := tx.Exec(ctx,
+		`DELETE FROM user_presence_pings WHERE user_id = $1 AND instance_id = $2`, userID, instanceID,
+	); err != nil {
+		return false, fmt.Errorf("userRepo.SetOffline ping: %w", err)
+	}
+	var elsewhere bool
+	if err := tx.QueryRow(ctx,
+		`SELECT EXISTS(SELECT 1 FROM user_presence_pings WHERE user_id = $1 AND last_ping_at > NOW() - `+presenceTTLSQL+`)`,
+		userID,
+	).Scan(&elsewhere); err != nil {
+		return false, fmt.Errorf("userRepo.SetOffline check: %w", err)
+	}
+	if elsewhere {
+		_, err = tx.Exec(ctx, `UPDATE users SET last_seen_at = NOW() WHERE id = $1`, userID)
+	} else {
+		_, err = tx.Exec(ctx,
+			`UPDATE users SET is_online = false, last_seen_at = NOW(), last_ping_at = NULL, presence = 'offline' WHERE id = $1`,
+			userID,
+		)
+	}
+	if err != nil {
+		return false, fmt.Errorf("userRepo.SetOffline: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("userRepo.SetOffline commit: %w", err)
+	}
+	return !elsewhere, nil
+}
+
+// SetPresence задаёт статус присутствия (online/away/dnd). Выбор dnd запоминается и переживает переподключения.
+func (r *UserRepository) SetPresence(ctx context.Context, userID string, presence model.PresenceStatus) error {
+	defer logger.DeferLogDuration("user.SetPresence", time.Now())()
+	_, err := r.pool.Exec(ctx,
+		`UPDATE users SET presence = $1, presence_dnd = ($1 = 'dnd') WHERE id = $2`,
+		presence, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("userRepo.SetPresence: %w", err)
+	}
+	return nil
+}
+
+// SetCustomStatus задаёт пользовательский статус; пустые emoji и text очищают его.
+func (r *UserRepository) SetCustomStatus(ctx context.Context, userID, emoji, text string, expiresAt *time.Time) error {
+	defer logger.DeferLogDuration("user.SetCustomStatus", time.Now())()
 	_, err := r.pool.Exec(ctx,
-		`UPDATE users SET is_online = $1, last_seen_at = $2 WHERE id = $3`,
-		online, time.Now().UTC(), userID,
+		`UPDATE users SET status_emoji = $1, status_text = $2, status_expires_at = $3 WHERE id = $4`,
+		emoji, text, expiresAt, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("userRepo.SetCustomStatus: %w", err)
+	}
+	return nil
+}
+
+// ClearExpiredCustomStatuses снимает статусы с истёкшим сроком и возвращает id затронутых пользователей.
+func (r *UserRepository) ClearExpiredCustomStatuses(ctx context.Context) ([]string, error) {
+	defer logger.DeferLogDuration("user.ClearExpiredCustomStatuses", time.Now())()
+	rows, err := r.pool.Query(ctx,
+		`UPDATE users SET status_emoji = '', status_text = '', status_expires_at = NULL
+		 WHERE status_expires_at IS NOT NULL AND status_expires_at <= NOW()
+		 RETURNING id`,
 	)
 	if err != nil {
-		return fmt.Errorf("userRepo.SetOnline: %w", err)
+		return nil, fmt.Errorf("userRepo.ClearExpiredCustomStatuses: %w", err)
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("userRepo.ClearExpiredCustomStatuses scan: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// GetPresence возвращает текущий статус присутствия пользователя.
+func (r *UserRepository) GetPresence(ctx context.Context, userID string) (model.PresenceStatus, error) {
+	defer logger.DeferLogDuration("user.GetPresence", time.Now())()
+	var presence model.PresenceStatus
+	err := r.pool.QueryRow(ctx, `SELECT presence FROM users WHERE id = $1`, userID).Scan(&presence)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("userRepo.GetPresence: %w", err)
+	}
+	return presence, nil
+}
+
+// SetHideLastSeen включает/выключает скрытие last_seen_at от других пользователей.
+func (r *UserRepository) SetHideLastSeen(ctx context.Context, userID string, hide bool) error {
+	defer logger.DeferLogDuration("user.SetHideLastSeen", time.Now())()
+	_, err := r.pool.Exec(ctx, `UPDATE users SET hide_last_seen = $1 WHERE id = $2`, hide, userID)
+	if err != nil {
+		return fmt.Errorf("userRepo.SetHideLastSeen: %w", err)
 	}
 	return nil
 }
 
+// GetHideLastSeen возвращает настройку скрытия last_seen_at пользователя.
+func (r *UserRepository) GetHideLastSeen(ctx context.Context, userID string) (bool, error) {
+	defer logger.DeferLogDuration("user.GetHideLastSeen", time.Now())()
+	var hide bool
+	err := r.pool.QueryRow(ctx, `SELECT hide_last_seen FROM users WHERE id = $1`, userID).Scan(&hide)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, ErrNotFound
+	}
+	if err != nil {
+		return false, fmt.Errorf("userRepo.GetHideLastSeen: %w", err)
+	}
+	return hide, nil
+}
+
+// GetPresenceBatch возвращает присутствие и last_seen_at для найденных из ids (отсутствующие пропускаются).
+// last_seen_at не заполняется у тех, кто скрыл его настройкой приватности, — кроме самого viewerID.
+func (r *UserRepository) GetPresenceBatch(ctx context.Context, viewerID string, ids []string) ([]model.UserPresenceInfo, error) {
+	defer logger.DeferLogDuration("user.GetPresenceBatch", time.Now())()
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	rows, err := r.pool.Query(ctx,
+		`SELECT id, `+onlineSQL+`, CASE WHEN `+onlineSQL+` THEN presence ELSE 'offline' END,
+		        CASE WHEN hide_last_seen AND id <> $2 THEN NULL ELSE last_seen_at END
+		 FROM users WHERE id = ANY($1)`, ids, viewerID)
+	if err != nil {
+		return nil, fmt.Errorf("userRepo.GetPresenceBatch: %w", err)
+	}
+	defer rows.Close()
+	var out []model.UserPresenceInfo
+	for rows.Next() {
+		var p model.UserPresenceInfo
+		if err := rows.Scan(&p.UserID, &p.IsOnline, &p.Presence, &p.LastSeenAt); err != nil {
+			return nil, fmt.Errorf("userRepo.GetPresenceBatch scan: %w", err)
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// OnlineIDs возвращает те из ids, у кого свежий heartbeat (подключены к любому экземпляру API).
+func (r *UserRepository) OnlineIDs(ctx context.Context, ids []string) ([]string, error) {
+	defer logger.DeferLogDuration("user.OnlineIDs", time.Now())()
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	rows, err := r.pool.Query(ctx, `SELECT id FROM users WHERE id = ANY($1) AND `+onlineSQL, ids)
+	if err != nil {
+		return nil, fmt.Errorf("userRepo.OnlineIDs: %w", err)
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("userRepo.OnlineIDs scan: %w", err)
+		}
+		out = append(out, id)
+	}
+	return out, rows.Err()
+}
+
+// Heartbeat продлевает last_ping_at пользователям, подключённым к этому экземпляру.
+// Возвращает тех, кто до этого считался offline (например, их отключение обработал другой экземпляр),
+// с их статусом присутствия — чтобы хаб разослал user_online.
+func (r *UserRepository) Heartbeat(ctx context.Context, instanceID string, ids []string) (map[string]model.PresenceStatus, error) {
+	defer logger.DeferLogDuration("user.Heartbeat", time.Now())()
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	if _, err := r.pool.Exec(ctx,
+		`INSERT INTO user_presence_pings (user_id, instance_id, last_ping_at)
+		 SELECT id, $2, NOW() FROM users WHERE id = ANY($1)
+		 ON CONFLICT (user_id, instance_id) DO UPDATE SET last_ping_at = NOW()`,
+		ids, instanceID,
+	); err != nil {
+		return nil, fmt.Errorf("userRepo.Heartbeat ping: %w", err)
+	}
+	rows, err := r.pool.Query(ctx,
+		`WITH prev AS (
+		   SELECT id, `+onlineSQL+` AS was_online FROM users WHERE id = ANY($1) FOR UPDATE
+		 )
+		 UPDATE users u SET last_ping_at = NOW(), last_seen_at = NOW(), is_online = true,
+		        presence = CASE
+		          WHEN prev.was_online THEN u.presence
+		          WHEN u.presence_dnd THEN 'dnd'
+		          WHEN u.presence = 'offline' THEN 'online'
+		          ELSE u.presence END
+		 FROM prev WHERE u.id = prev.id
+		 RETURNING u.id, prev.was_online, u.presence`, ids,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("userRepo.Heartbeat: %w", err)
+	}
+	defer rows.Close()
+	revived := make(map[string]model.PresenceStatus)
+	for rows.Next() {
+		var id string
+		var wasOnline bool
+		var presence model.PresenceStatus
+		if err := rows.Scan(&id, &wasOnline, &presence); err != nil {
+			return nil, fmt.Errorf("userRepo.Heartbeat scan: %w", err)
+		}
+		if !wasOnline {
+			revived[id] = presence
+		}
+	}
+	return revived, rows.Err()
+}
+
+// ExpireStalePresence переводит в offline пользователей, чей heartbeat устарел (экземпляр API упал
+// без корректного завершения), и возвращает их id. Безопасно вызывать с нескольких экземпляров.
+func (r *UserRepository) ExpireStalePresence(ctx context.Context) ([]string, error) {
+	defer logger.DeferLogDuration("user.ExpireStalePresence", time.Now())()
+	if _, err := r.pool.Exec(ctx, `DELETE FROM user_presence_pings WHERE last_ping_at <= NOW() - `+presenceTTLSQL); err != nil {
+		return nil, fmt.Errorf("userRepo.ExpireStalePresence pings: %w", err)
+	}
+	rows, err := r.pool.Query(ctx,
+		`UPDATE users SET is_online = false, presence = 'offline', last_ping_at = NULL
+		 WHERE last_ping_at IS NOT NULL AND NOT `+onlineSQL+`
+		 RETURNING id`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("userRepo.ExpireStalePresence: %w", err)
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("userRepo.ExpireStalePresence scan: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// DoNotDisturbIDs возвращает пользователей из ids, включивших «не беспокоить».
+func (r *UserRepository) DoNotDisturbIDs(ctx context.Context, ids []string) (map[string]struct{}, error) {
+	defer logger.DeferLogDuration("user.DoNotDisturbIDs", time.Now())()
+	out := make(map[string]struct{})
+	if len(ids) == 0 {
+		return out, nil
+	}
+	rows, err := r.pool.Query(ctx, `SELECT id FROM users WHERE id = ANY($1) AND presence_dnd`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("userRepo.DoNotDisturbIDs: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("userRepo.DoNotDisturbIDs scan: %w", err)
+		}
+		out[id] = struct{}{}
+	}
+	return out, rows.Err()
+}
+
 func (r *UserRepository) UpdateProfile(ctx context.Context, userID, username, avatarURL, email, phone string) error {
 	defer logger.DeferLogDuration("user.UpdateProfile", time.Now())()
 	_, err := r.pool.Exec(ctx,
@@ -150,6 +507,9 @@ func (r *UserRepository) UpdateProfile(ctx context.Context, userID, username, av
 		username, avatarURL, email, phone, userID,
 	)
 	if err != nil {
+		if conflict := userConflict(err); conflict != nil {
+			return conflict
+		}
 		return fmt.Errorf("userRepo.UpdateProfile: %w", err)
 	}
 	return nil
@@ -216,3 +576,115 @@ func (r *UserRepository) SetDisabled(ctx context.Context, userID string, disable
 	}
 	return nil
 }
+
+// MergeResult — сколько записей перенесено при слиянии учётных записей.
+type MergeResult struct {
+	Messages    int64 `json:"messages"`
+	Memberships int64 `json:"memberships"`
+	Sessions    int64 `json:"sessions"`
+}
+
+// mergeDedupSQL переносит строки таблицы с пользователя $1 на $2; строки, которые у $2 уже есть
+// (совпадает key), остаются у $1 и удаляются вместе с ним.
+func mergeDedupSQL(table, key string) string {
+	return `UPDATE ` + table + ` t SET user_id = $2 WHERE t.user_id = $1
+		AND NOT EXISTS (SELECT 1 FROM ` + table + ` x WHERE x.user_id = $2 AND ` + key + `)`
+}
+
+// MergeInto переносит на targetID сообщения, участие в чатах, реакции, избранное, сессии и файлы sourceID
+// и удаляет sourceID — всё в одной транзакции. Общие чаты не дублируются: остаётся участие target
+// (роль admin и более поздняя отметка прочтения берутся у любого из двоих). Личный чат между ними удаляется,
+// заметки source переносятся в заметки target. Права source не переносятся. ErrNotFound — нет одного из пользователей.
+func (r *UserRepository) MergeInto(ctx context.Context, sourceID, targetID string) (*MergeResult, error) {
+	defer logger.DeferLogDuration("user.MergeInto", time.Now())()
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("userRepo.MergeInto begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var locked int
+	if err := tx.QueryRow(ctx,
+		`SELECT COUNT(*) FROM (SELECT id FROM users WHERE id IN ($1, $2) ORDER BY id FOR UPDATE) u`, sourceID, targetID,
+	).Scan(&locked); err != nil {
+		return nil, fmt.Errorf("userRepo.MergeInto lock: %w", err)
+	}
+	if locked != 2 {
+		return nil, ErrNotFound
+	}
+
+	var notes [2]string
+	for i, id := range []string{sourceID, targetID} {
+		err := tx.QueryRow(ctx,
+			`SELECT c.id FROM chats c JOIN chat_members cm ON cm.chat_id = c.id
+			 WHERE c.chat_type = 'notes' AND cm.user_id = $1 ORDER BY c.created_at LIMIT 1`, id,
+		).Scan(&notes[i])
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("userRepo.MergeInto notes: %w", err)
+		}
+	}
+
+	type step struct {
+		name string
+		sql  string
+		args []any
+		n    *int64
+	}
+	res := &MergeResult{}
+	pair := []any{sourceID, targetID}
+	steps := []step{
+		{"personal chat", `DELETE FROM chats c WHERE c.chat_type = 'personal'
+			AND EXISTS (SELECT 1 FROM chat_members WHERE chat_id = c.id AND user_id = $1)
+			AND EXISTS (SELECT 1 FROM chat_members WHERE chat_id = c.id AND user_id = $2)`, pair, nil},
+	}
+	if notes[0] != "" && notes[1] != "" {
+		notesPair := []any{notes[0], notes[1]}
+		steps = append(steps,
+			step{"notes messages", `UPDATE messages SET chat_id = $2 WHERE chat_id = $1`, notesPair, nil},
+			step{"notes pins", `UPDATE pinned_messages SET chat_id = $2 WHERE chat_id = $1`, notesPair, nil},
+			step{"notes chat", `DELETE FROM chats WHERE id = $1`, []any{notes[0]}, nil},
+		)
+	}
+	steps = append(steps,
+		step{"shared memberships", `UPDATE chat_members t
+			SET role = CASE WHEN s.role = 'admin' THEN 'admin' ELSE t.role END,
+			    joined_at = LEAST(t.joined_at, s.joined_at),
+			    last_read_at = GREATEST(t.last_read_at, s.last_read_at)
+			FROM chat_members s WHERE s.chat_id = t.chat_id AND s.user_id = $1 AND t.user_id = $2`, pair, nil},
+		step{"memberships", mergeDedupSQL("chat_members", "x.chat_id = t.chat_id"), pair, &res.Memberships},
+		step{"messages", `UPDATE messages SET sender_id = $2 WHERE sender_id = $1`, pair, &res.Messages},
+		step{"chats", `UPDATE chats SET created_by = $2 WHERE created_by = $1`, pair, nil},
+		step{"pins", `UPDATE pinned_messages SET pinned_by = $2 WHERE pinned_by = $1`, pair, nil},
+		step{"contacts", `UPDATE message_contacts SET user_id = $2 WHERE user_id = $1`, pair, nil},
+		step{"reactions", mergeDedupSQL("message_reactions", "x.message_id = t.message_id AND x.emoji = t.emoji"), pair, nil},
+		step{"favorites", mergeDedupSQL("user_favorite_chats", "x.chat_id = t.chat_id"), pair, nil},
+		step{"hidden", mergeDedupSQL("hidden_messages", "x.message_id = t.message_id"), pair, nil},
+		step{"mentions", mergeDedupSQL("message_mentions", "x.message_id = t.message_id"), pair, nil},
+		step{"receipts", mergeDedupSQL("message_receipts", "x.message_id = t.message_id"), pair, nil},
+		// Квитанции target на сообщения source теперь относятся к его собственным сообщениям.
+		step{"own receipts", `DELETE FROM message_receipts r USING messages m
+			WHERE m.id = r.message_id AND m.sender_id = $1 AND r.user_id = $1`, []any{targetID}, nil},
+		step{"sessions", mergeDedupSQL("sessions", "x.device_id = t.device_id"), pair, &res.Sessions},
+		step{"call stats", mergeDedupSQL("call_stats", "x.call_id = t.call_id"), pair, nil},
+		step{"call peers", `UPDATE call_stats SET peer_id = $2 WHERE peer_id = $1`, pair, nil},
+		step{"uploads", `UPDATE user_uploads SET user_id = $2 WHERE user_id = $1`, pair, nil},
+		step{"upload usage", `INSERT INTO user_upload_usage (user_id, used_bytes, files)
+			SELECT $2, used_bytes, files FROM user_upload_usage WHERE user_id = $1
+			ON CONFLICT (user_id) DO UPDATE SET used_bytes = user_upload_usage.used_bytes + EXCLUDED.used_bytes,
+			    files = user_upload_usage.files + EXCLUDED.files, updated_at = NOW()`, pair, nil},
+		step{"user", `DELETE FROM users WHERE id = $1`, []any{sourceID}, nil},
+	)
+	for _, st := range steps {
+		tag, err := tx.Exec(ctx, st.sql, st.args...)
+		if err != nil {
+			return nil, fmt.Errorf("userRepo.MergeInto %s: %w", st.name, err)
+		}
+		if st.n != nil {
+			*st.n = tag.RowsAffected()
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("userRepo.MergeInto commit: %w", err)
+	}
+	return res, nil
+}
@@ -0,0 +1,118 @@
+// Package seed наполняет пустую БД демо-данными (пользователи, групповой чат, сообщения с реакциями),
+// чтобы после запуска API с -dev -seed было что открыть. Войти за демо-пользователя можно по коду
+// на его адрес (удобно с OTP_DELIVERY=console).
+package seed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/messenger/internal/logger"
+	"github.com/messenger/internal/model"
+	"github.com/messenger/internal/repository"
+)
+
+// ErrProduction — seed не запускается при APP_ENV=production.
+var ErrProduction = errors.New("seed: refusing to run in production")
+
+var demoUsers = []struct{ username, email string }{
+	{"alice", "alice@example.com"},
+	{"bob", "bob@example.com"},
+	{"carol", "carol@example.com"},
+}
+
+// demoMessages — переписка в демо-группе: индекс отправителя в demoUsers и текст.
+var demoMessages = []struct {
+	sender int
+	text   string
+}{
+	{0, "Всем привет! Это демо-чат для разработки."},
+	{1, "Привет! Вижу сообщения, всё работает 👍"},
+	{2, "А реакции и ответы тоже можно проверить здесь."},
+	{0, "@bob посмотри, пожалуйста, последний релиз."},
+	{1, "Уже смотрю, вечером отпишусь."},
+}
+
+// demoReactions — реакции: индексы сообщения в demoMessages и пользователя в demoUsers.
+var demoReactions = []struct {
+	message, user int
+	emoji         string
+}{
+	{0, 1, "👋"}, {0, 2, "👋"}, {1, 0, "🔥"}, {3, 1, "👀"},
+}
+
+// Run создаёт демо-данные, только если в БД ещё нет ни одного пользователя, поэтому повторный запуск
+// ничего не дублирует. Возвращает false, если данные не создавались.
+func Run(ctx context.Context, pool *pgxpool.Pool) (bool, error) {
+	if os.Getenv("APP_ENV") == "production" {
+		return false, ErrProduction
+	}
+	var exists bool
+	if err := pool.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM users)`).Scan(&exists); err != nil {
+		return false, fmt.Errorf("seed: %w", err)
+	}
+	if exists {
+		return false, nil
+	}
+
+	userRepo := repository.NewUserRepository(pool)
+	chatRepo := repository.NewChatRepository(pool)
+	msgRepo := repository.NewMessageRepository(pool, nil)
+	reactRepo := repository.NewReactionRepository(pool)
+
+	start := time.Now().UTC().Add(-time.Hour)
+	userIDs := make([]string, len(demoUsers))
+	for i, du := range demoUsers {
+		u := &model.User{
+			ID: uuid.NewString(), Username: du.username, Email: du.email,
+			LastSeenAt: start, CreatedAt: start,
+		}
+		if err := userRepo.Create(ctx, u); err != nil {
+			return false, fmt.Errorf("seed: user %s: %w", du.username, err)
+		}
+		userIDs[i] = u.ID
+	}
+
+	chat := &model.Chat{
+		ID: uuid.NewString(), ChatType: model.ChatTypeGroup, Name: "Демо-группа",
+		Description: "Создано флагом -seed", CreatedBy: userIDs[0], CreatedAt: start,
+	}
+	if err := chatRepo.Create(ctx, chat); err != nil {
+		return false, fmt.Errorf("seed: chat: %w", err)
+	}
+	for i, id := range userIDs {
+		role := "member"
+		if i == 0 {
+			role = "admin"
+		}
+		if err := chatRepo.AddMember(ctx, &model.ChatMember{ChatID: chat.ID, UserID: id, Role: role, JoinedAt: start}); err != nil {
+			return false, fmt.Errorf("seed: member: %w", err)
+		}
+	}
+
+	messageIDs := make([]string, len(demoMessages))
+	for i, dm := range demoMessages {
+		m := &model.Message{
+			ID: uuid.NewString(), ChatID: chat.ID, SenderID: userIDs[dm.sender], Content: dm.text,
+			ContentType: model.ContentTypeText, Status: model.MessageStatusRead,
+			CreatedAt: start.Add(time.Duration(i+1) * time.Minute),
+		}
+		if err := msgRepo.Create(ctx, m); err != nil {
+			return false, fmt.Errorf("seed: message: %w", err)
+		}
+		messageIDs[i] = m.ID
+	}
+	for _, dr := range demoReactions {
+		if err := reactRepo.Add(ctx, messageIDs[dr.message], userIDs[dr.user], dr.emoji); err != nil {
+			return false, fmt.Errorf("seed: reaction: %w", err)
+		}
+	}
+	logger.Infof("seed: created %d users, 1 group chat, %d messages", len(userIDs), len(messageIDs))
+	return true, nil
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/messenger/internal/logger"
+	"github.com/messenger/internal/storage"
+)
+
+// Исходы попыток входа в журнале auth_activity: событие — "<action>.<outcome>", например "verify_code.invalid_code".
+const (
+	activityRequestCode = "request_code"
+	activityVerifyCode  = "verify_code"
+)
+
+// EmailHash — ключ адреса в журнале auth_activity: HMAC-SHA256 нормализованного email с секретом key, сам адрес
+// не хранится. Без секрета хеш адреса из утёкшей таблицы подбирался бы по словарю известных адресов.
+func EmailHash(key []byte, email string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(normalizeEmailForKey(email)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func activityOutcome(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, ErrRateLimitExceeded):
+		return "rate_limited"
+	case errors.Is(err, ErrInvalidOTP):
+		return "invalid_code"
+	case errors.Is(err, ErrDomainNotAllowed):
+		return "domain_not_allowed"
+	case errors.Is(err, ErrUserDisabled):
+		return "user_disabled"
+	case errors.Is(err, ErrNotProvisioned):
+		return "not_provisioned"
+	case errors.Is(err, ErrSessionLimit):
+		return "session_limit"
+	case errors.Is(err, storage.ErrUnavailable):
+		return "unavailable"
+	default:
+		return "error"
+	}
+}
+
+// recordActivity пишет исход попытки в журнал; ошибки записи только логируются — вход от журнала не зависит.
+// Запросы с некорректным email не пишутся: по ним нечего искать.
+func (s *OTPAuthService) recordActivity(ctx context.Context, action, email, ip string, err error) {
+	if s.activity == nil || !emailRegexp.MatchString(normalizeEmailForKey(email)) {
+		return
+	}
+	// Клиент мог уже отключиться, а исход всё равно нужно сохранить.
+	ctx = context.WithoutCancel(ctx)
+	if recErr := s.activity.Record(ctx, EmailHash(s.activityKey, email), action+"."+activityOutcome(err), ip); recErr != nil {
+		logger.Errorf("auth activity: %v", recErr)
+	}
+}
+
+// RunActivityCleanup каждые interval удаляет записи журнала старше retention, до отмены ctx.
+func (s *OTPAuthService) RunActivityCleanup(ctx context.Context, retention, interval time.Duration) {
+	if s.activity == nil || retention <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.activity.DeleteOlderThan(ctx, time.Now().Add(-retention))
+			if err != nil {
+				if ctx.Err() == nil {
+					logger.Errorf("auth activity cleanup: %v", err)
+				}
+				continue
+			}
+			if n > 0 {
+				logger.Infof("auth activity cleanup: deleted %d record(s)", n)
+			}
+		}
+	}
+}
@@ -17,7 +17,6 @@ import (
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/messenger/internal/email"
 	"github.com/messenger/internal/logger"
 	"github.com/messenger/internal/model"
 	"github.com/messenger/internal/repository"
@@ -29,6 +28,11 @@ var (
 	ErrInvalidOTP        = errors.New("invalid or expired OTP")
 	ErrInvalidEmail      = errors.New("invalid email format")
 	ErrUserDisabled      = errors.New("user disabled")
+	ErrSessionNotFound   = errors.New("session not found")
+	ErrNotProvisioned    = errors.New("account not provisioned")
+	ErrDomainNotAllowed  = errors.New("email domain not allowed")
+	ErrSessionLimit      = errors.New("session limit reached")
+	ErrTimestampSkew     = errors.New("request timestamp out of window")
 )
 
 func maskSessionID(s string) string {
@@ -43,17 +47,31 @@ type OTPAuthService struct {
 	userRepo    *repository.UserRepository
 	sessionRepo *repository.SessionRepository
 	store       storage.SessionOTPStore
-	mailer      *email.Sender
+	deliverer   OTPDeliverer
+	revoke      SessionRevokeNotifier
+	welcome     WelcomeSender
+	policy      AuthPolicy
+	activity    *repository.AuthActivityRepository
+	activityKey []byte
 }
 
+// NewOTPAuthService создаёт сервис авторизации. revoke может быть nil — тогда API не уведомляется о logout;
+// welcome может быть nil — тогда новые пользователи не получают приветствие;
+// activity может быть nil — тогда попытки входа не журналируются; activityKey — секрет хеша email в журнале.
 func NewOTPAuthService(
 	userRepo *repository.UserRepository,
 	sessionRepo *repository.SessionRepository,
 	store storage.SessionOTPStore,
-	mailer *email.Sender,
+	deliverer OTPDeliverer,
+	revoke SessionRevokeNotifier,
+	welcome WelcomeSender,
+	policy AuthPolicy,
+	activity *repository.AuthActivityRepository,
+	activityKey []byte,
 ) *OTPAuthService {
 	return &OTPAuthService{
-		userRepo: userRepo, sessionRepo: sessionRepo, store: store, mailer: mailer,
+		userRepo: userRepo, sessionRepo: sessionRepo, store: store, deliverer: deliverer, revoke: revoke, welcome: welcome,
+		policy: policy, activity: activity, activityKey: activityKey,
 	}
 }
 
@@ -61,6 +79,8 @@ type RequestCodeRequest struct {
 	Email      string `json:"email"`
 	DeviceID   string `json:"device_id"`
 	DeviceName string `json:"device_name"`
+	// IP клиента — для журнала auth_activity, заполняет обработчик.
+	IP string `json:"-"`
 }
 
 // Валидация email: допустимый формат (упрощённый, без полного RFC).
@@ -115,6 +135,12 @@ func normalizeEmailForKey(s string) string {
 }
 
 func (s *OTPAuthService) RequestCode(ctx context.Context, req RequestCodeRequest) error {
+	err := s.requestCode(ctx, req)
+	s.recordActivity(ctx, activityRequestCode, req.Email, req.IP, err)
+	return err
+}
+
+func (s *OTPAuthService) requestCode(ctx context.Context, req RequestCodeRequest) error {
 	emailNorm := strings.TrimSpace(strings.ToLower(req.Email))
 	if emailNorm == "" {
 		return fmt.Errorf("email обязателен")
@@ -123,6 +149,10 @@ func (s *OTPAuthService) RequestCode(ctx context.Context, req RequestCodeRequest
 		return ErrInvalidEmail
 	}
 	keyEmail := normalizeEmailForKey(emailNorm)
+	// Проверка по домену — до rate limit и отправки письма, чтобы посторонние не тратили квоту SMTP.
+	if !s.policy.canLogin(keyEmail) {
+		return ErrDomainNotAllowed
+	}
 	allowed, err := s.store.CheckRateLimit(ctx, keyEmail)
 	if err != nil {
 		return err
@@ -135,7 +165,7 @@ func (s *OTPAuthService) RequestCode(ctx context.Context, req RequestCodeRequest
 	if existing, _ := s.store.GetOTP(ctx, keyEmail); existing != "" && len(existing) == 6 {
 		if ttl, _ := s.store.GetOTPTTL(ctx, keyEmail); ttl >= minTTLToReuse {
 			logger.Infof("request-code: переотправка того же кода для key=otp:%s (TTL %.0fs)", keyEmail, ttl.Seconds())
-			return s.mailer.SendOTP(ctx, emailNorm, existing)
+			return s.deliverer.SendOTP(ctx, emailNorm, existing)
 		}
 	}
 	code := generateOTP(6)
@@ -143,7 +173,13 @@ func (s *OTPAuthService) RequestCode(ctx context.Context, req RequestCodeRequest
 		return err
 	}
 	logger.Infof("request-code: код сохранён для key=otp:%s", keyEmail)
-	return s.mailer.SendOTP(ctx, emailNorm, code)
+	return s.deliverer.SendOTP(ctx, emailNorm, code)
+}
+
+// DevLastCode возвращает действующий код для email ("" — кода нет или истёк). Только для разработки и e2e-тестов:
+// вызывается из обработчика, который подключается лишь вне production.
+func (s *OTPAuthService) DevLastCode(ctx context.Context, email string) (string, error) {
+	return s.store.GetOTP(ctx, normalizeEmailForKey(email))
 }
 
 type VerifyCodeRequest struct {
@@ -151,6 +187,8 @@ type VerifyCodeRequest struct {
 	Code       string `json:"code"`
 	DeviceID   string `json:"device_id"`
 	DeviceName string `json:"device_name"` // опционально
+	// IP клиента — для журнала auth_activity, заполняет обработчик.
+	IP string `json:"-"`
 }
 
 type VerifyCodeResponse struct {
@@ -160,18 +198,41 @@ type VerifyCodeResponse struct {
 }
 
 func (s *OTPAuthService) VerifyCode(ctx context.Context, req VerifyCodeRequest) (*VerifyCodeResponse, error) {
+	resp, err := s.verifyCode(ctx, req)
+	s.recordActivity(ctx, activityVerifyCode, req.Email, req.IP, err)
+	return resp, err
+}
+
+func (s *OTPAuthService) verifyCode(ctx context.Context, req VerifyCodeRequest) (*VerifyCodeResponse, error) {
 	emailNorm := strings.TrimSpace(strings.ToLower(req.Email))
 	keyEmail := normalizeEmailForKey(emailNorm)
 	codeNorm := onlyDigits(strings.TrimSpace(req.Code))
 	if emailNorm == "" || codeNorm == "" || req.DeviceID == "" {
 		return nil, fmt.Errorf("email, code и device_id обязательны")
 	}
+	// Лимит попыток по IP — дополнение к лимиту запросов кода на email: перебор кодов для многих адресов
+	// с одного IP упирается в него.
+	if req.IP != "" {
+		allowed, err := s.store.CheckVerifyRateLimit(ctx, req.IP)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			return nil, ErrRateLimitExceeded
+		}
+	}
 	if len(codeNorm) != 6 {
 		return nil, ErrInvalidOTP
 	}
+	if !s.policy.canLogin(keyEmail) {
+		return nil, ErrDomainNotAllowed
+	}
 	storedCode, err := s.store.GetOTP(ctx, keyEmail)
 	if err != nil {
 		logger.Errorf("verify-code: Redis GetOTP error key=%q err=%v", keyEmail, err)
+		if errors.Is(err, storage.ErrUnavailable) {
+			return nil, err
+		}
 		return nil, ErrInvalidOTP
 	}
 	if storedCode == "" {
@@ -194,23 +255,31 @@ func (s *OTPAuthService) VerifyCode(ctx context.Context, req VerifyCodeRequest)
 		if !errors.Is(err, repository.ErrNotFound) {
 			return nil, err
 		}
+		if !s.policy.canProvision(emailNorm) {
+			logger.Infof("verify-code: автосоздание запрещено для key=%s", keyEmail)
+			return nil, ErrNotProvisioned
+		}
 		user, err = s.createUserByEmail(ctx, emailNorm)
 		if err != nil {
 			return nil, err
 		}
 		isNewUser = true
+		// Приветствие — только при создании пользователя, поэтому приходит один раз.
+		if s.welcome != nil {
+			s.welcome.Welcome(ctx, user)
+		}
 	}
 	if user.DisabledAt != nil {
 		return nil, ErrUserDisabled
 	}
+	if err := s.enforceSessionLimit(ctx, user.ID, req.DeviceID); err != nil {
+		return nil, err
+	}
 	sessionID := uuid.New().String()
-	secret := make([]byte, 32)
-	if _, err := rand.Read(secret); err != nil {
+	secretB64, secretHash, err := newSessionSecret()
+	if err != nil {
 		return nil, err
 	}
-	secretB64 := base64.StdEncoding.EncodeToString(secret)
-	h := sha256.Sum256(secret)
-	secretHash := hex.EncodeToString(h[:])
 	now := time.Now().UTC()
 	session := &model.Session{
 		ID: sessionID, UserID: user.ID, DeviceID: req.DeviceID, DeviceName: strings.TrimSpace(req.DeviceName),
@@ -238,6 +307,49 @@ func (s *OTPAuthService) VerifyCode(ctx context.Context, req VerifyCodeRequest)
 	return &VerifyCodeResponse{SessionID: sessionID, SessionSecret: secretB64, IsNewUser: isNewUser}, nil
 }
 
+// enforceSessionLimit освобождает место под сессию устройства deviceID, если у пользователя уже
+// policy.MaxSessions других активных сессий: отзывает самые давние или, при RejectOverLimit, возвращает ErrSessionLimit.
+func (s *OTPAuthService) enforceSessionLimit(ctx context.Context, userID, deviceID string) error {
+	limit := s.policy.MaxSessions
+	if limit <= 0 {
+		return nil
+	}
+	if s.policy.RejectOverLimit {
+		n, err := s.sessionRepo.CountActive(ctx, userID, deviceID)
+		if err != nil {
+			return err
+		}
+		if n >= limit {
+			return ErrSessionLimit
+		}
+		return nil
+	}
+	ids, err := s.sessionRepo.RevokeOldest(ctx, userID, deviceID, limit-1)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := s.store.DeleteSessionSecret(ctx, id); err != nil {
+			logger.Errorf("verify-code: DeleteSessionSecret session_id=%s: %v", maskSessionID(id), err)
+		}
+	}
+	if len(ids) > 0 {
+		logger.Infof("verify-code: session limit %d reached, revoked %d oldest session(s)", limit, len(ids))
+		s.notifyRevoked(userID, ids)
+	}
+	return nil
+}
+
+// newSessionSecret генерирует 32 случайных байта: base64 для клиента и store, sha256-hex для БД.
+func newSessionSecret() (secretB64, secretHash string, err error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	h := sha256.Sum256(secret)
+	return base64.StdEncoding.EncodeToString(secret), hex.EncodeToString(h[:]), nil
+}
+
 func (s *OTPAuthService) createUserByEmail(ctx context.Context, emailAddr string) (*model.User, error) {
 	username := deriveUsername(emailAddr)
 	for i := 0; i < 10; i++ {
@@ -310,6 +422,7 @@ func (s *OTPAuthService) LogoutSession(ctx context.Context, userID, sessionID st
 		if err := s.store.DeleteSessionSecret(ctx, sessionID); err != nil {
 			logger.Errorf("LogoutSession: DeleteSessionSecret session_id=%s: %v", maskSessionID(sessionID), err)
 		}
+		s.notifyRevoked(userID, []string{sessionID})
 	}
 	return ok, nil
 }
@@ -324,9 +437,76 @@ func (s *OTPAuthService) LogoutAllSessions(ctx context.Context, userID string) (
 			logger.Errorf("LogoutAllSessions: DeleteSessionSecret session_id=%s: %v", maskSessionID(id), err)
 		}
 	}
+	s.notifyRevoked(userID, ids)
+	return int64(len(ids)), nil
+}
+
+// LogoutOtherSessions отзывает все сессии пользователя, кроме текущей currentSessionID («выйти на других устройствах»).
+func (s *OTPAuthService) LogoutOtherSessions(ctx context.Context, userID, currentSessionID string) (int64, error) {
+	ids, err := s.sessionRepo.RevokeOthers(ctx, userID, currentSessionID)
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		if err := s.store.DeleteSessionSecret(ctx, id); err != nil {
+			logger.Errorf("LogoutOtherSessions: DeleteSessionSecret session_id=%s: %v", maskSessionID(id), err)
+		}
+	}
+	s.notifyRevoked(userID, ids)
 	return int64(len(ids)), nil
 }
 
+// SessionSecretOverlap — сколько прежний секрет остаётся действительным после ротации
+// (запросы, подписанные до получения нового секрета, не должны падать с 401).
+const SessionSecretOverlap = 2 * time.Minute
+
+type RotateSessionResponse struct {
+	SessionSecret      string    `json:"session_secret"`
+	PreviousValidUntil time.Time `json:"previous_valid_until"`
+}
+
+// RotateSessionSecret выдаёт сессии новый секрет без повторного входа. Прежний секрет
+// принимается ещё SessionSecretOverlap. Возвращает ErrSessionNotFound, если сессия не принадлежит пользователю.
+func (s *OTPAuthService) RotateSessionSecret(ctx context.Context, userID, sessionID string) (*RotateSessionResponse, error) {
+	oldSecret, err := s.store.GetSessionSecret(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("get session secret: %w", err)
+	}
+	if oldSecret == "" {
+		return nil, ErrSessionNotFound
+	}
+	secretB64, secretHash, err := newSessionSecret()
+	if err != nil {
+		return nil, err
+	}
+	ok, err := s.sessionRepo.UpdateSecretHash(ctx, userID, sessionID, secretHash)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	if err := s.store.SetPreviousSessionSecret(ctx, sessionID, oldSecret, SessionSecretOverlap); err != nil {
+		return nil, fmt.Errorf("save previous session secret: %w", err)
+	}
+	if err := s.store.SetSessionSecret(ctx, sessionID, secretB64); err != nil {
+		return nil, fmt.Errorf("save session secret: %w", err)
+	}
+	logger.Infof("session secret rotated session_id=%s", maskSessionID(sessionID))
+	return &RotateSessionResponse{
+		SessionSecret:      secretB64,
+		PreviousValidUntil: time.Now().UTC().Add(SessionSecretOverlap),
+	}, nil
+}
+
+// notifyRevoked асинхронно просит API закрыть WebSocket-соединения отозванных сессий.
+func (s *OTPAuthService) notifyRevoked(userID string, sessionIDs []string) {
+	if s.revoke == nil || len(sessionIDs) == 0 {
+		return
+	}
+	go s.revoke.SessionsRevoked(context.Background(), userID, sessionIDs)
+}
+
 // ValidateRequest проверяет подпись запроса и возвращает user_id. Используется API через POST /internal/validate.
 // timestamp — Unix секунды; допустимое отклонение ±30 сек.
 func (s *OTPAuthService) ValidateRequest(ctx context.Context, sessionID, timestamp, signature, method, path, body string) (userID string, err error) {
@@ -341,23 +521,28 @@ func (s *OTPAuthService) ValidateRequest(ctx context.Context, sessionID, timesta
 	t := time.Unix(ts, 0)
 	if time.Since(t) > 30*time.Second || time.Until(t) > 30*time.Second {
 		logger.Errorf("validate: timestamp out of window session_id=%s", maskSessionID(sessionID))
-		return "", ErrInvalidOTP
+		return "", ErrTimestampSkew
 	}
-	secretB64, err := s.store.GetSessionSecret(ctx, sessionID)
-	if err != nil || secretB64 == "" {
-		logger.Errorf("validate: no session_secret in Redis session_id=%s", maskSessionID(sessionID))
-		return "", ErrInvalidOTP
+	// Текущий секрет и (в окне перекрытия после ротации) прежний.
+	secrets, err := storage.SessionSecrets(ctx, s.store, sessionID)
+	if errors.Is(err, storage.ErrUnavailable) {
+		return "", err
 	}
-	secret, err := base64.StdEncoding.DecodeString(secretB64)
-	if err != nil || len(secret) != 32 {
+	if err != nil || len(secrets) == 0 {
+		logger.Errorf("validate: no session_secret in Redis session_id=%s", maskSessionID(sessionID))
 		return "", ErrInvalidOTP
 	}
 	tryPath := func(p string) bool {
 		pl := method + p + body + timestamp
-		mac := hmac.New(sha256.New, secret)
-		mac.Write([]byte(pl))
-		expected := hex.EncodeToString(mac.Sum(nil))
-		return hmac.Equal([]byte(signature), []byte(expected))
+		for _, secret := range secrets {
+			mac := hmac.New(sha256.New, secret)
+			mac.Write([]byte(pl))
+			expected := hex.EncodeToString(mac.Sum(nil))
+			if hmac.Equal([]byte(signature), []byte(expected)) {
+				return true
+			}
+		}
+		return false
 	}
 	if tryPath(path) {
 		// подпись совпала
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/messenger/internal/logger"
+)
+
+// OTPDeliverer доставляет код входа пользователю. По умолчанию — письмо (*email.Sender).
+type OTPDeliverer interface {
+	SendOTP(ctx context.Context, to, code string) error
+}
+
+// ConsoleDeliverer пишет код в лог вместо отправки — для локальной разработки без SMTP.
+type ConsoleDeliverer struct{}
+
+func (ConsoleDeliverer) SendOTP(_ context.Context, to, code string) error {
+	logger.Infof("otp console: code for %s: %s", to, code)
+	return nil
+}
+
+// WebhookDeliverer отправляет POST {"email", "code"} на внешний сервис (SMS-шлюз, мессенджер и т.п.).
+// secret, если задан, передаётся в Authorization: Bearer.
+type WebhookDeliverer struct {
+	url        string
+	secret     string
+	httpClient *http.Client
+}
+
+func NewWebhookDeliverer(url, secret string) *WebhookDeliverer {
+	return &WebhookDeliverer{
+		url:        strings.TrimSpace(url),
+		secret:     strings.TrimSpace(secret),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (d *WebhookDeliverer) SendOTP(ctx context.Context, to, code string) error {
+	body, _ := json.Marshal(map[string]string{"email": to, "code": code})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("otp webhook: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if d.secret != "" {
+		req.Header.Set("Authorization", "Bearer "+d.secret)
+	}
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("otp webhook: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("otp webhook: status %d", resp.StatusCode)
+	}
+	return nil
+}
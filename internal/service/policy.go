@@ -0,0 +1,46 @@
+package service
+
+import "strings"
+
+// AuthPolicy — ограничения входа по OTP, задаваемые конфигурацией.
+type AuthPolicy struct {
+	// AllowedDomains — домены email, которым вообще разрешён вход (выдача и проверка кода); пусто — любые.
+	AllowedDomains []string
+	// AutoProvision — создавать пользователя при первом входе с неизвестным email.
+	// false — входят только заранее созданные администратором пользователи.
+	AutoProvision bool
+	// AutoProvisionDomains — домены, для которых разрешено автосоздание; пусто — любые.
+	AutoProvisionDomains []string
+	// MaxSessions — сколько активных сессий (устройств) может быть у пользователя; 0 — без ограничения.
+	MaxSessions int
+	// RejectOverLimit — при превышении MaxSessions отказывать во входе, а не отзывать самую давнюю сессию.
+	RejectOverLimit bool
+}
+
+// canLogin сообщает, разрешён ли вход с этим email.
+func (p AuthPolicy) canLogin(emailAddr string) bool {
+	return emailDomainIn(emailAddr, p.AllowedDomains, true)
+}
+
+// canProvision сообщает, можно ли автоматически создать пользователя с этим email.
+func (p AuthPolicy) canProvision(emailAddr string) bool {
+	return p.AutoProvision && emailDomainIn(emailAddr, p.AutoProvisionDomains, true)
+}
+
+// emailDomainIn проверяет домен email (без учёта регистра) по списку; пустой список — результат empty.
+func emailDomainIn(emailAddr string, domains []string, empty bool) bool {
+	if len(domains) == 0 {
+		return empty
+	}
+	at := strings.LastIndex(emailAddr, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(emailAddr[at+1:])
+	for _, d := range domains {
+		if strings.EqualFold(strings.TrimPrefix(d, "@"), domain) {
+			return true
+		}
+	}
+	return false
+}
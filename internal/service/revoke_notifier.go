@@ -0,0 +1,66 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/messenger/internal/logger"
+)
+
+// SessionRevokeNotifier сообщает API об отозванных сессиях, чтобы тот закрыл их WebSocket-соединения.
+type SessionRevokeNotifier interface {
+	SessionsRevoked(ctx context.Context, userID string, sessionIDs []string)
+}
+
+// HTTPRevokeNotifier вызывает POST {apiURL}/internal/ws/revoke-sessions.
+// Заголовок X-Internal-Secret берётся из INTERNAL_VALIDATE_SECRET (как для /internal/validate).
+type HTTPRevokeNotifier struct {
+	apiURL     string
+	secret     string
+	httpClient *http.Client
+}
+
+// NewHTTPRevokeNotifier создаёт нотификатор для API по адресу apiURL.
+func NewHTTPRevokeNotifier(apiURL string) *HTTPRevokeNotifier {
+	return &HTTPRevokeNotifier{
+		apiURL:     strings.TrimSuffix(apiURL, "/"),
+		secret:     strings.TrimSpace(os.Getenv("INTERNAL_VALIDATE_SECRET")),
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (n *HTTPRevokeNotifier) SessionsRevoked(ctx context.Context, userID string, sessionIDs []string) {
+	if len(sessionIDs) == 0 {
+		return
+	}
+	if err := n.post(ctx, userID, sessionIDs); err != nil {
+		logger.Errorf("revoke notify user=%s sessions=%d: %v", userID, len(sessionIDs), err)
+	}
+}
+
+func (n *HTTPRevokeNotifier) post(ctx context.Context, userID string, sessionIDs []string) error {
+	body, _ := json.Marshal(map[string]any{"user_id": userID, "session_ids": sessionIDs})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.apiURL+"/internal/ws/revoke-sessions", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.secret != "" {
+		req.Header.Set("X-Internal-Secret", n.secret)
+	}
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
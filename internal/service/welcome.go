@@ -0,0 +1,70 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/messenger/internal/logger"
+	"github.com/messenger/internal/model"
+	"github.com/messenger/internal/repository"
+)
+
+// WelcomeSender отправляет приветствие пользователю, созданному при первом входе.
+type WelcomeSender interface {
+	Welcome(ctx context.Context, user *model.User)
+}
+
+// WelcomeData — поля, доступные в шаблоне приветствия: {{.Username}}, {{.Email}}.
+type WelcomeData struct {
+	Username string
+	Email    string
+}
+
+// NotesWelcome кладёт приветствие с подсказками в чат «Заметки» нового пользователя.
+type NotesWelcome struct {
+	chatRepo *repository.ChatRepository
+	msgRepo  *repository.MessageRepository
+	tmpl     *template.Template
+}
+
+// NewNotesWelcome разбирает text как text/template (WELCOME_MESSAGE) — текст задаётся на языке развёртывания.
+func NewNotesWelcome(chatRepo *repository.ChatRepository, msgRepo *repository.MessageRepository, text string) (*NotesWelcome, error) {
+	tmpl, err := template.New("welcome").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("welcome message template: %w", err)
+	}
+	if err := tmpl.Execute(new(bytes.Buffer), WelcomeData{}); err != nil {
+		return nil, fmt.Errorf("welcome message template: %w", err)
+	}
+	return &NotesWelcome{chatRepo: chatRepo, msgRepo: msgRepo, tmpl: tmpl}, nil
+}
+
+// Welcome не возвращает ошибку: вход не должен срываться из-за приветствия.
+func (w *NotesWelcome) Welcome(ctx context.Context, user *model.User) {
+	var buf bytes.Buffer
+	if err := w.tmpl.Execute(&buf, WelcomeData{Username: user.Username, Email: user.Email}); err != nil {
+		logger.Errorf("welcome user=%s: template: %v", user.ID, err)
+		return
+	}
+	chat, err := w.chatRepo.GetOrCreateNotesChat(ctx, user.ID)
+	if err != nil {
+		logger.Errorf("welcome user=%s: notes chat: %v", user.ID, err)
+		return
+	}
+	m := &model.Message{
+		ID:          uuid.New().String(),
+		ChatID:      chat.ID,
+		SenderID:    user.ID,
+		Content:     buf.String(),
+		ContentType: model.ContentTypeText,
+		Status:      model.MessageStatusRead,
+		CreatedAt:   time.Now().UTC(),
+	}
+	if err := w.msgRepo.Create(ctx, m); err != nil {
+		logger.Errorf("welcome user=%s: create message: %v", user.ID, err)
+	}
+}
@@ -2,13 +2,45 @@ package startup
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/messenger/internal/logger"
 )
 
+// queryExecModes — допустимые значения DB_QUERY_EXEC_MODE (те же имена, что у параметра default_query_exec_mode в DSN).
+var queryExecModes = map[string]pgx.QueryExecMode{
+	"cache_statement": pgx.QueryExecModeCacheStatement,
+	"cache_describe":  pgx.QueryExecModeCacheDescribe,
+	"describe_exec":   pgx.QueryExecModeDescribeExec,
+	"exec":            pgx.QueryExecModeExec,
+	"simple_protocol": pgx.QueryExecModeSimpleProtocol,
+}
+
+// ApplyQueryExecMode задаёт режим выполнения запросов и размер кеша подготовленных выражений.
+// Пустой mode и cacheCapacity <= 0 оставляют значения pgx (или из DSN) без изменений.
+func ApplyQueryExecMode(poolCfg *pgxpool.Config, mode string, cacheCapacity int) error {
+	if mode != "" {
+		m, ok := queryExecModes[mode]
+		if !ok {
+			return fmt.Errorf("unknown DB_QUERY_EXEC_MODE %q", mode)
+		}
+		poolCfg.ConnConfig.DefaultQueryExecMode = m
+	}
+	if cacheCapacity > 0 {
+		poolCfg.ConnConfig.StatementCacheCapacity = cacheCapacity
+		poolCfg.ConnConfig.DescriptionCacheCapacity = cacheCapacity
+	}
+	return nil
+}
+
 // ConnectDBWithRetry подключается к Postgres с повторами; при недоступности БД не роняет процесс сразу.
 // logPrefix добавляется к сообщениям лога (например "auth: ").
 func ConnectDBWithRetry(poolCfg *pgxpool.Config, maxWait time.Duration, logPrefix string) *pgxpool.Pool {
@@ -49,3 +81,46 @@ func ConnectDBWithRetry(poolCfg *pgxpool.Config, maxWait time.Duration, logPrefi
 		return pool
 	}
 }
+
+// RetryDB выполняет стартовую операцию с БД (миграции и т.п.) с теми же повторами, что ConnectDBWithRetry:
+// временный сбой (обрыв соединения, переключение реплики) не роняет процесс, а после maxWait — os.Exit.
+// Ошибки, которые повтор не исправит (ошибка SQL, нет файла), завершают процесс сразу.
+// attempt — таймаут одной попытки; op — название для лога.
+func RetryDB(maxWait, attempt time.Duration, logPrefix, op string, fn func(ctx context.Context) error) {
+	deadline := time.Now().Add(maxWait)
+	backoff := 2 * time.Second
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), attempt)
+		err := fn(ctx)
+		cancel()
+		if err == nil {
+			return
+		}
+		if !transientDBError(err) {
+			logger.Errorf("%s%s: %v", logPrefix, op, err)
+			os.Exit(1)
+		}
+		if time.Now().After(deadline) {
+			logger.Errorf("%s%s (gave up after %v): %v", logPrefix, op, maxWait, err)
+			os.Exit(1)
+		}
+		logger.Errorf("%s%s failed, retry in %v: %v", logPrefix, op, backoff, err)
+		time.Sleep(backoff)
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// transientDBError — сбой, который может пройти при повторе: сеть, таймаут, а из ошибок сервера —
+// классы 08 (соединение), 53 (нехватка ресурсов), 57P (сервер останавливается или ещё запускается).
+func transientDBError(err error) bool {
+	if errors.Is(err, fs.ErrNotExist) {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return strings.HasPrefix(pgErr.Code, "08") || strings.HasPrefix(pgErr.Code, "53") || strings.HasPrefix(pgErr.Code, "57P")
+	}
+	return true
+}
@@ -36,6 +36,9 @@ func (c *Client) DeleteOTP(ctx context.Context, email string) error {
 func (c *Client) CheckRateLimit(ctx context.Context, email string) (bool, error) {
 	return c.mem.CheckRateLimit(ctx, email)
 }
+func (c *Client) CheckVerifyRateLimit(ctx context.Context, ip string) (bool, error) {
+	return c.mem.CheckVerifyRateLimit(ctx, ip)
+}
 
 func (c *Client) SetSessionSecret(ctx context.Context, sessionID, secret string) error {
 	return c.repo.SetSessionSecret(ctx, sessionID, secret)
@@ -44,5 +47,14 @@ func (c *Client) GetSessionSecret(ctx context.Context, sessionID string) (string
 	return c.repo.GetSessionSecret(ctx, sessionID)
 }
 func (c *Client) DeleteSessionSecret(ctx context.Context, sessionID string) error {
+	_ = c.mem.DeleteSessionSecret(ctx, sessionID)
 	return c.repo.ClearSessionSecret(ctx, sessionID)
 }
+
+// Прежний секрет после ротации живёт минуты — в БД не сохраняется, перезапуск Auth просто завершает окно перекрытия.
+func (c *Client) SetPreviousSessionSecret(ctx context.Context, sessionID, secret string, ttl time.Duration) error {
+	return c.mem.SetPreviousSessionSecret(ctx, sessionID, secret, ttl)
+}
+func (c *Client) GetPreviousSessionSecret(ctx context.Context, sessionID string) (string, error) {
+	return c.mem.GetPreviousSessionSecret(ctx, sessionID)
+}
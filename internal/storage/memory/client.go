@@ -10,6 +10,8 @@ const (
 	otpTTL             = 300 * time.Second
 	otpRateLimitWindow = 600 * time.Second
 	otpRateLimitMax    = 10
+	otpVerifyIPWindow  = 600 * time.Second
+	otpVerifyIPMax     = 30
 	sessionSecretTTL   = 30 * 24 * time.Hour
 )
 
@@ -23,13 +25,16 @@ type Client struct {
 	otp     map[string]item
 	limit   map[string][]time.Time
 	secrets map[string]item
+	// prevSecrets — секреты до ротации, действуют до истечения окна перекрытия.
+	prevSecrets map[string]item
 }
 
 func New() *Client {
 	return &Client{
-		otp:     make(map[string]item),
-		limit:   make(map[string][]time.Time),
-		secrets: make(map[string]item),
+		otp:         make(map[string]item),
+		limit:       make(map[string][]time.Time),
+		secrets:     make(map[string]item),
+		prevSecrets: make(map[string]item),
 	}
 }
 
@@ -74,23 +79,33 @@ func (c *Client) DeleteOTP(ctx context.Context, email string) error {
 }
 
 func (c *Client) CheckRateLimit(ctx context.Context, email string) (bool, error) {
+	return c.hit(email, otpRateLimitMax, otpRateLimitWindow), nil
+}
+
+// CheckVerifyRateLimit — попытки ввода кода с ip; ключи с префиксом не пересекаются с email.
+func (c *Client) CheckVerifyRateLimit(ctx context.Context, ip string) (bool, error) {
+	return c.hit("verify_ip:"+ip, otpVerifyIPMax, otpVerifyIPWindow), nil
+}
+
+// hit учитывает событие по key в скользящем окне window; false — уже max событий.
+func (c *Client) hit(key string, max int, window time.Duration) bool {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	now := time.Now()
-	cut := now.Add(-otpRateLimitWindow)
-	slice := c.limit[email]
+	cut := now.Add(-window)
+	slice := c.limit[key]
 	var kept []time.Time
 	for _, t := range slice {
 		if t.After(cut) {
 			kept = append(kept, t)
 		}
 	}
-	if len(kept) >= otpRateLimitMax {
-		return false, nil
+	if len(kept) >= max {
+		return false
 	}
 	kept = append(kept, now)
-	c.limit[email] = kept
-	return true, nil
+	c.limit[key] = kept
+	return true
 }
 
 func (c *Client) SetSessionSecret(ctx context.Context, sessionID, secret string) error {
@@ -114,5 +129,23 @@ func (c *Client) DeleteSessionSecret(ctx context.Context, sessionID string) erro
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	delete(c.secrets, sessionID)
+	delete(c.prevSecrets, sessionID)
+	return nil
+}
+
+func (c *Client) SetPreviousSessionSecret(ctx context.Context, sessionID, secret string, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.prevSecrets[sessionID] = item{val: secret, exp: time.Now().Add(ttl)}
 	return nil
 }
+
+func (c *Client) GetPreviousSessionSecret(ctx context.Context, sessionID string) (string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	v, ok := c.prevSecrets[sessionID]
+	if !ok || time.Now().After(v.exp) {
+		return "", nil
+	}
+	return v.val, nil
+}
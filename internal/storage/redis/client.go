@@ -2,9 +2,13 @@ package redis
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync/atomic"
 	"time"
 
+	"github.com/messenger/internal/logger"
+	"github.com/messenger/internal/storage"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -16,8 +20,26 @@ const (
 	SessionSecretTTL   = 30 * 24 * 3600
 )
 
+// Попытки ввода кода с одного IP: не более OTPVerifyIPMax за OTPVerifyIPWindow секунд — против перебора
+// кодов для многих адресов с одного IP (лимит по email тут не помогает).
+const (
+	OTPVerifyIPWindow = 600
+	OTPVerifyIPMax    = 30
+)
+
+// Проверка доступности Redis: пока он доступен — пинг раз в healthCheckInterval; после сбоя —
+// переподключение с экспоненциальной паузой от healthRetryMin до healthRetryMax.
+const (
+	healthCheckInterval = 10 * time.Second
+	healthRetryMin      = 500 * time.Millisecond
+	healthRetryMax      = 30 * time.Second
+)
+
 type Client struct {
 	cli *redis.Client
+	// healthy — Redis отвечает. Пока false, методы сразу возвращают storage.ErrUnavailable,
+	// не дожидаясь таймаутов подключения на каждом запросе.
+	healthy atomic.Bool
 }
 
 func New(ctx context.Context, url string) (*Client, error) {
@@ -32,7 +54,75 @@ func New(ctx context.Context, url string) (*Client, error) {
 		}
 		return nil, fmt.Errorf("redis ping: %w", err)
 	}
-	return &Client{cli: cli}, nil
+	c := &Client{cli: cli}
+	c.healthy.Store(true)
+	return c, nil
+}
+
+// Healthy сообщает, доступен ли Redis по последней проверке.
+func (c *Client) Healthy() bool {
+	return c.healthy.Load()
+}
+
+// RunHealthCheck пингует Redis до отмены ctx. Сбой переводит клиент в состояние «недоступен»,
+// после чего пинг повторяется с растущей паузой; первый успешный пинг возвращает клиент в работу.
+func (c *Client) RunHealthCheck(ctx context.Context) {
+	wait := healthCheckInterval
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		pingCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+		err := c.cli.Ping(pingCtx).Err()
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			c.markUnhealthy(err)
+			if wait >= healthCheckInterval {
+				wait = healthRetryMin
+			} else {
+				wait = min(wait*2, healthRetryMax)
+			}
+			continue
+		}
+		if !c.healthy.Swap(true) {
+			logger.Infof("redis: connection restored")
+		}
+		wait = healthCheckInterval
+	}
+}
+
+func (c *Client) markUnhealthy(err error) {
+	if c.healthy.Swap(false) {
+		logger.Errorf("redis: unavailable, failing requests with 503 until it recovers: %v", err)
+	}
+}
+
+// ready возвращает storage.ErrUnavailable, пока Redis помечен недоступным.
+func (c *Client) ready() error {
+	if !c.healthy.Load() {
+		return storage.ErrUnavailable
+	}
+	return nil
+}
+
+// wrap переводит ошибки подключения в storage.ErrUnavailable. Отмена контекста запроса
+// клиентом не считается сбоем Redis.
+func (c *Client) wrap(err error) error {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return err
+	}
+	var redisErr redis.Error
+	if errors.As(err, &redisErr) {
+		// Ответ сервера (WRONGTYPE, OOM и т.п.) — Redis доступен.
+		return err
+	}
+	c.markUnhealthy(err)
+	return fmt.Errorf("%w: %v", storage.ErrUnavailable, err)
 }
 
 func (c *Client) Close() error {
@@ -41,59 +131,129 @@ func (c *Client) Close() error {
 
 // SetOTP сохраняет код (6 цифр) по ключу otp:{email}, TTL 5 мин. Храним код как есть для надёжной верификации.
 func (c *Client) SetOTP(ctx context.Context, email, code string) error {
-	return c.cli.Set(ctx, "otp:"+email, code, OTPTTL*time.Second).Err()
+	if err := c.ready(); err != nil {
+		return err
+	}
+	return c.wrap(c.cli.Set(ctx, "otp:"+email, code, OTPTTL*time.Second).Err())
 }
 
 // GetOTP возвращает код по email (ключ не удаляется — удаляем только после успешной верификации).
 func (c *Client) GetOTP(ctx context.Context, email string) (string, error) {
+	if err := c.ready(); err != nil {
+		return "", err
+	}
 	val, err := c.cli.Get(ctx, "otp:"+email).Result()
 	if err == redis.Nil {
 		return "", nil
 	}
-	return val, err
+	return val, c.wrap(err)
 }
 
 // GetOTPTTL возвращает оставшийся TTL ключа OTP. Если ключа нет, возвращает 0.
 func (c *Client) GetOTPTTL(ctx context.Context, email string) (time.Duration, error) {
+	if err := c.ready(); err != nil {
+		return 0, err
+	}
 	d, err := c.cli.TTL(ctx, "otp:"+email).Result()
 	if err != nil || d < 0 {
-		return 0, err
+		return 0, c.wrap(err)
 	}
 	return d, nil
 }
 
 // DeleteOTP удаляет OTP после успешной верификации (одноразовое использование кода).
 func (c *Client) DeleteOTP(ctx context.Context, email string) error {
-	return c.cli.Del(ctx, "otp:"+email).Err()
+	if err := c.ready(); err != nil {
+		return err
+	}
+	return c.wrap(c.cli.Del(ctx, "otp:"+email).Err())
+}
+
+// incrWindowScript — INCR счётчика и EXPIRE на первом инкременте одной операцией: при обрыве между
+// ними ключ без TTL навсегда заблокировал бы email/IP.
+var incrWindowScript = redis.NewScript(`
+local n = redis.call('INCR', KEYS[1])
+if n == 1 then
+	redis.call('EXPIRE', KEYS[1], ARGV[1])
+end
+return n
+`)
+
+// incrWindow увеличивает счётчик key с окном windowSec секунд и возвращает новое значение.
+func (c *Client) incrWindow(ctx context.Context, key string, windowSec int) (int64, error) {
+	n, err := incrWindowScript.Run(ctx, c.cli, []string{key}, windowSec).Int64()
+	if err != nil {
+		return 0, c.wrap(err)
+	}
+	return n, nil
 }
 
 // CheckRateLimit проверяет otp_limit:{email}: макс. OTPRateLimitMax запросов за окно. При превышении — HTTP 429.
 func (c *Client) CheckRateLimit(ctx context.Context, email string) (allowed bool, err error) {
-	key := "otp_limit:" + email
-	n, err := c.cli.Incr(ctx, key).Result()
-	if err != nil {
+	if err := c.ready(); err != nil {
 		return false, err
 	}
-	if n == 1 {
-		c.cli.Expire(ctx, key, OTPRateLimitWindow*time.Second)
+	n, err := c.incrWindow(ctx, "otp_limit:"+email, OTPRateLimitWindow)
+	if err != nil {
+		return false, err
 	}
 	return n <= int64(OTPRateLimitMax), nil
 }
 
+// CheckVerifyRateLimit считает попытки ввода кода по ключу otp_verify_ip:{ip}: макс. OTPVerifyIPMax за окно.
+func (c *Client) CheckVerifyRateLimit(ctx context.Context, ip string) (allowed bool, err error) {
+	if err := c.ready(); err != nil {
+		return false, err
+	}
+	n, err := c.incrWindow(ctx, "otp_verify_ip:"+ip, OTPVerifyIPWindow)
+	if err != nil {
+		return false, err
+	}
+	return n <= int64(OTPVerifyIPMax), nil
+}
+
 func (c *Client) SetSessionSecret(ctx context.Context, sessionID, secret string) error {
-	return c.cli.Set(ctx, "session_secret:"+sessionID, secret, SessionSecretTTL*time.Second).Err()
+	if err := c.ready(); err != nil {
+		return err
+	}
+	return c.wrap(c.cli.Set(ctx, "session_secret:"+sessionID, secret, SessionSecretTTL*time.Second).Err())
 }
 
 func (c *Client) GetSessionSecret(ctx context.Context, sessionID string) (string, error) {
+	if err := c.ready(); err != nil {
+		return "", err
+	}
 	val, err := c.cli.Get(ctx, "session_secret:"+sessionID).Result()
 	if err == redis.Nil {
 		return "", nil
 	}
-	return val, err
+	return val, c.wrap(err)
 }
 
 func (c *Client) DeleteSessionSecret(ctx context.Context, sessionID string) error {
-	return c.cli.Del(ctx, "session_secret:"+sessionID).Err()
+	if err := c.ready(); err != nil {
+		return err
+	}
+	return c.wrap(c.cli.Del(ctx, "session_secret:"+sessionID, "session_secret_prev:"+sessionID).Err())
+}
+
+// SetPreviousSessionSecret хранит секрет до ротации по ключу session_secret_prev:{id} в течение окна перекрытия.
+func (c *Client) SetPreviousSessionSecret(ctx context.Context, sessionID, secret string, ttl time.Duration) error {
+	if err := c.ready(); err != nil {
+		return err
+	}
+	return c.wrap(c.cli.Set(ctx, "session_secret_prev:"+sessionID, secret, ttl).Err())
+}
+
+func (c *Client) GetPreviousSessionSecret(ctx context.Context, sessionID string) (string, error) {
+	if err := c.ready(); err != nil {
+		return "", err
+	}
+	val, err := c.cli.Get(ctx, "session_secret_prev:"+sessionID).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return val, c.wrap(err)
 }
 
 // FlushDB очищает текущую БД Redis (для сброса OTP, rate limit, session_secret при тестах/перезапуске).
@@ -0,0 +1,52 @@
+package redis
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCheckVerifyRateLimit(t *testing.T) {
+	url := os.Getenv("TEST_REDIS_URL")
+	if url == "" {
+		t.Skip("TEST_REDIS_URL not set")
+	}
+	ctx := context.Background()
+	c, err := New(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip := "test-" + uuid.NewString()
+	key := "otp_verify_ip:" + ip
+	defer c.cli.Del(ctx, key)
+
+	for i := 1; i <= OTPVerifyIPMax; i++ {
+		allowed, err := c.CheckVerifyRateLimit(ctx, ip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !allowed {
+			t.Fatalf("attempt %d rejected, limit is %d", i, OTPVerifyIPMax)
+		}
+		// TTL выставляется вместе с первым INCR — ключ без срока жизни заблокировал бы IP навсегда.
+		if i == 1 {
+			ttl, err := c.cli.TTL(ctx, key).Result()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ttl <= 0 || ttl > OTPVerifyIPWindow*time.Second {
+				t.Fatalf("ttl after first attempt = %v, want (0, %ds]", ttl, OTPVerifyIPWindow)
+			}
+		}
+	}
+	allowed, err := c.CheckVerifyRateLimit(ctx, ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allowed {
+		t.Fatalf("attempt %d allowed, limit is %d", OTPVerifyIPMax+1, OTPVerifyIPMax)
+	}
+}
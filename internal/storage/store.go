@@ -2,9 +2,14 @@ package storage
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
 	"time"
 )
 
+// ErrUnavailable — хранилище (Redis) недоступно; запрос стоит повторить позже (HTTP 503).
+var ErrUnavailable = errors.New("storage temporarily unavailable")
+
 // SessionOTPStore — хранилище OTP-кодов, rate limit и session_secret.
 // Реализации: redis.Client, memory.Client (для -dev без Redis).
 type SessionOTPStore interface {
@@ -13,8 +18,34 @@ type SessionOTPStore interface {
 	GetOTPTTL(ctx context.Context, email string) (time.Duration, error)
 	DeleteOTP(ctx context.Context, email string) error
 	CheckRateLimit(ctx context.Context, email string) (allowed bool, err error)
+	// CheckVerifyRateLimit учитывает попытку ввода кода с адреса ip; false — лимит попыток исчерпан.
+	CheckVerifyRateLimit(ctx context.Context, ip string) (allowed bool, err error)
 	SetSessionSecret(ctx context.Context, sessionID, secret string) error
 	GetSessionSecret(ctx context.Context, sessionID string) (string, error)
 	DeleteSessionSecret(ctx context.Context, sessionID string) error
+	// SetPreviousSessionSecret сохраняет прежний секрет после ротации; он принимается ещё ttl.
+	SetPreviousSessionSecret(ctx context.Context, sessionID, secret string, ttl time.Duration) error
+	GetPreviousSessionSecret(ctx context.Context, sessionID string) (string, error)
 	Close() error
 }
+
+// SessionSecrets возвращает действующие секреты сессии для проверки HMAC: текущий и,
+// в окне перекрытия после ротации, прежний. Некорректные значения пропускаются.
+func SessionSecrets(ctx context.Context, s SessionOTPStore, sessionID string) ([][]byte, error) {
+	current, err := s.GetSessionSecret(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	var out [][]byte
+	if secret, err := base64.StdEncoding.DecodeString(current); err == nil && len(secret) == 32 {
+		out = append(out, secret)
+	}
+	prev, err := s.GetPreviousSessionSecret(ctx, sessionID)
+	if err != nil {
+		return out, nil
+	}
+	if secret, err := base64.StdEncoding.DecodeString(prev); err == nil && len(secret) == 32 {
+		out = append(out, secret)
+	}
+	return out, nil
+}
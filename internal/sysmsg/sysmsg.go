@@ -0,0 +1,103 @@
+// Package sysmsg — служебные сообщения чата («X добавил(а) Y в группу») в нейтральной форме: код события
+// и параметры (actor, target). Текст собирается при показе на языке зрителя; в messages.content хранится
+// вариант на языке по умолчанию — для старых клиентов, поиска и пушей.
+package sysmsg
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/messenger/internal/model"
+)
+
+// Коды событий.
+const (
+	MemberAdded       = "member_added"
+	MemberRemoved     = "member_removed"
+	MemberLeft        = "member_left"
+	MemberRoleGranted = "member_role_granted"
+	MemberRoleRevoked = "member_role_revoked"
+)
+
+// DefaultLang — язык, если запрошенный не поддерживается.
+const DefaultLang = "ru"
+
+// templates — тексты по языкам; {actor} и {target} заменяются параметрами события.
+var templates = map[string]map[string]string{
+	"ru": {
+		MemberAdded:       "{actor} добавил(а) {target} в группу",
+		MemberRemoved:     "{actor} исключил(а) {target} из группы",
+		MemberLeft:        "{actor} покинул(а) группу",
+		MemberRoleGranted: "{actor} назначил(а) {target} администратором",
+		MemberRoleRevoked: "{actor} снял(а) с {target} права администратора",
+	},
+	"en": {
+		MemberAdded:       "{actor} added {target} to the group",
+		MemberRemoved:     "{actor} removed {target} from the group",
+		MemberLeft:        "{actor} left the group",
+		MemberRoleGranted: "{actor} made {target} an admin",
+		MemberRoleRevoked: "{actor} revoked admin rights from {target}",
+	},
+}
+
+// New собирает событие: actor — кто сделал, target — над кем (пусто для member_left).
+func New(code, actor, target string) *model.SystemEvent {
+	params := map[string]string{"actor": actor}
+	if target != "" {
+		params["target"] = target
+	}
+	return &model.SystemEvent{Code: code, Params: params}
+}
+
+// Supported — есть ли тексты для языка lang.
+func Supported(lang string) bool {
+	_, ok := templates[lang]
+	return ok
+}
+
+// Render возвращает текст события на языке lang (неизвестный язык — DefaultLang). Для неизвестного
+// кода — пустая строка: вызывающий оставляет сохранённый content.
+func Render(lang string, ev *model.SystemEvent) string {
+	if ev == nil {
+		return ""
+	}
+	tmpl, ok := templates[lang][ev.Code]
+	if !ok {
+		if tmpl, ok = templates[DefaultLang][ev.Code]; !ok {
+			return ""
+		}
+	}
+	pairs := make([]string, 0, 2*len(ev.Params))
+	for k, v := range ev.Params {
+		pairs = append(pairs, "{"+k+"}", v)
+	}
+	return strings.NewReplacer(pairs...).Replace(tmpl)
+}
+
+// RequestLang — язык зрителя: параметр ?lang=, затем первый поддерживаемый из Accept-Language.
+// Пустая строка — язык не указан, content отдаётся как сохранён.
+func RequestLang(r *http.Request) string {
+	if lang := strings.ToLower(r.URL.Query().Get("lang")); Supported(lang) {
+		return lang
+	}
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		base, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if Supported(base) {
+			return base
+		}
+	}
+	return ""
+}
+
+// Localize перерисовывает content служебных сообщений со структурным событием на языке lang.
+func Localize(lang string, msgs []model.Message) {
+	if lang == "" {
+		return
+	}
+	for i := range msgs {
+		if text := Render(lang, msgs[i].SystemEvent); text != "" {
+			msgs[i].Content = text
+		}
+	}
+}
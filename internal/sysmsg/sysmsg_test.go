@@ -0,0 +1,72 @@
+package sysmsg
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/messenger/internal/model"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		lang string
+		ev   *model.SystemEvent
+		want string
+	}{
+		{"ru", "ru", New(MemberAdded, "Иван", "Мария"), "Иван добавил(а) Мария в группу"},
+		{"en", "en", New(MemberRemoved, "Ivan", "Maria"), "Ivan removed Maria from the group"},
+		{"no target", "en", New(MemberLeft, "Ivan", ""), "Ivan left the group"},
+		{"unsupported lang falls back", "de", New(MemberRoleGranted, "Иван", "Мария"), "Иван назначил(а) Мария администратором"},
+		{"placeholder in params not expanded", "en", New(MemberAdded, "{target}", "Maria"), "{target} added Maria to the group"},
+		{"unknown code", "en", &model.SystemEvent{Code: "chat_renamed"}, ""},
+		{"nil event", "en", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Render(tt.lang, tt.ev); got != tt.want {
+				t.Errorf("Render(%q) = %q, want %q", tt.lang, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestLang(t *testing.T) {
+	tests := []struct {
+		name, url, acceptLanguage, want string
+	}{
+		{"query", "/?lang=en", "ru", "en"},
+		{"query upper case", "/?lang=EN", "", "en"},
+		{"unsupported query uses header", "/?lang=de", "en-US,en;q=0.9", "en"},
+		{"region tag", "/", "en-GB", "en"},
+		{"first supported", "/", "de-DE, fr;q=0.8, ru;q=0.5", "ru"},
+		{"none supported", "/", "de, fr", ""},
+		{"no hints", "/", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.url, nil)
+			if tt.acceptLanguage != "" {
+				r.Header.Set("Accept-Language", tt.acceptLanguage)
+			}
+			if got := RequestLang(r); got != tt.want {
+				t.Errorf("RequestLang = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	msgs := []model.Message{
+		{Content: "Иван покинул(а) группу", SystemEvent: New(MemberLeft, "Иван", "")},
+		{Content: "hello"},
+	}
+	Localize("", msgs)
+	if msgs[0].Content != "Иван покинул(а) группу" {
+		t.Fatalf("empty lang changed content: %q", msgs[0].Content)
+	}
+	Localize("en", msgs)
+	if msgs[0].Content != "Иван left the group" || msgs[1].Content != "hello" {
+		t.Errorf("Localize(en) = %q, %q", msgs[0].Content, msgs[1].Content)
+	}
+}
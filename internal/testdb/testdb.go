@@ -0,0 +1,154 @@
+// Package testdb поднимает встроенный PostgreSQL (embedded-postgres, как у API с -dev) с применёнными
+// миграциями для интеграционных тестов репозиториев и обработчиков — без внешней БД.
+//
+// Запуск сервера занимает несколько секунд (при первом запуске бинарники PostgreSQL скачиваются в кеш),
+// поэтому один экземпляр обычно поднимается на весь пакет в TestMain:
+//
+//	func TestMain(m *testing.M) {
+//		db, err := testdb.Start(context.Background())
+//		if err != nil {
+//			fmt.Fprintln(os.Stderr, err)
+//			os.Exit(1)
+//		}
+//		code := m.Run()
+//		db.Close()
+//		os.Exit(code)
+//	}
+//
+// Репозитории создаются обычными конструкторами поверх DB.Pool (repository.NewUserRepository(db.Pool) и т.д.).
+package testdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/messenger/internal/dbmigrate"
+)
+
+const (
+	user     = "messenger"
+	password = "messenger_test"
+	database = "messenger_test"
+)
+
+// DB — запущенный встроенный PostgreSQL с пулом подключений к нему.
+type DB struct {
+	Pool *pgxpool.Pool
+	// URL — строка подключения (например, для TEST_DATABASE_URL).
+	URL string
+
+	pg  *embeddedpostgres.EmbeddedPostgres
+	dir string
+}
+
+// Start запускает PostgreSQL на свободном порту во временном каталоге и применяет миграции.
+// Остановка и удаление данных — Close.
+func Start(ctx context.Context) (*DB, error) {
+	port, err := freePort()
+	if err != nil {
+		return nil, fmt.Errorf("testdb: free port: %w", err)
+	}
+	dir, err := os.MkdirTemp("", "messenger-testdb-")
+	if err != nil {
+		return nil, fmt.Errorf("testdb: temp dir: %w", err)
+	}
+	pg := embeddedpostgres.NewDatabase(
+		embeddedpostgres.DefaultConfig().
+			Port(port).
+			Username(user).
+			Password(password).
+			Database(database).
+			DataPath(filepath.Join(dir, "data")).
+			RuntimePath(filepath.Join(dir, "runtime")).
+			StartTimeout(60 * time.Second),
+	)
+	if err := pg.Start(); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("testdb: start postgres: %w", err)
+	}
+	db := &DB{
+		URL: fmt.Sprintf("postgres://%s:%s@localhost:%d/%s?sslmode=disable", user, password, port, database),
+		pg:  pg,
+		dir: dir,
+	}
+	if db.Pool, err = pgxpool.New(ctx, db.URL); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("testdb: connect: %w", err)
+	}
+	migrations, err := migrationsDir()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := dbmigrate.Apply(ctx, db.Pool, migrations); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("testdb: %w", err)
+	}
+	return db, nil
+}
+
+// Close закрывает пул, останавливает PostgreSQL и удаляет его данные.
+func (d *DB) Close() error {
+	if d.Pool != nil {
+		d.Pool.Close()
+	}
+	err := d.pg.Stop()
+	if rmErr := os.RemoveAll(d.dir); err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+// New поднимает отдельный экземпляр на время одного теста и останавливает его в t.Cleanup.
+// Для пакета с несколькими тестами дешевле один Start в TestMain.
+func New(t testing.TB) *pgxpool.Pool {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	db, err := Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := db.Close(); err != nil {
+			t.Logf("testdb: close: %v", err)
+		}
+	})
+	return db.Pool
+}
+
+func freePort() (uint32, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return uint32(l.Addr().(*net.TCPAddr).Port), nil
+}
+
+// migrationsDir ищет каталог migrations в корне модуля (вверх от текущего каталога: go test запускается в каталоге пакета).
+func migrationsDir() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("testdb: %w", err)
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return filepath.Join(dir, "migrations"), nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", errors.New("testdb: go.mod not found above the working directory")
+		}
+		dir = parent
+	}
+}
@@ -5,20 +5,30 @@ import (
 	"context"
 	"encoding/json"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/messenger/internal/logger"
+	"github.com/messenger/internal/model"
+	"github.com/messenger/internal/sysmsg"
 )
 
 const (
-	writeWait      = 10 * time.Second
-	pongWait       = 60 * time.Second
-	pingPeriod     = (pongWait * 9) / 10
-	maxMessageSize = 4096
-	sendBufSize    = 256
+	writeWait   = 10 * time.Second
+	sendBufSize = 256
+	// defaultPongWait / defaultMaxMessageSize — если HubConfig.PongWait / MaxMessageSize не заданы.
+	defaultPongWait       = 60 * time.Second
+	defaultMaxMessageSize = 4096
+	// idleCloseReason — текст кадра закрытия при отключении по бездействию (HubConfig.IdleTimeout).
+	idleCloseReason = "idle timeout"
 )
 
+// PingInterval — как часто сервер шлёт ping при таймауте pong pongWait: с запасом, чтобы pong успел прийти.
+func PingInterval(pongWait time.Duration) time.Duration {
+	return pongWait * 9 / 10
+}
+
 // bufPool pools bytes.Buffer for JSON encoding in the hot-path (writePump).
 var bufPool = sync.Pool{
 	New: func() any { return new(bytes.Buffer) },
@@ -31,6 +41,19 @@ type Client struct {
 	conn   *websocket.Conn
 	send   chan OutgoingMessage
 	userID string
+	// sessionID — сессия устройства, с которой открыто соединение (для закрытия при logout).
+	sessionID string
+	// lang — язык служебных сообщений (sysmsg.RequestLang запроса подключения); пусто — как сохранены.
+	lang string
+
+	// recordingChatID — чат, в котором клиент сейчас записывает голосовое (пусто — не записывает).
+	recordingMu     sync.Mutex
+	recordingChatID string
+	// recordingTimer снимает индикатор записи, если клиент не прислал стоп за recordingTimeout.
+	recordingTimer *time.Timer
+
+	// lastActive — время (UnixNano) последнего сообщения от клиента; pong его не обновляет.
+	lastActive atomic.Int64
 
 	// done is used as a non-blocking guard in sendToClient.
 	done chan struct{}
@@ -40,14 +63,18 @@ type Client struct {
 	wg     sync.WaitGroup
 }
 
-func NewClient(hub *Hub, conn *websocket.Conn, userID string) *Client {
-	return &Client{
-		hub:    hub,
-		conn:   conn,
-		send:   make(chan OutgoingMessage, sendBufSize),
-		userID: userID,
-		done:   make(chan struct{}),
+func NewClient(hub *Hub, conn *websocket.Conn, userID, sessionID, lang string) *Client {
+	c := &Client{
+		hub:       hub,
+		conn:      conn,
+		send:      make(chan OutgoingMessage, sendBufSize),
+		userID:    userID,
+		sessionID: sessionID,
+		lang:      lang,
+		done:      make(chan struct{}),
 	}
+	c.lastActive.Store(time.Now().UnixNano())
+	return c
 }
 
 // Start launches ReadPump and WritePump goroutines with controlled lifecycle.
@@ -85,7 +112,8 @@ func (c *Client) readPump(ctx context.Context) {
 		c.conn.Close()
 	}()
 
-	c.conn.SetReadLimit(maxMessageSize)
+	pongWait := c.hub.cfg.PongWait
+	c.conn.SetReadLimit(c.hub.cfg.MaxMessageSize)
 	if err := c.conn.SetReadDeadline(time.Now().Add(pongWait)); err != nil {
 		logger.Errorf("ws set read deadline user=%s: %v", c.userID, err)
 		return
@@ -108,6 +136,7 @@ func (c *Client) readPump(ctx context.Context) {
 			}
 			return
 		}
+		c.lastActive.Store(time.Now().UnixNano())
 
 		var msg IncomingMessage
 		if err := json.Unmarshal(raw, &msg); err != nil {
@@ -121,9 +150,35 @@ func (c *Client) readPump(ctx context.Context) {
 
 // writePump writes messages to the WebSocket connection.
 // Exits on ctx cancellation, write error, or connection close.
+// localize перерисовывает текст служебного сообщения в new_message на языке клиента. Payload общий для всех
+// получателей рассылки, поэтому сообщение копируется, а не меняется на месте.
+func (c *Client) localize(msg OutgoingMessage) OutgoingMessage {
+	if c.lang == "" || msg.Type != EventNewMessage {
+		return msg
+	}
+	m, ok := msg.Payload.(*model.Message)
+	if !ok || m.SystemEvent == nil {
+		return msg
+	}
+	if text := sysmsg.Render(c.lang, m.SystemEvent); text != "" && text != m.Content {
+		localized := *m
+		localized.Content = text
+		msg.Payload = &localized
+	}
+	return msg
+}
+
 func (c *Client) writePump(ctx context.Context) {
 	defer c.wg.Done()
-	ticker := time.NewTicker(pingPeriod)
+	ticker := time.NewTicker(PingInterval(c.hub.cfg.PongWait))
+	// idleC — проверка бездействия клиента; nil (никогда не срабатывает), если IdleTimeout не задан.
+	var idleC <-chan time.Time
+	idleTimeout := c.hub.cfg.IdleTimeout
+	if idleTimeout > 0 {
+		idleTicker := time.NewTicker(max(idleTimeout/4, time.Second))
+		defer idleTicker.Stop()
+		idleC = idleTicker.C
+	}
 	defer func() {
 		ticker.Stop()
 		c.conn.Close()
@@ -144,7 +199,7 @@ func (c *Client) writePump(ctx context.Context) {
 			buf := bufPool.Get().(*bytes.Buffer)
 			buf.Reset()
 			enc := json.NewEncoder(buf)
-			if err := enc.Encode(msg); err != nil {
+			if err := enc.Encode(c.localize(msg)); err != nil {
 				bufPool.Put(buf)
 				logger.Errorf("ws marshal error user=%s: %v", c.userID, err)
 				continue
@@ -167,6 +222,16 @@ func (c *Client) writePump(ctx context.Context) {
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
+		case <-idleC:
+			if time.Since(time.Unix(0, c.lastActive.Load())) < idleTimeout {
+				continue
+			}
+			logger.Infof("ws idle timeout user=%s", c.userID)
+			closeMsg := websocket.FormatCloseMessage(websocket.CloseGoingAway, idleCloseReason)
+			if err := c.conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(writeWait)); err != nil {
+				logger.Errorf("ws close message user=%s: %v", c.userID, err)
+			}
+			return
 		}
 	}
 }
@@ -2,35 +2,85 @@ package ws
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/messenger/internal/logger"
+	"github.com/messenger/internal/maintenance"
 	"github.com/messenger/internal/model"
 	"github.com/messenger/internal/repository"
+	"github.com/messenger/internal/sysmsg"
 )
 
 // PushNotifier отправляет пуш-уведомления. Если nil — пуши не отправляются.
 type PushNotifier interface {
-	Notify(ctx context.Context, userID, title, body string, data map[string]string)
+	NotifyBatch(ctx context.Context, userIDs []string, title, body string, data map[string]string)
+	// ChatRead сообщает, что пользователь прочитал чат: недоставленные уведомления из него не нужно
+	// отправлять повторно на новые устройства.
+	ChatRead(ctx context.Context, userID, chatID string)
+}
+
+// HubConfig — настраиваемые политики хаба (из config.Config).
+type HubConfig struct {
+	// AllowedReactions — разрешённые эмодзи реакций; пустой список — любые.
+	AllowedReactions []string
+	// MaxReactionsPerUser — лимит реакций одного пользователя на одно сообщение; 0 — без ограничения.
+	MaxReactionsPerUser int
+	// AwayAfter — после скольких секунд бездействия (сообщает клиент) online меняется на away; 0 — не менять.
+	AwayAfter time.Duration
+	// EditWindow / DeleteWindow — сколько времени после отправки можно редактировать/удалять своё сообщение.
+	// 0 — без ограничения. Администраторы группы не ограничены.
+	EditWindow   time.Duration
+	DeleteWindow time.Duration
+	// PushConcurrency — сколько push-уведомлений хаб отправляет одновременно; <= 0 — 16.
+	PushConcurrency int
+	// Maintenance — режим обслуживания: пока включён, изменяющие события от не-администраторов
+	// отклоняются. nil — режим не используется.
+	Maintenance *maintenance.Mode
+	// FileURLHosts — внешние хосты, ссылки на которые допустимы в file_url (например CDN хранилища).
+	// Пусто — только свои пути /api/files/... и /api/audio/....
+	FileURLHosts []string
+	// IdleTimeout — соединение, от которого столько времени не было сообщений (pong не в счёт),
+	// закрывается с CloseGoingAway. 0 — не закрывается.
+	IdleTimeout time.Duration
+	// PongWait — сколько ждать pong (или любое сообщение) от клиента до разрыва; ping шлётся раз в
+	// PingInterval(PongWait). <= 0 — 60 с.
+	PongWait time.Duration
+	// MaxMessageSize — максимальный размер входящего сообщения в байтах; <= 0 — 4096.
+	MaxMessageSize int64
 }
 
 type Hub struct {
-	mu          sync.RWMutex
-	clients     map[string]map[*Client]struct{}
-	total       int
-	maxConns    int
-	chatRepo    *repository.ChatRepository
-	msgRepo     *repository.MessageRepository
-	userRepo    *repository.UserRepository
-	reactRepo   *repository.ReactionRepository
-	pinnedRepo  *repository.PinnedRepository
-	pushClient  PushNotifier
-	register    chan *Client
-	unregister  chan *Client
-	done        chan struct{}
+	mu         sync.RWMutex
+	clients    map[string]map[*Client]struct{}
+	total      int
+	maxConns   int
+	chatRepo   *repository.ChatRepository
+	msgRepo    *repository.MessageRepository
+	userRepo   *repository.UserRepository
+	reactRepo  *repository.ReactionRepository
+	pinnedRepo *repository.PinnedRepository
+	pushClient PushNotifier
+	cfg        HubConfig
+	// allowedReactions — множество из cfg.AllowedReactions; nil — без ограничений.
+	allowedReactions map[string]struct{}
+	// autoAway — пользователи, переведённые в away по бездействию (а не вручную); защищено mu.
+	autoAway map[string]struct{}
+	// pushSem ограничивает число одновременных запросов к push-сервису (cfg.PushConcurrency).
+	pushSem chan struct{}
+	// instanceID отличает heartbeat этого экземпляра API от остальных (user_presence_pings).
+	instanceID string
+	register   chan *Client
+	unregister chan *Client
+	done       chan struct{}
 }
 
 func NewHub(
@@ -41,26 +91,47 @@ func NewHub(
 	pinnedRepo *repository.PinnedRepository,
 	maxConns int,
 	pushClient PushNotifier,
+	cfg HubConfig,
 ) *Hub {
 	if maxConns <= 0 {
 		maxConns = 10000
 	}
+	var allowedReactions map[string]struct{}
+	if len(cfg.AllowedReactions) > 0 {
+		allowedReactions = make(map[string]struct{}, len(cfg.AllowedReactions))
+		for _, e := range cfg.AllowedReactions {
+			allowedReactions[e] = struct{}{}
+		}
+	}
+	if cfg.PushConcurrency <= 0 {
+		cfg.PushConcurrency = 16
+	}
+	if cfg.PongWait <= 0 {
+		cfg.PongWait = defaultPongWait
+	}
+	if cfg.MaxMessageSize <= 0 {
+		cfg.MaxMessageSize = defaultMaxMessageSize
+	}
 	return &Hub{
-		clients:    make(map[string]map[*Client]struct{}),
-		maxConns:   maxConns,
-		chatRepo:   chatRepo,
-		msgRepo:    msgRepo,
-		userRepo:   userRepo,
-		reactRepo:  reactRepo,
-		pinnedRepo: pinnedRepo,
-		pushClient: pushClient,
-		register:   make(chan *Client, 64),
-		unregister: make(chan *Client, 64),
-		done:       make(chan struct{}),
+		clients:          make(map[string]map[*Client]struct{}),
+		autoAway:         make(map[string]struct{}),
+		instanceID:       uuid.NewString(),
+		maxConns:         maxConns,
+		chatRepo:         chatRepo,
+		msgRepo:          msgRepo,
+		userRepo:         userRepo,
+		reactRepo:        reactRepo,
+		pinnedRepo:       pinnedRepo,
+		pushClient:       pushClient,
+		cfg:              cfg,
+		allowedReactions: allowedReactions,
+		pushSem:          make(chan struct{}, cfg.PushConcurrency),
+		register:         make(chan *Client, 64),
+		unregister:       make(chan *Client, 64),
+		done:             make(chan struct{}),
 	}
 }
 
-
 func (h *Hub) Run(ctx context.Context) {
 	defer close(h.done)
 	for {
@@ -115,10 +186,15 @@ func (h *Hub) addClient(c *Client) {
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	if err := h.userRepo.SetOnline(ctx, c.userID, true); err != nil {
+	status, err := h.userRepo.SetOnline(ctx, c.userID, h.instanceID)
+	if err != nil {
 		logger.Errorf("ws set online user=%s: %v", c.userID, err)
+		status = model.PresenceOnline
+	}
+	h.broadcastUserStatus(c.userID, status)
+	if h.cfg.Maintenance != nil && h.cfg.Maintenance.Enabled() {
+		h.sendToClient(c, OutgoingMessage{Type: EventMaintenance, Payload: h.cfg.Maintenance.Status()})
 	}
-	h.broadcastUserStatus(c.userID, true)
 }
 
 func (h *Hub) removeClient(c *Client) {
@@ -137,29 +213,54 @@ func (h *Hub) removeClient(c *Client) {
 	lastClient := len(clients) == 0
 	if lastClient {
 		delete(h.clients, c.userID)
+		delete(h.autoAway, c.userID)
 	}
 	h.mu.Unlock()
 
 	// Network I/O outside the lock.
 	c.Close()
 
+	c.recordingMu.Lock()
+	recordingChatID := c.recordingChatID
+	c.recordingChatID = ""
+	if c.recordingTimer != nil {
+		c.recordingTimer.Stop()
+		c.recordingTimer = nil
+	}
+	c.recordingMu.Unlock()
+	if recordingChatID != "" {
+		h.broadcastRecordingStopped(context.Background(), c, recordingChatID)
+	}
+
 	if lastClient {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
-		if err := h.userRepo.SetOnline(ctx, c.userID, false); err != nil {
+		offline, err := h.userRepo.SetOffline(ctx, c.userID, h.instanceID)
+		if err != nil {
 			logger.Errorf("ws set offline user=%s: %v", c.userID, err)
 		}
-		h.broadcastUserStatus(c.userID, false)
+		// Пользователь, подключённый к другому экземпляру, остаётся онлайн — не рассылаем user_offline.
+		if offline || err != nil {
+			h.broadcastUserStatus(c.userID, model.PresenceOffline)
+		}
 	}
 }
 
 // HandleMessage dispatches incoming WebSocket messages.
 func (h *Hub) HandleMessage(ctx context.Context, c *Client, msg IncomingMessage) {
+	if !isReadOnlyEvent(msg.Type) && h.cfg.Maintenance != nil && h.cfg.Maintenance.Blocks(ctx, c.userID) {
+		h.sendToClient(c, OutgoingMessage{Type: EventError, Payload: h.cfg.Maintenance.Status().Message})
+		return
+	}
 	switch msg.Type {
 	case EventNewMessage:
 		h.handleNewMessage(ctx, c, msg)
 	case EventTyping:
 		h.handleTyping(ctx, c, msg)
+	case EventRecordingVoice:
+		h.handleRecording(ctx, c, msg, true)
+	case EventRecordingStopped:
+		h.handleRecording(ctx, c, msg, false)
 	case EventMessageRead:
 		h.handleMessageRead(ctx, c, msg)
 	case EventMessageEdited:
@@ -174,68 +275,147 @@ func (h *Hub) HandleMessage(ctx context.Context, c *Client, msg IncomingMessage)
 		h.handlePinMessage(ctx, c, msg)
 	case EventMessageUnpinned:
 		h.handleUnpinMessage(ctx, c, msg)
+	case EventFetchMessages:
+		h.handleFetchMessages(ctx, c, msg)
+	case EventSetPresence:
+		h.handleSetPresence(ctx, c, msg)
 	default:
 		h.sendToClient(c, OutgoingMessage{Type: EventError, Payload: "unknown event type"})
 	}
 }
 
+// isReadOnlyEvent — событие ничего не сохраняет и разрешено в режиме обслуживания. Список разрешающий:
+// новое событие по умолчанию считается изменяющим данные и блокируется.
+func isReadOnlyEvent(t EventType) bool {
+	switch t {
+	case EventTyping, EventRecordingVoice, EventRecordingStopped, EventFetchMessages:
+		return true
+	}
+	return false
+}
+
 func (h *Hub) handleNewMessage(ctx context.Context, c *Client, msg IncomingMessage) {
 	defer logger.DeferLogDuration("ws.handleNewMessage", time.Now())()
-	if msg.ChatID == "" || (msg.Content == "" && msg.FileURL == "") {
-		h.sendToClient(c, OutgoingMessage{Type: EventError, Payload: "chat_id and content required"})
-		return
+	if _, err := h.PostMessage(ctx, c.userID, msg); err != nil {
+		h.sendToClient(c, OutgoingMessage{Type: EventError, Payload: err.Msg})
+	}
+}
+
+// SendError — сообщение не принято: Msg — текст для клиента, Status — HTTP-код для REST.
+type SendError struct {
+	Status int
+	Msg    string
+}
+
+func (e *SendError) Error() string { return e.Msg }
+
+// PostMessage сохраняет сообщение пользователя userID и рассылает его участникам чата (с квитанциями
+// доставки и пушами). Общая для WebSocket (new_message) и REST (POST /api/chats/{chatId}/messages).
+func (h *Hub) PostMessage(ctx context.Context, userID string, msg IncomingMessage) (*model.Message, *SendError) {
+	if msg.ChatID == "" || (msg.Content == "" && msg.FileURL == "" && len(msg.Attachments) == 0 && msg.Location == nil && msg.ContactUserID == "") {
+		return nil, &SendError{Status: http.StatusBadRequest, Msg: "chat_id and content required"}
+	}
+	attachments, errMsg := normalizeAttachments(msg.Attachments, h.cfg.FileURLHosts)
+	if errMsg == "" && msg.FileURL != "" && !allowedFileURL(msg.FileURL, h.cfg.FileURLHosts) {
+		errMsg = "invalid file_url"
+	}
+	if errMsg == "" {
+		errMsg = validateLocation(msg.ContentType, msg.Location)
+	}
+	if errMsg != "" {
+		return nil, &SendError{Status: http.StatusBadRequest, Msg: errMsg}
 	}
 
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	isMember, err := h.chatRepo.IsMember(ctx, msg.ChatID, c.userID)
+	isMember, err := h.chatRepo.IsMember(ctx, msg.ChatID, userID)
 	if err != nil {
-		logger.Errorf("ws check membership chat=%s user=%s: %v", msg.ChatID, c.userID, err)
-		h.sendToClient(c, OutgoingMessage{Type: EventError, Payload: "internal error"})
-		return
+		logger.Errorf("ws check membership chat=%s user=%s: %v", msg.ChatID, userID, err)
+		return nil, &SendError{Status: http.StatusInternalServerError, Msg: "internal error"}
 	}
 	if !isMember {
-		h.sendToClient(c, OutgoingMessage{Type: EventError, Payload: "not a member"})
-		return
+		return nil, &SendError{Status: http.StatusForbidden, Msg: "not a member"}
+	}
+	if err := h.sendAllowed(ctx, userID, msg.ChatID); err != nil {
+		return nil, err
+	}
+
+	var contact *model.ContactCard
+	if msg.ContentType == model.ContentTypeContact {
+		if msg.ContactUserID == "" {
+			return nil, &SendError{Status: http.StatusBadRequest, Msg: "contact_user_id required"}
+		}
+		u, err := h.userRepo.GetByID(ctx, msg.ContactUserID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return nil, &SendError{Status: http.StatusBadRequest, Msg: "contact user not found"}
+			}
+			logger.Errorf("ws get contact user=%s: %v", msg.ContactUserID, err)
+			return nil, &SendError{Status: http.StatusInternalServerError, Msg: "internal error"}
+		}
+		pub := u.ToPublic()
+		contact = &model.ContactCard{UserID: u.ID, Username: u.Username, AvatarURL: u.AvatarURL, User: &pub}
+	} else if msg.ContactUserID != "" {
+		return nil, &SendError{Status: http.StatusBadRequest, Msg: "contact_user_id requires content_type contact"}
 	}
 
 	contentType := model.ContentTypeText
 	if msg.ContentType != "" {
 		contentType = msg.ContentType
+	} else if len(attachments) > 0 {
+		contentType = albumContentType(attachments)
 	}
 
 	var replyToID *string
 	if msg.ReplyToID != "" {
+		// Ответ только на видимое отправителю сообщение этого же чата — иначе превью раскрыло бы чужой чат.
+		ok := uuid.Validate(msg.ReplyToID) == nil
+		if ok {
+			if ok, err = h.msgRepo.CanReplyTo(ctx, msg.ReplyToID, msg.ChatID, userID); err != nil {
+				logger.Errorf("ws check reply_to message=%s chat=%s: %v", msg.ReplyToID, msg.ChatID, err)
+				return nil, &SendError{Status: http.StatusInternalServerError, Msg: "internal error"}
+			}
+		}
+		if !ok {
+			return nil, &SendError{Status: http.StatusBadRequest, Msg: "reply_to message not found in this chat"}
+		}
 		replyToID = &msg.ReplyToID
 	}
 
 	// Нормализация имени файла: "+" часто приходит вместо пробела (URL-кодирование), сохраняем в БД с пробелами (UTF-8).
 	fileName := strings.TrimSpace(strings.ReplaceAll(msg.FileName, "+", " "))
+	fileURL, fileSize := msg.FileURL, msg.FileSize
+	if len(attachments) > 0 {
+		// Для старых клиентов первый файл альбома дублируется в file_*.
+		fileURL, fileName, fileSize = attachments[0].FileURL, attachments[0].FileName, attachments[0].FileSize
+	}
 	now := time.Now().UTC()
 	m := &model.Message{
 		ID:          uuid.New().String(),
 		ChatID:      msg.ChatID,
-		SenderID:    c.userID,
+		SenderID:    userID,
 		Content:     msg.Content,
 		ContentType: contentType,
-		FileURL:     msg.FileURL,
+		FileURL:     fileURL,
 		FileName:    fileName,
-		FileSize:    msg.FileSize,
+		FileSize:    fileSize,
 		Status:      model.MessageStatusSent,
 		ReplyToID:   replyToID,
 		CreatedAt:   now,
+		Attachments: attachments,
+		Location:    msg.Location,
+		Contact:     contact,
 	}
 
 	if err := h.msgRepo.Create(ctx, m); err != nil {
-		logger.Errorf("ws save message chat=%s user=%s: %v", msg.ChatID, c.userID, err)
-		h.sendToClient(c, OutgoingMessage{Type: EventError, Payload: "failed to save message"})
-		return
+		logger.Errorf("ws save message chat=%s user=%s: %v", msg.ChatID, userID, err)
+		return nil, &SendError{Status: http.StatusInternalServerError, Msg: "failed to save message"}
 	}
 
-	sender, err := h.userRepo.GetByID(ctx, c.userID)
+	sender, err := h.userRepo.GetByID(ctx, userID)
 	if err != nil {
-		logger.Errorf("ws get sender user=%s: %v", c.userID, err)
+		logger.Errorf("ws get sender user=%s: %v", userID, err)
 	} else {
 		pub := sender.ToPublic()
 		m.Sender = &pub
@@ -258,15 +438,26 @@ func (h *Hub) handleNewMessage(ctx context.Context, c *Client, msg IncomingMessa
 	memberIDs, err := h.chatRepo.GetMemberIDs(ctx, msg.ChatID)
 	if err != nil {
 		logger.Errorf("ws get members chat=%s: %v", msg.ChatID, err)
-		return
+		return m, nil
 	}
 
 	out := OutgoingMessage{Type: EventNewMessage, Payload: m}
 	for _, uid := range memberIDs {
 		h.sendToUser(uid, out)
 	}
+	if replyToID != nil {
+		h.broadcastThreadUpdate(ctx, msg.ChatID, *replyToID, memberIDs)
+	}
 
-	// Пуш-уведомления получателям (кроме отправителя)
+	// Квитанции о доставке — получателям с живым соединением (к этому или другому экземпляру).
+	onlineIDs := h.OnlineUsers(ctx, memberIDs)
+	delivered := slices.DeleteFunc(slices.Clone(onlineIDs), func(uid string) bool { return uid == userID })
+	if err := h.msgRepo.MarkDelivered(ctx, m.ID, delivered); err != nil {
+		logger.Errorf("ws mark delivered message=%s: %v", m.ID, err)
+	}
+
+	// Пуш-уведомления получателям (кроме отправителя), у которых нет активного WebSocket —
+	// подключённые уже получили сообщение через new_message.
 	if h.pushClient != nil {
 		senderName := ""
 		if m.Sender != nil {
@@ -276,20 +467,154 @@ func (h *Hub) handleNewMessage(ctx context.Context, c *Client, msg IncomingMessa
 			senderName = "Сообщение"
 		}
 		body := m.Content
-		if m.ContentType != "text" || body == "" {
+		switch {
+		case m.ContentType == model.ContentTypeLocation:
+			body = "📍 Location"
+		case m.ContentType == model.ContentTypeContact:
+			body = "👤 " + m.Contact.Username
+		case m.ContentType != "text" || body == "":
 			body = "Вложение"
 		}
 		if len(body) > 120 {
 			body = body[:117] + "..."
 		}
 		data := map[string]string{"chat_id": msg.ChatID, "message_id": m.ID}
+		// Пользователям с живым соединением (к этому или другому экземпляру) пуш не нужен.
+		online := make(map[string]struct{}, len(memberIDs))
+		for _, uid := range onlineIDs {
+			online[uid] = struct{}{}
+		}
+		recipients := make([]string, 0, len(memberIDs))
 		for _, uid := range memberIDs {
-			if uid != c.userID {
-				uid := uid
-				go h.pushClient.Notify(context.Background(), uid, senderName, body, data)
+			if _, ok := online[uid]; ok || uid == userID {
+				continue
+			}
+			recipients = append(recipients, uid)
+		}
+		// «Не беспокоить» — без push.
+		dnd, err := h.userRepo.DoNotDisturbIDs(ctx, recipients)
+		if err != nil {
+			logger.Errorf("ws get dnd users chat=%s: %v", msg.ChatID, err)
+		}
+		targets := recipients[:0]
+		for _, uid := range recipients {
+			if _, ok := dnd[uid]; !ok {
+				targets = append(targets, uid)
 			}
 		}
+		if len(targets) > 0 {
+			go h.notifyPush(targets, senderName, body, data)
+		}
 	}
+	return m, nil
+}
+
+// pushBatchSize — получателей в одном запросе к push-сервису (его предел — 1000).
+const pushBatchSize = 500
+
+// notifyPush рассылает пуш получателям пакетами (обычно одним запросом на сообщение), держа не больше
+// cfg.PushConcurrency запросов одновременно на весь хаб.
+func (h *Hub) notifyPush(userIDs []string, title, body string, data map[string]string) {
+	for batch := range slices.Chunk(userIDs, pushBatchSize) {
+		h.pushSem <- struct{}{}
+		go func() {
+			defer func() { <-h.pushSem }()
+			h.pushClient.NotifyBatch(context.Background(), batch, title, body, data)
+		}()
+	}
+}
+
+// maxAttachments — максимум файлов в одном сообщении-альбоме.
+const maxAttachments = 10
+
+// allowedFileURL проверяет file_url из сообщения: путь к файлу, загруженному через этот сервер
+// (/api/files/<имя> или /api/audio/<имя>), или https-ссылка на хост из fileHosts.
+// Прочие ссылки клиент отрисовал бы как вложение — это подмена содержимого.
+func allowedFileURL(raw string, fileHosts []string) bool {
+	if strings.HasPrefix(raw, "/") {
+		name, ok := strings.CutPrefix(raw, "/api/files/")
+		if !ok {
+			name, ok = strings.CutPrefix(raw, "/api/audio/")
+		}
+		return ok && name != "" && name != "." && name != ".." && !strings.ContainsAny(name, "/\\?#%")
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.User != nil || u.Host == "" {
+		return false
+	}
+	for _, host := range fileHosts {
+		if strings.EqualFold(u.Host, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeAttachments проверяет вложения альбома и нормализует имена файлов.
+// Возвращает текст ошибки для клиента, если вложения некорректны.
+func normalizeAttachments(in []model.Attachment, fileHosts []string) ([]model.Attachment, string) {
+	if len(in) == 0 {
+		return nil, ""
+	}
+	if len(in) > maxAttachments {
+		return nil, fmt.Sprintf("too many attachments (max %d)", maxAttachments)
+	}
+	out := make([]model.Attachment, len(in))
+	for i, a := range in {
+		if a.FileURL == "" {
+			return nil, "attachment file_url required"
+		}
+		if !allowedFileURL(a.FileURL, fileHosts) {
+			return nil, "invalid attachment file_url"
+		}
+		switch a.ContentType {
+		case "":
+			a.ContentType = model.ContentTypeFile
+		case model.ContentTypeImage, model.ContentTypeFile, model.ContentTypeVoice:
+		default:
+			return nil, "invalid attachment content_type"
+		}
+		a.FileName = strings.TrimSpace(strings.ReplaceAll(a.FileName, "+", " "))
+		// Размеры и BlurHash подставляются при сохранении из данных загрузки.
+		a.Width, a.Height, a.BlurHash = 0, 0, ""
+		if len(a.FileName) > 255 {
+			return nil, "attachment file_name too long"
+		}
+		out[i] = a
+	}
+	return out, ""
+}
+
+// validateLocation проверяет геопозицию: она обязательна для content_type "location" и допустима только с ним.
+func validateLocation(contentType model.ContentType, loc *model.Location) string {
+	if contentType != model.ContentTypeLocation {
+		if loc != nil {
+			return "location requires content_type location"
+		}
+		return ""
+	}
+	if loc == nil {
+		return "location required"
+	}
+	if math.IsNaN(loc.Latitude) || loc.Latitude < -90 || loc.Latitude > 90 ||
+		math.IsNaN(loc.Longitude) || loc.Longitude < -180 || loc.Longitude > 180 {
+		return "invalid coordinates"
+	}
+	loc.Label = strings.TrimSpace(loc.Label)
+	if len(loc.Label) > 200 {
+		return "location label too long"
+	}
+	return ""
+}
+
+// albumContentType — "image" для альбома только из картинок, иначе "file".
+func albumContentType(attachments []model.Attachment) model.ContentType {
+	for _, a := range attachments {
+		if a.ContentType != model.ContentTypeImage {
+			return model.ContentTypeFile
+		}
+	}
+	return model.ContentTypeImage
 }
 
 func (h *Hub) handleEditMessage(ctx context.Context, c *Client, msg IncomingMessage) {
@@ -311,6 +636,10 @@ func (h *Hub) handleEditMessage(ctx context.Context, c *Client, msg IncomingMess
 		h.sendToClient(c, OutgoingMessage{Type: EventError, Payload: "can only edit own messages"})
 		return
 	}
+	if !h.withinWindow(ctx, c, original, h.cfg.EditWindow) {
+		h.sendToClient(c, OutgoingMessage{Type: EventError, Payload: "edit window has expired"})
+		return
+	}
 
 	now := time.Now().UTC()
 	if err := h.msgRepo.UpdateContent(ctx, msg.MessageID, msg.Content, now); err != nil {
@@ -349,8 +678,26 @@ func (h *Hub) handleDeleteMessage(ctx context.Context, c *Client, msg IncomingMe
 		h.sendToClient(c, OutgoingMessage{Type: EventError, Payload: "message not found"})
 		return
 	}
+
+	switch msg.Scope {
+	case "", DeleteScopeEveryone:
+	case DeleteScopeMe:
+		h.hideMessageForUser(ctx, c, original)
+		return
+	default:
+		h.sendToClient(c, OutgoingMessage{Type: EventError, Payload: "invalid delete scope"})
+		return
+	}
+
 	if original.SenderID != c.userID {
-		h.sendToClient(c, OutgoingMessage{Type: EventError, Payload: "can only delete own messages"})
+		role, err := h.chatRepo.GetMemberRole(ctx, original.ChatID, c.userID)
+		if err != nil || role != "admin" {
+			h.sendToClient(c, OutgoingMessage{Type: EventError, Payload: "can only delete own messages"})
+			return
+		}
+	}
+	if !h.withinWindow(ctx, c, original, h.cfg.DeleteWindow) {
+		h.sendToClient(c, OutgoingMessage{Type: EventError, Payload: "delete window has expired"})
 		return
 	}
 
@@ -367,16 +714,53 @@ func (h *Hub) handleDeleteMessage(ctx context.Context, c *Client, msg IncomingMe
 	out := OutgoingMessage{Type: EventMessageDeleted, Payload: MessageDeletedPayload{
 		MessageID: msg.MessageID,
 		ChatID:    original.ChatID,
+		Scope:     DeleteScopeEveryone,
 	}}
 	for _, uid := range memberIDs {
 		h.sendToUser(uid, out)
 	}
 }
 
+// hideMessageForUser скрывает сообщение только у текущего пользователя ("удалить у меня").
+// Доступно любому участнику чата; событие уходит только в соединения этого пользователя.
+func (h *Hub) hideMessageForUser(ctx context.Context, c *Client, m *model.Message) {
+	isMember, err := h.chatRepo.IsMember(ctx, m.ChatID, c.userID)
+	if err != nil || !isMember {
+		h.sendToClient(c, OutgoingMessage{Type: EventError, Payload: "not a member"})
+		return
+	}
+	if err := h.msgRepo.HideForUser(ctx, m.ID, c.userID); err != nil {
+		logger.Errorf("ws hide message %s user=%s: %v", m.ID, c.userID, err)
+		h.sendToClient(c, OutgoingMessage{Type: EventError, Payload: "failed to delete"})
+		return
+	}
+	h.sendToUser(c.userID, OutgoingMessage{Type: EventMessageDeleted, Payload: MessageDeletedPayload{
+		MessageID: m.ID,
+		ChatID:    m.ChatID,
+		Scope:     DeleteScopeMe,
+	}})
+}
+
+// withinWindow проверяет, что сообщение отправлено не раньше window назад.
+// window == 0 — без ограничения; администраторы чата не ограничены.
+func (h *Hub) withinWindow(ctx context.Context, c *Client, m *model.Message, window time.Duration) bool {
+	if window <= 0 || time.Since(m.CreatedAt) <= window {
+		return true
+	}
+	role, err := h.chatRepo.GetMemberRole(ctx, m.ChatID, c.userID)
+	return err == nil && role == "admin"
+}
+
 func (h *Hub) handleAddReaction(ctx context.Context, c *Client, msg IncomingMessage) {
 	if msg.MessageID == "" || msg.Emoji == "" {
 		return
 	}
+	if h.allowedReactions != nil {
+		if _, ok := h.allowedReactions[msg.Emoji]; !ok {
+			h.sendToClient(c, OutgoingMessage{Type: EventError, Payload: "reaction not allowed"})
+			return
+		}
+	}
 
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
@@ -386,7 +770,11 @@ func (h *Hub) handleAddReaction(ctx context.Context, c *Client, msg IncomingMess
 		return
 	}
 
-	if err := h.reactRepo.Add(ctx, msg.MessageID, c.userID, msg.Emoji); err != nil {
+	if err := h.reactRepo.AddLimited(ctx, msg.MessageID, c.userID, msg.Emoji, h.cfg.MaxReactionsPerUser); err != nil {
+		if errors.Is(err, repository.ErrReactionLimit) {
+			h.sendToClient(c, OutgoingMessage{Type: EventError, Payload: fmt.Sprintf("reaction limit reached (max %d per message)", h.cfg.MaxReactionsPerUser)})
+			return
+		}
 		logger.Errorf("ws add reaction %s: %v", msg.MessageID, err)
 		return
 	}
@@ -449,6 +837,10 @@ func (h *Hub) handlePinMessage(ctx context.Context, c *Client, msg IncomingMessa
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
+	if !h.canPin(ctx, c, msg.ChatID) {
+		return
+	}
+
 	if err := h.pinnedRepo.Pin(ctx, msg.ChatID, msg.MessageID, c.userID); err != nil {
 		logger.Errorf("ws pin message %s: %v", msg.MessageID, err)
 		return
@@ -477,6 +869,10 @@ func (h *Hub) handleUnpinMessage(ctx context.Context, c *Client, msg IncomingMes
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
+	if !h.canPin(ctx, c, msg.ChatID) {
+		return
+	}
+
 	if err := h.pinnedRepo.Unpin(ctx, msg.ChatID, msg.MessageID); err != nil {
 		logger.Errorf("ws unpin message %s: %v", msg.MessageID, err)
 		return
@@ -496,25 +892,259 @@ func (h *Hub) handleUnpinMessage(ctx context.Context, c *Client, msg IncomingMes
 	}
 }
 
-func (h *Hub) handleTyping(ctx context.Context, c *Client, msg IncomingMessage) {
+// canPin проверяет членство и политику закрепления чата; при отказе отправляет клиенту EventError.
+func (h *Hub) canPin(ctx context.Context, c *Client, chatID string) bool {
+	role, err := h.chatRepo.GetMemberRole(ctx, chatID, c.userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			h.sendToClient(c, OutgoingMessage{Type: EventError, Payload: "not a member"})
+		} else {
+			logger.Errorf("ws pin get role chat=%s user=%s: %v", chatID, c.userID, err)
+			h.sendToClient(c, OutgoingMessage{Type: EventError, Payload: "internal error"})
+		}
+		return false
+	}
+	chat, err := h.chatRepo.GetByID(ctx, chatID)
+	if err != nil {
+		logger.Errorf("ws pin get chat=%s: %v", chatID, err)
+		h.sendToClient(c, OutgoingMessage{Type: EventError, Payload: "internal error"})
+		return false
+	}
+	if (chat.PinPolicy == model.PinPolicyAdmins || chat.ChatType == model.ChatTypeChannel) && role != "admin" {
+		h.sendToClient(c, OutgoingMessage{Type: EventError, Payload: "only admins can pin messages in this chat"})
+		return false
+	}
+	return true
+}
+
+// sendAllowed проверяет политику отправки чата: в режиме admins и в каналах писать могут только администраторы.
+// Иначе возвращает отказ для клиента.
+func (h *Hub) sendAllowed(ctx context.Context, userID, chatID string) *SendError {
+	chat, err := h.chatRepo.GetByID(ctx, chatID)
+	if err != nil {
+		logger.Errorf("ws send get chat=%s: %v", chatID, err)
+		return &SendError{Status: http.StatusInternalServerError, Msg: "internal error"}
+	}
+	if chat.SendPolicy != model.SendPolicyAdmins && chat.ChatType != model.ChatTypeChannel {
+		return nil
+	}
+	role, err := h.chatRepo.GetMemberRole(ctx, chatID, userID)
+	if err != nil {
+		logger.Errorf("ws send get role chat=%s user=%s: %v", chatID, userID, err)
+		return &SendError{Status: http.StatusInternalServerError, Msg: "internal error"}
+	}
+	if role != "admin" {
+		return &SendError{Status: http.StatusForbidden, Msg: "only admins can send messages in this chat"}
+	}
+	return nil
+}
+
+// Ограничения страницы истории — как у REST GET /api/chats/{chatId}/messages.
+const (
+	fetchMessagesDefaultLimit = 50
+	fetchMessagesMaxLimit     = 100
+)
+
+// handleFetchMessages отдаёт страницу истории чата по WebSocket (курсор — id сообщения, старше которого грузить).
+func (h *Hub) handleFetchMessages(ctx context.Context, c *Client, msg IncomingMessage) {
+	defer logger.DeferLogDuration("ws.handleFetchMessages", time.Now())()
 	if msg.ChatID == "" {
+		h.sendToClient(c, OutgoingMessage{Type: EventError, Payload: "chat_id required"})
 		return
 	}
-	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	memberIDs, err := h.chatRepo.GetMemberIDs(ctx, msg.ChatID)
+	isMember, err := h.chatRepo.IsMember(ctx, msg.ChatID, c.userID)
+	if err != nil {
+		logger.Errorf("ws check membership chat=%s user=%s: %v", msg.ChatID, c.userID, err)
+		h.sendToClient(c, OutgoingMessage{Type: EventError, Payload: "internal error"})
+		return
+	}
+	if !isMember {
+		h.sendToClient(c, OutgoingMessage{Type: EventError, Payload: "not a member"})
+		return
+	}
+
+	limit := msg.Limit
+	if limit <= 0 {
+		limit = fetchMessagesDefaultLimit
+	}
+	if limit > fetchMessagesMaxLimit {
+		limit = fetchMessagesMaxLimit
+	}
+
+	var beforeAt *time.Time
+	if msg.Before != "" {
+		cursor, err := h.msgRepo.GetByID(ctx, msg.Before)
+		if err != nil || cursor.ChatID != msg.ChatID {
+			h.sendToClient(c, OutgoingMessage{Type: EventError, Payload: "invalid before"})
+			return
+		}
+		beforeAt = &cursor.CreatedAt
+	}
+
+	messages, err := h.msgRepo.GetChatMessagesBefore(ctx, msg.ChatID, c.userID, beforeAt, msg.Before, limit+1)
 	if err != nil {
-		logger.Errorf("ws get members for typing chat=%s: %v", msg.ChatID, err)
+		logger.Errorf("ws fetch messages chat=%s user=%s: %v", msg.ChatID, c.userID, err)
+		h.sendToClient(c, OutgoingMessage{Type: EventError, Payload: "failed to get messages"})
 		return
 	}
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
 
-	out := OutgoingMessage{
+	h.msgRepo.AttachReactionsAndReplies(ctx, h.reactRepo, messages)
+	sysmsg.Localize(c.lang, messages)
+
+	h.sendToClient(c, OutgoingMessage{Type: EventMessagesPage, Payload: MessagesPagePayload{
+		ChatID:   msg.ChatID,
+		Messages: messages,
+		HasMore:  hasMore,
+	}})
+}
+
+// handleSetPresence меняет статус присутствия. Явный status (online/away/dnd) задаёт его вручную;
+// без status клиент сообщает idle_seconds, и сервер сам переводит online → away и обратно.
+func (h *Hub) handleSetPresence(ctx context.Context, c *Client, msg IncomingMessage) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	status := msg.Status
+	switch status {
+	case model.PresenceOnline, model.PresenceAway, model.PresenceDND:
+		h.mu.Lock()
+		delete(h.autoAway, c.userID)
+		h.mu.Unlock()
+	case "":
+		if h.cfg.AwayAfter <= 0 {
+			return
+		}
+		current, err := h.userRepo.GetPresence(ctx, c.userID)
+		if err != nil {
+			logger.Errorf("ws get presence user=%s: %v", c.userID, err)
+			return
+		}
+		idle := time.Duration(msg.IdleSeconds) * time.Second
+		h.mu.Lock()
+		_, auto := h.autoAway[c.userID]
+		switch {
+		case current == model.PresenceOnline && idle >= h.cfg.AwayAfter:
+			h.autoAway[c.userID] = struct{}{}
+			status = model.PresenceAway
+		case current == model.PresenceAway && auto && idle < h.cfg.AwayAfter:
+			delete(h.autoAway, c.userID)
+			status = model.PresenceOnline
+		}
+		h.mu.Unlock()
+		if status == "" {
+			return
+		}
+	default:
+		h.sendToClient(c, OutgoingMessage{Type: EventError, Payload: "status must be online, away or dnd"})
+		return
+	}
+
+	if err := h.userRepo.SetPresence(ctx, c.userID, status); err != nil {
+		logger.Errorf("ws set presence user=%s: %v", c.userID, err)
+		h.sendToClient(c, OutgoingMessage{Type: EventError, Payload: "failed to set presence"})
+		return
+	}
+	h.broadcastUserStatus(c.userID, status)
+}
+
+func (h *Hub) handleTyping(ctx context.Context, c *Client, msg IncomingMessage) {
+	if msg.ChatID == "" {
+		return
+	}
+	h.broadcastActivity(ctx, c, msg.ChatID, OutgoingMessage{
 		Type: EventTyping,
 		Payload: TypingPayload{
 			ChatID: msg.ChatID,
 			UserID: c.userID,
 		},
+	})
+}
+
+// recordingTimeout — сколько индикатор записи живёт без повторного recording_voice от клиента.
+const recordingTimeout = 30 * time.Second
+
+// handleRecording рассылает "записывает голосовое" / "перестал записывать" — по той же схеме, что и typing:
+// клиент сам шлёт старт/стоп, а сервер дополнительно шлёт стоп, если соединение закрылось посреди записи
+// или клиент молчит дольше recordingTimeout (повторный старт продлевает индикатор).
+func (h *Hub) handleRecording(ctx context.Context, c *Client, msg IncomingMessage, recording bool) {
+	if msg.ChatID == "" {
+		return
+	}
+	c.recordingMu.Lock()
+	prev := c.recordingChatID
+	if recording {
+		c.recordingChatID = msg.ChatID
+		if c.recordingTimer != nil {
+			c.recordingTimer.Stop()
+		}
+		chatID := msg.ChatID
+		var t *time.Timer
+		t = time.AfterFunc(recordingTimeout, func() { h.expireRecording(c, chatID, t) })
+		c.recordingTimer = t
+	} else if prev == msg.ChatID {
+		c.recordingChatID = ""
+		if c.recordingTimer != nil {
+			c.recordingTimer.Stop()
+			c.recordingTimer = nil
+		}
+	}
+	c.recordingMu.Unlock()
+	if recording && prev != "" && prev != msg.ChatID {
+		h.broadcastRecordingStopped(ctx, c, prev)
+	}
+
+	evType := EventRecordingStopped
+	if recording {
+		evType = EventRecordingVoice
+	}
+	h.broadcastActivity(ctx, c, msg.ChatID, OutgoingMessage{
+		Type:    evType,
+		Payload: RecordingPayload{ChatID: msg.ChatID, UserID: c.userID},
+	})
+}
+
+// expireRecording срабатывает по таймеру: если клиент всё ещё "записывает" в chatID, снимает индикатор.
+// Устаревший таймер (запись уже продлена или остановлена) ничего не делает.
+func (h *Hub) expireRecording(c *Client, chatID string, t *time.Timer) {
+	c.recordingMu.Lock()
+	if c.recordingTimer != t || c.recordingChatID != chatID {
+		c.recordingMu.Unlock()
+		return
+	}
+	c.recordingChatID = ""
+	c.recordingTimer = nil
+	c.recordingMu.Unlock()
+	h.broadcastRecordingStopped(context.Background(), c, chatID)
+}
+
+func (h *Hub) broadcastRecordingStopped(ctx context.Context, c *Client, chatID string) {
+	h.broadcastActivity(ctx, c, chatID, OutgoingMessage{
+		Type:    EventRecordingStopped,
+		Payload: RecordingPayload{ChatID: chatID, UserID: c.userID},
+	})
+}
+
+// broadcastActivity отправляет эфемерное событие (typing/recording) остальным участникам чата.
+// Ничего не отправляет, если отправитель не участник чата.
+func (h *Hub) broadcastActivity(ctx context.Context, c *Client, chatID string, out OutgoingMessage) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	memberIDs, err := h.chatRepo.GetMemberIDs(ctx, chatID)
+	if err != nil {
+		logger.Errorf("ws get members for %s chat=%s: %v", out.Type, chatID, err)
+		return
+	}
+	if !slices.Contains(memberIDs, c.userID) {
+		return
 	}
 	for _, uid := range memberIDs {
 		if uid != c.userID {
@@ -530,43 +1160,88 @@ func (h *Hub) handleMessageRead(ctx context.Context, c *Client, msg IncomingMess
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	if err := h.msgRepo.MarkAsRead(ctx, msg.ChatID, c.userID); err != nil {
+	if err := h.MarkRead(ctx, msg.ChatID, c.userID, msg.MessageID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			h.sendToClient(c, OutgoingMessage{Type: EventError, Payload: "message not found"})
+			return
+		}
 		logger.Errorf("ws mark read chat=%s user=%s: %v", msg.ChatID, c.userID, err)
-		return
 	}
+}
 
-	// Update last_read_at for unread count tracking
-	now := time.Now().UTC()
-	if err := h.chatRepo.UpdateMemberLastRead(ctx, msg.ChatID, c.userID, now); err != nil {
-		logger.Errorf("ws update last_read_at chat=%s user=%s: %v", msg.ChatID, c.userID, err)
+// MarkRead отмечает чат прочитанным пользователем userID: до messageID включительно или, если messageID
+// пуст, целиком. Остальным участникам рассылается EventMessageRead с позицией прочтения.
+// ErrNotFound — пользователь не участник чата или сообщения нет в чате.
+func (h *Hub) MarkRead(ctx context.Context, chatID, userID, messageID string) error {
+	isMember, err := h.chatRepo.IsMember(ctx, chatID, userID)
+	if err != nil {
+		return err
+	}
+	if !isMember {
+		return repository.ErrNotFound
 	}
 
-	memberIDs, err := h.chatRepo.GetMemberIDs(ctx, msg.ChatID)
-	if err != nil {
-		logger.Errorf("ws get members for read chat=%s: %v", msg.ChatID, err)
-		return
+	payload := MessageReadPayload{ChatID: chatID, UserID: userID}
+	if messageID != "" {
+		readAt, seenAt, err := h.msgRepo.MarkReadUpTo(ctx, chatID, userID, messageID)
+		if err != nil {
+			return err
+		}
+		payload.MessageID = messageID
+		payload.ReadAt = &readAt
+		payload.SeenAt = seenAt.UTC()
+	} else {
+		if err := h.msgRepo.MarkAsRead(ctx, chatID, userID); err != nil {
+			return err
+		}
+		// Update last_read_at for unread count tracking
+		now := time.Now().UTC()
+		if err := h.chatRepo.UpdateMemberLastRead(ctx, chatID, userID, now); err != nil {
+			logger.Errorf("ws update last_read_at chat=%s user=%s: %v", chatID, userID, err)
+		}
+		payload.SeenAt = now
 	}
 
-	out := OutgoingMessage{
-		Type: EventMessageRead,
-		Payload: MessageReadPayload{
-			ChatID: msg.ChatID,
-			UserID: c.userID,
-		},
+	memberIDs, err := h.chatRepo.GetMemberIDs(ctx, chatID)
+	if err != nil {
+		logger.Errorf("ws get members for read chat=%s: %v", chatID, err)
+		return nil
 	}
+	out := OutgoingMessage{Type: EventMessageRead, Payload: payload}
 	for _, uid := range memberIDs {
-		if uid != c.userID {
+		if uid != userID {
 			h.sendToUser(uid, out)
 		}
 	}
+	if h.pushClient != nil {
+		go func() {
+			h.pushSem <- struct{}{}
+			defer func() { <-h.pushSem }()
+			h.pushClient.ChatRead(context.Background(), userID, chatID)
+		}()
+	}
+	return nil
 }
 
-func (h *Hub) broadcastUserStatus(userID string, online bool) {
+func (h *Hub) broadcastUserStatus(userID string, status model.PresenceStatus) {
+	online := status != model.PresenceOffline
 	evType := EventUserOffline
 	if online {
 		evType = EventUserOnline
 	}
 
+	h.BroadcastToContacts(userID, OutgoingMessage{
+		Type: evType,
+		Payload: UserStatusPayload{
+			UserID: userID,
+			Online: online,
+			Status: status,
+		},
+	})
+}
+
+// BroadcastToContacts отправляет событие всем, у кого есть общий чат с userID (кроме самого userID).
+func (h *Hub) BroadcastToContacts(userID string, out OutgoingMessage) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -576,14 +1251,6 @@ func (h *Hub) broadcastUserStatus(userID string, online bool) {
 		return
 	}
 
-	out := OutgoingMessage{
-		Type: evType,
-		Payload: UserStatusPayload{
-			UserID: userID,
-			Online: online,
-		},
-	}
-
 	notified := make(map[string]struct{}, 16)
 	for _, chat := range chats {
 		memberIDs, err := h.chatRepo.GetMemberIDs(ctx, chat.ID)
@@ -604,6 +1271,29 @@ func (h *Hub) broadcastUserStatus(userID string, online bool) {
 	}
 }
 
+// RunStatusExpiry каждые interval снимает истёкшие пользовательские статусы и рассылает их очистку.
+func (h *Hub) RunStatusExpiry(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			clearCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			ids, err := h.userRepo.ClearExpiredCustomStatuses(clearCtx)
+			cancel()
+			if err != nil {
+				logger.Errorf("ws clear expired statuses: %v", err)
+				continue
+			}
+			for _, id := range ids {
+				h.BroadcastToContacts(id, OutgoingMessage{Type: EventUserStatusTextChanged, Payload: UserStatusTextPayload{UserID: id}})
+			}
+		}
+	}
+}
+
 // BroadcastToChat sends a message to all members of a chat.
 func (h *Hub) BroadcastToChat(ctx context.Context, chatID string, msg OutgoingMessage) {
 	defer logger.DeferLogDuration("ws.BroadcastToChat", time.Now())()
@@ -617,6 +1307,19 @@ func (h *Hub) BroadcastToChat(ctx context.Context, chatID string, msg OutgoingMe
 	}
 }
 
+// broadcastThreadUpdate рассылает участникам чата новый счётчик ответов сообщения replyToID.
+func (h *Hub) broadcastThreadUpdate(ctx context.Context, chatID, replyToID string, memberIDs []string) {
+	n, err := h.msgRepo.ReplyCount(ctx, replyToID)
+	if err != nil {
+		logger.Errorf("ws thread reply count message=%s: %v", replyToID, err)
+		return
+	}
+	out := OutgoingMessage{Type: EventThreadUpdated, Payload: ThreadUpdatedPayload{ChatID: chatID, MessageID: replyToID, ReplyCount: n}}
+	for _, uid := range memberIDs {
+		h.sendToUser(uid, out)
+	}
+}
+
 func (h *Hub) sendToUser(userID string, msg OutgoingMessage) {
 	h.mu.RLock()
 	clients, ok := h.clients[userID]
@@ -646,6 +1349,125 @@ func (h *Hub) sendToClient(c *Client, msg OutgoingMessage) {
 	}
 }
 
+// CloseUserSession закрывает WebSocket-соединения пользователя, открытые с данной сессии.
+// Дальнейшая очистка (removeClient, статус offline) идёт через обычный Unregister из readPump.
+func (h *Hub) CloseUserSession(userID, sessionID string) int {
+	h.mu.RLock()
+	targets := make([]*Client, 0, 1)
+	for c := range h.clients[userID] {
+		if c.sessionID == sessionID {
+			targets = append(targets, c)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, c := range targets {
+		c.Close()
+	}
+	return len(targets)
+}
+
+// DisconnectUser закрывает все WebSocket-соединения пользователя (например, при отключении администратором).
+func (h *Hub) DisconnectUser(userID string) int {
+	h.mu.RLock()
+	targets := make([]*Client, 0, len(h.clients[userID]))
+	for c := range h.clients[userID] {
+		targets = append(targets, c)
+	}
+	h.mu.RUnlock()
+
+	for _, c := range targets {
+		c.Close()
+	}
+	return len(targets)
+}
+
+// OnlineUsers возвращает те из ids, кто онлайн: есть живое соединение с этим хабом
+// или свежий heartbeat от другого экземпляра API.
+func (h *Hub) OnlineUsers(ctx context.Context, ids []string) []string {
+	remote, err := h.userRepo.OnlineIDs(ctx, ids)
+	if err != nil {
+		logger.Errorf("ws online users: %v", err)
+	}
+	isRemote := make(map[string]struct{}, len(remote))
+	for _, id := range remote {
+		isRemote[id] = struct{}{}
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	online := make([]string, 0, len(ids))
+	for _, id := range ids {
+		_, ok := isRemote[id]
+		if ok || len(h.clients[id]) > 0 {
+			online = append(online, id)
+		}
+	}
+	return online
+}
+
+// RunHeartbeat каждые interval продлевает last_ping_at подключённым к этому хабу пользователям
+// и переводит в offline тех, чей heartbeat устарел (их экземпляр API упал). interval должен быть
+// заметно меньше repository.PresenceTTL.
+func (h *Hub) RunHeartbeat(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.heartbeat(ctx)
+		}
+	}
+}
+
+func (h *Hub) heartbeat(ctx context.Context) {
+	h.mu.RLock()
+	ids := make([]string, 0, len(h.clients))
+	for id := range h.clients {
+		ids = append(ids, id)
+	}
+	h.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	revived, err := h.userRepo.Heartbeat(ctx, h.instanceID, ids)
+	if err != nil {
+		logger.Errorf("ws heartbeat users=%d: %v", len(ids), err)
+	}
+	for id, status := range revived {
+		h.broadcastUserStatus(id, status)
+	}
+	stale, err := h.userRepo.ExpireStalePresence(ctx)
+	if err != nil {
+		logger.Errorf("ws expire stale presence: %v", err)
+		return
+	}
+	for _, id := range stale {
+		h.broadcastUserStatus(id, model.PresenceOffline)
+	}
+}
+
+// BroadcastMaintenance рассылает состояние режима обслуживания всем подключённым клиентам.
+func (h *Hub) BroadcastMaintenance(status maintenance.Status) {
+	h.mu.RLock()
+	targets := make([]*Client, 0, h.total)
+	for _, clients := range h.clients {
+		for c := range clients {
+			targets = append(targets, c)
+		}
+	}
+	h.mu.RUnlock()
+	for _, c := range targets {
+		h.sendToClient(c, OutgoingMessage{Type: EventMaintenance, Payload: status})
+	}
+}
+
+// SendToUser отправляет событие во все соединения пользователя.
+func (h *Hub) SendToUser(userID string, msg OutgoingMessage) {
+	h.sendToUser(userID, msg)
+}
+
 func (h *Hub) Register(c *Client) {
 	select {
 	case h.register <- c:
@@ -0,0 +1,83 @@
+package ws
+
+import (
+	"testing"
+
+	"github.com/messenger/internal/model"
+	"github.com/messenger/internal/sysmsg"
+)
+
+func TestAllowedFileURL(t *testing.T) {
+	hosts := []string{"cdn.example.com"}
+	cases := []struct {
+		url  string
+		want bool
+	}{
+		{"/api/files/0b7c6f1e-2a4d-4c1e-9d55-1f0e2b3c4d5e.png", true},
+		{"/api/audio/0b7c6f1e-2a4d-4c1e-9d55-1f0e2b3c4d5e.webm", true},
+		{"https://cdn.example.com/uploads/a.png", true},
+		{"https://CDN.example.com/a.png", true},
+		{"/api/files/", false},
+		{"/api/files/../users/me", false},
+		{"/api/files/%2e%2e%2fusers", false},
+		{"/api/files/signed/a.png?expires=1&sig=x", false},
+		{"/api/files/a.png?redirect=https://evil.example", false},
+		{"/api/users/me", false},
+		{"//evil.example/a.png", false},
+		{"https://evil.example/a.png", false},
+		{"https://cdn.example.com.evil.example/a.png", false},
+		{"https://user@cdn.example.com/a.png", false},
+		{"http://cdn.example.com/a.png", false},
+		{"javascript:alert(1)", false},
+		{"data:text/html;base64,PHNjcmlwdD4=", false},
+	}
+	for _, tc := range cases {
+		if got := allowedFileURL(tc.url, hosts); got != tc.want {
+			t.Errorf("allowedFileURL(%q) = %v, want %v", tc.url, got, tc.want)
+		}
+	}
+	if allowedFileURL("https://cdn.example.com/a.png", nil) {
+		t.Error("external host accepted without FileURLHosts")
+	}
+}
+
+func TestNormalizeAttachmentsRejectsForeignURL(t *testing.T) {
+	_, errMsg := normalizeAttachments([]model.Attachment{
+		{FileURL: "/api/files/a.png", ContentType: model.ContentTypeImage},
+		{FileURL: "https://evil.example/b.png", ContentType: model.ContentTypeImage},
+	}, nil)
+	if errMsg == "" {
+		t.Fatal("attachment with external file_url accepted")
+	}
+}
+
+func TestIsReadOnlyEvent(t *testing.T) {
+	for _, e := range []EventType{EventTyping, EventRecordingVoice, EventRecordingStopped, EventFetchMessages} {
+		if !isReadOnlyEvent(e) {
+			t.Errorf("%s blocked during maintenance", e)
+		}
+	}
+	for _, e := range []EventType{EventNewMessage, EventMessageRead, EventMessageEdited, EventMessageDeleted,
+		EventReactionAdded, EventReactionRemoved, EventMessagePinned, EventMessageUnpinned, EventSetPresence, "future_event"} {
+		if isReadOnlyEvent(e) {
+			t.Errorf("%s allowed during maintenance", e)
+		}
+	}
+}
+
+func TestClientLocalize(t *testing.T) {
+	shared := &model.Message{Content: "Иван покинул(а) группу", SystemEvent: sysmsg.New(sysmsg.MemberLeft, "Иван", "")}
+	out := OutgoingMessage{Type: EventNewMessage, Payload: shared}
+
+	got := (&Client{lang: "en"}).localize(out)
+	if m := got.Payload.(*model.Message); m.Content != "Иван left the group" {
+		t.Errorf("en content = %q", m.Content)
+	}
+	// Payload рассылки общий: исходное сообщение не меняется.
+	if shared.Content != "Иван покинул(а) группу" {
+		t.Errorf("shared payload modified: %q", shared.Content)
+	}
+	if got := (&Client{}).localize(out); got.Payload != shared {
+		t.Error("client without lang got a copy")
+	}
+}
@@ -9,22 +9,44 @@ import (
 type EventType string
 
 const (
-	EventNewMessage      EventType = "new_message"
-	EventMessageRead     EventType = "message_read"
-	EventMessageEdited   EventType = "message_edited"
-	EventMessageDeleted  EventType = "message_deleted"
-	EventTyping          EventType = "typing"
-	EventUserOnline      EventType = "user_online"
-	EventUserOffline     EventType = "user_offline"
-	EventChatCreated     EventType = "chat_created"
-	EventReactionAdded   EventType = "reaction_added"
-	EventReactionRemoved EventType = "reaction_removed"
-	EventMessagePinned   EventType = "message_pinned"
-	EventMessageUnpinned EventType = "message_unpinned"
-	EventMemberAdded     EventType = "member_added"
-	EventMemberRemoved   EventType = "member_removed"
-	EventChatUpdated     EventType = "chat_updated"
-	EventError           EventType = "error"
+	EventNewMessage       EventType = "new_message"
+	EventMessageRead      EventType = "message_read"
+	EventMessageEdited    EventType = "message_edited"
+	EventMessageDeleted   EventType = "message_deleted"
+	EventTyping           EventType = "typing"
+	EventUserOnline       EventType = "user_online"
+	EventUserOffline      EventType = "user_offline"
+	EventChatCreated      EventType = "chat_created"
+	EventReactionAdded    EventType = "reaction_added"
+	EventReactionRemoved  EventType = "reaction_removed"
+	EventMessagePinned    EventType = "message_pinned"
+	EventMessageUnpinned  EventType = "message_unpinned"
+	EventMemberAdded      EventType = "member_added"
+	EventMemberRemoved    EventType = "member_removed"
+	EventChatUpdated      EventType = "chat_updated"
+	EventRecordingVoice   EventType = "recording_voice"
+	EventRecordingStopped EventType = "recording_stopped"
+	// EventFetchMessages — запрос клиента на страницу истории чата; ответ — EventMessagesPage.
+	EventFetchMessages EventType = "fetch_messages"
+	EventMessagesPage  EventType = "messages_page"
+	// EventSetPresence — клиент задаёт статус (online/away/dnd) или сообщает время бездействия.
+	EventSetPresence EventType = "set_presence"
+	// EventUserStatusTextChanged — пользователь изменил или очистил свой статус (эмодзи + текст).
+	EventUserStatusTextChanged EventType = "user_status_text_changed"
+	EventError                 EventType = "error"
+	// EventMaintenance — включён или выключен режим обслуживания; payload — maintenance.Status.
+	EventMaintenance EventType = "maintenance"
+	// EventChatCleared — пользователь очистил историю чата у себя (рассылается его же устройствам).
+	EventChatCleared EventType = "chat_cleared"
+	// EventMemberRoleChanged — администратор сменил роль участника; payload — MemberRoleChangedPayload.
+	EventMemberRoleChanged EventType = "member_role_changed"
+	// EventFileScanStatus — фоновая проверка файла антивирусом завершена; payload — FileScanStatusPayload.
+	EventFileScanStatus EventType = "file_scan_status"
+	// EventThreadUpdated — в ветку добавлен ответ; payload — ThreadUpdatedPayload.
+	EventThreadUpdated EventType = "thread_updated"
+	// EventResyncRequired — данные изменились в обход API (миграция, слияние): клиенту нужно перечитать
+	// указанные чаты или, без chat_ids, всё состояние. payload — ResyncPayload.
+	EventResyncRequired EventType = "resync_required"
 )
 
 // IncomingMessage is what the client sends to the server.
@@ -38,20 +60,44 @@ type IncomingMessage struct {
 	FileURL     string            `json:"file_url,omitempty"`
 	FileName    string            `json:"file_name,omitempty"`
 	FileSize    int64             `json:"file_size,omitempty"`
+	// Attachments — несколько файлов в одном сообщении (альбом); file_* тогда не нужны.
+	Attachments []model.Attachment `json:"attachments,omitempty"`
+	// Location — для content_type "location".
+	Location *model.Location `json:"location,omitempty"`
+	// ContactUserID — для content_type "contact": id пользователя, которым делятся.
+	ContactUserID string `json:"contact_user_id,omitempty"`
 
 	// For reply
 	ReplyToID string `json:"reply_to_id,omitempty"`
 
 	// For edit/delete
 	MessageID string `json:"message_id,omitempty"`
+	// Scope for delete: "everyone" (default) or "me"
+	Scope DeleteScope `json:"scope,omitempty"`
 
 	// For reactions
 	Emoji string `json:"emoji,omitempty"`
 
+	// For fetch_messages: before — id самого старого загруженного сообщения (пусто — с конца), limit — размер страницы.
+	Before string `json:"before,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+
+	// For set_presence: status — online/away/dnd; idle_seconds — сколько клиент бездействует (авто-away).
+	Status      model.PresenceStatus `json:"status,omitempty"`
+	IdleSeconds int                  `json:"idle_seconds,omitempty"`
+
 	// For forward
 	ForwardChatID string `json:"forward_chat_id,omitempty"`
 }
 
+// DeleteScope controls who a deletion applies to.
+type DeleteScope string
+
+const (
+	DeleteScopeEveryone DeleteScope = "everyone"
+	DeleteScopeMe       DeleteScope = "me"
+)
+
 // OutgoingMessage is what the server sends to the client.
 // Payload uses typed structs to avoid heap-heavy map[string]any.
 type OutgoingMessage struct {
@@ -70,9 +116,11 @@ type MessageEditedPayload struct {
 }
 
 // MessageDeletedPayload is broadcast when a message is deleted.
+// For scope "me" it is sent only to the deleting user's own connections.
 type MessageDeletedPayload struct {
-	MessageID string `json:"message_id"`
-	ChatID    string `json:"chat_id"`
+	MessageID string      `json:"message_id"`
+	ChatID    string      `json:"chat_id"`
+	Scope     DeleteScope `json:"scope,omitempty"`
 }
 
 // ReactionPayload is broadcast when a reaction is added or removed.
@@ -102,16 +150,45 @@ type TypingPayload struct {
 	UserID string `json:"user_id"`
 }
 
+// RecordingPayload is broadcast when a user starts or stops recording a voice message.
+type RecordingPayload struct {
+	ChatID string `json:"chat_id"`
+	UserID string `json:"user_id"`
+}
+
 // MessageReadPayload is broadcast when messages are read.
 type MessageReadPayload struct {
 	ChatID string `json:"chat_id"`
 	UserID string `json:"user_id"`
+	// MessageID / ReadAt — позиция прочтения: пользователь прочитал всё до этого сообщения включительно.
+	// Пусто, если прочитан весь чат.
+	MessageID string     `json:"message_id,omitempty"`
+	ReadAt    *time.Time `json:"read_at,omitempty"`
+	// SeenAt — когда пользователь прочитал (для «просмотрено в 14:32»); в группах то же время пишется
+	// в квитанцию каждого прочитанного сообщения (GET /api/messages/{id}/receipts).
+	SeenAt time.Time `json:"seen_at"`
 }
 
-// UserStatusPayload is broadcast for online/offline status.
+// UserStatusPayload is broadcast for presence changes: user_offline for offline, user_online otherwise.
 type UserStatusPayload struct {
-	UserID string `json:"user_id"`
-	Online bool   `json:"online"`
+	UserID string               `json:"user_id"`
+	Online bool                 `json:"online"`
+	Status model.PresenceStatus `json:"status"`
+}
+
+// MessagesPagePayload answers fetch_messages: messages newest-first, HasMore — есть ли ещё более старые.
+type MessagesPagePayload struct {
+	ChatID   string          `json:"chat_id"`
+	Messages []model.Message `json:"messages"`
+	HasMore  bool            `json:"has_more"`
+}
+
+// UserStatusTextPayload is broadcast when a user's custom status changes; empty fields mean the status was cleared.
+type UserStatusTextPayload struct {
+	UserID          string     `json:"user_id"`
+	StatusEmoji     string     `json:"status_emoji"`
+	StatusText      string     `json:"status_text"`
+	StatusExpiresAt *time.Time `json:"status_expires_at,omitempty"`
 }
 
 // MemberAddedPayload is broadcast when a member is added to a group.
@@ -123,6 +200,22 @@ type MemberAddedPayload struct {
 	ActorName    string `json:"actor_name"`
 }
 
+// MemberRoleChangedPayload — новая роль участника (admin, member, subscriber) и кто её назначил.
+type MemberRoleChangedPayload struct {
+	ChatID    string `json:"chat_id"`
+	UserID    string `json:"user_id"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	ActorID   string `json:"actor_id"`
+	ActorName string `json:"actor_name"`
+}
+
+// ChatClearedPayload — история чата до ClearedBefore скрыта для этого пользователя.
+type ChatClearedPayload struct {
+	ChatID        string    `json:"chat_id"`
+	ClearedBefore time.Time `json:"cleared_before"`
+}
+
 // MemberRemovedPayload is broadcast when a member is removed or leaves.
 type MemberRemovedPayload struct {
 	ChatID    string `json:"chat_id"`
@@ -131,3 +224,22 @@ type MemberRemovedPayload struct {
 	IsLeave   bool   `json:"is_leave"`   // true if user left themselves
 	ActorName string `json:"actor_name"` // who removed (empty if is_leave)
 }
+
+// FileScanStatusPayload — результат проверки загруженного файла: clean (можно скачивать) или infected.
+type FileScanStatusPayload struct {
+	FileURL    string `json:"file_url"`
+	ScanStatus string `json:"scan_status"`
+}
+
+// ThreadUpdatedPayload — новое значение reply_count у сообщения, на которое ответили.
+type ThreadUpdatedPayload struct {
+	ChatID     string `json:"chat_id"`
+	MessageID  string `json:"message_id"`
+	ReplyCount int    `json:"reply_count"`
+}
+
+// ResyncPayload — что перечитать: чаты ChatIDs или, если список пуст, всё (список чатов и открытый чат).
+type ResyncPayload struct {
+	ChatIDs []string `json:"chat_ids,omitempty"`
+	Reason  string   `json:"reason,omitempty"`
+}
@@ -0,0 +1,3 @@
+-- Индексы для фильтров поиска сообщений (отправитель / тип контента + диапазон дат).
+CREATE INDEX IF NOT EXISTS idx_messages_sender_created ON messages(sender_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_messages_chat_type_created ON messages(chat_id, content_type, created_at DESC);
@@ -0,0 +1,15 @@
+-- Сводная статистика качества звонков (WebRTC stats), присылается каждым участником после звонка.
+CREATE TABLE IF NOT EXISTS call_stats (
+    call_id UUID NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    peer_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    duration_sec INTEGER NOT NULL DEFAULT 0,
+    avg_bitrate_kbps INTEGER NOT NULL DEFAULT 0,
+    packet_loss_pct REAL NOT NULL DEFAULT 0,
+    jitter_ms REAL NOT NULL DEFAULT 0,
+    end_reason VARCHAR(32) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (call_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_call_stats_created_at ON call_stats(created_at);
@@ -0,0 +1,8 @@
+-- Политика закрепления сообщений в группе: everyone — любой участник, admins — только администраторы группы.
+ALTER TABLE chats ADD COLUMN IF NOT EXISTS pin_policy VARCHAR(16) NOT NULL DEFAULT 'everyone';
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'chats_pin_policy_check') THEN
+    ALTER TABLE chats ADD CONSTRAINT chats_pin_policy_check CHECK (pin_policy IN ('everyone', 'admins'));
+  END IF;
+END $$;
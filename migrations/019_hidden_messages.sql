@@ -0,0 +1,7 @@
+-- "Удалить у меня": сообщения, скрытые конкретным пользователем (у остальных участников остаются).
+CREATE TABLE IF NOT EXISTS hidden_messages (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    hidden_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, message_id)
+);
@@ -0,0 +1,3 @@
+-- Чувствительные чаты: содержимое новых сообщений хранится зашифрованным (AES-GCM, ключ из MESSAGE_ENCRYPTION_KEYS).
+ALTER TABLE chats ADD COLUMN IF NOT EXISTS is_sensitive BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS content_encrypted BOOLEAN NOT NULL DEFAULT false;
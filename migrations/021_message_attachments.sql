@@ -0,0 +1,10 @@
+-- Вложения сообщений-альбомов (несколько файлов в одном сообщении). Первое вложение дублируется в messages.file_*.
+CREATE TABLE IF NOT EXISTS message_attachments (
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    position INT NOT NULL,
+    content_type VARCHAR(20) NOT NULL,
+    file_url TEXT NOT NULL,
+    file_name TEXT NOT NULL DEFAULT '',
+    file_size BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (message_id, position)
+);
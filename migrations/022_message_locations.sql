@@ -0,0 +1,10 @@
+-- Геопозиция для сообщений content_type = 'location'.
+CREATE TABLE IF NOT EXISTS message_locations (
+    message_id UUID PRIMARY KEY REFERENCES messages(id) ON DELETE CASCADE,
+    latitude DOUBLE PRECISION NOT NULL CHECK (latitude BETWEEN -90 AND 90),
+    longitude DOUBLE PRECISION NOT NULL CHECK (longitude BETWEEN -180 AND 180),
+    label TEXT NOT NULL DEFAULT ''
+);
+
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_content_type_check;
+ALTER TABLE messages ADD CONSTRAINT messages_content_type_check CHECK (content_type IN ('text', 'image', 'file', 'system', 'voice', 'location'));
@@ -0,0 +1,10 @@
+-- Карточки контактов для сообщений content_type = 'contact'. username/avatar_url — снимок на момент отправки.
+CREATE TABLE IF NOT EXISTS message_contacts (
+    message_id UUID PRIMARY KEY REFERENCES messages(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    username VARCHAR(50) NOT NULL,
+    avatar_url TEXT NOT NULL DEFAULT ''
+);
+
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_content_type_check;
+ALTER TABLE messages ADD CONSTRAINT messages_content_type_check CHECK (content_type IN ('text', 'image', 'file', 'system', 'voice', 'location', 'contact'));
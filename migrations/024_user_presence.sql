@@ -0,0 +1,6 @@
+-- Статус присутствия: online/away/dnd/offline. presence_dnd — выбранный пользователем режим «не беспокоить»,
+-- сохраняется между подключениями и отключает push-уведомления.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS presence VARCHAR(10) NOT NULL DEFAULT 'offline';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS presence_dnd BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_presence_check;
+ALTER TABLE users ADD CONSTRAINT users_presence_check CHECK (presence IN ('online', 'away', 'dnd', 'offline'));
@@ -0,0 +1,5 @@
+-- Пользовательский статус (эмодзи + текст) с необязательным сроком действия.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status_emoji VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status_text VARCHAR(400) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status_expires_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS idx_users_status_expires ON users(status_expires_at) WHERE status_expires_at IS NOT NULL;
@@ -0,0 +1,4 @@
+-- Heartbeat присутствия: онлайн = last_ping_at свежее repository.PresenceTTL.
+-- Заменяет глобальный сброс is_online при старте, который не переживал падения и мешал нескольким экземплярам.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS last_ping_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS idx_users_last_ping ON users(last_ping_at) WHERE last_ping_at IS NOT NULL;
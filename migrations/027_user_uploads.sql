@@ -0,0 +1,15 @@
+-- Учёт загруженных файлов по пользователям: владелец каждого файла и счётчик объёма для квоты.
+CREATE TABLE IF NOT EXISTS user_uploads (
+    file_name  VARCHAR(255) PRIMARY KEY,
+    user_id    UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    size_bytes BIGINT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_user_uploads_user ON user_uploads(user_id);
+
+CREATE TABLE IF NOT EXISTS user_upload_usage (
+    user_id    UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    used_bytes BIGINT NOT NULL DEFAULT 0,
+    files      INT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
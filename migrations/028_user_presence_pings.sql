@@ -0,0 +1,9 @@
+-- Heartbeat присутствия по экземплярам API: отключение на одном экземпляре не переводит в offline
+-- пользователя, подключённого к другому. users.last_ping_at остаётся максимумом по всем экземплярам.
+CREATE TABLE IF NOT EXISTS user_presence_pings (
+    user_id      UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    instance_id  VARCHAR(64) NOT NULL,
+    last_ping_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, instance_id)
+);
+CREATE INDEX IF NOT EXISTS idx_user_presence_pings_last ON user_presence_pings(last_ping_at);
@@ -0,0 +1,23 @@
+-- Упоминания @username, записываемые при отправке: счётчик непрочитанных упоминаний больше не ищет
+-- по messages.content (в чувствительных чатах там шифротекст).
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'message_mentions') THEN
+        CREATE TABLE message_mentions (
+            message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+            user_id    UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+            PRIMARY KEY (message_id, user_id)
+        );
+        CREATE INDEX idx_message_mentions_user ON message_mentions(user_id);
+
+        -- Перенос упоминаний из уже сохранённых открытых сообщений (однократно, при создании таблицы).
+        INSERT INTO message_mentions (message_id, user_id)
+        SELECT m.id, u.id FROM messages m
+        JOIN chat_members cm ON cm.chat_id = m.chat_id
+        JOIN users u ON u.id = cm.user_id
+        WHERE NOT m.content_encrypted AND m.is_deleted = false AND m.sender_id != u.id AND u.username != ''
+          AND m.content LIKE '%@%'
+          AND m.content ~* ('(^|[^[:alnum:]_])@' || regexp_replace(u.username, '([^[:alnum:]])', '\\\1', 'g') || '($|[^[:alnum:]_])')
+        ON CONFLICT DO NOTHING;
+    END IF;
+END $$;
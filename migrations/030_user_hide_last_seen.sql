@@ -0,0 +1,2 @@
+-- Приватность: скрывать время последнего визита от других пользователей.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS hide_last_seen BOOLEAN NOT NULL DEFAULT false;
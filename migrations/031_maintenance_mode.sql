@@ -0,0 +1,8 @@
+-- Режим обслуживания (только чтение): одна строка, общая для всех экземпляров API.
+CREATE TABLE IF NOT EXISTS maintenance_mode (
+    id         BOOLEAN PRIMARY KEY DEFAULT true CHECK (id),
+    enabled    BOOLEAN NOT NULL DEFAULT false,
+    message    TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+INSERT INTO maintenance_mode (id) VALUES (true) ON CONFLICT (id) DO NOTHING;
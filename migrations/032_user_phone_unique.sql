@@ -0,0 +1,7 @@
+-- Телефон уникален среди пользователей. Номера приводятся к виду без разделителей (так их сохраняет API);
+-- при повторах номер остаётся у самого раннего пользователя, у остальных очищается.
+UPDATE users SET phone = regexp_replace(phone, '[[:space:]().-]', '', 'g') WHERE phone ~ '[[:space:]().-]';
+UPDATE users u SET phone = ''
+FROM users o
+WHERE u.phone <> '' AND o.phone = u.phone AND (o.created_at, o.id) < (u.created_at, u.id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_phone_unique ON users (phone) WHERE phone <> '';
@@ -0,0 +1,19 @@
+-- Статус доставки/прочтения по каждому получателю. Общий messages.status остаётся для личных чатов;
+-- в группах статус выводится из квитанций всех участников.
+CREATE TABLE IF NOT EXISTS message_receipts (
+    message_id   UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id      UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    delivered_at TIMESTAMPTZ,
+    read_at      TIMESTAMPTZ,
+    PRIMARY KEY (message_id, user_id)
+);
+
+-- Первичное заполнение для групп по last_read_at участников (только пока таблица пуста).
+INSERT INTO message_receipts (message_id, user_id, delivered_at, read_at)
+SELECT m.id, cm.user_id, cm.last_read_at, cm.last_read_at
+FROM chat_members cm
+JOIN chats c ON c.id = cm.chat_id AND c.chat_type = 'group'
+JOIN messages m ON m.chat_id = cm.chat_id AND m.sender_id IS DISTINCT FROM cm.user_id AND m.created_at <= cm.last_read_at
+WHERE cm.last_read_at > 'epoch'::timestamptz
+  AND NOT EXISTS (SELECT 1 FROM message_receipts)
+ON CONFLICT (message_id, user_id) DO NOTHING;
@@ -0,0 +1,2 @@
+-- «Очистить историю у себя»: сообщения не позже cleared_before участник больше не видит.
+ALTER TABLE chat_members ADD COLUMN IF NOT EXISTS cleared_before TIMESTAMPTZ;
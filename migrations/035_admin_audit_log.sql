@@ -0,0 +1,10 @@
+-- Журнал действий администраторов (слияние учётных записей и т.п.).
+CREATE TABLE IF NOT EXISTS admin_audit_log (
+    id         BIGSERIAL PRIMARY KEY,
+    actor_id   UUID REFERENCES users(id) ON DELETE SET NULL,
+    action     VARCHAR(64) NOT NULL,
+    target_id  UUID,
+    details    JSONB NOT NULL DEFAULT '{}'::jsonb,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_admin_audit_log_created ON admin_audit_log(created_at DESC);
@@ -0,0 +1,8 @@
+-- Кто может отправлять сообщения в группу: все участники или только администраторы (канал объявлений).
+ALTER TABLE chats ADD COLUMN IF NOT EXISTS send_policy VARCHAR(16) NOT NULL DEFAULT 'everyone';
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'chats_send_policy_check') THEN
+    ALTER TABLE chats ADD CONSTRAINT chats_send_policy_check CHECK (send_policy IN ('everyone', 'admins'));
+  END IF;
+END $$;
@@ -0,0 +1,27 @@
+-- Каналы: тип чата 'channel', роль участника 'subscriber' (только чтение и реакции) и ссылка-приглашение.
+DO $$
+DECLARE
+  conname text;
+BEGIN
+  FOR conname IN
+    SELECT c.conname
+    FROM pg_constraint c
+    JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = ANY(c.conkey) AND NOT a.attisdropped
+    WHERE c.conrelid = 'chats'::regclass AND c.contype = 'c' AND a.attname = 'chat_type'
+  LOOP
+    EXECUTE format('ALTER TABLE chats DROP CONSTRAINT %I', conname);
+  END LOOP;
+  FOR conname IN
+    SELECT c.conname
+    FROM pg_constraint c
+    JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = ANY(c.conkey) AND NOT a.attisdropped
+    WHERE c.conrelid = 'chat_members'::regclass AND c.contype = 'c' AND a.attname = 'role'
+  LOOP
+    EXECUTE format('ALTER TABLE chat_members DROP CONSTRAINT %I', conname);
+  END LOOP;
+END $$;
+ALTER TABLE chats ADD CONSTRAINT chats_chat_type_check CHECK (chat_type IN ('personal', 'group', 'notes', 'channel'));
+ALTER TABLE chat_members ADD CONSTRAINT chat_members_role_check CHECK (role IN ('admin', 'member', 'subscriber'));
+
+ALTER TABLE chats ADD COLUMN IF NOT EXISTS invite_token VARCHAR(64);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_chats_invite_token ON chats(invite_token) WHERE invite_token IS NOT NULL;
@@ -0,0 +1,11 @@
+-- Журнал входов по коду (request-code / verify-code) для разбора подозрительной активности.
+-- Email хранится только как хеш нормализованного адреса (см. 049); записи старше срока хранения удаляет сервис auth.
+CREATE TABLE IF NOT EXISTS auth_activity (
+    id         BIGSERIAL PRIMARY KEY,
+    email_hash CHAR(64) NOT NULL,
+    event      VARCHAR(64) NOT NULL,
+    ip         VARCHAR(64) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_auth_activity_email ON auth_activity(email_hash, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_auth_activity_created ON auth_activity(created_at);
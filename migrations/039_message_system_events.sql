@@ -0,0 +1,6 @@
+-- Служебные сообщения в нейтральной форме: код события и параметры (actor, target); текст собирается при показе.
+CREATE TABLE IF NOT EXISTS message_system_events (
+    message_id UUID PRIMARY KEY REFERENCES messages(id) ON DELETE CASCADE,
+    code TEXT NOT NULL,
+    params JSONB NOT NULL DEFAULT '{}'
+);
@@ -0,0 +1,21 @@
+-- Служебные учётные записи (боты) и их API-ключи. Бот — обычный пользователь без входа по коду;
+-- запросы от его имени авторизуются заголовком Authorization: Bearer <ключ>. Хранится только SHA-256 ключа.
+CREATE TABLE IF NOT EXISTS bot_accounts (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS bot_api_keys (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES bot_accounts(user_id) ON DELETE CASCADE,
+    name TEXT NOT NULL DEFAULT '',
+    key_prefix TEXT NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_bot_api_keys_user ON bot_api_keys (user_id);
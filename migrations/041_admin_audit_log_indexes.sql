@@ -0,0 +1,4 @@
+-- Фильтры журнала администраторов (GET /api/admin/audit-log): по автору, действию и объекту, страницы по id.
+CREATE INDEX IF NOT EXISTS idx_admin_audit_log_actor ON admin_audit_log(actor_id, id DESC);
+CREATE INDEX IF NOT EXISTS idx_admin_audit_log_action ON admin_audit_log(action, id DESC);
+CREATE INDEX IF NOT EXISTS idx_admin_audit_log_target ON admin_audit_log(target_id, id DESC);
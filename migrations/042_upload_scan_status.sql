@@ -0,0 +1,3 @@
+-- Статус фоновой проверки загрузки антивирусом (CLAMAV_ASYNC): pending, clean или infected.
+-- Файлы, загруженные раньше, проверены при загрузке или не проверялись вовсе — считаются clean.
+ALTER TABLE user_uploads ADD COLUMN IF NOT EXISTS scan_status VARCHAR(16) NOT NULL DEFAULT 'clean';
@@ -0,0 +1,7 @@
+-- Размеры и BlurHash загруженных картинок: в учёте загрузок и во вложениях сообщений.
+ALTER TABLE user_uploads ADD COLUMN IF NOT EXISTS width INT NOT NULL DEFAULT 0;
+ALTER TABLE user_uploads ADD COLUMN IF NOT EXISTS height INT NOT NULL DEFAULT 0;
+ALTER TABLE user_uploads ADD COLUMN IF NOT EXISTS blurhash TEXT NOT NULL DEFAULT '';
+ALTER TABLE message_attachments ADD COLUMN IF NOT EXISTS width INT NOT NULL DEFAULT 0;
+ALTER TABLE message_attachments ADD COLUMN IF NOT EXISTS height INT NOT NULL DEFAULT 0;
+ALTER TABLE message_attachments ADD COLUMN IF NOT EXISTS blurhash TEXT NOT NULL DEFAULT '';
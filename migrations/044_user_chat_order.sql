@@ -0,0 +1,8 @@
+-- Чаты, закреплённые пользователем вверху списка, в заданном им порядке (в отличие от флага «Избранное»).
+CREATE TABLE IF NOT EXISTS user_chat_order (
+    user_id  UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    chat_id  UUID NOT NULL REFERENCES chats(id) ON DELETE CASCADE,
+    position INT NOT NULL,
+    PRIMARY KEY (user_id, chat_id)
+);
+CREATE INDEX IF NOT EXISTS idx_user_chat_order_user ON user_chat_order(user_id, position);
@@ -0,0 +1,2 @@
+-- «Отметить непрочитанным»: чат показывается с непрочитанным, пока пользователь его не откроет.
+ALTER TABLE chat_members ADD COLUMN IF NOT EXISTS marked_unread BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,2 @@
+-- Ветки ответов: поиск ответов на сообщение (reply_count, GET /api/messages/{id}/thread).
+CREATE INDEX IF NOT EXISTS idx_messages_reply_to ON messages(reply_to_id) WHERE reply_to_id IS NOT NULL;
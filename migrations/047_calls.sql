@@ -0,0 +1,10 @@
+-- Звонки по данным сигнализации call-сервиса. Участники и длительность в отчётах о качестве берутся отсюда,
+-- а не из тела отчёта клиента.
+CREATE TABLE IF NOT EXISTS calls (
+    id UUID PRIMARY KEY,
+    caller_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    callee_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    accepted_at TIMESTAMPTZ,
+    ended_at TIMESTAMPTZ
+);
@@ -0,0 +1,4 @@
+-- Размеры и BlurHash картинки, отправленной одним сообщением (file_url), — как у вложений альбомов.
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS width INT NOT NULL DEFAULT 0;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS height INT NOT NULL DEFAULT 0;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS blurhash TEXT NOT NULL DEFAULT '';
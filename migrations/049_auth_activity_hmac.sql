@@ -0,0 +1,7 @@
+-- email_hash теперь HMAC с секретом AUTH_ACTIVITY_HASH_KEY. Старые записи (sha256 без секрета) удаляются:
+-- по ним уже не найти, а хеш без секрета подбирается по словарю адресов. Миграции выполняются при каждом
+-- запуске, поэтому строки помечаются: добавленный столбец заполняет существующие false, а новые записи
+-- получают true по умолчанию — удаление срабатывает только один раз.
+ALTER TABLE auth_activity ADD COLUMN IF NOT EXISTS keyed BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE auth_activity ALTER COLUMN keyed SET DEFAULT true;
+DELETE FROM auth_activity WHERE NOT keyed;
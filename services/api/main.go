@@ -7,6 +7,7 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -21,25 +22,41 @@ import (
 	chimw "github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
 
+	"github.com/messenger/internal/blobstore"
+	"github.com/messenger/internal/buildinfo"
 	"github.com/messenger/internal/config"
+	"github.com/messenger/internal/dbmigrate"
 	"github.com/messenger/internal/handler"
+	"github.com/messenger/internal/icehealth"
 	"github.com/messenger/internal/logger"
+	"github.com/messenger/internal/maintenance"
+	"github.com/messenger/internal/metrics"
 	"github.com/messenger/internal/middleware"
+	"github.com/messenger/internal/msgcrypt"
 	"github.com/messenger/internal/push"
 	"github.com/messenger/internal/repository"
+	"github.com/messenger/internal/seed"
 	"github.com/messenger/internal/startup"
 	"github.com/messenger/internal/ws"
 )
 
 func main() {
 	logger.SetPrefix("api")
+	buildinfo.LogStartup("api")
 	migrate := flag.Bool("migrate", false, "run database migrations")
 	dev := flag.Bool("dev", false, "start with embedded PostgreSQL (no external DB required)")
+	seedDemo := flag.Bool("seed", false, "after migrations, fill an empty database with demo users, a group chat and messages (not in production)")
 	flag.Parse()
 
 	logger.Info("starting API service")
 	cfg := config.Load()
+	corsOrigins, err := cfg.CORSOrigins()
+	if err != nil {
+		logger.Errorf("config: CORS_ALLOWED_ORIGINS: %v", err)
+		os.Exit(1)
+	}
 
 	var embeddedDB *embeddedpostgres.EmbeddedPostgres
 	if *dev {
@@ -64,31 +81,71 @@ func main() {
 	}
 	poolCfg.MaxConns = int32(cfg.DBMaxConnections())
 	poolCfg.MinConns = 4
+	if err := startup.ApplyQueryExecMode(poolCfg, cfg.Database.QueryExecMode, cfg.Database.StatementCacheCapacity); err != nil {
+		logger.Errorf("db config: %v", err)
+		os.Exit(1)
+	}
+	if cfg.SlowQueryThreshold > 0 {
+		poolCfg.ConnConfig.Tracer = repository.NewSlowQueryTracer(cfg.SlowQueryThreshold)
+	}
 
 	pool := startup.ConnectDBWithRetry(poolCfg, 60*time.Second, "")
 	defer pool.Close()
 
+	logger.SetDurationObserver(metrics.ObserveDuration)
+	registerPoolMetrics(pool)
+
 	runMigrations(pool)
+	if *seedDemo {
+		if _, err := seed.Run(context.Background(), pool); err != nil {
+			logger.Errorf("%v", err)
+		}
+	}
 	if *migrate && !*dev {
 		return
 	}
 
-	resetCtx, resetCancel := context.WithTimeout(context.Background(), 5*time.Second)
-	if _, err := pool.Exec(resetCtx, "UPDATE users SET is_online = false"); err != nil {
-		logger.Errorf("reset online status: %v", err)
-	}
-	resetCancel()
 	logger.Info("database connected, migrations applied")
 
 	userRepo := repository.NewUserRepository(pool)
 	permRepo := repository.NewPermissionRepository(pool)
 	chatRepo := repository.NewChatRepository(pool)
-	msgRepo := repository.NewMessageRepository(pool)
+	var msgCipher *msgcrypt.Cipher
+	if cfg.MessageEncryptionKeys != "" {
+		keys, current, err := msgcrypt.ParseKeys(cfg.MessageEncryptionKeys)
+		if err == nil {
+			msgCipher, err = msgcrypt.New(keys, current)
+		}
+		if err != nil {
+			logger.Errorf("message encryption: %v", err)
+			os.Exit(1)
+		}
+		logger.Info("message encryption at rest enabled for sensitive chats")
+	}
+	msgRepo := repository.NewMessageRepository(pool, msgCipher)
 	reactRepo := repository.NewReactionRepository(pool)
-	pinnedRepo := repository.NewPinnedRepository(pool)
+	pinnedRepo := repository.NewPinnedRepository(pool, msgRepo)
+	callStatsRepo := repository.NewCallStatsRepository(pool)
 	pushClient := push.NewClient(cfg.PushServiceURL)
+	maintenanceMode := maintenance.New(repository.NewMaintenanceRepository(pool), permRepo, cfg.MaintenanceMode)
+	if err := maintenanceMode.Load(context.Background()); err != nil {
+		logger.Errorf("maintenance mode: %v", err)
+	}
 	hubCtx, hubCancel := context.WithCancel(context.Background())
-	hub := ws.NewHub(chatRepo, msgRepo, userRepo, reactRepo, pinnedRepo, cfg.MaxWSConnections, pushClient)
+	hub := ws.NewHub(chatRepo, msgRepo, userRepo, reactRepo, pinnedRepo, cfg.MaxWSConnections, pushClient, ws.HubConfig{
+		AllowedReactions:    cfg.AllowedReactions,
+		MaxReactionsPerUser: cfg.MaxReactionsPerUser,
+		AwayAfter:           cfg.PresenceAwayAfter,
+		EditWindow:          cfg.MessageEditWindow,
+		DeleteWindow:        cfg.MessageDeleteWindow,
+		PushConcurrency:     cfg.PushConcurrency,
+		Maintenance:         maintenanceMode,
+		FileURLHosts:        cfg.FileURLHosts,
+		IdleTimeout:         time.Duration(cfg.WSIdleTimeout) * time.Second,
+		PongWait:            time.Duration(cfg.WSPongTimeout) * time.Second,
+		MaxMessageSize:      int64(cfg.WSMaxMessageSize),
+	})
+	maintenanceMode.OnChange(hub.BroadcastMaintenance)
 
 	var hubWg sync.WaitGroup
 	hubWg.Add(1)
@@ -96,46 +153,73 @@ func main() {
 		defer hubWg.Done()
 		hub.Run(hubCtx)
 	}()
-
-	chatH := handler.NewChatHandler(chatRepo, userRepo, msgRepo, hub)
-	msgH := handler.NewMessageHandler(msgRepo, chatRepo, reactRepo, pinnedRepo)
-	fileH := handler.NewFileHandler(cfg)
+	go hub.RunStatusExpiry(hubCtx, time.Minute)
+	go hub.RunHeartbeat(hubCtx, repository.PresenceTTL/3)
+	go maintenanceMode.Run(hubCtx, 15*time.Second)
+
+	auditRepo := repository.NewAuditRepository(pool)
+	chatH := handler.NewChatHandler(chatRepo, userRepo, msgRepo, permRepo, auditRepo, hub, cfg.UnreadIncludeSystem, cfg.SystemMessageLang)
+	msgH := handler.NewMessageHandler(msgRepo, chatRepo, reactRepo, pinnedRepo, hub, cfg.MaxMessageOffset, cfg.MaxPinnedPage)
+	fileStore, err := blobstore.New(cfg.Storage)
+	if err != nil {
+		logger.Errorf("file storage: %v", err)
+		os.Exit(1)
+	}
+	fileH := handler.NewFileHandler(cfg, repository.NewUploadRepository(pool), fileStore, hub)
+	go fileH.RescanPending(hubCtx)
 	audioH := handler.NewAudioHandler(cfg)
-	userH := handler.NewUserHandler(userRepo, msgRepo, permRepo)
-	wsH := handler.NewWSHandler(hub, cfg.CORSAllowedOrigins)
-	configH := handler.NewConfigHandler(cfg)
+	userH := handler.NewUserHandler(userRepo, msgRepo, permRepo, auditRepo, hub, handler.PhoneRules{AllowedPrefixes: cfg.PhoneAllowedPrefixes})
+	wsH := handler.NewWSHandler(hub, corsOrigins)
+	var iceChecker *icehealth.Checker
+	if cfg.CallICEHealthInterval > 0 {
+		iceChecker = icehealth.NewChecker(cfg.CallICEServers, 3*time.Second)
+		go iceChecker.Run(hubCtx, cfg.CallICEHealthInterval)
+	}
+	configH := handler.NewConfigHandler(cfg, iceChecker, permRepo)
 	pushH := handler.NewPushHandler(pushClient)
+	callStatsH := handler.NewCallStatsHandler(callStatsRepo, permRepo)
+	maintenanceH := handler.NewMaintenanceHandler(maintenanceMode, permRepo)
+	authActivityH := handler.NewAuthActivityHandler(repository.NewAuthActivityRepository(pool), permRepo, []byte(cfg.AuthActivityHashKey))
+	auditH := handler.NewAuditHandler(auditRepo, permRepo)
+	botRepo := repository.NewBotRepository(pool)
+	botH := handler.NewBotHandler(userRepo, botRepo, permRepo, auditRepo)
 
 	r := chi.NewRouter()
-	r.Use(chimw.RealIP)
+	r.Use(middleware.RealIP)
 	r.Use(chimw.Logger)
 	r.Use(middleware.RecoverJSON)
-	// Не сжимать WebSocket — иначе ResponseWriter не реализует http.Hijacker и upgrade даёт 500.
-	r.Use(func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-			if strings.EqualFold(req.Header.Get("Upgrade"), "websocket") {
-				next.ServeHTTP(w, req)
-				return
-			}
-			chimw.Compress(5)(next).ServeHTTP(w, req)
-		})
-	})
+	// Сжимаются только текстовые ответы от COMPRESS_MIN_SIZE байт; WebSocket не оборачивается.
+	r.Use(middleware.Compress(cfg.CompressLevel, cfg.CompressMinSize))
 	r.Use(middleware.RequestLog)
+	r.Use(middleware.LogBodies(cfg.LogBodiesSamplePercent, cfg.LogBodiesMaxBytes, "/api/files/upload", "/api/audio/upload"))
 	r.Use(middleware.SecureHeaders)
-	r.Use(middleware.RateLimitAPI)
+	// Загрузки ограничены MAX_UPLOAD_SIZE_MB в своих обработчиках.
+	r.Use(middleware.MaxBody(cfg.MaxBodySize, "/api/files/upload", "/api/audio/upload"))
+	r.Use(middleware.NewRateLimitAPI(rateLimitRedis(cfg)))
 	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{cfg.CORSAllowedOrigins},
+		AllowedOrigins:   corsOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-Session-Id", "X-Timestamp", "X-Signature"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
+	r.NotFound(middleware.NotFound)
+	r.MethodNotAllowed(middleware.MethodNotAllowed)
 
+	r.Get("/version", buildinfo.Handler("api"))
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK); w.Write([]byte("ok")) })
 	r.Get("/api/config/cache", configH.GetCacheConfig)
 	r.Get("/api/config/push", configH.GetPushConfig)
 	r.Get("/api/config/call", configH.GetCallConfig)
-	r.Get("/api/files/{filename}", fileH.Serve)
+	r.Get("/api/config/reactions", configH.GetReactionsConfig)
+	r.Get("/api/config/ws", configH.GetWSConfig)
+	r.Get("/api/maintenance", maintenanceH.GetStatus)
+	r.Get("/api/time", handler.ServerTime)
+	r.With(middleware.InternalOnly).Post("/internal/ws/revoke-sessions", wsH.RevokeSessions)
+	r.With(middleware.InternalOnly).Post("/internal/calls", callStatsH.RecordCall)
+	r.With(middleware.InternalOnly).Get("/metrics", metrics.Handler().ServeHTTP)
+	// Единственный путь к файлам без сессии; /api/files/{filename} — в группе с авторизацией.
+	r.Get("/api/files/signed/{filename}", fileH.ServeSigned)
 	if audioH != nil {
 		r.Get("/api/audio/{filename}", audioH.Serve)
 	}
@@ -154,10 +238,27 @@ func main() {
 		r.Get("/api/call/validate", handler.CallValidate(cfg.AuthServiceURL, nil))
 	}
 
+	// Маршруты, доступные и ботам: Authorization: Bearer <API-ключ> вместо подписи сессии.
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.BotKeyAuth(botRepo, middleware.AuthServiceValidate(cfg.AuthServiceURL, nil)))
+		r.Use(middleware.Maintenance(maintenanceMode))
+		r.Get("/api/chats/{chatId}/messages", msgH.GetMessages)
+		r.Get("/api/chats/{chatId}/messages/unread", msgH.GetUnreadMessages)
+		r.Post("/api/chats/{chatId}/messages", msgH.SendMessage)
+		r.Post("/api/chats/{chatId}/read", msgH.MarkAsRead)
+		r.Post("/api/chats/{chatId}/unread", chatH.MarkUnread)
+	})
+
 	r.Group(func(r chi.Router) {
 		r.Use(middleware.AuthServiceValidate(cfg.AuthServiceURL, nil))
+		r.Use(middleware.Maintenance(maintenanceMode))
 		r.Get("/api/users/me", userH.GetProfile)
 		r.Put("/api/users/me", userH.UpdateProfile)
+		r.Put("/api/users/me/status", userH.SetStatus)
+		r.Post("/api/users/presence", userH.GetPresenceBatch)
+		r.Delete("/api/users/me/status", userH.ClearStatus)
+		r.Get("/api/users/me/privacy", userH.GetPrivacy)
+		r.Put("/api/users/me/privacy", userH.SetPrivacy)
 		r.Get("/api/users", userH.GetUsers)
 		r.Get("/api/users/employees", userH.GetEmployees)
 		r.Post("/api/users", userH.CreateUser)
@@ -165,26 +266,59 @@ func main() {
 		r.Get("/api/users/me/favorites", userH.GetFavorites)
 		r.Post("/api/users/me/favorites", userH.AddFavorite)
 		r.Delete("/api/users/me/favorites/{chatId}", userH.RemoveFavorite)
+		r.Get("/api/users/me/pinned-chats", chatH.GetPinnedChats)
+		r.Put("/api/users/me/pinned-chats", chatH.SetPinnedChats)
+		r.Post("/api/users/me/pinned-chats", chatH.PinChat)
+		r.Delete("/api/users/me/pinned-chats/{chatId}", chatH.UnpinChat)
 		r.Get("/api/users/{id}", userH.GetUser)
 		r.Put("/api/users/{id}", userH.UpdateUserProfile)
 		r.Get("/api/users/{id}/stats", userH.GetUserStats)
+		r.Get("/api/users/{id}/chats", chatH.GetUserGroups)
+		r.Delete("/api/users/{id}/chats", chatH.RemoveUserFromGroups)
 		r.Get("/api/users/{id}/permissions", userH.GetUserPermissions)
 		r.Put("/api/users/{id}/permissions", userH.UpdateUserPermissions)
 		r.Put("/api/users/{id}/disable", userH.SetUserDisabled)
+		r.Get("/api/admin/ice-health", configH.GetICEHealth)
+		r.Get("/api/admin/call-stats", callStatsH.GetSummary)
+		r.Put("/api/admin/maintenance", maintenanceH.SetStatus)
+		r.Post("/api/admin/users/{id}/merge-into/{targetId}", userH.MergeUser)
+		r.Get("/api/admin/auth-activity", authActivityH.List)
+		r.Get("/api/admin/audit-log", auditH.List)
+		r.Post("/api/admin/resync", chatH.ForceResync)
+		r.Get("/api/bots", botH.List)
+		r.Post("/api/bots", botH.Create)
+		r.Get("/api/bots/{id}/keys", botH.ListKeys)
+		r.Post("/api/bots/{id}/keys", botH.CreateKey)
+		r.Delete("/api/bots/{id}/keys/{keyId}", botH.RevokeKey)
 		r.Get("/api/chats", chatH.GetUserChats)
 		r.Post("/api/chats/personal", chatH.CreatePersonalChat)
 		r.Post("/api/chats/group", chatH.CreateGroupChat)
+		r.Post("/api/chats/channel", chatH.CreateChannel)
+		r.Post("/api/chats/join/{token}", chatH.JoinByInvite)
 		r.Get("/api/chats/{id}", chatH.GetChat)
 		r.Put("/api/chats/{id}", chatH.UpdateChat)
 		r.Post("/api/chats/{id}/members", chatH.AddMembers)
 		r.Delete("/api/chats/{id}/members/{memberId}", chatH.RemoveMember)
+		r.Put("/api/chats/{id}/members/{memberId}/role", chatH.UpdateMemberRole)
 		r.Post("/api/chats/{id}/leave", chatH.LeaveChat)
-		r.Get("/api/chats/{chatId}/messages", msgH.GetMessages)
-		r.Post("/api/chats/{chatId}/read", msgH.MarkAsRead)
+		r.Post("/api/chats/{id}/clear", chatH.ClearHistory)
+		r.Get("/api/chats/{id}/invite", chatH.GetInviteLink)
+		r.Post("/api/chats/{id}/invite", chatH.ResetInviteLink)
 		r.Get("/api/chats/{chatId}/pinned", msgH.GetPinnedMessages)
+		r.Get("/api/chats/{chatId}/media", msgH.GetChatMedia)
+		r.Get("/api/chats/{chatId}/reactions", msgH.GetChatReactions)
+		r.Get("/api/chats/{chatId}/online", chatH.GetOnlineMembers)
+		r.Get("/api/chats/{id}/stats", chatH.GetChatStats)
 		r.Get("/api/messages/{messageId}/reactions", msgH.GetReactions)
+		r.Get("/api/messages/{messageId}/receipts", msgH.GetReceipts)
+		r.Get("/api/messages/{messageId}/thread", msgH.GetThread)
 		r.Get("/api/messages/search", msgH.SearchMessages)
 		r.Post("/api/files/upload", fileH.Upload)
+		r.Get("/api/files/usage", fileH.GetUsage)
+		r.Get("/api/files/{filename}", fileH.Serve)
+		r.Delete("/api/files/{filename}", fileH.Delete)
+		r.Post("/api/files/{filename}/signed-url", fileH.CreateSignedURL)
+		r.Get("/api/files/{filename}/status", fileH.GetFileMeta)
 		if audioH != nil {
 			r.Post("/api/audio/upload", audioH.Upload)
 		} else {
@@ -194,6 +328,7 @@ func main() {
 				_ = json.NewEncoder(w).Encode(map[string]string{"error": "audio service not configured"})
 			})
 		}
+		r.Post("/api/calls/{callId}/stats", callStatsH.ReportStats)
 		r.Post("/api/push/subscribe", pushH.Subscribe)
 		r.Delete("/api/push/subscribe", pushH.Unsubscribe)
 		r.Get("/ws", wsH.ServeWS)
@@ -273,6 +408,13 @@ func authProxyHandler(authBaseURL string) http.HandlerFunc {
 			return
 		}
 		proxyReq.Header.Set("Content-Type", r.Header.Get("Content-Type"))
+		// Адрес клиента для журнала попыток входа и лимитов в auth (RemoteAddr уже подменён middleware.RealIP).
+		// Запрос собирается заново: True-Client-IP/X-Forwarded-For клиента в auth не попадают.
+		if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			proxyReq.Header.Set("X-Real-Ip", ip)
+		} else {
+			proxyReq.Header.Set("X-Real-Ip", r.RemoteAddr)
+		}
 		if proxyReq.Header.Get("Content-Type") == "" {
 			proxyReq.Header.Set("Content-Type", "application/json")
 		}
@@ -306,32 +448,30 @@ func spaHandler(dir string) http.HandlerFunc {
 	}
 }
 
+// runMigrations применяет миграции; временная недоступность БД переживается повторами (миграции идемпотентны).
 func runMigrations(pool *pgxpool.Pool) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	files := []string{
-		"migrations/001_init.sql", "migrations/002_features.sql", "migrations/003_phone.sql",
-		"migrations/004_system_messages.sql", "migrations/005_user_favorites.sql", "migrations/006_notes_chat.sql",
-		"migrations/007_sessions_otp_auth.sql", "migrations/008_sessions_revoked_at.sql",
-		"migrations/010_user_permissions.sql", "migrations/011_user_permissions_administrator.sql", "migrations/012_user_permissions_member.sql",
-		"migrations/013_normalize_file_names.sql", "migrations/014_allow_voice_content_type.sql",
-		"migrations/015_user_disabled_at.sql",
-	}
-	for _, f := range files {
-		data, err := os.ReadFile(f)
-		if err != nil {
-			logger.Errorf("read migration %s: %v", f, err)
-			os.Exit(1)
-		}
-		if _, err := pool.Exec(ctx, string(data)); err != nil {
-			logger.Errorf("run migration %s: %v", f, err)
-			os.Exit(1)
-		}
-	}
+	startup.RetryDB(60*time.Second, 30*time.Second, "", "migrations", func(ctx context.Context) error {
+		return dbmigrate.Apply(ctx, pool, "migrations")
+	})
 	logger.Info("migrations applied")
 }
 
+// registerPoolMetrics публикует в /metrics состояние пула подключений к БД.
+func registerPoolMetrics(pool *pgxpool.Pool) {
+	metrics.RegisterGauge("messenger_db_conns_total", "Open database connections.", func() float64 {
+		return float64(pool.Stat().TotalConns())
+	})
+	metrics.RegisterGauge("messenger_db_conns_acquired", "Database connections currently in use.", func() float64 {
+		return float64(pool.Stat().AcquiredConns())
+	})
+	metrics.RegisterGauge("messenger_db_conns_idle", "Idle database connections.", func() float64 {
+		return float64(pool.Stat().IdleConns())
+	})
+	metrics.RegisterGauge("messenger_db_acquire_wait_total", "Acquires that had to wait for a free connection.", func() float64 {
+		return float64(pool.Stat().EmptyAcquireCount())
+	})
+}
+
 func startEmbeddedPostgres(cfg *config.Config) (*embeddedpostgres.EmbeddedPostgres, error) {
 	const (
 		port     = 5432
@@ -367,3 +507,25 @@ func startEmbeddedPostgres(cfg *config.Config) (*embeddedpostgres.EmbeddedPostgr
 	logger.Infof("embedded PostgreSQL running on port %d", port)
 	return db, nil
 }
+
+// rateLimitRedis подключает Redis для общего лимита запросов (RATE_LIMIT_BACKEND=redis).
+// nil — Redis не настроен: лимит считается в памяти процесса. Пока Redis недоступен, лимитер
+// сам переходит на память процесса, а клиент переподключается, когда Redis вернётся.
+func rateLimitRedis(cfg *config.Config) *redis.Client {
+	if !cfg.Redis.RateLimit {
+		return nil
+	}
+	opts, err := redis.ParseURL(cfg.Redis.URL)
+	if err != nil {
+		logger.Errorf("rate limit: redis url: %v (using in-process limiter)", err)
+		return nil
+	}
+	rdb := redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		logger.Errorf("rate limit: redis ping: %v (in-process limiter until redis is reachable)", err)
+	}
+	logger.Info("rate limit: using redis")
+	return rdb
+}
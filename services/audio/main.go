@@ -13,11 +13,15 @@ import (
 	chimw "github.com/go-chi/chi/v5/middleware"
 
 	"github.com/messenger/internal/audioserver"
+	"github.com/messenger/internal/blobstore"
+	"github.com/messenger/internal/buildinfo"
 	"github.com/messenger/internal/logger"
+	"github.com/messenger/internal/middleware"
 )
 
 func main() {
 	logger.SetPrefix("audio")
+	buildinfo.LogStartup("audio")
 	uploadDir := os.Getenv("UPLOAD_DIR")
 	if uploadDir == "" {
 		uploadDir = "./uploads"
@@ -35,12 +39,20 @@ func main() {
 	}
 	logger.Infof("starting audio service: upload_dir=%s max_upload_mb=%d", uploadDir, maxMB)
 
-	svc := audioserver.New(uploadDir, maxSize)
+	store, err := blobstore.New(blobstore.ConfigFromEnv(uploadDir))
+	if err != nil {
+		logger.Errorf("audio storage: %v", err)
+		os.Exit(1)
+	}
+	svc := audioserver.New(store, maxSize)
 
 	r := chi.NewRouter()
-	r.Use(chimw.RealIP)
+	r.Use(middleware.RealIP)
 	r.Use(chimw.Logger)
 	r.Use(chimw.Recoverer)
+	r.NotFound(middleware.NotFound)
+	r.MethodNotAllowed(middleware.MethodNotAllowed)
+	r.Get("/version", buildinfo.Handler("audio"))
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK); w.Write([]byte("ok")) })
 	r.Post("/upload", svc.Upload)
 	r.Get("/audio/{filename}", func(w http.ResponseWriter, r *http.Request) {
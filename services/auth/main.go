@@ -4,6 +4,7 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
@@ -16,6 +17,7 @@ import (
 	"github.com/go-chi/cors"
 	"github.com/jackc/pgx/v5/pgxpool"
 
+	"github.com/messenger/internal/buildinfo"
 	"github.com/messenger/internal/config"
 	"github.com/messenger/internal/email"
 	"github.com/messenger/internal/handler"
@@ -30,11 +32,17 @@ import (
 
 func main() {
 	logger.SetPrefix("auth")
+	buildinfo.LogStartup("auth")
 	dev := flag.Bool("dev", false, "use in-memory store instead of Redis (no Redis required)")
 	flag.Parse()
 
 	logger.Info("starting auth service")
 	cfg := config.Load()
+	corsOrigins, err := cfg.CORSOrigins()
+	if err != nil {
+		logger.Errorf("config: CORS_ALLOWED_ORIGINS: %v", err)
+		os.Exit(1)
+	}
 	if cfg.SMTP.Username == "" || cfg.SMTP.Password == "" {
 		logger.Info("SMTP не настроен (SMTP_USERNAME/SMTP_PASSWORD в .env). Письма с кодом отправляться не будут.")
 	} else {
@@ -47,6 +55,10 @@ func main() {
 		os.Exit(1)
 	}
 	poolCfg.MaxConns = int32(cfg.DBMaxConnections())
+	if err := startup.ApplyQueryExecMode(poolCfg, cfg.Database.QueryExecMode, cfg.Database.StatementCacheCapacity); err != nil {
+		logger.Errorf("db config: %v", err)
+		os.Exit(1)
+	}
 	pool := startup.ConnectDBWithRetry(poolCfg, 60*time.Second, "auth: ")
 	defer pool.Close()
 
@@ -60,35 +72,82 @@ func main() {
 	} else {
 		redisClient := startup.ConnectRedisWithRetry(cfg.Redis.URL, 60*time.Second, "auth: ")
 		defer redisClient.Close()
+		healthCtx, stopHealth := context.WithCancel(context.Background())
+		defer stopHealth()
+		go redisClient.RunHealthCheck(healthCtx)
 		store = redisClient
 	}
-	mailer := email.NewSender(&cfg.SMTP)
-	otpSvc := service.NewOTPAuthService(userRepo, sessionRepo, store, mailer)
+	deliverer, err := otpDeliverer(cfg)
+	if err != nil {
+		logger.Errorf("config: %v", err)
+		os.Exit(1)
+	}
+	var revoke service.SessionRevokeNotifier
+	if cfg.APIServiceURL != "" {
+		revoke = service.NewHTTPRevokeNotifier(cfg.APIServiceURL)
+	}
+	var welcome service.WelcomeSender
+	if cfg.WelcomeMessage != "" {
+		notesWelcome, err := service.NewNotesWelcome(repository.NewChatRepository(pool), repository.NewMessageRepository(pool, nil), cfg.WelcomeMessage)
+		if err != nil {
+			logger.Errorf("config: %v", err)
+			os.Exit(1)
+		}
+		welcome = notesWelcome
+	}
+	var activity *repository.AuthActivityRepository
+	switch {
+	case cfg.AuthActivityRetention <= 0:
+	case cfg.AuthActivityHashKey == "":
+		logger.Info("AUTH_ACTIVITY_HASH_KEY not set — журнал попыток входа не ведётся")
+	default:
+		activity = repository.NewAuthActivityRepository(pool)
+	}
+	otpSvc := service.NewOTPAuthService(userRepo, sessionRepo, store, deliverer, revoke, welcome, service.AuthPolicy{
+		AllowedDomains:       cfg.AllowedEmailDomains,
+		AutoProvision:        cfg.AutoProvision,
+		AutoProvisionDomains: cfg.AutoProvisionDomains,
+		MaxSessions:          cfg.MaxSessionsPerUser,
+		RejectOverLimit:      cfg.SessionLimitReject,
+	}, activity, []byte(cfg.AuthActivityHashKey))
+	cleanupCtx, stopCleanup := context.WithCancel(context.Background())
+	defer stopCleanup()
+	go otpSvc.RunActivityCleanup(cleanupCtx, cfg.AuthActivityRetention, time.Hour)
 	authH := handler.NewAuthHandler(otpSvc)
 
 	r := chi.NewRouter()
-	r.Use(chimw.RealIP)
+	r.Use(middleware.RealIP)
 	r.Use(chimw.Logger)
 	r.Use(chimw.Recoverer)
+	r.Use(middleware.MaxBody(cfg.MaxBodySize))
 	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{cfg.CORSAllowedOrigins},
+		AllowedOrigins:   corsOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Content-Type", "X-Session-Id", "X-Timestamp", "X-Signature"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
+	r.NotFound(middleware.NotFound)
+	r.MethodNotAllowed(middleware.MethodNotAllowed)
 
 	r.Post("/api/auth/request-code", authH.RequestCode)
 	r.Post("/api/auth/verify-code", authH.VerifyCode)
 	r.With(middleware.InternalOnly).Post("/internal/validate", handler.ValidateSession(otpSvc))
+	if cfg.DevOTPEndpoint {
+		logger.Info("DEV_OTP_ENDPOINT: GET /api/auth/dev/last-code включён — только для разработки")
+		r.Get("/api/auth/dev/last-code", authH.DevLastCode)
+	}
 
 	r.Group(func(r chi.Router) {
 		r.Use(middleware.SessionAuth(sessionRepo, store))
 		r.Get("/api/auth/sessions", authH.GetSessions)
 		r.Delete("/api/auth/session", authH.LogoutSession)
 		r.Delete("/api/auth/sessions", authH.LogoutAllSessions)
+		r.Delete("/api/auth/sessions/others", authH.LogoutOtherSessions)
+		r.Post("/api/auth/session/rotate", authH.RotateSession)
 	})
 
+	r.Get("/version", buildinfo.Handler("auth"))
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("ok"))
@@ -121,3 +180,25 @@ func main() {
 	srvWg.Wait()
 	logger.Info("auth server stopped")
 }
+
+// otpDeliverer выбирает канал доставки кодов по OTP_DELIVERY.
+func otpDeliverer(cfg *config.Config) (service.OTPDeliverer, error) {
+	switch cfg.OTPDelivery {
+	case "", "email":
+		return email.NewSender(&cfg.SMTP), nil
+	case "webhook":
+		if cfg.OTPWebhookURL == "" {
+			return nil, fmt.Errorf("OTP_DELIVERY=webhook требует OTP_WEBHOOK_URL")
+		}
+		logger.Infof("OTP: коды отправляются на webhook %s", cfg.OTPWebhookURL)
+		return service.NewWebhookDeliverer(cfg.OTPWebhookURL, cfg.OTPWebhookSecret), nil
+	case "console":
+		if os.Getenv("APP_ENV") == "production" {
+			return nil, fmt.Errorf("OTP_DELIVERY=console недоступен в production")
+		}
+		logger.Info("OTP: коды пишутся в лог (OTP_DELIVERY=console), письма не отправляются")
+		return service.ConsoleDeliverer{}, nil
+	default:
+		return nil, fmt.Errorf("неизвестный OTP_DELIVERY=%q (email, webhook, console)", cfg.OTPDelivery)
+	}
+}
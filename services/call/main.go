@@ -11,12 +11,15 @@ import (
 	"github.com/go-chi/chi/v5"
 	chimw "github.com/go-chi/chi/v5/middleware"
 
+	"github.com/messenger/internal/buildinfo"
 	"github.com/messenger/internal/callserver"
 	"github.com/messenger/internal/logger"
+	"github.com/messenger/internal/middleware"
 )
 
 func main() {
 	logger.SetPrefix("call")
+	buildinfo.LogStartup("call")
 	apiURL := os.Getenv("API_URL")
 	if apiURL == "" {
 		apiURL = "http://localhost:8080"
@@ -29,11 +32,15 @@ func main() {
 
 	validate := callserver.ValidateViaHTTP(apiURL, &http.Client{Timeout: 5 * time.Second})
 	hub := callserver.NewHub(validate)
+	hub.SetRecorder(callserver.RecordViaHTTP(apiURL, &http.Client{Timeout: 5 * time.Second}))
 
 	r := chi.NewRouter()
-	r.Use(chimw.RealIP)
+	r.Use(middleware.RealIP)
 	r.Use(chimw.Logger)
 	r.Use(chimw.Recoverer)
+	r.NotFound(middleware.NotFound)
+	r.MethodNotAllowed(middleware.MethodNotAllowed)
+	r.Get("/version", buildinfo.Handler("call"))
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK); w.Write([]byte("ok")) })
 	r.Get("/call/ws", hub.ServeWS)
 
@@ -12,12 +12,17 @@ import (
 	"github.com/go-chi/chi/v5"
 	chimw "github.com/go-chi/chi/v5/middleware"
 
+	"github.com/messenger/internal/blobstore"
+	"github.com/messenger/internal/buildinfo"
+	"github.com/messenger/internal/clamav"
 	"github.com/messenger/internal/fileserver"
 	"github.com/messenger/internal/logger"
+	"github.com/messenger/internal/middleware"
 )
 
 func main() {
 	logger.SetPrefix("files")
+	buildinfo.LogStartup("files")
 	uploadDir := os.Getenv("UPLOAD_DIR")
 	if uploadDir == "" {
 		uploadDir = "./uploads"
@@ -35,17 +40,34 @@ func main() {
 	}
 	logger.Infof("starting files service: upload_dir=%s max_upload_mb=%d", uploadDir, maxMB)
 
-	svc := fileserver.New(uploadDir, maxSize)
+	storeCfg := blobstore.ConfigFromEnv(uploadDir)
+	store, err := blobstore.New(storeCfg)
+	if err != nil {
+		logger.Errorf("file storage: %v", err)
+		os.Exit(1)
+	}
+	svc := fileserver.New(store, storeCfg.Gzip, maxSize)
+	svc.ContentTypes = fileserver.ParseContentTypes(os.Getenv("FILE_CONTENT_TYPES"))
+	if clamAddr := os.Getenv("CLAMAV_ADDR"); clamAddr != "" {
+		svc.Scanner = clamav.New(clamAddr, os.Getenv("CLAMAV_FAIL_OPEN") == "true")
+		logger.Infof("virus scan enabled: clamd=%s fail_open=%v", clamAddr, svc.Scanner.FailOpen)
+	}
 
 	r := chi.NewRouter()
-	r.Use(chimw.RealIP)
+	r.Use(middleware.RealIP)
 	r.Use(chimw.Logger)
 	r.Use(chimw.Recoverer)
+	r.NotFound(middleware.NotFound)
+	r.MethodNotAllowed(middleware.MethodNotAllowed)
+	r.Get("/version", buildinfo.Handler("files"))
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK); w.Write([]byte("ok")) })
 	r.Post("/upload", svc.Upload)
 	r.Get("/files/{filename}", func(w http.ResponseWriter, r *http.Request) {
 		svc.Serve(w, r, chi.URLParam(r, "filename"))
 	})
+	r.Delete("/files/{filename}", func(w http.ResponseWriter, r *http.Request) {
+		svc.Delete(w, r, chi.URLParam(r, "filename"))
+	})
 
 	srv := &http.Server{Addr: addr, Handler: r, ReadTimeout: 15 * time.Second, WriteTimeout: 30 * time.Second}
 	go func() {
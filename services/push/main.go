@@ -7,7 +7,9 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -16,7 +18,9 @@ import (
 	chimw "github.com/go-chi/chi/v5/middleware"
 	"github.com/redis/go-redis/v9"
 
+	"github.com/messenger/internal/buildinfo"
 	"github.com/messenger/internal/logger"
+	"github.com/messenger/internal/middleware"
 	"github.com/messenger/internal/push"
 )
 
@@ -31,6 +35,12 @@ type Config struct {
 	RedisURL        string
 	VAPIDPublicKey  string
 	VAPIDPrivateKey string
+	// SendConcurrency — сколько отправок в push-сервисы браузеров идёт одновременно (на весь сервис).
+	SendConcurrency int
+	// ReplayMax — сколько последних недоставленных уведомлений хранится на пользователя для повторной
+	// отправки при новой подписке; 0 — не хранить. ReplayWindow — сколько они хранятся.
+	ReplayMax    int
+	ReplayWindow time.Duration
 }
 
 func loadConfig() *Config {
@@ -39,6 +49,18 @@ func loadConfig() *Config {
 		RedisURL:        getEnv("REDIS_URL", "redis://localhost:6379"),
 		VAPIDPublicKey:  os.Getenv("VAPID_PUBLIC_KEY"),
 		VAPIDPrivateKey: os.Getenv("VAPID_PRIVATE_KEY"),
+		SendConcurrency: 8,
+		ReplayMax:       20,
+		ReplayWindow:    24 * time.Hour,
+	}
+	if n, err := strconv.Atoi(os.Getenv("PUSH_SEND_CONCURRENCY")); err == nil && n > 0 {
+		c.SendConcurrency = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("PUSH_REPLAY_MAX")); err == nil && n >= 0 {
+		c.ReplayMax = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("PUSH_REPLAY_WINDOW_HOURS")); err == nil && n > 0 {
+		c.ReplayWindow = time.Duration(n) * time.Hour
 	}
 	return c
 }
@@ -70,14 +92,25 @@ type NotifyRequest struct {
 	Data   map[string]string `json:"data,omitempty"`
 }
 
+// NotifyBatchRequest — одно уведомление для нескольких пользователей.
+type NotifyBatchRequest struct {
+	UserIDs []string          `json:"user_ids"`
+	Title   string            `json:"title"`
+	Body    string            `json:"body"`
+	Data    map[string]string `json:"data,omitempty"`
+}
+
 type Server struct {
 	cfg   *Config
 	redis *redis.Client
 	vapid *webpush.Options
+	// sendSem ограничивает одновременные отправки (cfg.SendConcurrency).
+	sendSem chan struct{}
 }
 
 func main() {
 	logger.SetPrefix("push")
+	buildinfo.LogStartup("push")
 	if len(os.Args) > 1 && (os.Args[1] == "-gen-vapid" || os.Args[1] == "--gen-vapid") {
 		priv, pub, err := webpush.GenerateVAPIDKeys()
 		if err != nil {
@@ -128,18 +161,23 @@ func main() {
 			TTL:             30,
 		}
 	}
-	s := &Server{cfg: cfg, redis: rdb, vapid: vapidOpts}
+	s := &Server{cfg: cfg, redis: rdb, vapid: vapidOpts, sendSem: make(chan struct{}, cfg.SendConcurrency)}
 
 	r := chi.NewRouter()
-	r.Use(chimw.RealIP)
+	r.Use(middleware.RealIP)
 	r.Use(chimw.Logger)
 	r.Use(chimw.Recoverer)
+	r.NotFound(middleware.NotFound)
+	r.MethodNotAllowed(middleware.MethodNotAllowed)
+	r.Get("/version", buildinfo.Handler("push"))
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK); w.Write([]byte("ok")) })
 	r.Get("/api/vapid-public", s.handleVAPIDPublic)
 	r.Route("/api", func(r chi.Router) {
 		r.Post("/subscribe", s.handleSubscribe)
 		r.Delete("/subscribe", s.handleUnsubscribe)
 		r.Post("/notify", s.handleNotify)
+		r.Post("/notify-batch", s.handleNotifyBatch)
+		r.Post("/chat-read", s.handleChatRead)
 	})
 
 	srv := &http.Server{
@@ -206,6 +244,13 @@ func (s *Server) handleSubscribe(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "failed to save subscription", http.StatusInternalServerError)
 		return
 	}
+	if s.vapid != nil && s.cfg.ReplayMax > 0 {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			s.replayMissed(ctx, req.UserID, req.Subscription)
+		}()
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -260,44 +305,264 @@ func (s *Server) handleNotify(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "user_id required", http.StatusBadRequest)
 		return
 	}
-	key := redisKeyPrefix + req.UserID
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
-	list, err := s.redis.LRange(ctx, key, 0, -1).Result()
+	targets, err := s.loadSubscriptions(ctx, []string{req.UserID})
 	if err != nil {
 		logger.Errorf("notify redis: %v", err)
 		http.Error(w, "failed to get subscriptions", http.StatusInternalServerError)
 		return
 	}
-	payload := map[string]interface{}{"title": req.Title, "body": req.Body, "data": req.Data}
-	payloadBytes, _ := json.Marshal(payload)
-	var subs []PushSubscription
-	for _, item := range list {
-		var sub PushSubscription
-		if json.Unmarshal([]byte(item), &sub) == nil && sub.Endpoint != "" {
-			subs = append(subs, sub)
+	if s.vapid == nil {
+		return
+	}
+	payload := notificationPayload(req.Title, req.Body, req.Data)
+	// Без подписок хранить нечего: повторная отправка — только на новое устройство уже подписанного пользователя.
+	if delivered := s.send(ctx, payload, targets); len(targets) > 0 && !delivered[req.UserID] {
+		s.recordMissed(ctx, payload, req.Data["chat_id"], []string{req.UserID})
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// maxBatchUsers — сколько получателей принимает один /api/notify-batch.
+const maxBatchUsers = 1000
+
+// handleNotifyBatch отправляет одно уведомление многим пользователям: подписки читаются одним
+// pipeline-запросом к Redis, отправка идёт в фоне (ответ 202 сразу), чтобы API не ждал всю рассылку.
+func (s *Server) handleNotifyBatch(w http.ResponseWriter, r *http.Request) {
+	var req NotifyBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	userIDs := make([]string, 0, len(req.UserIDs))
+	seen := make(map[string]struct{}, len(req.UserIDs))
+	for _, id := range req.UserIDs {
+		id = strings.TrimSpace(id)
+		if _, dup := seen[id]; id == "" || dup {
+			continue
 		}
+		seen[id] = struct{}{}
+		userIDs = append(userIDs, id)
 	}
-	if s.vapid == nil {
+	if len(userIDs) == 0 {
+		http.Error(w, "user_ids required", http.StatusBadRequest)
+		return
+	}
+	if len(userIDs) > maxBatchUsers {
+		http.Error(w, "too many user_ids", http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	targets, err := s.loadSubscriptions(ctx, userIDs)
+	cancel()
+	if err != nil {
+		logger.Errorf("notify-batch redis: %v", err)
+		http.Error(w, "failed to get subscriptions", http.StatusInternalServerError)
 		return
 	}
-	for i := range subs {
-		sub := &subs[i]
-		wpSub := &webpush.Subscription{
-			Endpoint: sub.Endpoint,
-			Keys:     webpush.Keys{P256dh: sub.Keys.P256dh, Auth: sub.Keys.Auth},
+	if s.vapid != nil {
+		payload := notificationPayload(req.Title, req.Body, req.Data)
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			delivered := s.send(ctx, payload, targets)
+			subscribed := make(map[string]bool, len(targets))
+			for _, t := range targets {
+				subscribed[t.userID] = true
+			}
+			missed := make([]string, 0, len(userIDs))
+			for _, id := range userIDs {
+				if subscribed[id] && !delivered[id] {
+					missed = append(missed, id)
+				}
+			}
+			s.recordMissed(ctx, payload, req.Data["chat_id"], missed)
+		}()
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// missedKeyPrefix — список недоставленных уведомлений пользователя (новые в начале).
+const missedKeyPrefix = "push:missed:"
+
+// missedNotification — уведомление, не доставленное ни на одно устройство пользователя. ChatID — чат,
+// из которого оно пришло: после прочтения чата уведомление удаляется (handleChatRead).
+type missedNotification struct {
+	At      int64           `json:"at"`
+	ChatID  string          `json:"chat_id,omitempty"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// recordMissed запоминает payload из чата chatID для пользователей userIDs (вызывающий передаёт только
+// пользователей с подписками): не больше cfg.ReplayMax последних на пользователя, список живёт
+// cfg.ReplayWindow с последней записи.
+func (s *Server) recordMissed(ctx context.Context, payload []byte, chatID string, userIDs []string) {
+	if s.cfg.ReplayMax <= 0 || len(userIDs) == 0 {
+		return
+	}
+	raw, err := json.Marshal(missedNotification{At: time.Now().Unix(), ChatID: chatID, Payload: payload})
+	if err != nil {
+		return
+	}
+	pipe := s.redis.Pipeline()
+	for _, id := range userIDs {
+		key := missedKeyPrefix + id
+		pipe.LPush(ctx, key, raw)
+		pipe.LTrim(ctx, key, 0, int64(s.cfg.ReplayMax-1))
+		pipe.Expire(ctx, key, s.cfg.ReplayWindow)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Errorf("record missed redis: %v", err)
+	}
+}
+
+// handleChatRead удаляет недоставленные уведомления из прочитанного чата: на новом устройстве они
+// были бы уже неактуальны. Элементы удаляются по значению (LREM), поэтому параллельная запись не теряется.
+func (s *Server) handleChatRead(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID string `json:"user_id"`
+		ChatID string `json:"chat_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	req.UserID = strings.TrimSpace(req.UserID)
+	if req.UserID == "" || req.ChatID == "" {
+		http.Error(w, "user_id and chat_id required", http.StatusBadRequest)
+		return
+	}
+	key := missedKeyPrefix + req.UserID
+	ctx := r.Context()
+	list, err := s.redis.LRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		logger.Errorf("chat-read redis: %v", err)
+		http.Error(w, "failed to get missed notifications", http.StatusInternalServerError)
+		return
+	}
+	pipe := s.redis.Pipeline()
+	for _, item := range list {
+		var m missedNotification
+		if json.Unmarshal([]byte(item), &m) == nil && m.ChatID == req.ChatID {
+			pipe.LRem(ctx, key, 1, item)
 		}
-		resp, err := webpush.SendNotificationWithContext(ctx, payloadBytes, wpSub, s.vapid)
-		if err != nil {
-			logger.Errorf("send %s: %v", sub.Endpoint[:min(50, len(sub.Endpoint))], err)
+	}
+	if pipe.Len() > 0 {
+		if _, err := pipe.Exec(ctx); err != nil {
+			logger.Errorf("chat-read redis: %v", err)
+			http.Error(w, "failed to remove missed notifications", http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// replayMissed отправляет на новую подписку sub недоставленные пользователю уведомления не старше
+// cfg.ReplayWindow (старые первыми) и очищает список — повторно они не отправляются.
+func (s *Server) replayMissed(ctx context.Context, userID string, sub PushSubscription) {
+	key := missedKeyPrefix + userID
+	pipe := s.redis.TxPipeline()
+	items := pipe.LRange(ctx, key, 0, -1)
+	pipe.Del(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		logger.Errorf("replay redis: %v", err)
+		return
+	}
+	cutoff := time.Now().Add(-s.cfg.ReplayWindow).Unix()
+	target := []pushTarget{{userID: userID, sub: sub}}
+	list := items.Val()
+	replayed := 0
+	for i := len(list) - 1; i >= 0; i-- {
+		var m missedNotification
+		if json.Unmarshal([]byte(list[i]), &m) != nil || m.At < cutoff {
 			continue
 		}
-		resp.Body.Close()
-		if resp.StatusCode == 410 || resp.StatusCode == 404 {
-			s.removeSubscription(ctx, req.UserID, sub.Endpoint)
+		s.send(ctx, m.Payload, target)
+		replayed++
+	}
+	if replayed > 0 {
+		logger.Infof("replayed %d missed notifications user=%s", replayed, userID)
+	}
+}
+
+func notificationPayload(title, body string, data map[string]string) []byte {
+	payload := map[string]interface{}{"title": title, "body": body, "data": data}
+	payloadBytes, _ := json.Marshal(payload)
+	return payloadBytes
+}
+
+// pushTarget — одна подписка получателя.
+type pushTarget struct {
+	userID string
+	sub    PushSubscription
+}
+
+// loadSubscriptions читает подписки пользователей одним pipeline-запросом.
+func (s *Server) loadSubscriptions(ctx context.Context, userIDs []string) ([]pushTarget, error) {
+	pipe := s.redis.Pipeline()
+	cmds := make([]*redis.StringSliceCmd, len(userIDs))
+	for i, id := range userIDs {
+		cmds[i] = pipe.LRange(ctx, redisKeyPrefix+id, 0, -1)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	var targets []pushTarget
+	for i, cmd := range cmds {
+		for _, item := range cmd.Val() {
+			var sub PushSubscription
+			if json.Unmarshal([]byte(item), &sub) == nil && sub.Endpoint != "" {
+				targets = append(targets, pushTarget{userID: userIDs[i], sub: sub})
+			}
 		}
 	}
-	w.WriteHeader(http.StatusNoContent)
+	return targets, nil
+}
+
+// send отправляет payload по подпискам параллельно, но не больше cfg.SendConcurrency на весь сервис;
+// подписки, отвергнутые браузерным push-сервисом (404/410), удаляются. Возвращает пользователей,
+// которым уведомление принято хотя бы на одно устройство.
+func (s *Server) send(ctx context.Context, payload []byte, targets []pushTarget) map[string]bool {
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		stale     []pushTarget
+		delivered = make(map[string]bool)
+	)
+	for i := range targets {
+		t := &targets[i]
+		s.sendSem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-s.sendSem }()
+			wpSub := &webpush.Subscription{
+				Endpoint: t.sub.Endpoint,
+				Keys:     webpush.Keys{P256dh: t.sub.Keys.P256dh, Auth: t.sub.Keys.Auth},
+			}
+			resp, err := webpush.SendNotificationWithContext(ctx, payload, wpSub, s.vapid)
+			if err != nil {
+				logger.Errorf("send %s: %v", t.sub.Endpoint[:min(50, len(t.sub.Endpoint))], err)
+				return
+			}
+			resp.Body.Close()
+			mu.Lock()
+			switch {
+			case resp.StatusCode == 410 || resp.StatusCode == 404:
+				stale = append(stale, *t)
+			case resp.StatusCode >= 200 && resp.StatusCode < 300:
+				delivered[t.userID] = true
+			}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	// Удаление переписывает весь список в Redis — выполняем последовательно после отправки.
+	for _, t := range stale {
+		s.removeSubscription(ctx, t.userID, t.sub.Endpoint)
+	}
+	return delivered
 }
 
 func (s *Server) removeSubscription(ctx context.Context, userID, endpoint string) {
@@ -191,6 +191,26 @@ export const verifyCode = (email: string, code: string, deviceName?: string): Pr
     return data as VerifyCodeResponse;
   });
 
+const fileBlobUrls = new Map<string, Promise<string>>();
+
+/** Файлы /api/files/{name} отдаются только с сессией: грузим с подписанными заголовками и отдаём blob: URL.
+ * Подписанные ссылки (/api/files/signed/…) и внешние URL возвращаются как есть. */
+export function getFileBlobUrl(url: string): Promise<string> {
+  if (!url.startsWith(`${API}/files/`) || url.startsWith(`${API}/files/signed/`)) return Promise.resolve(url);
+  const cached = fileBlobUrls.get(url);
+  if (cached) return cached;
+  const p = (async () => {
+    const pathname = url.includes('?') ? url.slice(0, url.indexOf('?')) : url;
+    const headers = (await getSessionAuthHeaders('GET', pathname, '')) ?? {};
+    const res = await fetch(`${getApiBase()}${url}`, { headers });
+    if (!res.ok) throw new ApiError(`HTTP ${res.status}`, res.status);
+    return URL.createObjectURL(await res.blob());
+  })();
+  fileBlobUrls.set(url, p);
+  p.catch(() => fileBlobUrls.delete(url));
+  return p;
+}
+
 /** Query string для WebSocket /ws с подписью сессии (session_id, timestamp, signature). */
 export async function getSessionWsQuery(): Promise<string | null> {
   const sessionId = getSessionId();
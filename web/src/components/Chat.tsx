@@ -1,6 +1,6 @@
 import { useState, useEffect, useLayoutEffect, useRef, useCallback, useMemo } from 'react';
 import { useAuthStore, useChatStore } from '../store';
-import { Avatar, Modal, IconSend, IconPaperclip, IconMicrophone, IconCheck, IconCheckDouble, IconFile, IconDownload, IconReply, IconEdit, IconTrash, IconPin, IconForward, IconX, IconBack, IconInfo, IconSearch, IconDotsVertical, IconStarOutline, IconStarFilled, IconSmile, IconChevronUp, IconChevronDown, TypingDots, formatTime, formatFileSize, IconPhone, IconPlay, IconPause, IconVolume } from './ui';
+import { Avatar, Modal, IconSend, IconPaperclip, IconMicrophone, IconCheck, IconCheckDouble, IconFile, IconDownload, IconReply, IconEdit, IconTrash, IconPin, IconForward, IconX, IconBack, IconInfo, IconSearch, IconDotsVertical, IconStarOutline, IconStarFilled, IconSmile, IconChevronUp, IconChevronDown, TypingDots, useFileSrc, formatTime, formatFileSize, IconPhone, IconPlay, IconPause, IconVolume } from './ui';
 import UserCard from './UserCard';
 import type { Message, ChatWithLastMessage } from '../types';
 
@@ -795,6 +795,7 @@ export default function Chat({ onBack, onOpenInfo, onOpenSearch, onOpenProfile }
 }
 
 function VoiceMessage({ url, isOwn }: { url: string; isOwn: boolean }) {
+  const src = useFileSrc(url);
   const audioRef = useRef<HTMLAudioElement | null>(null);
   const [duration, setDuration] = useState(0);
   const [current, setCurrent] = useState(0);
@@ -883,7 +884,7 @@ function VoiceMessage({ url, isOwn }: { url: string; isOwn: boolean }) {
       >
         <IconVolume size={14} />
       </button>
-      <audio ref={audioRef} src={url} preload="metadata" />
+      <audio ref={audioRef} src={src} preload="metadata" />
     </div>
   );
 }
@@ -917,6 +918,7 @@ function MsgBubble({ msg, isOwn, showAvatar, isGroup, onCtx, onReply, onReact, m
   onUserClick?: (userId: string) => void;
 }) {
   const [showEmoji, setShowEmoji] = useState(false);
+  const fileSrc = useFileSrc(msg.file_url || undefined);
 
   const groups = useMemo(() => {
     if (msg.is_deleted) return [];
@@ -967,9 +969,9 @@ function MsgBubble({ msg, isOwn, showAvatar, isGroup, onCtx, onReply, onReact, m
             </div>
           )}
 
-          {msg.content_type === 'image' && msg.file_url && (
-            <a href={msg.file_url} target="_blank" rel="noopener noreferrer" className="block mb-1.5">
-              <img src={msg.file_url} alt={normalizeFileDisplayName(msg.file_name) || 'image'} className="rounded-compass max-w-full max-h-60 object-cover" loading="lazy" />
+          {msg.content_type === 'image' && fileSrc && (
+            <a href={fileSrc} target="_blank" rel="noopener noreferrer" className="block mb-1.5">
+              <img src={fileSrc} alt={normalizeFileDisplayName(msg.file_name) || 'image'} className="rounded-compass max-w-full max-h-60 object-cover" loading="lazy" />
             </a>
           )}
           {msg.content_type === 'voice' && (
@@ -995,7 +997,7 @@ function MsgBubble({ msg, isOwn, showAvatar, isGroup, onCtx, onReply, onReact, m
                   {msg.file_size ? <p className={`text-[11px] mt-0.5 ${isOwn ? 'text-white/60' : 'text-txt-secondary dark:text-[#8b98a5]'}`}>{formatFileSize(msg.file_size)}</p> : null}
                 </div>
               </div>
-              <a href={`${msg.file_url}?name=${encodeURIComponent(normalizeFileDisplayName(msg.file_name) || 'file')}`} download={normalizeFileDisplayName(msg.file_name) || 'file'}
+              <a href={fileSrc} download={normalizeFileDisplayName(msg.file_name) || 'file'}
                 className={`flex items-center justify-center gap-2 py-2.5 border-t transition-colors cursor-pointer ${
                   isOwn
                     ? 'border-white/15 text-white/90 hover:bg-white/10'
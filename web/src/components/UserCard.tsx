@@ -11,7 +11,7 @@ interface Props {
 }
 
 /* ── Helpers ── */
-function formatLastSeen(iso: string): string {
+function formatLastSeen(iso?: string): string {
   if (!iso) return 'Неизвестно';
   const d = new Date(iso);
   const now = new Date();
@@ -1,4 +1,17 @@
-import React from 'react';
+import React, { useEffect, useState } from 'react';
+import { getFileBlobUrl } from '../api';
+
+/** src для <img>/<audio>/<a>: файлы /api/files/ требуют сессию, поэтому подставляется blob: URL. */
+export function useFileSrc(url?: string): string | undefined {
+  const [src, setSrc] = useState<string | undefined>(undefined);
+  useEffect(() => {
+    if (!url) { setSrc(undefined); return; }
+    let cancelled = false;
+    getFileBlobUrl(url).then((u) => { if (!cancelled) setSrc(u); }, () => { if (!cancelled) setSrc(undefined); });
+    return () => { cancelled = true; };
+  }, [url]);
+  return src;
+}
 
 /* ─── Avatar ─── */
 const palette = ['#007AFF','#FF6A64','#05C46B','#FF8A00','#D05DBD','#2574A9','#009FE6','#8B5CF6','#F59E0B','#6366F1'];
@@ -22,11 +35,12 @@ export const Avatar = React.memo(function Avatar({ name, url, size = 40, online,
   const bg = hashColor(name);
   const fontSize = size * 0.36;
   const dotSize = Math.max(size * 0.24, 8);
+  const src = useFileSrc(url);
 
   return (
     <div className={`relative shrink-0 ${className}`} style={{ width: size, height: size }}>
-      {url ? (
-        <img src={url} alt={name} className="w-full h-full rounded-full object-cover" />
+      {src ? (
+        <img src={src} alt={name} className="w-full h-full rounded-full object-cover" />
       ) : (
         <div
           className="w-full h-full rounded-full flex items-center justify-center text-white font-bold select-none"
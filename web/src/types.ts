@@ -5,7 +5,7 @@ export interface UserPublic {
   phone: string;
   avatar_url: string;
   is_online: boolean;
-  last_seen_at: string;
+  last_seen_at?: string;
   disabled_at?: string | null;
 }
 